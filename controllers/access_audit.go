@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// ListAccessAudits lists the latest reads of wallet data, optionally of a single user
+func ListAccessAudits(c *gin.Context) {
+	var actorID uuid.UUID
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+			return
+		}
+		actorID = id
+	}
+
+	audits, err := models.GetAccessAudits(actorID, 200)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get access audits", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "access audits retrieved successfully", audits)
+}
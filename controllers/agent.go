@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// AgentCashIn credits a customer from the float of the calling agent against cash
+func AgentCashIn(c *gin.Context) {
+	var body models.AgentOperationRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	operation, transfer, err := body.CashIn()
+	if err != nil {
+		handleAgentError(c, "failed to cash in", err)
+		return
+	}
+
+	helpers.PublishTransferEvents(transfer)
+	helpers.PublishAgentOperation(operation)
+	status.HandleSuccessData(c, "cash-in completed successfully", operation)
+}
+
+// AgentCashOut asks a customer to confirm a cash-out at the calling agent, the customer receives an OTP
+func AgentCashOut(c *gin.Context) {
+	var body models.AgentOperationRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	operation, err := body.CashOut(helpers.AgentOTPTTL())
+	if err != nil {
+		handleAgentError(c, "failed to start cash-out", err)
+		return
+	}
+
+	helpers.PublishAgentCashOutOTP(operation)
+	helpers.PublishAgentOperation(operation)
+	status.HandleSuccessData(c, "cash-out waiting for customer confirmation", operation)
+}
+
+// ConfirmAgentCashOut pays a pending cash-out to the agent, confirmed by the agent with the customer OTP
+// or by the customer from its own session
+func ConfirmAgentCashOut(c *gin.Context) {
+	var body models.AgentConfirmRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	operation, transfer, err := body.ConfirmCashOut()
+	if err != nil {
+		handleAgentError(c, "failed to confirm cash-out", err)
+		return
+	}
+
+	helpers.PublishTransferEvents(transfer)
+	helpers.PublishAgentOperation(operation)
+	status.HandleSuccessData(c, "cash-out completed successfully", operation)
+}
+
+// RebalanceAgentFloat moves float from the calling agent to another agent
+func RebalanceAgentFloat(c *gin.Context) {
+	var body models.FloatRebalanceRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	transfer, err := body.RebalanceFloat()
+	if err != nil {
+		handleAgentError(c, "failed to move float", err)
+		return
+	}
+
+	helpers.PublishTransferEvents(transfer)
+	status.HandleSuccessData(c, "float moved successfully", transfer)
+}
+
+// ListAgentOperations lists the latest operations of an agent, or of a customer at the agents
+func ListAgentOperations(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	operations, err := models.GetAgentOperations(userID, 100)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get agent operations", err)
+		return
+	}
+	status.HandleSuccessData(c, "agent operations retrieved successfully", operations)
+}
+
+// ListAgentSummaries lists the daily activity summaries of an agent
+func ListAgentSummaries(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) && !helpers.IsAdmin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	summaries, err := models.GetAgentDailySummaries(userID, 90)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get agent summaries", err)
+		return
+	}
+	status.HandleSuccessData(c, "agent summaries retrieved successfully", summaries)
+}
+
+// RegisterAgent makes a user an agent, admins only
+func RegisterAgent(c *gin.Context) {
+	var body models.AgentRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	agent, err := body.RegisterAgent()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "wallet not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to register agent", err)
+		return
+	}
+	status.HandleSuccessData(c, "agent registered successfully", agent)
+}
+
+// SetAgentStatus suspends or reactivates an agent, admins only
+func SetAgentStatus(c *gin.Context) {
+	var body models.AgentStatusRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	agent, err := body.SetAgentStatus()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "agent not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to update agent", err)
+		return
+	}
+	status.HandleSuccessData(c, "agent updated successfully", agent)
+}
+
+// MoveAgentFloat tops up or withdraws the float of an agent against the treasury wallet, admins only
+func MoveAgentFloat(c *gin.Context) {
+	var body models.FloatRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	treasuryWalletID, err := helpers.AgentFloatWalletID()
+	if err != nil {
+		status.HandleError(c, http.StatusServiceUnavailable, "agent float wallet not configured", err)
+		return
+	}
+
+	transfer, err := body.MoveFloat(treasuryWalletID)
+	if err != nil {
+		handleAgentError(c, "failed to move float", err)
+		return
+	}
+
+	helpers.PublishTransferEvents(transfer)
+	status.HandleSuccessData(c, "float moved successfully", transfer)
+}
+
+// ListAgents lists the agents with their float, optionally by status, admins only
+func ListAgents(c *gin.Context) {
+	agents, err := models.GetAgents(c.Query("status"))
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get agents", err)
+		return
+	}
+	status.HandleSuccessData(c, "agents retrieved successfully", agents)
+}
+
+// handleAgentError maps the agent and transfer errors to a response
+func handleAgentError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, models.ErrAgentNotFound):
+		status.HandleError(c, http.StatusForbidden, err.Error(), err)
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "wallet or operation not found", err)
+	case errors.Is(err, models.ErrSameWallet):
+		status.HandleError(c, http.StatusBadRequest, "cannot serve your own wallet", err)
+	case errors.Is(err, models.ErrCurrencyMismatch):
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+	case errors.Is(err, models.ErrAgentOTP):
+		status.HandleError(c, http.StatusUnauthorized, err.Error(), err)
+	case errors.Is(err, models.ErrAgentExpired):
+		status.HandleError(c, http.StatusGone, err.Error(), err)
+	case errors.Is(err, models.ErrTransferExists):
+		status.HandleError(c, http.StatusConflict, "reference already used", err)
+	case errors.Is(err, models.ErrInsufficientFunds):
+		status.HandleError(c, http.StatusUnprocessableEntity, "insufficient funds", err)
+	case errors.Is(err, models.ErrWalletLocked):
+		status.HandleError(c, http.StatusLocked, "wallet is locked", err)
+	case errors.Is(err, models.ErrGuardianControl):
+		status.HandleError(c, http.StatusForbidden, err.Error(), err)
+	default:
+		status.HandleError(c, http.StatusInternalServerError, message, err)
+	}
+}
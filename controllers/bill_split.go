@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// CreateBillSplit shares an amount among participants, settled to the caller's wallet
+func CreateBillSplit(c *gin.Context) {
+	var body models.BillSplitRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	split, err := body.CreateBillSplit()
+	switch {
+	case errors.Is(err, models.ErrSplitShares):
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "wallet not found", err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to create bill split", err)
+		return
+	}
+
+	helpers.PublishBillSplitCreated(split)
+	status.HandleSuccessData(c, "bill split created successfully", split)
+}
+
+// PayBillSplitShare pays the caller's share of a split
+func PayBillSplitShare(c *gin.Context) {
+	var body models.BillSplitAction
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	split, share, transfer, err := body.PayBillSplitShare()
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "open bill split or unpaid share not found", err)
+		return
+	case errors.Is(err, models.ErrInsufficientFunds):
+		status.HandleError(c, http.StatusUnprocessableEntity, "insufficient funds", err)
+		return
+	case errors.Is(err, models.ErrWalletLocked):
+		status.HandleError(c, http.StatusLocked, "wallet is locked", err)
+		return
+	case errors.Is(err, models.ErrGuardianControl):
+		status.HandleError(c, http.StatusForbidden, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrCurrencyMismatch):
+		status.HandleError(c, http.StatusConflict, "wallets have different currencies", err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to pay share", err)
+		return
+	}
+
+	helpers.PublishBillSplitPayment(split, share, transfer)
+	status.HandleSuccessData(c, "share paid successfully", split)
+}
+
+// RemindBillSplit reminds the participants who have not paid a split of the caller
+func RemindBillSplit(c *gin.Context) {
+	var body models.BillSplitAction
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	split, err := models.GetBillSplit(body.SplitID, body.UserID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && split.CreatorID != body.UserID) {
+		status.HandleError(c, http.StatusNotFound, "bill split not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get bill split", err)
+		return
+	}
+
+	reminded, err := helpers.RemindBillSplit(split.ID, body.UserID)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to remind participants", err)
+		return
+	}
+	status.HandleSuccessData(c, "participants reminded successfully", gin.H{"reminded": reminded})
+}
+
+// CancelBillSplit stops collecting the unpaid shares of a split of the caller
+func CancelBillSplit(c *gin.Context) {
+	var body models.BillSplitAction
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	split, err := body.CancelBillSplit()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "open bill split not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to cancel bill split", err)
+		return
+	}
+
+	helpers.PublishBillSplitCanceled(split)
+	status.HandleSuccessData(c, "bill split canceled successfully", split)
+}
+
+// ListBillSplits lists the splits a user created or takes part in
+func ListBillSplits(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	splits, err := models.GetBillSplits(userID, 100)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get bill splits", err)
+		return
+	}
+	status.HandleSuccessData(c, "bill splits retrieved successfully", splits)
+}
+
+// GetBillSplit returns a split and who has paid, for its creator or a participant
+func GetBillSplit(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+	splitID, err := uuid.Parse(c.Param("splitID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid bill split id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	split, err := models.GetBillSplit(splitID, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "bill split not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get bill split", err)
+		return
+	}
+	status.HandleSuccessData(c, "bill split retrieved successfully", split)
+}
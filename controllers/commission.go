@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// GetCommissionBalance returns the commissions a partner earned and was not paid yet
+func GetCommissionBalance(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) && !helpers.IsAdmin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	balance, entries, err := models.GetAccruedCommissions(userID)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get commissions", err)
+		return
+	}
+	status.HandleSuccessData(c, "commissions retrieved successfully", gin.H{"balance": balance, "entries": entries})
+}
+
+// ListCommissionStatements lists the commission payouts of a partner
+func ListCommissionStatements(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) && !helpers.IsAdmin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	payouts, err := models.GetCommissionPayouts(userID, 100)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get statements", err)
+		return
+	}
+	status.HandleSuccessData(c, "statements retrieved successfully", payouts)
+}
+
+// GetCommissionStatement returns a commission payout of a partner with the operations it paid
+func GetCommissionStatement(c *gin.Context) {
+	payout := getCommissionStatement(c)
+	if payout == nil {
+		return
+	}
+	status.HandleSuccessData(c, "statement retrieved successfully", payout)
+}
+
+// DownloadCommissionStatement downloads a commission payout of a partner as CSV
+func DownloadCommissionStatement(c *gin.Context) {
+	payout := getCommissionStatement(c)
+	if payout == nil {
+		return
+	}
+
+	content, err := models.RenderCommissionStatement(payout)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to render statement", err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "commission-"+payout.ID.String()+".csv"))
+	c.Data(http.StatusOK, "text/csv", content)
+}
+
+// getCommissionStatement loads the statement of the route for the caller, or answers the error and returns nil
+func getCommissionStatement(c *gin.Context) *models.CommissionPayout {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return nil
+	}
+	payoutID, err := uuid.Parse(c.Param("payoutID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid statement id", err)
+		return nil
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) && !helpers.IsAdmin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return nil
+	}
+
+	payout, err := models.GetCommissionPayout(payoutID, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "statement not found", err)
+		return nil
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get statement", err)
+		return nil
+	}
+	return payout
+}
+
+// CreateCommissionRule replaces the tiered commission of a source, for a partner or by default, admins only
+func CreateCommissionRule(c *gin.Context) {
+	var body models.CommissionRuleRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	rule, err := body.CreateCommissionRule(jwt.GetUserIDFromGin(c))
+	if errors.Is(err, models.ErrCommissionTiers) || errors.Is(err, models.ErrCommissionSource) {
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to create commission rule", err)
+		return
+	}
+	status.HandleSuccessData(c, "commission rule created successfully", rule)
+}
+
+// DisableCommissionRule stops a commission rule, admins only
+func DisableCommissionRule(c *gin.Context) {
+	ruleID, err := uuid.Parse(c.Param("ruleID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid rule id", err)
+		return
+	}
+
+	rule, err := models.DisableCommissionRule(ruleID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "active rule not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to disable commission rule", err)
+		return
+	}
+	status.HandleSuccessData(c, "commission rule disabled successfully", rule)
+}
+
+// ListCommissionRules lists the commission rules, the active ones unless all=true, admins only
+func ListCommissionRules(c *gin.Context) {
+	rules, err := models.GetCommissionRules(c.Query("all") != "true")
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get commission rules", err)
+		return
+	}
+	status.HandleSuccessData(c, "commission rules retrieved successfully", rules)
+}
+
+// RegisterCommissionPartner makes a user a commission partner, admins only
+func RegisterCommissionPartner(c *gin.Context) {
+	var body models.CommissionPartnerRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	partner, err := body.RegisterCommissionPartner()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "wallet not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to register partner", err)
+		return
+	}
+	status.HandleSuccessData(c, "partner registered successfully", partner)
+}
+
+// ListCommissionPayouts lists the latest commission payouts of every partner, or of user_id, admins only
+func ListCommissionPayouts(c *gin.Context) {
+	var partnerID uuid.UUID
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+			return
+		}
+		partnerID = id
+	}
+
+	payouts, err := models.GetCommissionPayouts(partnerID, 200)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get commission payouts", err)
+		return
+	}
+	status.HandleSuccessData(c, "commission payouts retrieved successfully", payouts)
+}
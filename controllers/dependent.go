@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// CreateDependent invites a child to open a wallet under the controls of the caller
+func CreateDependent(c *gin.Context) {
+	var body models.DependentRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	invitation, err := body.InviteDependent(helpers.DependentInvitationTTL())
+	switch {
+	case errors.Is(err, models.ErrSameWallet):
+		status.HandleError(c, http.StatusBadRequest, "cannot be your own guardian", err)
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "guardian wallet not found", err)
+		return
+	case errors.Is(err, models.ErrDependentWallet), errors.Is(err, models.ErrDependentInvitation):
+		status.HandleError(c, http.StatusConflict, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to invite dependent", err)
+		return
+	}
+
+	helpers.PublishDependentInvitation(invitation)
+	status.HandleSuccessData(c, "dependent invited successfully", invitation)
+}
+
+// AcceptDependentInvitation opens the wallet of the calling child under the guardian who invited it
+func AcceptDependentInvitation(c *gin.Context) {
+	var body models.DependentInvitationAction
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	acceptDependentInvitation(c, body.InvitationID, body.UserID)
+}
+
+// ApproveDependentInvitation opens the wallet of a child after the relationship was verified, admins only
+func ApproveDependentInvitation(c *gin.Context) {
+	var body models.DependentInvitationAction
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	acceptDependentInvitation(c, body.InvitationID, uuid.Nil)
+}
+
+// acceptDependentInvitation accepts an invitation for childID, or any child when uuid.Nil
+func acceptDependentInvitation(c *gin.Context, invitationID, childID uuid.UUID) {
+	dependent, invitation, err := models.AcceptDependentInvitation(invitationID, childID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "pending invitation not found", err)
+		return
+	case errors.Is(err, models.ErrDependentWallet):
+		status.HandleError(c, http.StatusConflict, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to create dependent wallet", err)
+		return
+	}
+
+	helpers.PublishDependentInvitation(invitation)
+	status.HandleSuccessData(c, "dependent wallet created successfully", dependent)
+}
+
+// DeclineDependentInvitation declines an invitation of the calling child, or cancels one of the calling guardian
+func DeclineDependentInvitation(c *gin.Context) {
+	var body models.DependentInvitationAction
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	invitation, err := models.DeclineDependentInvitation(body.InvitationID, body.UserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "pending invitation not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to decline invitation", err)
+		return
+	}
+
+	helpers.PublishDependentInvitation(invitation)
+	status.HandleSuccessData(c, "invitation closed successfully", invitation)
+}
+
+// ListDependentInvitations lists the invitations sent by a guardian or received by a child
+func ListDependentInvitations(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	invitations, err := models.GetDependentInvitations(userID)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get invitations", err)
+		return
+	}
+	status.HandleSuccessData(c, "invitations retrieved successfully", invitations)
+}
+
+// SetDependentControls sets the spending limits and blocked merchant categories of a child of the caller
+func SetDependentControls(c *gin.Context) {
+	var body models.DependentControlsRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	dependent, err := body.SetDependentControls()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "dependent not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to update controls", err)
+		return
+	}
+	status.HandleSuccessData(c, "controls updated successfully", dependent)
+}
+
+// CreateDependentAllowance schedules pocket money from the caller to a child
+func CreateDependentAllowance(c *gin.Context) {
+	var body models.DependentAllowanceRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	order, err := body.CreateAllowance()
+	switch {
+	case errors.Is(err, models.ErrInvalidSchedule):
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "dependent not found", err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to create allowance", err)
+		return
+	}
+	status.HandleSuccessData(c, "allowance created successfully", order)
+}
+
+// ListDependents lists the children of a guardian
+func ListDependents(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	dependents, err := models.GetDependents(userID)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get dependents", err)
+		return
+	}
+	status.HandleSuccessData(c, "dependents retrieved successfully", dependents)
+}
+
+// GetDependentHistory returns the latest wallet logs of a child of a guardian
+func GetDependentHistory(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+	childID, err := uuid.Parse(c.Param("childID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid child id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	dependent, err := models.GetDependent(childID, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "dependent not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get dependent", err)
+		return
+	}
+	history, err := models.GetDependentHistory(childID, userID, 100)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get history", err)
+		return
+	}
+
+	// record the read in the access audit
+	helpers.AuditAccess(c, models.AccessReadHistory, dependent.WalletID)
+
+	status.HandleSuccessData(c, "history retrieved successfully", history)
+}
@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// OpenDispute opens a dispute against a transfer paid by the caller
+func OpenDispute(c *gin.Context) {
+	var body models.DisputeRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	dispute, err := body.OpenDispute()
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "transfer not found", err)
+		return
+	case errors.Is(err, models.ErrDisputeWindow), errors.Is(err, models.ErrDisputeAmount):
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrDisputeExists):
+		status.HandleError(c, http.StatusConflict, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to open dispute", err)
+		return
+	}
+
+	helpers.PublishDisputeEvent(dispute)
+	status.HandleSuccessData(c, "dispute opened successfully", dispute)
+}
+
+// AddDisputeEvidence adds a note of the caller, the payer or the recipient, to a dispute
+func AddDisputeEvidence(c *gin.Context) {
+	var body models.DisputeEvidenceRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	addDisputeEvidence(c, &body, false)
+}
+
+// AddDisputeEvidenceAdmin adds a note of the calling admin to a dispute
+func AddDisputeEvidenceAdmin(c *gin.Context) {
+	var body models.DisputeEvidenceRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+	body.UserID = jwt.GetUserIDFromGin(c)
+
+	addDisputeEvidence(c, &body, true)
+}
+
+// addDisputeEvidence records a note and answers the request
+func addDisputeEvidence(c *gin.Context, body *models.DisputeEvidenceRequest, admin bool) {
+	evidence, err := body.AddDisputeEvidence(admin)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "unresolved dispute not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to add evidence", err)
+		return
+	}
+	status.HandleSuccessData(c, "evidence added successfully", evidence)
+}
+
+// WithdrawDispute closes an unresolved dispute opened by the caller
+func WithdrawDispute(c *gin.Context) {
+	var body models.DisputeAction
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	dispute, err := body.WithdrawDispute()
+	handleDisputeMove(c, dispute, err, "dispute withdrawn successfully")
+}
+
+// ListDisputes lists the disputes of a user as payer or recipient
+func ListDisputes(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	var statuses []string
+	if raw := c.Query("status"); raw != "" {
+		statuses = []string{raw}
+	}
+
+	disputes, err := models.GetDisputes(userID, statuses, 100)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get disputes", err)
+		return
+	}
+	status.HandleSuccessData(c, "disputes retrieved successfully", disputes)
+}
+
+// GetDispute returns a dispute of a user with its evidence
+func GetDispute(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	getDispute(c, userID)
+}
+
+// GetDisputeAdmin returns any dispute with its evidence
+func GetDisputeAdmin(c *gin.Context) {
+	getDispute(c, uuid.Nil)
+}
+
+// getDispute answers with the dispute of the route, of a party when userID is set
+func getDispute(c *gin.Context, userID uuid.UUID) {
+	disputeID, err := uuid.Parse(c.Param("disputeID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid dispute id", err)
+		return
+	}
+
+	dispute, err := models.GetDispute(disputeID, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "dispute not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get dispute", err)
+		return
+	}
+	status.HandleSuccessData(c, "dispute retrieved successfully", dispute)
+}
+
+// ListDisputesAdmin lists the disputes of a status, the unresolved ones by default
+func ListDisputesAdmin(c *gin.Context) {
+	statuses := []string{models.DisputeOpen, models.DisputeInReview}
+	if raw := c.Query("status"); raw != "" {
+		statuses = []string{raw}
+	}
+
+	disputes, err := models.GetDisputes(uuid.Nil, statuses, 200)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get disputes", err)
+		return
+	}
+	status.HandleSuccessData(c, "disputes retrieved successfully", disputes)
+}
+
+// ProvisionalDispute holds the disputed amount or credits it to the payer while the case is worked
+func ProvisionalDispute(c *gin.Context) {
+	var body models.DisputeProvisionalRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	dispute, err := body.ProvisionalDispute()
+	handleDisputeMove(c, dispute, err, "dispute funds moved successfully")
+}
+
+// ResolveDispute resolves a dispute in favor of the payer or the recipient
+func ResolveDispute(c *gin.Context) {
+	var body models.DisputeResolveRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	dispute, err := body.ResolveDispute(jwt.GetUserIDFromGin(c))
+	handleDisputeMove(c, dispute, err, "dispute resolved successfully")
+}
+
+// handleDisputeMove answers a change of a dispute and its funds, and publishes it
+func handleDisputeMove(c *gin.Context, dispute *models.Dispute, err error, message string) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "unresolved dispute not found", err)
+		return
+	case errors.Is(err, models.ErrDisputeFunds):
+		status.HandleError(c, http.StatusConflict, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrInsufficientFunds):
+		status.HandleError(c, http.StatusUnprocessableEntity, "insufficient funds for the ledger adjustment", err)
+		return
+	case errors.Is(err, models.ErrWalletInactive):
+		status.HandleError(c, http.StatusUnprocessableEntity, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to update dispute", err)
+		return
+	}
+
+	helpers.PublishDisputeEvent(dispute)
+	status.HandleSuccessData(c, message, dispute)
+}
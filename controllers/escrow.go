@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// CreateEscrow holds funds of the caller for a seller until the delivery is confirmed
+func CreateEscrow(c *gin.Context) {
+	var body models.EscrowRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	escrow, err := body.CreateEscrow()
+	switch {
+	case errors.Is(err, models.ErrSameWallet):
+		status.HandleError(c, http.StatusBadRequest, "cannot open an escrow with yourself", err)
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "wallet or seller not found", err)
+		return
+	case errors.Is(err, models.ErrEscrowExists):
+		status.HandleError(c, http.StatusConflict, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrInsufficientFunds):
+		status.HandleError(c, http.StatusUnprocessableEntity, "insufficient funds", err)
+		return
+	case errors.Is(err, models.ErrWalletLocked):
+		status.HandleError(c, http.StatusLocked, "wallet is locked", err)
+		return
+	case errors.Is(err, models.ErrGuardianControl):
+		status.HandleError(c, http.StatusForbidden, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to create escrow", err)
+		return
+	}
+
+	helpers.PublishEscrowEvent(escrow)
+	status.HandleSuccessData(c, "escrow funded successfully", escrow)
+}
+
+// ConfirmEscrow releases an escrow to the seller once the caller, the buyer, confirms the delivery
+func ConfirmEscrow(c *gin.Context) {
+	var body models.EscrowAction
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	escrow, err := body.ConfirmEscrow()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "funded escrow not found", err)
+		return
+	}
+	if errors.Is(err, models.ErrWalletInactive) {
+		status.HandleError(c, http.StatusUnprocessableEntity, err.Error(), err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to release escrow", err)
+		return
+	}
+
+	helpers.PublishEscrowEvent(escrow)
+	status.HandleSuccessData(c, "escrow released successfully", escrow)
+}
+
+// CancelEscrow refunds an escrow to the buyer when the caller, the seller, cancels the order
+func CancelEscrow(c *gin.Context) {
+	var body models.EscrowAction
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	escrow, err := body.CancelEscrow()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "funded escrow not found", err)
+		return
+	}
+	if errors.Is(err, models.ErrWalletInactive) {
+		status.HandleError(c, http.StatusUnprocessableEntity, err.Error(), err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to refund escrow", err)
+		return
+	}
+
+	helpers.PublishEscrowEvent(escrow)
+	status.HandleSuccessData(c, "escrow refunded successfully", escrow)
+}
+
+// DisputeEscrow freezes an escrow of the caller until an admin resolves it
+func DisputeEscrow(c *gin.Context) {
+	var body models.EscrowDisputeRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	escrow, err := body.DisputeEscrow()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "funded escrow not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to dispute escrow", err)
+		return
+	}
+
+	helpers.PublishEscrowEvent(escrow)
+	status.HandleSuccessData(c, "escrow disputed successfully", escrow)
+}
+
+// ListEscrows lists the escrows of a user as buyer or seller
+func ListEscrows(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	escrows, err := models.GetEscrows(userID, c.Query("status"), 100)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get escrows", err)
+		return
+	}
+	status.HandleSuccessData(c, "escrows retrieved successfully", escrows)
+}
+
+// GetEscrow returns an escrow of a user as buyer or seller
+func GetEscrow(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+	escrowID, err := uuid.Parse(c.Param("escrowID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid escrow id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	escrow, err := models.GetEscrow(escrowID, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "escrow not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get escrow", err)
+		return
+	}
+	status.HandleSuccessData(c, "escrow retrieved successfully", escrow)
+}
+
+// ListDisputedEscrows lists the escrows waiting for an admin, or of another status with ?status=
+func ListDisputedEscrows(c *gin.Context) {
+	escrows, err := models.GetEscrows(uuid.Nil, c.DefaultQuery("status", models.EscrowDisputed), 200)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get escrows", err)
+		return
+	}
+	status.HandleSuccessData(c, "escrows retrieved successfully", escrows)
+}
+
+// ResolveEscrow pays a disputed escrow to the seller and the buyer as decided by the calling admin
+func ResolveEscrow(c *gin.Context) {
+	var body models.EscrowResolveRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	escrow, err := body.ResolveEscrow(jwt.GetUserIDFromGin(c))
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "disputed escrow not found", err)
+		return
+	case errors.Is(err, models.ErrEscrowResolution):
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrWalletInactive):
+		status.HandleError(c, http.StatusUnprocessableEntity, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to resolve escrow", err)
+		return
+	}
+
+	helpers.PublishEscrowEvent(escrow)
+	status.HandleSuccessData(c, "escrow resolved successfully", escrow)
+}
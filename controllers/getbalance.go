@@ -1,12 +1,11 @@
 package controllers
 
 import (
-	jwt "github.com/emmadal/feeti-module/auth"
 	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
 	"github.com/emmadal/feeti-wallet/models"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"log"
 	"net/http"
 )
 
@@ -21,7 +20,7 @@ func GetBalanceByUser(c *gin.Context) {
 
 	// parse userID and verify user identity with context data
 	userID := uuid.MustParse(ctxUserID)
-	if userID != jwt.GetUserIDFromGin(c) {
+	if !helpers.ActsFor(c, userID, models.PermissionView) {
 		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
 		return
 	}
@@ -34,28 +33,24 @@ func GetBalanceByUser(c *gin.Context) {
 		status.HandleError(c, http.StatusInternalServerError, "failed to get wallet", err)
 		return
 	}
+	pockets, err := models.GetPockets(wl.ID)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get pockets", err)
+		return
+	}
 	response := models.WalletResponse{
-		ID:       wl.ID,
-		Currency: wl.Currency,
-		Balance:  wl.Balance,
+		ID:           wl.ID,
+		Currency:     wl.Currency,
+		Balance:      wl.Balance,
+		TotalBalance: wl.Balance,
+		Pockets:      pockets,
+	}
+	for _, pocket := range pockets {
+		response.TotalBalance += pocket.Balance
 	}
 
-	// record wallet log
-	go func() {
-		walletLog := models.WalletLog{
-			UserID:         userID,
-			WalletID:       wl.ID,
-			Activity:       "GET_BALANCE",
-			OldBalance:     wl.Balance,
-			NewBalance:     wl.Balance,
-			ActivityAmount: 0,
-			Currency:       wl.Currency,
-			Metadata:       `{"source": "get_balance"}`,
-		}
-		if err := walletLog.CreateWalletLog(); err != nil {
-			log.Printf("Error creating wallet log: %v\n", err)
-		}
-	}()
+	// record the read in the access audit
+	helpers.AuditAccess(c, models.AccessReadBalance, wl.ID)
 
 	status.HandleSuccessData(c, "balance retrieved successfully", response)
 }
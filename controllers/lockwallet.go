@@ -3,9 +3,9 @@ package controllers
 import (
 	jwt "github.com/emmadal/feeti-module/auth"
 	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
 	"github.com/emmadal/feeti-wallet/models"
 	"github.com/gin-gonic/gin"
-	"log"
 	"net/http"
 )
 
@@ -19,8 +19,8 @@ func LockWalletByUser(c *gin.Context) {
 		return
 	}
 
-	// verify user identity with context data
-	if body.UserID != jwt.GetUserIDFromGin(c) {
+	// verify user identity with context data, organization admins and guardians lock its wallet
+	if !helpers.ActsFor(c, body.UserID, models.PermissionManage) {
 		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
 		return
 	}
@@ -41,27 +41,12 @@ func LockWalletByUser(c *gin.Context) {
 	}
 
 	// Lock wallet
-	if err := w.LockWallet(); err != nil {
+	if err := w.LockWallet(jwt.GetUserIDFromGin(c)); err != nil {
 		status.HandleError(c, http.StatusInternalServerError, "failed to lock wallet", err)
 		return
 	}
 
-	// Create a withdrawal log
-	go func() {
-		walletLog := models.WalletLog{
-			UserID:         body.UserID,
-			WalletID:       wallet.ID,
-			Activity:       "LOCK_WALLET",
-			OldBalance:     wallet.Balance,
-			NewBalance:     wallet.Balance,
-			ActivityAmount: 0,
-			Currency:       wallet.Currency,
-			Metadata:       `{"source": "lock_wallet"}`,
-		}
-		if err := walletLog.CreateWalletLog(); err != nil {
-			log.Printf("Error creating wallet log: %v\n", err)
-		}
-	}() // Pass the context to the goroutine
+	helpers.PublishBalanceEvent(models.EventWalletLocked, wallet, body.UserID, 0)
 
 	status.HandleSuccess(c, "wallet locked successfully")
 }
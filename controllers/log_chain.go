@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"errors"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// VerifyWalletLogChain walks the log chain of a wallet and reports the first broken link
+func VerifyWalletLogChain(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("walletID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid wallet id", err)
+		return
+	}
+
+	verification, err := models.VerifyWalletLogChain(walletID)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to verify wallet log chain", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "wallet log chain verified", verification)
+}
+
+// GetLatestChainAnchor gets the last signed chain heads, to be anchored externally
+func GetLatestChainAnchor(c *gin.Context) {
+	anchor, err := models.GetLatestChainAnchor()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "no chain anchor yet", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get chain anchor", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "chain anchor retrieved successfully", anchor)
+}
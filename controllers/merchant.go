@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// RegisterMerchant creates or updates the merchant profile of a wallet
+func RegisterMerchant(c *gin.Context) {
+	var body models.MerchantRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	merchant, err := body.CreateMerchant()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "wallet not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to register merchant", err)
+		return
+	}
+	status.HandleSuccessData(c, "merchant registered successfully", merchant)
+}
+
+// GenerateMerchantQR generates a static QR code, or a dynamic one when an amount is set
+func GenerateMerchantQR(c *gin.Context) {
+	var body models.MerchantQRRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	qr, err := body.CreateMerchantQR()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "merchant not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to create QR code", err)
+		return
+	}
+	if err := helpers.EncodeMerchantQR(qr); err != nil {
+		status.HandleError(c, http.StatusUnprocessableEntity, err.Error(), err)
+		return
+	}
+	status.HandleSuccessData(c, "QR code generated successfully", qr)
+}
+
+// PayMerchantQR pays a scanned merchant QR code from the caller's wallet
+func PayMerchantQR(c *gin.Context) {
+	var body models.MerchantPayRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	qr, err := helpers.ParseMerchantQR(body.Payload)
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if !qr.Dynamic && body.Amount == 0 {
+		status.HandleError(c, http.StatusBadRequest, "amount is required for a static QR code", nil)
+		return
+	}
+
+	payment, transfer, err := body.PayMerchant(qr)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "merchant or wallet not found", err)
+		return
+	case errors.Is(err, models.ErrInvalidMerchantQR):
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrMerchantQRUsed), errors.Is(err, models.ErrTransferExists):
+		status.HandleError(c, http.StatusConflict, "payment already made", err)
+		return
+	case errors.Is(err, models.ErrMerchantQRExpired):
+		status.HandleError(c, http.StatusGone, "QR code expired", err)
+		return
+	case errors.Is(err, models.ErrSameWallet):
+		status.HandleError(c, http.StatusBadRequest, "cannot pay your own merchant wallet", err)
+		return
+	case errors.Is(err, models.ErrInsufficientFunds):
+		status.HandleError(c, http.StatusUnprocessableEntity, "insufficient funds", err)
+		return
+	case errors.Is(err, models.ErrWalletLocked):
+		status.HandleError(c, http.StatusLocked, "wallet is locked", err)
+		return
+	case errors.Is(err, models.ErrGuardianControl):
+		status.HandleError(c, http.StatusForbidden, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrCurrencyMismatch):
+		status.HandleError(c, http.StatusConflict, "wallets have different currencies", err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to pay merchant", err)
+		return
+	}
+
+	helpers.PublishTransferEvents(transfer)
+	helpers.PublishMerchantPayment(payment)
+	status.HandleSuccessData(c, "merchant paid successfully", payment)
+}
+
+// ListMerchantPayments lists the latest payments received by a merchant of the caller, optionally through a link
+func ListMerchantPayments(c *gin.Context) {
+	merchantID, err := uuid.Parse(c.Param("merchantID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid merchant id", err)
+		return
+	}
+
+	// only the owner of the merchant can read its payments
+	if _, err := models.GetMerchant(merchantID, jwt.GetUserIDFromGin(c)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			status.HandleError(c, http.StatusNotFound, "merchant not found", err)
+			return
+		}
+		status.HandleError(c, http.StatusInternalServerError, "failed to get merchant", err)
+		return
+	}
+
+	var linkID uuid.UUID
+	if raw := c.Query("link_id"); raw != "" {
+		if linkID, err = uuid.Parse(raw); err != nil {
+			status.HandleError(c, http.StatusBadRequest, "invalid link id", err)
+			return
+		}
+	}
+
+	payments, err := models.GetMerchantPayments(merchantID, linkID, 200)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get merchant payments", err)
+		return
+	}
+	status.HandleSuccessData(c, "merchant payments retrieved successfully", payments)
+}
@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"strings"
+)
+
+// CreateOrganization creates a business wallet with the caller as its admin
+func CreateOrganization(c *gin.Context) {
+	var body models.OrganizationRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	organization, err := body.CreateOrganization()
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to create organization", err)
+		return
+	}
+	status.HandleSuccessData(c, "organization created successfully", organization)
+}
+
+// SetOrganizationMember adds, changes or removes a member of an organization administered by the caller
+func SetOrganizationMember(c *gin.Context) {
+	var body models.OrganizationMemberRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	organization, err := body.SetOrganizationMember()
+	handleOrganizationChange(c, organization, err, "organization members updated successfully")
+}
+
+// SetOrganizationPolicy changes the approval policy of an organization administered by the caller
+func SetOrganizationPolicy(c *gin.Context) {
+	var body models.OrganizationPolicyRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	organization, err := body.SetOrganizationPolicy()
+	handleOrganizationChange(c, organization, err, "organization policy updated successfully")
+}
+
+// handleOrganizationChange answers a change of the members or the policy of an organization
+func handleOrganizationChange(c *gin.Context, organization *models.Organization, err error, message string) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "organization not found", err)
+		return
+	case errors.Is(err, models.ErrOrganizationRole):
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", err)
+		return
+	case errors.Is(err, models.ErrLastAdmin), errors.Is(err, models.ErrApprovalPolicy):
+		status.HandleError(c, http.StatusConflict, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to update organization", err)
+		return
+	}
+	status.HandleSuccessData(c, message, organization)
+}
+
+// submitOrganizationWithdrawal holds the funds of a withdrawal of a member from the organization wallet,
+// the execution job sends it once approved, at once below the approval threshold
+func submitOrganizationWithdrawal(c *gin.Context, body *models.WithdrawRequest) {
+	operation, transaction, err := models.SubmitOrganizationWithdrawal(
+		body.UserID,
+		body.WalletID,
+		jwt.GetUserIDFromGin(c),
+		body.Amount,
+		body.Provider,
+		body.PhoneNumber,
+	)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "organization not found", err)
+		return
+	case errors.Is(err, models.ErrOrganizationRole):
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", err)
+		return
+	case errors.Is(err, models.ErrOrganizationWallet):
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrInsufficientFunds):
+		status.HandleError(c, http.StatusUnprocessableEntity, "insufficient funds", err)
+		return
+	case errors.Is(err, models.ErrGuardianControl):
+		status.HandleError(c, http.StatusForbidden, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to submit withdrawal", err)
+		return
+	}
+
+	helpers.PublishTransactionEvent(transaction)
+	helpers.PublishOrganizationOperation(operation)
+	status.HandleSuccessData(c, "withdrawal "+strings.ToLower(operation.Status), operation)
+}
+
+// ApproveOrganizationOperation approves a pending operation, the execution job sends it once it has its approvals
+func ApproveOrganizationOperation(c *gin.Context) {
+	decideOrganizationOperation(c, (*models.OperationDecisionRequest).ApproveOperation, "operation approved successfully")
+}
+
+// RejectOrganizationOperation rejects a pending operation and releases its funds
+func RejectOrganizationOperation(c *gin.Context) {
+	decideOrganizationOperation(c, (*models.OperationDecisionRequest).RejectOperation, "operation rejected successfully")
+}
+
+// CancelOrganizationOperation cancels a pending operation submitted by the caller and releases its funds
+func CancelOrganizationOperation(c *gin.Context) {
+	decideOrganizationOperation(c, (*models.OperationDecisionRequest).CancelOperation, "operation canceled successfully")
+}
+
+// decideOrganizationOperation applies a decision of the caller to an operation and answers
+func decideOrganizationOperation(c *gin.Context, decide func(*models.OperationDecisionRequest) (*models.OrganizationOperation, error), message string) {
+	var body models.OperationDecisionRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	operation, err := decide(&body)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "pending operation not found", err)
+		return
+	case errors.Is(err, models.ErrOrganizationRole):
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", err)
+		return
+	case errors.Is(err, models.ErrSelfApproval), errors.Is(err, models.ErrAlreadyDecided):
+		status.HandleError(c, http.StatusConflict, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to update operation", err)
+		return
+	}
+
+	helpers.PublishOrganizationOperation(operation)
+	status.HandleSuccessData(c, message, operation)
+}
+
+// ListOrganizations lists the organizations of a user with its role
+func ListOrganizations(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	organizations, err := models.GetOrganizations(userID)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get organizations", err)
+		return
+	}
+	status.HandleSuccessData(c, "organizations retrieved successfully", organizations)
+}
+
+// GetOrganization returns an organization of a user with its members
+func GetOrganization(c *gin.Context) {
+	userID, organizationID, ok := organizationParams(c)
+	if !ok {
+		return
+	}
+
+	organization, err := models.GetOrganization(organizationID, userID)
+	if errors.Is(err, pgx.ErrNoRows) || errors.Is(err, models.ErrOrganizationRole) {
+		status.HandleError(c, http.StatusNotFound, "organization not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get organization", err)
+		return
+	}
+	status.HandleSuccessData(c, "organization retrieved successfully", organization)
+}
+
+// ListOrganizationOperations lists the operations of an organization of a user, of a status with ?status=
+func ListOrganizationOperations(c *gin.Context) {
+	userID, organizationID, ok := organizationParams(c)
+	if !ok {
+		return
+	}
+
+	if _, err := models.GetOrganizationRole(organizationID, userID); err != nil {
+		status.HandleError(c, http.StatusNotFound, "organization not found", err)
+		return
+	}
+
+	operations, err := models.GetOrganizationOperations(organizationID, c.Query("status"), 100)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get operations", err)
+		return
+	}
+	status.HandleSuccessData(c, "operations retrieved successfully", operations)
+}
+
+// organizationParams parses the user and organization of the route for the caller, or answers the error
+func organizationParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	organizationID, err := uuid.Parse(c.Param("organizationID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid organization id", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, organizationID, true
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// CreatePaymentLink creates a shareable link paying a merchant of the caller
+func CreatePaymentLink(c *gin.Context) {
+	var body models.PaymentLinkRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	link, err := body.CreatePaymentLink()
+	switch {
+	case errors.Is(err, models.ErrPaymentLinkAmount):
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "merchant not found or currency differs", err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to create payment link", err)
+		return
+	}
+	status.HandleSuccessData(c, "payment link created successfully", link)
+}
+
+// DisablePaymentLink stops a link of the caller from being paid
+func DisablePaymentLink(c *gin.Context) {
+	var body models.PaymentLinkDisableRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	link, err := body.DisablePaymentLink()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "payment link not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to disable payment link", err)
+		return
+	}
+	status.HandleSuccessData(c, "payment link disabled successfully", link)
+}
+
+// ResolvePaymentLink describes a link to anyone holding its code
+func ResolvePaymentLink(c *gin.Context) {
+	view, err := models.ResolvePaymentLink(c.Param("code"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "payment link not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get payment link", err)
+		return
+	}
+	status.HandleSuccessData(c, "payment link retrieved successfully", view)
+}
+
+// PayPaymentLink pays a link from the caller's wallet
+func PayPaymentLink(c *gin.Context) {
+	var body models.PaymentLinkPayRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	payment, transfer, err := body.PayPaymentLink()
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "payment link or wallet not found", err)
+		return
+	case errors.Is(err, models.ErrPaymentLinkUnavailable):
+		status.HandleError(c, http.StatusGone, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrPaymentLinkAmount):
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrTransferExists):
+		status.HandleError(c, http.StatusConflict, "payment already made", err)
+		return
+	case errors.Is(err, models.ErrSameWallet):
+		status.HandleError(c, http.StatusBadRequest, "cannot pay your own merchant wallet", err)
+		return
+	case errors.Is(err, models.ErrInsufficientFunds):
+		status.HandleError(c, http.StatusUnprocessableEntity, "insufficient funds", err)
+		return
+	case errors.Is(err, models.ErrWalletLocked):
+		status.HandleError(c, http.StatusLocked, "wallet is locked", err)
+		return
+	case errors.Is(err, models.ErrGuardianControl):
+		status.HandleError(c, http.StatusForbidden, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrCurrencyMismatch):
+		status.HandleError(c, http.StatusConflict, "wallets have different currencies", err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to pay payment link", err)
+		return
+	}
+
+	helpers.PublishTransferEvents(transfer)
+	helpers.PublishMerchantPayment(payment)
+	status.HandleSuccessData(c, "payment link paid successfully", payment)
+}
+
+// ListPaymentLinks lists the links of a merchant of the caller with their usage
+func ListPaymentLinks(c *gin.Context) {
+	merchantID, err := uuid.Parse(c.Param("merchantID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid merchant id", err)
+		return
+	}
+
+	// only the owner of the merchant can read its links
+	if _, err := models.GetMerchant(merchantID, jwt.GetUserIDFromGin(c)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			status.HandleError(c, http.StatusNotFound, "merchant not found", err)
+			return
+		}
+		status.HandleError(c, http.StatusInternalServerError, "failed to get merchant", err)
+		return
+	}
+
+	links, err := models.GetPaymentLinks(merchantID, 200)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get payment links", err)
+		return
+	}
+	status.HandleSuccessData(c, "payment links retrieved successfully", links)
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// CreatePaymentRequest asks another user to pay the caller
+func CreatePaymentRequest(c *gin.Context) {
+	var body models.PaymentRequestCreate
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	request, err := body.CreatePaymentRequest()
+	switch {
+	case errors.Is(err, models.ErrSameWallet):
+		status.HandleError(c, http.StatusBadRequest, "cannot request money from yourself", err)
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "wallet or payer not found", err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to create payment request", err)
+		return
+	}
+
+	helpers.PublishPaymentRequestEvent(request)
+	status.HandleSuccessData(c, "payment request created successfully", request)
+}
+
+// RespondPaymentRequest accepts or declines a payment request received by the caller
+func RespondPaymentRequest(c *gin.Context) {
+	var body models.PaymentRequestResponse
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	request, transfer, err := body.RespondPaymentRequest()
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "payment request not found", err)
+		return
+	case errors.Is(err, models.ErrPaymentRequestExpired):
+		status.HandleError(c, http.StatusGone, "payment request expired", err)
+		return
+	case errors.Is(err, models.ErrInsufficientFunds):
+		status.HandleError(c, http.StatusUnprocessableEntity, "insufficient funds", err)
+		return
+	case errors.Is(err, models.ErrWalletLocked):
+		status.HandleError(c, http.StatusLocked, "wallet is locked", err)
+		return
+	case errors.Is(err, models.ErrGuardianControl):
+		status.HandleError(c, http.StatusForbidden, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrCurrencyMismatch):
+		status.HandleError(c, http.StatusConflict, "wallets have different currencies", err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to answer payment request", err)
+		return
+	}
+
+	if transfer != nil {
+		helpers.PublishTransferEvents(transfer)
+	}
+	helpers.PublishPaymentRequestEvent(request)
+	status.HandleSuccessData(c, "payment request answered successfully", request)
+}
+
+// CancelPaymentRequest withdraws a pending payment request sent by the caller
+func CancelPaymentRequest(c *gin.Context) {
+	var body models.PaymentRequestCancel
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	request, err := body.CancelPaymentRequest()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "payment request not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to cancel payment request", err)
+		return
+	}
+
+	helpers.PublishPaymentRequestEvent(request)
+	status.HandleSuccessData(c, "payment request canceled successfully", request)
+}
+
+// ListPaymentRequests lists the incoming or outgoing payment requests of a user
+func ListPaymentRequests(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	direction := c.DefaultQuery("direction", "incoming")
+	if direction != "incoming" && direction != "outgoing" {
+		status.HandleError(c, http.StatusBadRequest, "direction must be incoming or outgoing", nil)
+		return
+	}
+
+	requests, err := models.GetPaymentRequests(userID, direction == "outgoing", c.Query("status"), 100)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get payment requests", err)
+		return
+	}
+	status.HandleSuccessData(c, "payment requests retrieved successfully", requests)
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"io"
+	"net/http"
+)
+
+// maxPayoutFile bounds the size of an uploaded payout file
+const maxPayoutFile = 5 << 20 // 5 MB
+
+// UploadPayoutBatch validates a payout CSV file (multipart "user_id", "wallet_id" and "file")
+// and returns the draft batch with its totals and fees to confirm
+func UploadPayoutBatch(c *gin.Context) {
+	userID, err := uuid.Parse(c.PostForm("user_id"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+	walletID, err := uuid.Parse(c.PostForm("wallet_id"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid wallet id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "payout file is required", err)
+		return
+	}
+	if header.Size > maxPayoutFile {
+		status.HandleError(c, http.StatusRequestEntityTooLarge, "payout file too large", nil)
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid payout file", err)
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxPayoutFile))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid payout file", err)
+		return
+	}
+
+	lines, err := models.ParsePayoutFile(bytes.NewReader(content))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	batch, err := models.CreatePayoutBatch(userID, walletID, header.Filename, lines, helpers.PayoutFees())
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "wallet not found", err)
+		return
+	case errors.Is(err, models.ErrPayoutEmpty):
+		status.HandleError(c, http.StatusUnprocessableEntity, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to create payout batch", err)
+		return
+	}
+	status.HandleSuccessData(c, "payout batch validated successfully", batch)
+}
+
+// ConfirmPayoutBatch queues the valid lines of a draft batch of the caller for payment
+func ConfirmPayoutBatch(c *gin.Context) {
+	updatePayoutBatch(c, (*models.PayoutBatchAction).ConfirmPayoutBatch, "draft payout batch not found", "payout batch confirmed successfully")
+}
+
+// CancelPayoutBatch cancels a draft batch of the caller
+func CancelPayoutBatch(c *gin.Context) {
+	updatePayoutBatch(c, (*models.PayoutBatchAction).CancelPayoutBatch, "draft payout batch not found", "payout batch canceled successfully")
+}
+
+// ResumePayoutBatch queues the failed lines of a finished batch of the caller again
+func ResumePayoutBatch(c *gin.Context) {
+	updatePayoutBatch(c, (*models.PayoutBatchAction).ResumePayoutBatch, "payout batch with failed lines not found", "payout batch resumed successfully")
+}
+
+// updatePayoutBatch applies an action of the caller to a batch, answers and starts paying the queued lines
+func updatePayoutBatch(c *gin.Context, action func(*models.PayoutBatchAction) (*models.PayoutBatch, error), notFound, message string) {
+	var body models.PayoutBatchAction
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	batch, err := action(&body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, notFound, err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to update payout batch", err)
+		return
+	}
+
+	helpers.PublishPayoutBatchEvent(batch)
+	if batch.Status == models.PayoutBatchProcessing {
+		helpers.ProcessPayoutsNow()
+	}
+	status.HandleSuccessData(c, message, batch)
+}
+
+// ListPayoutBatches lists the payout batches of a user
+func ListPayoutBatches(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	batches, err := models.GetPayoutBatches(userID, 100)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get payout batches", err)
+		return
+	}
+	status.HandleSuccessData(c, "payout batches retrieved successfully", batches)
+}
+
+// GetPayoutBatch returns a payout batch of a user with the status of every line
+func GetPayoutBatch(c *gin.Context) {
+	batch := getPayoutBatch(c)
+	if batch == nil {
+		return
+	}
+	status.HandleSuccessData(c, "payout batch retrieved successfully", batch)
+}
+
+// DownloadPayoutResult returns the outcome of every line of a payout batch as CSV
+func DownloadPayoutResult(c *gin.Context) {
+	batch := getPayoutBatch(c)
+	if batch == nil {
+		return
+	}
+
+	content, err := models.RenderPayoutResult(batch)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to render payout result", err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "payout-"+batch.ID.String()+".csv"))
+	c.Data(http.StatusOK, "text/csv", content)
+}
+
+// getPayoutBatch loads the batch of the route for the caller, or answers the error and returns nil
+func getPayoutBatch(c *gin.Context) *models.PayoutBatch {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return nil
+	}
+	batchID, err := uuid.Parse(c.Param("batchID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid batch id", err)
+		return nil
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return nil
+	}
+
+	batch, err := models.GetPayoutBatch(batchID, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "payout batch not found", err)
+		return nil
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get payout batch", err)
+		return nil
+	}
+	return batch
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// CreatePocket creates a savings pocket under a wallet
+func CreatePocket(c *gin.Context) {
+	var body models.PocketRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	pocket, err := body.CreatePocket()
+	if err != nil {
+		handlePocketError(c, "failed to create pocket", err)
+		return
+	}
+	status.HandleSuccessData(c, "pocket created successfully", pocket)
+}
+
+// UpdatePocket renames a pocket or changes its goal
+func UpdatePocket(c *gin.Context) {
+	var body models.PocketRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	pocket, err := body.UpdatePocket()
+	if err != nil {
+		handlePocketError(c, "failed to update pocket", err)
+		return
+	}
+	status.HandleSuccessData(c, "pocket updated successfully", pocket)
+}
+
+// TransferPocket moves money between the main balance and a pocket
+func TransferPocket(c *gin.Context) {
+	var body models.PocketTransferRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	transfer, err := body.TransferPocket()
+	if err != nil {
+		handlePocketError(c, "failed to move money", err)
+		return
+	}
+	status.HandleSuccessData(c, "money moved successfully", transfer)
+}
+
+// ClosePocket moves the pocket balance back to the main balance and closes the pocket
+func ClosePocket(c *gin.Context) {
+	var body models.PocketCloseRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	transfer, err := body.ClosePocket()
+	if err != nil {
+		handlePocketError(c, "failed to close pocket", err)
+		return
+	}
+	status.HandleSuccessData(c, "pocket closed successfully", transfer)
+}
+
+// handlePocketError maps the pocket errors to a response
+func handlePocketError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "pocket or wallet not found", err)
+	case errors.Is(err, models.ErrPocketExists):
+		status.HandleError(c, http.StatusConflict, err.Error(), err)
+	case errors.Is(err, models.ErrInsufficientFunds):
+		status.HandleError(c, http.StatusUnprocessableEntity, "insufficient funds", err)
+	case errors.Is(err, models.ErrWalletLocked):
+		status.HandleError(c, http.StatusLocked, "wallet is locked", err)
+	default:
+		status.HandleError(c, http.StatusInternalServerError, message, err)
+	}
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"errors"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/emmadal/feeti-wallet/providers"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// ProviderCallback applies a signed payment provider callback
+func ProviderCallback(c *gin.Context) {
+	provider, err := providers.Get(c.Param("provider"))
+	if err != nil {
+		status.HandleError(c, http.StatusNotFound, "unknown provider", err)
+		return
+	}
+	body := c.MustGet(helpers.WebhookBodyKey).([]byte)
+
+	// ignore a callback already processed
+	callback := models.ProviderCallback{
+		Provider:  provider.Name(),
+		Signature: c.GetString(helpers.WebhookSignatureKey),
+		Payload:   string(body),
+	}
+	processed, err := callback.CallbackProcessed()
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to check callback", err)
+		return
+	}
+	if processed {
+		status.HandleSuccess(c, "callback already processed")
+		return
+	}
+
+	result, err := provider.ParseCallback(body)
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid callback", err)
+		return
+	}
+
+	// update the transaction, settling it at most once
+	transaction, err := helpers.ApplyProviderResult(provider.Name(), *result)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "transaction not found", err)
+		return
+	}
+	if errors.Is(err, models.ErrInvalidTransition) {
+		status.HandleError(c, http.StatusConflict, "transaction already settled", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to apply callback", err)
+		return
+	}
+
+	callback.TransactionID = &transaction.ID
+	callback.Status = transaction.Status
+	if err := callback.CreateProviderCallback(); err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to record callback", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "callback processed successfully", gin.H{
+		"transaction_id": transaction.ID,
+		"status":         transaction.Status,
+	})
+}
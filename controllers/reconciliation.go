@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// ReconcileWallet recomputes a wallet from its history and compares it with the stored balances
+func ReconcileWallet(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("walletID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid wallet id", err)
+		return
+	}
+
+	run, err := helpers.ReconcileWallets(walletID, 0)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to reconcile wallet", err)
+		return
+	}
+	if run.WalletsChecked == 0 {
+		status.HandleError(c, http.StatusNotFound, "wallet not found", nil)
+		return
+	}
+
+	status.HandleSuccessData(c, "wallet reconciled successfully", run)
+}
+
+// ListWalletDiscrepancies lists the latest reconciliation discrepancies, optionally of a single wallet
+func ListWalletDiscrepancies(c *gin.Context) {
+	var walletID uuid.UUID
+	if raw := c.Query("wallet_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			status.HandleError(c, http.StatusBadRequest, "invalid wallet id", err)
+			return
+		}
+		walletID = id
+	}
+
+	discrepancies, err := models.GetWalletDiscrepancies(walletID, 200)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get discrepancies", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "discrepancies retrieved successfully", discrepancies)
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"fmt"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+// GenerateComplianceReport generates a regulator report for a period
+func GenerateComplianceReport(c *gin.Context) {
+	var body models.ReportRequest
+
+	// parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// the period covers whole days, "to" included
+	from, _ := time.Parse(time.DateOnly, body.From)
+	to, _ := time.Parse(time.DateOnly, body.To)
+	to = to.AddDate(0, 0, 1)
+	if !to.After(from) {
+		status.HandleError(c, http.StatusBadRequest, "invalid report period", nil)
+		return
+	}
+
+	report, err := models.GenerateComplianceReport(from, to, body.Format, models.DefaultReportConfig())
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to generate report", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "report generated successfully", report)
+}
+
+// ListComplianceReports lists the generated regulator reports
+func ListComplianceReports(c *gin.Context) {
+	reports, err := models.GetComplianceReports()
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get reports", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "reports retrieved successfully", reports)
+}
+
+// DownloadComplianceReport downloads a regulator report file
+func DownloadComplianceReport(c *gin.Context) {
+	reportID, err := uuid.Parse(c.Param("reportID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid report id", err)
+		return
+	}
+
+	r := models.ComplianceReport{ID: reportID}
+	report, err := r.GetComplianceReport()
+	if err != nil {
+		status.HandleError(c, http.StatusNotFound, "report not found", err)
+		return
+	}
+
+	contentType := "text/csv"
+	if report.Format == models.ReportFormatXML {
+		contentType = "application/xml"
+	}
+	filename := fmt.Sprintf(
+		"compliance-report-%s-%s.%s",
+		report.PeriodStart.UTC().Format(time.DateOnly),
+		report.PeriodEnd.UTC().Format(time.DateOnly),
+		report.Format,
+	)
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("X-Checksum-SHA256", report.Checksum)
+	helpers.AuditAccess(c, models.AccessDownloadReport, report.ID)
+	c.Data(http.StatusOK, contentType, report.Content)
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// ReverseTransaction refunds all or part of a top-up or withdrawal
+func ReverseTransaction(c *gin.Context) {
+	var body models.ReversalRequest
+
+	// parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	reversal, err := body.ReverseWalletLog(jwt.GetUserIDFromGin(c).String())
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "transaction not found", err)
+		return
+	case errors.Is(err, models.ErrNotReversible),
+		errors.Is(err, models.ErrReversalExceedsOriginal),
+		errors.Is(err, models.ErrInsufficientFunds),
+		errors.Is(err, models.ErrWalletInactive):
+		status.HandleError(c, http.StatusUnprocessableEntity, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrWalletLocked):
+		status.HandleError(c, http.StatusLocked, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrIdempotencyConflict):
+		status.HandleError(c, http.StatusConflict, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to reverse transaction", err)
+		return
+	}
+
+	helpers.PublishReversalEvent(reversal)
+	status.HandleSuccessData(c, "transaction reversed successfully", reversal)
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/emmadal/feeti-wallet/providers"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxSettlementFile bounds the size of an uploaded settlement file
+const maxSettlementFile = 20 << 20 // 20 MB
+
+// ImportSettlement imports a provider settlement file (multipart "file", "provider" and "date")
+func ImportSettlement(c *gin.Context) {
+	provider := c.PostForm("provider")
+	date, err := time.Parse(time.DateOnly, c.PostForm("date"))
+	if provider == "" || err != nil {
+		status.HandleError(c, http.StatusBadRequest, "provider and date (YYYY-MM-DD) are required", err)
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "settlement file is required", err)
+		return
+	}
+	if header.Size > maxSettlementFile {
+		status.HandleError(c, http.StatusRequestEntityTooLarge, "settlement file too large", nil)
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid settlement file", err)
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxSettlementFile))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid settlement file", err)
+		return
+	}
+
+	report, err := helpers.ImportSettlementFile(provider, date, header.Filename, content, jwt.GetUserIDFromGin(c).String())
+	switch {
+	case errors.Is(err, providers.ErrNoSettlementLayout):
+		status.HandleError(c, http.StatusNotFound, err.Error(), err)
+		return
+	case errors.Is(err, models.ErrSettlementImported):
+		status.HandleError(c, http.StatusConflict, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusUnprocessableEntity, "failed to import settlement file", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "settlement file imported successfully", report)
+}
+
+// ListSettlementImports lists the imported settlement files
+func ListSettlementImports(c *gin.Context) {
+	imports, err := models.GetSettlementImports()
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get settlement imports", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "settlement imports retrieved successfully", imports)
+}
+
+// GetSettlementReport gets the reconciliation report of an imported settlement file
+func GetSettlementReport(c *gin.Context) {
+	importID, err := uuid.Parse(c.Param("importID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid import id", err)
+		return
+	}
+
+	s := models.SettlementImport{ID: importID}
+	report, err := s.GetSettlementImport()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "settlement import not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get settlement report", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "settlement report retrieved successfully", report)
+}
+
+// ListSettlementExceptions lists the unresolved settlement exceptions for ops
+func ListSettlementExceptions(c *gin.Context) {
+	items, err := models.GetSettlementExceptions(500)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get settlement exceptions", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "settlement exceptions retrieved successfully", items)
+}
+
+// ResolveSettlementException closes a settlement exception with a note
+func ResolveSettlementException(c *gin.Context) {
+	itemID, err := uuid.Parse(c.Param("itemID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid exception id", err)
+		return
+	}
+
+	var body models.SettlementResolution
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	item := models.SettlementItem{ID: itemID}
+	resolved, err := item.ResolveSettlementException(jwt.GetUserIDFromGin(c).String(), body.Note)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "open exception not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to resolve exception", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "exception resolved successfully", resolved)
+}
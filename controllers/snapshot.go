@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GetBalanceAt gets the balance of a wallet at an instant, now by default
+func GetBalanceAt(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("walletID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid wallet id", err)
+		return
+	}
+
+	at := time.Now()
+	if raw := c.Query("at"); raw != "" {
+		at, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			status.HandleError(c, http.StatusBadRequest, "invalid date, expected RFC 3339", err)
+			return
+		}
+	}
+
+	// the wallet owner and finance admins only, checked first so other users cannot probe wallet ids
+	if !helpers.IsAdmin(c) {
+		ownerID, err := models.GetWalletOwner(walletID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			status.HandleError(c, http.StatusInternalServerError, "failed to get wallet balance", err)
+			return
+		}
+		if ownerID != jwt.GetUserIDFromGin(c) {
+			status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+			return
+		}
+	}
+
+	w := models.Wallet{ID: walletID}
+	balance, err := w.BalanceAt(at)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "wallet not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get wallet balance", err)
+		return
+	}
+
+	helpers.AuditAccess(c, models.AccessReadBalance, walletID)
+	status.HandleSuccessData(c, "balance retrieved successfully", balance)
+}
+
+// GetMonthEndBalances lists the balance of every wallet at the end of a month from the snapshots
+func GetMonthEndBalances(c *gin.Context) {
+	month, err := time.Parse("2006-01", c.Query("month"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid month, expected YYYY-MM", err)
+		return
+	}
+	monthEnd := month.AddDate(0, 1, 0)
+	if monthEnd.After(time.Now()) {
+		status.HandleError(c, http.StatusBadRequest, "month not over yet", nil)
+		return
+	}
+
+	// the snapshot job creates them, a month end it has not reached yet has none
+	snapshots, err := models.GetBalanceSnapshots(monthEnd)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get snapshots", err)
+		return
+	}
+	if len(snapshots) == 0 {
+		status.HandleError(c, http.StatusNotFound, "month-end snapshots not created yet", nil)
+		return
+	}
+
+	if c.Query("format") != models.ReportFormatCSV {
+		status.HandleSuccessData(c, "month-end balances retrieved successfully", snapshots)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "month-end-balances-"+month.Format("2006-01")+".csv"))
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"wallet_id", "snapshot_at", "balance", "currency"})
+	for _, s := range snapshots {
+		_ = writer.Write([]string{s.WalletID.String(), s.SnapshotAt.UTC().Format(time.RFC3339), strconv.FormatInt(s.Balance, 10), s.Currency})
+	}
+	writer.Flush()
+}
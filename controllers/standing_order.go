@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// CreateStandingOrder schedules a one-off or recurring transfer
+func CreateStandingOrder(c *gin.Context) {
+	var body models.StandingOrderRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	order, err := body.CreateStandingOrder()
+	switch {
+	case errors.Is(err, models.ErrInvalidSchedule), errors.Is(err, models.ErrSameWallet):
+		status.HandleError(c, http.StatusBadRequest, err.Error(), err)
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "wallet or recipient not found", err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to create standing order", err)
+		return
+	}
+	status.HandleSuccessData(c, "standing order created successfully", order)
+}
+
+// ListStandingOrders lists the standing orders of a user
+func ListStandingOrders(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	orders, err := models.GetStandingOrders(userID)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get standing orders", err)
+		return
+	}
+	status.HandleSuccessData(c, "standing orders retrieved successfully", orders)
+}
+
+// ListStandingOrderRuns lists the executions of a standing order
+func ListStandingOrderRuns(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+	orderID, err := uuid.Parse(c.Param("orderID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid standing order id", err)
+		return
+	}
+
+	// verify user identity with context data
+	if userID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	runs, err := models.GetStandingOrderRuns(orderID, userID, 100)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get standing order runs", err)
+		return
+	}
+	status.HandleSuccessData(c, "standing order runs retrieved successfully", runs)
+}
+
+// SetStandingOrderStatus pauses, resumes or cancels a standing order
+func SetStandingOrderStatus(c *gin.Context) {
+	var body models.StandingOrderStatusRequest
+
+	// Parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	// verify user identity with context data
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	order, err := body.SetStandingOrderStatus()
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "standing order not found", err)
+		return
+	case errors.Is(err, models.ErrStandingOrderStatus):
+		status.HandleError(c, http.StatusConflict, err.Error(), err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to update standing order", err)
+		return
+	}
+	status.HandleSuccessData(c, "standing order updated successfully", order)
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// streamHeartbeat keeps idle streams open through proxies
+const streamHeartbeat = 25 * time.Second
+
+// StreamWallet pushes the balance and transaction updates of the caller's wallet over Server-Sent Events
+func StreamWallet(c *gin.Context) {
+	userID := jwt.GetUserIDFromGin(c)
+
+	// Subscribe before the snapshot so no update is missed in between
+	events, unsubscribe := helpers.SubscribeWalletStream(userID)
+	defer unsubscribe()
+
+	w := models.Wallet{UserID: userID}
+	wallet, err := w.GetBalance()
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get wallet", err)
+		return
+	}
+
+	helpers.AuditAccess(c, models.AccessStreamWallet, wallet.ID)
+
+	// The stream outlives the server write timeout
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear stream write deadline: %v\n", err)
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.SSEvent("balance", models.WalletResponse{
+		ID:          wallet.ID,
+		Currency:    wallet.Currency,
+		Balance:     wallet.Balance,
+		HeldBalance: wallet.HeldBalance,
+	})
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(out io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event := <-events:
+			c.SSEvent(event.Type, event)
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(out, ": ping\n\n")
+			return err == nil
+		}
+	})
+}
@@ -1,10 +1,13 @@
 package controllers
 
 import (
-	"fmt"
+	"errors"
 	jwt "github.com/emmadal/feeti-module/auth"
 	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
 	"github.com/emmadal/feeti-wallet/models"
+	"github.com/emmadal/feeti-wallet/providers"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -26,42 +29,23 @@ func TopupWallet(c *gin.Context) {
 		return
 	}
 
-	// get active balance
-	w := models.Wallet{UserID: body.UserID, ID: body.WalletID}
-	balance, err := w.GetBalance()
-	if err != nil {
-		status.HandleError(c, http.StatusInternalServerError, "failed to get wallet balance", err)
+	// start the cash-in, the wallet is credited once the provider confirms
+	t := models.Transaction{
+		UserID:   body.UserID,
+		WalletID: body.WalletID,
+		Amount:   body.Amount,
+		Provider: body.Provider,
+	}
+	transaction, err := helpers.InitiateDeposit(t, body.PhoneNumber)
+	if errors.Is(err, providers.ErrUnknownProvider) {
+		status.HandleError(c, http.StatusBadRequest, "unknown payment provider", err)
 		return
 	}
-
-	// topup wallet
-	wallet, err := w.RechargeWallet(body.Amount)
 	if err != nil {
 		status.HandleError(c, http.StatusInternalServerError, "failed to topup wallet", err)
 		return
 	}
 
-	// Create topup log
-	go func() {
-		walletLog := models.WalletLog{
-			UserID:         body.UserID,
-			WalletID:       wallet.ID,
-			Activity:       "TOPUP_WALLET",
-			OldBalance:     balance.Balance,
-			NewBalance:     wallet.Balance,
-			ActivityAmount: body.Amount,
-			Currency:       wallet.Currency,
-			Metadata:       `{"source": "topup"}`,
-		}
-		if err := walletLog.CreateWalletLog(); err != nil {
-			fmt.Printf("Failed to log topup activity for user %d: %v\n", body.UserID, err)
-		}
-	}()
-
 	// return success response
-	status.HandleSuccessData(c, "wallet topup successful", models.WalletResponse{
-		ID:       wallet.ID,
-		Currency: wallet.Currency,
-		Balance:  wallet.Balance,
-	})
+	status.HandleSuccessData(c, "wallet topup "+strings.ToLower(transaction.Status), transaction)
 }
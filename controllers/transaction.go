@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"errors"
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// GetTransactionStatus gets the status of a transaction of the user
+func GetTransactionStatus(c *gin.Context) {
+	transactionID, err := uuid.Parse(c.Param("transactionID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid transaction id", err)
+		return
+	}
+
+	t := models.Transaction{ID: transactionID}
+	transaction, err := t.GetTransaction()
+	if errors.Is(err, pgx.ErrNoRows) {
+		status.HandleError(c, http.StatusNotFound, "transaction not found", err)
+		return
+	}
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get transaction", err)
+		return
+	}
+
+	// verify user identity with context data
+	if transaction.UserID != jwt.GetUserIDFromGin(c) {
+		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+		return
+	}
+
+	helpers.AuditAccess(c, models.AccessReadTransaction, transaction.ID)
+	status.HandleSuccessData(c, "transaction retrieved successfully", transaction)
+}
@@ -3,9 +3,9 @@ package controllers
 import (
 	jwt "github.com/emmadal/feeti-module/auth"
 	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
 	"github.com/emmadal/feeti-wallet/models"
 	"github.com/gin-gonic/gin"
-	"log"
 	"net/http"
 )
 
@@ -19,12 +19,19 @@ func UnLockWalletByUser(c *gin.Context) {
 		return
 	}
 
-	// verify user identity with context data
-	if body.UserID != jwt.GetUserIDFromGin(c) {
+	// verify user identity with context data, organization admins and guardians unlock its wallet
+	if !helpers.ActsFor(c, body.UserID, models.PermissionManage) {
 		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
 		return
 	}
 
+	// a child cannot lift the lock of its guardian
+	callerID := jwt.GetUserIDFromGin(c)
+	if callerID == body.UserID && models.IsGuardianLocked(body.UserID) {
+		status.HandleError(c, http.StatusForbidden, "wallet locked by guardian", nil)
+		return
+	}
+
 	w := models.Wallet{ID: body.WalletID, UserID: body.UserID}
 
 	// Check if the wallet is locked
@@ -41,27 +48,12 @@ func UnLockWalletByUser(c *gin.Context) {
 	}
 
 	// Unlock wallet
-	if err := w.UnlockWallet(); err != nil {
+	if err := w.UnlockWallet(callerID); err != nil {
 		status.HandleError(c, http.StatusInternalServerError, "failed to unlock wallet", err)
 		return
 	}
 
-	// Create a withdrawal log
-	go func() {
-		walletLog := models.WalletLog{
-			UserID:         body.UserID,
-			WalletID:       wallet.ID,
-			Activity:       "UNLOCK_WALLET",
-			OldBalance:     wallet.Balance,
-			NewBalance:     wallet.Balance,
-			ActivityAmount: 0,
-			Currency:       wallet.Currency,
-			Metadata:       `{"source": "unlock_wallet"}`,
-		}
-		if err := walletLog.CreateWalletLog(); err != nil {
-			log.Printf("Error creating wallet log: %v\n", err)
-		}
-	}() // Pass the context to the goroutine
+	helpers.PublishBalanceEvent(models.EventWalletUnlocked, wallet, body.UserID, 0)
 
 	status.HandleSuccess(c, "wallet unlocked successfully")
 }
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"errors"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+)
+
+// CreateWebhookSubscription registers a partner webhook. The secret is only returned here.
+func CreateWebhookSubscription(c *gin.Context) {
+	var body models.WebhookSubscriptionRequest
+
+	// parse request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	subscription, err := body.CreateWebhookSubscription()
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to create webhook", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "webhook created successfully", subscription)
+}
+
+// ListWebhookSubscriptions lists the partner webhooks
+func ListWebhookSubscriptions(c *gin.Context) {
+	subscriptions, err := models.GetWebhookSubscriptions()
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get webhooks", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "webhooks retrieved successfully", subscriptions)
+}
+
+// DisableWebhookSubscription stops the deliveries of a partner webhook
+func DisableWebhookSubscription(c *gin.Context) {
+	subscriptionID, err := uuid.Parse(c.Param("subscriptionID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid webhook id", err)
+		return
+	}
+
+	s := models.WebhookSubscription{ID: subscriptionID}
+	if err := s.DisableWebhookSubscription(); err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to disable webhook", err)
+		return
+	}
+
+	status.HandleSuccess(c, "webhook disabled successfully")
+}
+
+// ListWebhookDeliveries lists deliveries by status, dead-lettered ones by default
+func ListWebhookDeliveries(c *gin.Context) {
+	deliveryStatus := c.DefaultQuery("status", models.DeliveryDead)
+	switch deliveryStatus {
+	case models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		status.HandleError(c, http.StatusBadRequest, "invalid delivery status", nil)
+		return
+	}
+
+	deliveries, err := models.GetWebhookDeliveriesByStatus(deliveryStatus, 100)
+	if err != nil {
+		status.HandleError(c, http.StatusInternalServerError, "failed to get deliveries", err)
+		return
+	}
+
+	status.HandleSuccessData(c, "deliveries retrieved successfully", deliveries)
+}
+
+// ReplayWebhookDelivery queues a delivery again, e.g. from the dead-letter store
+func ReplayWebhookDelivery(c *gin.Context) {
+	deliveryID, err := uuid.Parse(c.Param("deliveryID"))
+	if err != nil {
+		status.HandleError(c, http.StatusBadRequest, "invalid delivery id", err)
+		return
+	}
+
+	d := models.WebhookDelivery{ID: deliveryID}
+	err = d.ReplayWebhookDelivery()
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		status.HandleError(c, http.StatusNotFound, "delivery not found", err)
+		return
+	case err != nil:
+		status.HandleError(c, http.StatusInternalServerError, "failed to replay delivery", err)
+		return
+	}
+
+	status.HandleSuccess(c, "delivery queued successfully")
+}
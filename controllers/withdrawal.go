@@ -1,12 +1,15 @@
 package controllers
 
 import (
-	"fmt"
+	"errors"
 	jwt "github.com/emmadal/feeti-module/auth"
 	status "github.com/emmadal/feeti-module/status"
+	"github.com/emmadal/feeti-wallet/helpers"
 	"github.com/emmadal/feeti-wallet/models"
+	"github.com/emmadal/feeti-wallet/providers"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strings"
 )
 
 // WithdrawWallet processes a wallet withdraw request
@@ -19,8 +22,8 @@ func WithdrawWallet(c *gin.Context) {
 		return
 	}
 
-	// verify user identity with context data
-	if body.UserID != jwt.GetUserIDFromGin(c) {
+	// verify user identity with context data, members of an organization initiate its withdrawals
+	if !helpers.ActsFor(c, body.UserID, models.PermissionInitiate) {
 		status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
 		return
 	}
@@ -47,41 +50,37 @@ func WithdrawWallet(c *gin.Context) {
 		return
 	}
 
-	// withdraw wallet
-	w.Balance = balance.Balance
-	wallet, err := w.WithdrawWallet(body.Amount)
+	// withdrawals of an organization wallet go through its approval policy
+	if body.UserID != jwt.GetUserIDFromGin(c) {
+		submitOrganizationWithdrawal(c, &body)
+		return
+	}
+
+	// hold the funds and start the payout at the provider
+	t := models.Transaction{
+		UserID:   body.UserID,
+		WalletID: body.WalletID,
+		Amount:   body.Amount,
+		Provider: body.Provider,
+	}
+	transaction, err := helpers.InitiateWithdrawal(t, body.PhoneNumber)
+	if errors.Is(err, providers.ErrUnknownProvider) {
+		status.HandleError(c, http.StatusBadRequest, "unknown payment provider", err)
+		return
+	}
+	if errors.Is(err, models.ErrInsufficientFunds) {
+		status.HandleError(c, http.StatusUnauthorized, "insufficient balance", err)
+		return
+	}
+	if errors.Is(err, models.ErrGuardianControl) {
+		status.HandleError(c, http.StatusForbidden, err.Error(), err)
+		return
+	}
 	if err != nil {
 		status.HandleError(c, http.StatusInternalServerError, "failed to withdraw wallet", err)
 		return
 	}
 
-	// publish event to NATS
-	//go func(c context.Context) {
-	//	data, _ := json.Marshal(wallet)
-	//	helpers.JStream.Publish(c, "wallet.transactions", data)
-	//}(c.Request.Context())
-
-	// Create a withdrawal log
-	go func() {
-		walletLog := models.WalletLog{
-			UserID:         body.UserID,
-			WalletID:       wallet.ID,
-			Activity:       "WITHDRAWAL",
-			OldBalance:     balance.Balance,
-			NewBalance:     wallet.Balance,
-			ActivityAmount: body.Amount,
-			Currency:       wallet.Currency,
-			Metadata:       `{"source": "withdrawal"}`,
-		}
-		if err := walletLog.CreateWalletLog(); err != nil {
-			fmt.Printf("Failed to create withdrawal log: %v\n", err)
-		}
-	}()
-
 	// return response
-	status.HandleSuccessData(c, "withdrawal successful", models.WalletResponse{
-		ID:       wallet.ID,
-		Currency: wallet.Currency,
-		Balance:  wallet.Balance,
-	})
+	status.HandleSuccessData(c, "withdrawal "+strings.ToLower(transaction.Status), transaction)
 }
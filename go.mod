@@ -3,6 +3,7 @@ module github.com/emmadal/feeti-wallet
 go 1.24.3
 
 require (
+	github.com/emmadal/feeti-module v0.0.0-20250604170525-451d7a457534
 	github.com/gin-contrib/cors v1.7.5
 	github.com/gin-contrib/gzip v1.2.3
 	github.com/gin-gonic/gin v1.10.1
@@ -16,7 +17,6 @@ require (
 	github.com/bytedance/sonic v1.13.2 // indirect
 	github.com/bytedance/sonic/loader v0.2.4 // indirect
 	github.com/cloudwego/base64x v0.1.5 // indirect
-	github.com/emmadal/feeti-module v0.0.0-20250604170525-451d7a457534 // indirect
 	github.com/gabriel-vasile/mimetype v1.4.9 // indirect
 	github.com/gin-contrib/sse v1.1.0 // indirect
 	github.com/gin-contrib/timeout v1.0.2 // indirect
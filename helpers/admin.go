@@ -0,0 +1,41 @@
+package helpers
+
+import (
+	jwt "github.com/emmadal/feeti-module/auth"
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// adminUserIDs returns the users allowed to call admin endpoints
+func adminUserIDs() map[uuid.UUID]bool {
+	admins := make(map[uuid.UUID]bool)
+	for _, raw := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if id, err := uuid.Parse(strings.TrimSpace(raw)); err == nil {
+			admins[id] = true
+		}
+	}
+	return admins
+}
+
+// IsAdmin checks if the caller is listed in ADMIN_USER_IDS
+func IsAdmin(c *gin.Context) bool {
+	return adminUserIDs()[jwt.GetUserIDFromGin(c)]
+}
+
+// AdminOnly restricts a route to the users listed in ADMIN_USER_IDS.
+// It must be used after the JWT middleware.
+func AdminOnly() gin.HandlerFunc {
+	admins := adminUserIDs()
+	return func(c *gin.Context) {
+		if !admins[jwt.GetUserIDFromGin(c)] {
+			status.HandleError(c, http.StatusForbidden, "Forbidden request", nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
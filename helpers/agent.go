@@ -0,0 +1,109 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/google/uuid"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// AgentOTPTTL returns how long a cash-out OTP is valid from AGENT_OTP_TTL, 5 minutes by default
+func AgentOTPTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("AGENT_OTP_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 5 * time.Minute
+}
+
+// AgentFloatWalletID returns the treasury wallet funding the agent floats from AGENT_FLOAT_WALLET_ID
+func AgentFloatWalletID() (uuid.UUID, error) {
+	return uuid.Parse(os.Getenv("AGENT_FLOAT_WALLET_ID"))
+}
+
+// PublishAgentOperation notifies an agent operation on wallet.agent.<cash_in|cash_out>.<pending|completed|expired|failed>
+// and a float under its minimum on wallet.agent.float_low
+func PublishAgentOperation(o *models.AgentOperation) {
+	if nc == nil {
+		return
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		log.Printf("Error marshaling agent operation: %v\n", err)
+		return
+	}
+	subject := SubjectAgent + "." + strings.ToLower(o.Kind) + "." + strings.ToLower(o.Status)
+	if err := nc.Publish(subject, data); err != nil {
+		log.Printf("Failed to publish agent operation %s: %v\n", o.ID, err)
+	}
+	if o.FloatLow() {
+		if err := nc.Publish(SubjectAgentFloatLow, data); err != nil {
+			log.Printf("Failed to publish low float of agent %s: %v\n", o.AgentID, err)
+		}
+	}
+}
+
+// PublishAgentCashOutOTP sends the OTP of a cash-out to the customer through the notification service
+func PublishAgentCashOutOTP(o *models.AgentOperation) {
+	if nc == nil {
+		return
+	}
+	data, err := json.Marshal(map[string]any{
+		"operation_id": o.ID,
+		"customer_id":  o.CustomerID,
+		"agent_id":     o.AgentID,
+		"amount":       o.Amount,
+		"currency":     o.Currency,
+		"otp":          o.OTP,
+		"expires_at":   o.ExpiresAt,
+	})
+	if err != nil {
+		log.Printf("Error marshaling cash-out otp: %v\n", err)
+		return
+	}
+	if err := nc.Publish(SubjectAgentCashOutOTP, data); err != nil {
+		log.Printf("Failed to publish cash-out otp %s: %v\n", o.ID, err)
+	}
+}
+
+// expireAgentCashOuts expires the cash-outs the customers did not confirm
+func expireAgentCashOuts() error {
+	expired, err := models.ExpireAgentCashOuts(time.Now())
+	if err != nil {
+		return err
+	}
+	for i := range expired {
+		PublishAgentOperation(&expired[i])
+	}
+	if len(expired) > 0 {
+		log.Printf("Expired %d agent cash-outs\n", len(expired))
+	}
+	return nil
+}
+
+// summarizeAgentDays makes the daily activity summaries of the previous UTC day and sends them to the agents
+func summarizeAgentDays() error {
+	summaries, err := models.CreateAgentDailySummaries(time.Now().UTC().AddDate(0, 0, -1))
+	if err != nil {
+		return err
+	}
+	for _, summary := range summaries {
+		if nc == nil {
+			break
+		}
+		data, err := json.Marshal(summary)
+		if err != nil {
+			log.Printf("Error marshaling agent summary: %v\n", err)
+			continue
+		}
+		if err := nc.Publish(SubjectAgentSummary, data); err != nil {
+			log.Printf("Failed to publish summary of agent %s: %v\n", summary.AgentID, err)
+		}
+	}
+	if len(summaries) > 0 {
+		log.Printf("Created %d agent daily summaries\n", len(summaries))
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package helpers
+
+import (
+	jwt "github.com/emmadal/feeti-module/auth"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// maxUserAgent bounds the user agent stored in the access audit
+const maxUserAgent = 512
+
+// AuditAccess records in the background who read a resource, from which IP and user agent
+func AuditAccess(c *gin.Context, action string, resourceID uuid.UUID) {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > maxUserAgent {
+		userAgent = userAgent[:maxUserAgent]
+	}
+	audit := models.AccessAudit{
+		ActorID:    jwt.GetUserIDFromGin(c),
+		Action:     action,
+		ResourceID: resourceID,
+		IPAddress:  c.ClientIP(),
+		UserAgent:  userAgent,
+	}
+
+	go func() {
+		if err := audit.CreateAccessAudit(); err != nil {
+			log.Printf("Error creating access audit: %v\n", err)
+		}
+	}()
+}
+
+// accessAuditRetention returns how long reads are kept, from ACCESS_AUDIT_RETENTION_DAYS
+func accessAuditRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ACCESS_AUDIT_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = 90
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// purgeAccessAudits deletes the reads past the retention period
+func purgeAccessAudits() error {
+	deleted, err := models.PurgeAccessAudits(time.Now().Add(-accessAuditRetention()))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("Purged %d access audit rows\n", deleted)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package helpers
+
+import (
+	jwt "github.com/emmadal/feeti-module/auth"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ActsFor checks if the caller may use a permission on the wallet of an owner: the owner itself,
+// the guardian of a child, who views and locks its wallet, or a member of the owning organization whose role grants it
+func ActsFor(c *gin.Context, ownerID uuid.UUID, permission string) bool {
+	callerID := jwt.GetUserIDFromGin(c)
+	if callerID == ownerID {
+		return true
+	}
+	if models.IsGuardian(ownerID, callerID) {
+		return permission == models.PermissionView || permission == models.PermissionManage
+	}
+	role, err := models.GetOrganizationRole(ownerID, callerID)
+	if err != nil {
+		return false
+	}
+	return models.RoleGrants(role, permission)
+}
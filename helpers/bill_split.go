@@ -0,0 +1,79 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// Bill split reminder intervals, per share
+const (
+	billSplitReminderInterval     = 24 * time.Hour // automatic reminders
+	billSplitManualReminderPeriod = time.Hour      // reminders asked by the creator
+)
+
+// publishBillSplit publishes a split or share on a bill split subject
+func publishBillSplit(subject string, v any) {
+	if nc == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error marshaling bill split event: %v\n", err)
+		return
+	}
+	if err := nc.Publish(subject, data); err != nil {
+		log.Printf("Failed to publish %s: %v\n", subject, err)
+	}
+}
+
+// PublishBillSplitCreated notifies the participants of a new split
+func PublishBillSplitCreated(split *models.BillSplit) {
+	publishBillSplit(SubjectBillSplitCreated, split)
+	if split.Status == models.BillSplitSettled {
+		publishBillSplit(SubjectBillSplitSettled, split)
+	}
+}
+
+// PublishBillSplitPayment notifies the creator of a paid share and of the settlement it completes
+func PublishBillSplitPayment(split *models.BillSplit, share *models.BillSplitShare, transfer *models.Transfer) {
+	PublishTransferEvents(transfer)
+	publishBillSplit(SubjectBillSplitPaid, share)
+	if split.Status == models.BillSplitSettled {
+		publishBillSplit(SubjectBillSplitSettled, split)
+	}
+}
+
+// PublishBillSplitCanceled notifies the participants that a split is canceled
+func PublishBillSplitCanceled(split *models.BillSplit) {
+	publishBillSplit(SubjectBillSplitCanceled, split)
+}
+
+// RemindBillSplit reminds the participants of a split of its creator who have not paid yet
+func RemindBillSplit(splitID, creatorID uuid.UUID) (int, error) {
+	shares, err := models.RemindBillSplitShares(splitID, creatorID, billSplitManualReminderPeriod)
+	if err != nil {
+		return 0, err
+	}
+	for i := range shares {
+		publishBillSplit(SubjectBillSplitReminder, &shares[i])
+	}
+	return len(shares), nil
+}
+
+// remindBillSplits reminds every participant who has not paid an open split for a day
+func remindBillSplits() error {
+	shares, err := models.RemindBillSplitShares(uuid.Nil, uuid.Nil, billSplitReminderInterval)
+	if err != nil {
+		return err
+	}
+	for i := range shares {
+		publishBillSplit(SubjectBillSplitReminder, &shares[i])
+	}
+	if len(shares) > 0 {
+		log.Printf("Sent %d bill split reminders\n", len(shares))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/google/uuid"
+	"log"
+	"os"
+	"time"
+)
+
+// Commission accrual bounds
+const (
+	commissionLookback = 7 * 24 * time.Hour // wallet logs older than this are not accrued anymore
+	commissionBatch    = 1000
+)
+
+// commissionPayoutDelay leaves the accrual time to catch up with the end of a period before it is paid
+const commissionPayoutDelay = time.Hour
+
+// CommissionPeriod returns the payout period from COMMISSION_PAYOUT_PERIOD, monthly by default
+func CommissionPeriod() string {
+	switch period := os.Getenv("COMMISSION_PAYOUT_PERIOD"); period {
+	case models.CommissionDaily, models.CommissionWeekly:
+		return period
+	default:
+		return models.CommissionMonthly
+	}
+}
+
+// CommissionWalletID returns the wallet paying the commissions from COMMISSION_WALLET_ID
+func CommissionWalletID() (uuid.UUID, error) {
+	return uuid.Parse(os.Getenv("COMMISSION_WALLET_ID"))
+}
+
+// PublishCommissionPayout notifies a partner of its statement on wallet.commission.paid
+func PublishCommissionPayout(p *models.CommissionPayout) {
+	if nc == nil {
+		return
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("Error marshaling commission payout: %v\n", err)
+		return
+	}
+	if err := nc.Publish(SubjectCommissionPaid, data); err != nil {
+		log.Printf("Failed to publish commission payout %s: %v\n", p.ID, err)
+	}
+}
+
+// accrueCommissions records the commissions of the new partner wallet logs
+func accrueCommissions() error {
+	since := time.Now().Add(-commissionLookback)
+	for {
+		accrued, err := models.AccrueCommissions(since, commissionBatch)
+		if err != nil {
+			return err
+		}
+		if accrued > 0 {
+			log.Printf("Accrued %d commissions\n", accrued)
+		}
+		if accrued < commissionBatch {
+			return nil
+		}
+	}
+}
+
+// payCommissions pays every partner the commissions of the finished periods
+func payCommissions() error {
+	walletID, err := CommissionWalletID()
+	if err != nil {
+		return nil // payouts are off without a commission wallet
+	}
+	period := CommissionPeriod()
+	periodEnd := models.CommissionPeriodStart(period, time.Now().Add(-commissionPayoutDelay))
+	periodStart := models.CommissionPeriodStart(period, periodEnd.Add(-time.Nanosecond))
+
+	due, err := models.GetDueCommissions(periodEnd)
+	if err != nil {
+		return err
+	}
+	for _, d := range due {
+		payout, transfer, err := d.PayCommissions(periodStart, periodEnd, walletID)
+		if errors.Is(err, models.ErrTransferExists) {
+			continue // late entries of a period already paid go with the next period
+		}
+		if err != nil {
+			log.Printf("Error paying %s commissions of %s: %v\n", d.Currency, d.PartnerID, err)
+			continue
+		}
+		if payout == nil {
+			continue
+		}
+		if transfer != nil {
+			PublishTransferEvents(transfer)
+		}
+		PublishCommissionPayout(payout)
+	}
+	return nil
+}
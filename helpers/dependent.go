@@ -0,0 +1,34 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/emmadal/feeti-wallet/models"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// DependentInvitationTTL returns how long a child can accept an invitation from DEPENDENT_INVITATION_TTL, 7 days by default
+func DependentInvitationTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("DEPENDENT_INVITATION_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 7 * 24 * time.Hour
+}
+
+// PublishDependentInvitation notifies an invitation on wallet.dependent.invitation.<pending|accepted|declined|canceled>,
+// the notification service asks the child to accept the pending ones
+func PublishDependentInvitation(i *models.DependentInvitation) {
+	if nc == nil {
+		return
+	}
+	data, err := json.Marshal(i)
+	if err != nil {
+		log.Printf("Error marshaling dependent invitation: %v\n", err)
+		return
+	}
+	if err := nc.Publish(SubjectDependentInvitation+"."+strings.ToLower(i.Status), data); err != nil {
+		log.Printf("Failed to publish dependent invitation %s: %v\n", i.ID, err)
+	}
+}
@@ -0,0 +1,38 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/emmadal/feeti-wallet/models"
+	"log"
+	"strings"
+)
+
+// disputeEvent names the event of the current state of a dispute
+func disputeEvent(d *models.Dispute) string {
+	switch {
+	case d.Status == models.DisputeOpen:
+		return "opened"
+	case d.Status == models.DisputeInReview && d.Funds == models.DisputeFundsHeld:
+		return "held"
+	case d.Status == models.DisputeInReview:
+		return "credited"
+	default:
+		return strings.ToLower(d.Status)
+	}
+}
+
+// PublishDisputeEvent notifies a dispute change on
+// wallet.dispute.<opened|held|credited|resolved_payer|resolved_recipient|withdrawn>
+func PublishDisputeEvent(d *models.Dispute) {
+	if nc == nil {
+		return
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		log.Printf("Error marshaling dispute: %v\n", err)
+		return
+	}
+	if err := nc.Publish(SubjectDispute+"."+disputeEvent(d), data); err != nil {
+		log.Printf("Failed to publish dispute %s: %v\n", d.ID, err)
+	}
+}
@@ -0,0 +1,23 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/emmadal/feeti-wallet/models"
+	"log"
+	"strings"
+)
+
+// PublishEscrowEvent notifies both parties of an escrow change on wallet.escrow.<funded|disputed|released|refunded|split>
+func PublishEscrowEvent(e *models.Escrow) {
+	if nc == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Error marshaling escrow: %v\n", err)
+		return
+	}
+	if err := nc.Publish(SubjectEscrow+"."+strings.ToLower(e.Status), data); err != nil {
+		log.Printf("Failed to publish escrow %s: %v\n", e.ID, err)
+	}
+}
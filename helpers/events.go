@@ -0,0 +1,127 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/google/uuid"
+	"log"
+	"strings"
+	"time"
+)
+
+// walletEventSubject returns the NATS subject of an event type, e.g. wallet.events.credited
+func walletEventSubject(eventType string) string {
+	return SubjectWalletEvents + "." + strings.TrimPrefix(eventType, "wallet.")
+}
+
+// PublishWalletEvent publishes a wallet change on the internal event bus
+func PublishWalletEvent(event models.WalletEvent) {
+	if nc == nil {
+		return
+	}
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling wallet event: %v\n", err)
+		return
+	}
+	if err := nc.Publish(walletEventSubject(event.Type), data); err != nil {
+		log.Printf("Failed to publish wallet event %s: %v\n", event.Type, err)
+	}
+}
+
+// PublishTransactionEvent publishes the balance change of a transaction status update
+func PublishTransactionEvent(t *models.Transaction) {
+	if t.PreviousStatus == t.Status {
+		return
+	}
+
+	event := models.WalletEvent{
+		// One event per transaction status so duplicates are dropped downstream
+		ID:        uuid.NewSHA1(t.ID, []byte(t.Status)),
+		UserID:    t.UserID,
+		WalletID:  t.WalletID,
+		Amount:    t.Amount,
+		Currency:  t.Currency,
+		Reference: t.ID.String(),
+	}
+	switch {
+	case t.Status == models.TransactionPending && t.Type == models.TransactionWithdrawal:
+		event.Type = models.EventWalletDebited
+	case t.Status == models.TransactionCompleted && t.Type == models.TransactionDeposit:
+		event.Type = models.EventWalletCredited
+	case t.Status == models.TransactionFailed && t.Type == models.TransactionWithdrawal:
+		event.Type = models.EventWalletCredited
+	case t.Status == models.TransactionReversed && t.Type == models.TransactionDeposit:
+		event.Type = models.EventWalletDebited
+	case t.Status == models.TransactionReversed && t.Type == models.TransactionWithdrawal:
+		event.Type = models.EventWalletCredited
+	default:
+		return
+	}
+
+	if wallet, err := models.GetWalletBalance(t.WalletID); err == nil {
+		event.Balance = wallet.Balance
+	}
+	PublishWalletEvent(event)
+}
+
+// PublishReversalEvent publishes the balance change of a reversal
+func PublishReversalEvent(r *models.Reversal) {
+	event := models.WalletEvent{
+		ID:        r.ID,
+		Type:      models.EventWalletCredited,
+		UserID:    r.UserID,
+		WalletID:  r.WalletID,
+		Amount:    r.Amount,
+		Balance:   r.NewBalance,
+		Currency:  r.Currency,
+		Reference: r.ReversalLogID.String(),
+	}
+	if r.NewBalance < r.OldBalance {
+		event.Type = models.EventWalletDebited
+	}
+	PublishWalletEvent(event)
+}
+
+// PublishBalanceEvent publishes a credit or debit of a wallet
+func PublishBalanceEvent(eventType string, wallet *models.Wallet, userID uuid.UUID, amount int64) {
+	PublishWalletEvent(models.WalletEvent{
+		Type:     eventType,
+		UserID:   userID,
+		WalletID: wallet.ID,
+		Amount:   amount,
+		Balance:  wallet.Balance,
+		Currency: wallet.Currency,
+	})
+}
+
+// PublishTransferEvents publishes the debit of the sender and the credit of the receiver of a transfer
+func PublishTransferEvents(t *models.Transfer) {
+	PublishWalletEvent(models.WalletEvent{
+		ID:        uuid.NewSHA1(t.ID, []byte(models.EventWalletDebited)),
+		Type:      models.EventWalletDebited,
+		UserID:    t.FromUserID,
+		WalletID:  t.FromWalletID,
+		Amount:    t.Amount,
+		Balance:   t.FromBalance,
+		Currency:  t.Currency,
+		Reference: t.ID.String(),
+	})
+	PublishWalletEvent(models.WalletEvent{
+		ID:        uuid.NewSHA1(t.ID, []byte(models.EventWalletCredited)),
+		Type:      models.EventWalletCredited,
+		UserID:    t.ToUserID,
+		WalletID:  t.ToWalletID,
+		Amount:    t.Amount,
+		Balance:   t.ToBalance,
+		Currency:  t.Currency,
+		Reference: t.ID.String(),
+	})
+}
@@ -0,0 +1,116 @@
+package helpers
+
+import (
+	"context"
+	"github.com/emmadal/feeti-wallet/models"
+	"log"
+	"time"
+)
+
+// StartJobs starts the background jobs until the context is canceled
+func StartJobs(ctx context.Context) {
+	// Chain the logs written before the hash chain existed
+	go runJob("wallet_log_chain_backfill", models.ChainPendingWalletLogs)
+
+	go RunPeriodically(ctx, "compliance_report", time.Hour, generateDailyComplianceReports)
+	go RunPeriodically(ctx, "provider_status", time.Minute, pollProviderTransactions)
+	go RunPeriodically(ctx, "webhook_delivery", 10*time.Second, deliverWebhooks)
+	go RunPeriodically(ctx, "access_audit_retention", 24*time.Hour, purgeAccessAudits)
+	go RunPeriodically(ctx, "wallet_log_anchor", time.Hour, anchorWalletLogChains)
+	go RunPeriodically(ctx, "balance_snapshot", time.Hour, createDailyBalanceSnapshots)
+	go RunPeriodically(ctx, "reconciliation", time.Hour, reconcileNightly)
+	go RunPeriodically(ctx, "standing_orders", time.Minute, executeStandingOrders)
+	go RunPeriodically(ctx, "payment_request_expiry", time.Minute, expirePaymentRequests)
+	go RunPeriodically(ctx, "bill_split_reminder", time.Hour, remindBillSplits)
+	go RunPeriodically(ctx, "payouts", time.Minute, processPayouts)
+	go RunPeriodically(ctx, "organization_operations", 10*time.Second, executeOrganizationOperations)
+	go RunPeriodically(ctx, "agent_cash_out_expiry", time.Minute, expireAgentCashOuts)
+	go RunPeriodically(ctx, "agent_daily_summary", time.Hour, summarizeAgentDays)
+	go RunPeriodically(ctx, "commission_accrual", 5*time.Minute, accrueCommissions)
+	go RunPeriodically(ctx, "commission_payouts", time.Hour, payCommissions)
+}
+
+// RunPeriodically runs a job on every interval on a single replica at a time
+func RunPeriodically(ctx context.Context, name string, interval time.Duration, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		runJob(name, job)
+		select {
+		case <-ctx.Done():
+			log.Printf("Job %s stopped\n", name)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runJob runs a job once, holding the job lock
+func runJob(name string, job func() error) {
+	// Add recovery to prevent crashes
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic in job %s: %v\n", name, r)
+		}
+	}()
+
+	startTime := time.Now()
+	ran, err := models.RunExclusive(name, job)
+	if err != nil {
+		log.Printf("Job %s failed: %v\n", name, err)
+		return
+	}
+	if ran {
+		log.Printf("Job %s completed in %v\n", name, time.Since(startTime))
+	}
+}
+
+// generateDailyComplianceReports generates the reports of the previous day
+func generateDailyComplianceReports() error {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	from := to.AddDate(0, 0, -1)
+	config := models.DefaultReportConfig()
+
+	for _, format := range []string{models.ReportFormatCSV, models.ReportFormatXML} {
+		exists, err := models.ComplianceReportExists(from, to, format)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		report, err := models.GenerateComplianceReport(from, to, format, config)
+		if err != nil {
+			return err
+		}
+		log.Printf("Compliance report %s generated for %s with %d flags\n", report.ID, from.Format(time.DateOnly), report.FlagCount)
+	}
+	return nil
+}
+
+// snapshotBackfillDays bounds how far back missing daily snapshots are created
+const snapshotBackfillDays = 31
+
+// createDailyBalanceSnapshots snapshots every wallet at the missing day boundaries.
+// A boundary is only snapshotted once the transactions that started before it had time to commit.
+func createDailyBalanceSnapshots() error {
+	latest := time.Now().UTC().Add(-10 * time.Minute).Truncate(24 * time.Hour)
+	oldest := latest.AddDate(0, 0, -snapshotBackfillDays)
+
+	snapshotted, err := models.GetSnapshotDays(oldest)
+	if err != nil {
+		return err
+	}
+	for day := oldest; !day.After(latest); day = day.AddDate(0, 0, 1) {
+		if snapshotted[day] {
+			continue
+		}
+		created, err := models.CreateBalanceSnapshots(day)
+		if err != nil {
+			return err
+		}
+		log.Printf("Created %d balance snapshots at %s\n", created, day.Format(time.DateOnly))
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package helpers
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"github.com/emmadal/feeti-wallet/models"
+	"log"
+	"os"
+)
+
+// walletLogSigningKey loads the ed25519 key of WALLET_LOG_SIGNING_KEY, a base64 32-byte seed
+func walletLogSigningKey() (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(os.Getenv("WALLET_LOG_SIGNING_KEY"))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, models.ErrNoSigningKey
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// anchorWalletLogChains signs the current chain heads
+func anchorWalletLogChains() error {
+	key, err := walletLogSigningKey()
+	if errors.Is(err, models.ErrNoSigningKey) {
+		log.Println("Skipping wallet log anchor: WALLET_LOG_SIGNING_KEY not set")
+		return nil
+	}
+
+	anchor, err := models.CreateChainAnchor(key)
+	if err != nil {
+		return err
+	}
+	log.Printf("Wallet log anchor %s signed %d chain heads, digest %s\n", anchor.ID, len(anchor.Heads), anchor.Digest)
+	return nil
+}
@@ -0,0 +1,213 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/google/uuid"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// EMVCo merchant-presented QR tags
+const (
+	emvPayloadFormat   = "00"
+	emvInitiation      = "01"
+	emvMerchantAccount = "26" // Feeti template: 00 GUID, 01 merchant id, 02 wallet id
+	emvCategoryCode    = "52"
+	emvCurrency        = "53"
+	emvAmount          = "54"
+	emvCountryCode     = "58"
+	emvMerchantName    = "59"
+	emvMerchantCity    = "60"
+	emvAdditionalData  = "62" // 01 bill number (merchant reference), 05 reference label (dynamic code id)
+	emvCRC             = "63"
+
+	emvStatic  = "11"
+	emvDynamic = "12"
+
+	// merchantQRGUID identifies Feeti in the merchant account information template
+	merchantQRGUID = "com.feeti"
+)
+
+// emvCurrencies maps the wallet currencies to their ISO 4217 numeric codes
+var emvCurrencies = map[string]string{
+	"XAF": "950",
+	"XOF": "952",
+	"USD": "840",
+}
+
+// emvField encodes a tag, its two digit length and its value
+func emvField(tag, value string) string {
+	return fmt.Sprintf("%s%02d%s", tag, len(value), value)
+}
+
+// emvCRC16 is the CRC-16/CCITT-FALSE checksum of EMVCo QR codes
+func emvCRC16(data string) string {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return fmt.Sprintf("%04X", crc)
+}
+
+// EncodeMerchantQR sets the EMVCo payload of a merchant QR code
+func EncodeMerchantQR(qr *models.MerchantQR) error {
+	currency, ok := emvCurrencies[qr.Currency]
+	if !ok {
+		return fmt.Errorf("%w: unsupported currency %s", models.ErrInvalidMerchantQR, qr.Currency)
+	}
+
+	initiation := emvStatic
+	if qr.Dynamic {
+		initiation = emvDynamic
+	}
+	account := emvField("00", merchantQRGUID) + emvField("01", qr.MerchantID.String()) + emvField("02", qr.WalletID.String())
+
+	var b strings.Builder
+	b.WriteString(emvField(emvPayloadFormat, "01"))
+	b.WriteString(emvField(emvInitiation, initiation))
+	b.WriteString(emvField(emvMerchantAccount, account))
+	b.WriteString(emvField(emvCategoryCode, qr.CategoryCode))
+	b.WriteString(emvField(emvCurrency, currency))
+	if qr.Amount > 0 {
+		b.WriteString(emvField(emvAmount, strconv.FormatInt(qr.Amount, 10)))
+	}
+	b.WriteString(emvField(emvCountryCode, qr.CountryCode))
+	b.WriteString(emvField(emvMerchantName, qr.Name))
+	b.WriteString(emvField(emvMerchantCity, qr.City))
+
+	additional := ""
+	if qr.Reference != "" {
+		additional += emvField("01", qr.Reference)
+	}
+	if qr.Dynamic {
+		additional += emvField("05", qr.ID.String())
+	}
+	if additional != "" {
+		b.WriteString(emvField(emvAdditionalData, additional))
+	}
+
+	b.WriteString(emvCRC + "04")
+	qr.Payload = b.String() + emvCRC16(b.String())
+	return nil
+}
+
+// parseEMVFields splits a TLV string into its tags
+func parseEMVFields(data string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("%w: truncated field", models.ErrInvalidMerchantQR)
+		}
+		tag := data[:2]
+		length, err := strconv.Atoi(data[2:4])
+		if err != nil || len(data) < 4+length {
+			return nil, fmt.Errorf("%w: bad length of tag %s", models.ErrInvalidMerchantQR, tag)
+		}
+		if _, ok := fields[tag]; ok {
+			return nil, fmt.Errorf("%w: repeated tag %s", models.ErrInvalidMerchantQR, tag)
+		}
+		fields[tag] = data[4 : 4+length]
+		data = data[4+length:]
+	}
+	return fields, nil
+}
+
+// ParseMerchantQR validates the checksum and content of a scanned Feeti merchant QR payload
+func ParseMerchantQR(payload string) (*models.MerchantQR, error) {
+	payload = strings.TrimSpace(payload)
+	if len(payload) < 8 || payload[len(payload)-8:len(payload)-4] != emvCRC+"04" {
+		return nil, fmt.Errorf("%w: missing checksum", models.ErrInvalidMerchantQR)
+	}
+	if !strings.EqualFold(emvCRC16(payload[:len(payload)-4]), payload[len(payload)-4:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", models.ErrInvalidMerchantQR)
+	}
+	fields, err := parseEMVFields(payload)
+	if err != nil {
+		return nil, err
+	}
+	if fields[emvPayloadFormat] != "01" {
+		return nil, fmt.Errorf("%w: unsupported payload format", models.ErrInvalidMerchantQR)
+	}
+
+	account, err := parseEMVFields(fields[emvMerchantAccount])
+	if err != nil {
+		return nil, err
+	}
+	if account["00"] != merchantQRGUID {
+		return nil, fmt.Errorf("%w: not a Feeti merchant", models.ErrInvalidMerchantQR)
+	}
+	qr := &models.MerchantQR{
+		Name:         fields[emvMerchantName],
+		City:         fields[emvMerchantCity],
+		CategoryCode: fields[emvCategoryCode],
+		CountryCode:  fields[emvCountryCode],
+		Payload:      payload,
+	}
+	if qr.MerchantID, err = uuid.Parse(account["01"]); err != nil {
+		return nil, fmt.Errorf("%w: bad merchant id", models.ErrInvalidMerchantQR)
+	}
+	if qr.WalletID, err = uuid.Parse(account["02"]); err != nil {
+		return nil, fmt.Errorf("%w: bad wallet id", models.ErrInvalidMerchantQR)
+	}
+	for currency, code := range emvCurrencies {
+		if fields[emvCurrency] == code {
+			qr.Currency = currency
+		}
+	}
+	if qr.Currency == "" {
+		return nil, fmt.Errorf("%w: unsupported currency", models.ErrInvalidMerchantQR)
+	}
+
+	if raw, ok := fields[emvAmount]; ok {
+		// Amounts are whole units, "1500.00" is accepted from other generators
+		whole, fraction, _ := strings.Cut(raw, ".")
+		amount, err := strconv.ParseInt(whole, 10, 64)
+		if err != nil || amount <= 0 || strings.Trim(fraction, "0") != "" {
+			return nil, fmt.Errorf("%w: bad amount", models.ErrInvalidMerchantQR)
+		}
+		qr.Amount = amount
+	}
+
+	additional, err := parseEMVFields(fields[emvAdditionalData])
+	if err != nil {
+		return nil, err
+	}
+	qr.Reference = additional["01"]
+
+	switch fields[emvInitiation] {
+	case emvStatic:
+	case emvDynamic:
+		qr.Dynamic = true
+		if qr.ID, err = uuid.Parse(additional["05"]); err != nil || qr.Amount == 0 {
+			return nil, fmt.Errorf("%w: dynamic code without id or amount", models.ErrInvalidMerchantQR)
+		}
+	default:
+		return nil, fmt.Errorf("%w: bad point of initiation", models.ErrInvalidMerchantQR)
+	}
+	return qr, nil
+}
+
+// PublishMerchantPayment notifies the merchant, e.g. its point of sale, of a received payment
+func PublishMerchantPayment(payment *models.MerchantPayment) {
+	if nc == nil {
+		return
+	}
+	data, err := json.Marshal(payment)
+	if err != nil {
+		log.Printf("Error marshaling merchant payment: %v\n", err)
+		return
+	}
+	if err := nc.Publish(SubjectMerchantPaymentReceived, data); err != nil {
+		log.Printf("Failed to publish payment of merchant %s: %v\n", payment.MerchantID, err)
+	}
+}
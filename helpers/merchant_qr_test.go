@@ -0,0 +1,71 @@
+package helpers
+
+import (
+	"errors"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/google/uuid"
+	"strings"
+	"testing"
+)
+
+func TestEMVCRC16(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"empty", "", "FFFF"},
+		{"single byte", "A", "B915"},
+		{"check value", "123456789", "29B1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := emvCRC16(tt.data); got != tt.want {
+				t.Errorf("emvCRC16(%q) = %s, want %s", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerchantQRChecksum(t *testing.T) {
+	qr := &models.MerchantQR{
+		MerchantID:   uuid.New(),
+		WalletID:     uuid.New(),
+		Name:         "Shop",
+		City:         "Abidjan",
+		CategoryCode: "5411",
+		CountryCode:  "CI",
+		Currency:     "XOF",
+		Amount:       1500,
+	}
+	if err := EncodeMerchantQR(qr); err != nil {
+		t.Fatalf("EncodeMerchantQR: %v", err)
+	}
+	if _, err := ParseMerchantQR(qr.Payload); err != nil {
+		t.Fatalf("ParseMerchantQR() of an encoded payload: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"changed amount", strings.Replace(qr.Payload, "1500", "1600", 1)},
+		{"changed checksum digit", qr.Payload[:len(qr.Payload)-1] + flipHex(qr.Payload[len(qr.Payload)-1])},
+		{"missing checksum", qr.Payload[:len(qr.Payload)-8]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseMerchantQR(tt.payload); !errors.Is(err, models.ErrInvalidMerchantQR) {
+				t.Errorf("ParseMerchantQR() error = %v, want %v", err, models.ErrInvalidMerchantQR)
+			}
+		})
+	}
+}
+
+// flipHex returns another hexadecimal digit than c
+func flipHex(c byte) string {
+	if c == '0' {
+		return "1"
+	}
+	return "0"
+}
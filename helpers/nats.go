@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/emmadal/feeti-module/subject"
 	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 	"log"
@@ -92,7 +93,7 @@ func NatsConnect() error {
 		// Only start subscribers if everything is set up correctly
 		// Use a WaitGroup to track when all subscriptions are ready
 		var subWg sync.WaitGroup
-		subWg.Add(6) // We have 6 subscriptions
+		subWg.Add(10) // We have 10 subscriptions
 
 		go func() {
 			// Catch subscription panics to prevent goroutine crashes
@@ -112,12 +113,16 @@ func NatsConnect() error {
 			err4 := subscribeToCheckBalance(&subWg)
 			err5 := subscribeToDeposit(&subWg)
 			err6 := subscribeToWithdraw(&subWg)
+			err7 := subscribeToReverse(&subWg)
+			err8 := subscribeToTransactionStatus(&subWg)
+			err9 := subscribeToWalletEventsForWebhooks(&subWg)
+			err10 := subscribeToWalletEventsForStreams(&subWg)
 
 			// Wait for all subscriptions to be ready
 			subWg.Wait()
 
 			// Check for errors
-			for i, err := range []error{err1, err2, err3, err4, err5, err6} {
+			for i, err := range []error{err1, err2, err3, err4, err5, err6, err7, err8, err9, err10} {
 				if err != nil {
 					topic := ""
 					switch i {
@@ -133,6 +138,12 @@ func NatsConnect() error {
 						topic = subject.SubjectWalletDeposit
 					case 5:
 						topic = subject.SubjectWalletWithdraw
+					case 6:
+						topic = SubjectWalletReverse
+					case 7:
+						topic = SubjectWalletTransactionStatus
+					case 8, 9:
+						topic = SubjectWalletEvents + ".>"
 					}
 					log.Printf("Failed to subscribe to %s: %v\n", topic, err)
 				}
@@ -326,7 +337,7 @@ func subscribeToDisableWallet(wg *sync.WaitGroup) error {
 
 		// Create a wallet with a retry mechanism
 		wallet := models.Wallet{UserID: request.UserID}
-		err := wallet.DeleteWallet()
+		walletIDs, err := wallet.DeleteWallet()
 		if err != nil {
 			log.Printf("Failed to disable wallet for user id [%s]: %v\n", request.UserID, err)
 			sendResponse(msg, ResponsePayload{
@@ -336,6 +347,9 @@ func subscribeToDisableWallet(wg *sync.WaitGroup) error {
 			return
 		}
 		log.Printf("Wallet for user id [%s] disabled successfully in %v\n", request.UserID, time.Since(startTime))
+		for _, walletID := range walletIDs {
+			PublishWalletEvent(models.WalletEvent{Type: models.EventWalletDisabled, UserID: request.UserID, WalletID: walletID})
+		}
 
 		// Send success response
 		sendResponse(msg, ResponsePayload{
@@ -547,6 +561,7 @@ func subscribeToDeposit(wg *sync.WaitGroup) error {
 			})
 			return
 		}
+		PublishBalanceEvent(models.EventWalletCredited, wallet, p.UserID, p.Balance)
 
 		// Send success response
 		sendResponse(msg, ResponsePayload{
@@ -614,6 +629,7 @@ func subscribeToWithdraw(wg *sync.WaitGroup) error {
 			return
 		}
 		log.Printf("Withdraw processed successfully in %v\n", time.Since(startTime))
+		PublishBalanceEvent(models.EventWalletDebited, wallet, p.UserID, p.Balance)
 
 		// Send success response
 		sendResponse(msg, ResponsePayload{
@@ -637,6 +653,147 @@ func subscribeToWithdraw(wg *sync.WaitGroup) error {
 	return nil
 }
 
+// subscribeToReverse refunds all or part of a wallet log
+func subscribeToReverse(wg *sync.WaitGroup) error {
+	defer wg.Done()
+	// Subscribe to the "wallet.reverse" subject
+	sub, err := nc.Subscribe(SubjectWalletReverse, func(msg *nats.Msg) {
+		startTime := time.Now()
+		log.Printf("Received message [%s] on subject %s\n", string(msg.Data), msg.Subject)
+
+		// Add recovery to prevent crashes
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Recovered from panic in wallet.reverse handler: %v\n", r)
+				sendResponse(msg, ResponsePayload{
+					Success: false,
+					Error:   fmt.Sprintf("Internal server error: %v", r),
+				})
+			}
+		}()
+
+		// Parse the message payload
+		var p models.ReversalRequest
+		if err := json.Unmarshal(msg.Data, &p); err != nil {
+			log.Printf("Unable to unmarshal payload: %v\n", err)
+			sendResponse(msg, ResponsePayload{
+				Success: false,
+				Error:   "Unable to unmarshal payload",
+			})
+			return
+		}
+
+		// Same rules as the HTTP route
+		if err := binding.Validator.ValidateStruct(&p); err != nil {
+			log.Printf("Invalid reversal request: %v\n", err)
+			sendResponse(msg, ResponsePayload{
+				Success: false,
+				Error:   fmt.Sprintf("Invalid request: %v", err),
+			})
+			return
+		}
+
+		// Reverse the wallet log
+		reversal, err := p.ReverseWalletLog("payment-service")
+		if err != nil {
+			log.Printf("Failed to reverse wallet log [%s]: %v\n", p.LogID, err)
+			sendResponse(msg, ResponsePayload{
+				Success: false,
+				Error:   fmt.Sprintf("Failed to reverse wallet log: %v", err),
+			})
+			return
+		}
+		log.Printf("Reversal processed successfully in %v\n", time.Since(startTime))
+		PublishReversalEvent(reversal)
+
+		// Send success response
+		sendResponse(msg, ResponsePayload{
+			Success: true,
+			Data:    reversal,
+		})
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to wallet.reverse: %w", err)
+	}
+
+	// Keep subscription active - don't auto-unsubscribe
+	if err := sub.SetPendingLimits(-1, -1); err != nil {
+		log.Printf("Failed to set pending limits for wallet.reverse: %v\n", err)
+	}
+
+	// Register this subscription for cleanup
+	RegisterSubscription(sub)
+
+	return nil
+}
+
+// subscribeToTransactionStatus applies the final status of an asynchronous transaction
+func subscribeToTransactionStatus(wg *sync.WaitGroup) error {
+	defer wg.Done()
+	// Subscribe to the "wallet.transaction.status" subject
+	sub, err := nc.Subscribe(SubjectWalletTransactionStatus, func(msg *nats.Msg) {
+		startTime := time.Now()
+		log.Printf("Received message [%s] on subject %s\n", string(msg.Data), msg.Subject)
+
+		// Add recovery to prevent crashes
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Recovered from panic in wallet.transaction.status handler: %v\n", r)
+				sendResponse(msg, ResponsePayload{
+					Success: false,
+					Error:   fmt.Sprintf("Internal server error: %v", r),
+				})
+			}
+		}()
+
+		// Parse the message payload
+		var p models.TransactionStatusRequest
+		err := json.Unmarshal(msg.Data, &p)
+		if err != nil || p.TransactionID == uuid.Nil || p.Status == "" {
+			log.Printf("Unable to unmarshal payload: %v\n", err)
+			sendResponse(msg, ResponsePayload{
+				Success: false,
+				Error:   "Unable to unmarshal payload",
+			})
+			return
+		}
+
+		// Update the transaction status
+		transaction, err := p.UpdateStatus()
+		if err != nil {
+			log.Printf("Failed to update transaction [%s]: %v\n", p.TransactionID, err)
+			sendResponse(msg, ResponsePayload{
+				Success: false,
+				Error:   fmt.Sprintf("Failed to update transaction: %v", err),
+			})
+			return
+		}
+		log.Printf("Transaction status updated successfully in %v\n", time.Since(startTime))
+		PublishTransactionEvent(transaction)
+
+		// Send success response
+		sendResponse(msg, ResponsePayload{
+			Success: true,
+			Data:    transaction,
+		})
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to wallet.transaction.status: %w", err)
+	}
+
+	// Keep subscription active - don't auto-unsubscribe
+	if err := sub.SetPendingLimits(-1, -1); err != nil {
+		log.Printf("Failed to set pending limits for wallet.transaction.status: %v\n", err)
+	}
+
+	// Register this subscription for cleanup
+	RegisterSubscription(sub)
+
+	return nil
+}
+
 // sendResponse sends a structured response to the NATS message
 func sendResponse(msg *nats.Msg, payload ResponsePayload) {
 	// If there's no reply subject, we can't respond
@@ -0,0 +1,87 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/emmadal/feeti-wallet/providers"
+	"log"
+	"strings"
+	"sync"
+)
+
+// organizationWorkers bounds the withdrawals sent to the providers at the same time
+const organizationWorkers = 4
+
+// executeOrganizationOperations claims the approved organization operations and sends them to their provider
+// concurrently, so a slow provider does not hold back the other operations
+func executeOrganizationOperations() error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	workers := make(chan struct{}, organizationWorkers)
+	for {
+		workers <- struct{}{}
+		operation, err := models.ClaimApprovedOperation()
+		if err != nil || operation == nil {
+			<-workers
+			return err
+		}
+		if operation.Status != models.OperationExecuting {
+			<-workers
+			PublishOrganizationOperation(operation)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			transaction, err := executeOrganizationOperation(operation)
+			if err == nil {
+				err = operation.CompleteOperation(transaction)
+			}
+			if err != nil {
+				// Claimed again once its lease expires
+				log.Printf("Failed to execute organization operation %s: %v\n", operation.ID, err)
+				return
+			}
+			PublishOrganizationOperation(operation)
+		}()
+	}
+}
+
+// executeOrganizationOperation sends the withdrawal held for a claimed operation to its provider.
+// A withdrawal already sent by a previous run is left to the provider poller.
+func executeOrganizationOperation(o *models.OrganizationOperation) (*models.Transaction, error) {
+	t := models.Transaction{ID: *o.TransactionID}
+	transaction, err := t.GetTransaction()
+	if err != nil {
+		return nil, err
+	}
+	if transaction.Status != models.TransactionPending || transaction.ProviderReference != "" {
+		return transaction, nil
+	}
+
+	provider, err := providers.Get(transaction.Provider)
+	if err != nil {
+		return failPayment(transaction, err)
+	}
+	return initiatePayment(provider, transaction, providers.CashOut, o.PhoneNumber)
+}
+
+// PublishOrganizationOperation notifies the members of an operation change on
+// wallet.organization.operation.<pending|approved|rejected|canceled|executed|failed>
+func PublishOrganizationOperation(o *models.OrganizationOperation) {
+	if nc == nil {
+		return
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		log.Printf("Error marshaling organization operation: %v\n", err)
+		return
+	}
+	if err := nc.Publish(SubjectOrganizationOperation+"."+strings.ToLower(o.Status), data); err != nil {
+		log.Printf("Failed to publish organization operation %s: %v\n", o.ID, err)
+	}
+}
@@ -0,0 +1,44 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/emmadal/feeti-wallet/models"
+	"log"
+	"strings"
+	"time"
+)
+
+// PublishPaymentRequestEvent notifies a payment request change on wallet.request.<created|accepted|declined|expired|canceled>
+func PublishPaymentRequestEvent(r *models.PaymentRequest) {
+	if nc == nil {
+		return
+	}
+	event := strings.ToLower(r.Status)
+	if r.Status == models.PaymentRequestPending {
+		event = "created"
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("Error marshaling payment request: %v\n", err)
+		return
+	}
+	if err := nc.Publish(SubjectPaymentRequest+"."+event, data); err != nil {
+		log.Printf("Failed to publish payment request %s: %v\n", r.ID, err)
+	}
+}
+
+// expirePaymentRequests expires the unanswered payment requests and notifies both users
+func expirePaymentRequests() error {
+	expired, err := models.ExpirePaymentRequests(time.Now())
+	if err != nil {
+		return err
+	}
+	for i := range expired {
+		PublishPaymentRequestEvent(&expired[i])
+	}
+	if len(expired) > 0 {
+		log.Printf("Expired %d payment requests\n", len(expired))
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/emmadal/feeti-wallet/providers"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"time"
+)
+
+// providerTimeout bounds every call to a payment provider
+const providerTimeout = 20 * time.Second
+
+// providerLostAfter is the age after which a payment the provider does not know is failed
+const providerLostAfter = 15 * time.Minute
+
+// LoadProviders registers the payment providers configured in the environment
+func LoadProviders() {
+	providers.LoadFromEnv(func(provider string, result providers.PaymentResult) {
+		if _, err := ApplyProviderResult(provider, result); err != nil {
+			log.Printf("Failed to apply %s result for %s: %v\n", provider, result.Reference, err)
+		}
+	})
+}
+
+// InitiateDeposit creates a pending deposit and starts the cash-in at the provider
+func InitiateDeposit(t models.Transaction, phoneNumber string) (*models.Transaction, error) {
+	provider, err := providers.Get(t.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction, err := t.CreateDeposit()
+	if err != nil {
+		return nil, err
+	}
+	return initiatePayment(provider, transaction, providers.CashIn, phoneNumber)
+}
+
+// InitiateWithdrawal holds the funds and starts the cash-out at the provider
+func InitiateWithdrawal(t models.Transaction, phoneNumber string) (*models.Transaction, error) {
+	provider, err := providers.Get(t.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction, err := t.CreateWithdrawal()
+	if err != nil {
+		return nil, err
+	}
+	transaction.PreviousStatus = ""
+	PublishTransactionEvent(transaction)
+
+	return initiatePayment(provider, transaction, providers.CashOut, phoneNumber)
+}
+
+// initiatePayment sends the payment to the provider and records the outcome
+func initiatePayment(provider providers.Provider, t *models.Transaction, direction, phoneNumber string) (*models.Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+
+	req := providers.PaymentRequest{
+		TransactionID: t.ID,
+		Direction:     direction,
+		Amount:        t.Amount,
+		Currency:      t.Currency,
+		PhoneNumber:   phoneNumber,
+		Description:   "Feeti wallet " + t.Type,
+	}
+
+	// Store the provider reference first, so the poller finds the payment whatever happens next
+	reference, err := provider.Prepare(ctx, req)
+	if err == nil {
+		err = models.SetProviderReference(t.ID, reference)
+	}
+	if err != nil {
+		// Nothing was sent, release any held funds
+		log.Printf("Failed to prepare %s at %s: %v\n", t.ID, provider.Name(), err)
+		return failPayment(t, err)
+	}
+	t.ProviderReference = reference
+	req.Reference = reference
+
+	result, err := provider.Initiate(ctx, req)
+	if providers.IsRejected(err) {
+		// The provider refused the payment, release any held funds
+		log.Printf("Provider %s rejected %s: %v\n", provider.Name(), t.ID, err)
+		return failPayment(t, err)
+	}
+	if err != nil {
+		// The payment may have been made, the poller resolves it from the provider status
+		log.Printf("Unknown outcome of %s at %s, left pending: %v\n", t.ID, provider.Name(), err)
+		return t, nil
+	}
+	return applyResult(t, *result)
+}
+
+// failPayment fails a transaction the provider did not pay
+func failPayment(t *models.Transaction, cause error) (*models.Transaction, error) {
+	r := models.TransactionStatusRequest{TransactionID: t.ID, Status: models.TransactionFailed, Reason: cause.Error()}
+	failed, err := r.UpdateStatus()
+	if err != nil {
+		return nil, err
+	}
+	PublishTransactionEvent(failed)
+	return failed, nil
+}
+
+// ApplyProviderResult applies a provider status to the matching transaction
+func ApplyProviderResult(provider string, result providers.PaymentResult) (*models.Transaction, error) {
+	t, err := models.GetTransactionByProviderReference(provider, result.Reference)
+	if errors.Is(err, pgx.ErrNoRows) && result.ExternalID != "" {
+		// Some providers only echo our transaction id
+		id, parseErr := uuid.Parse(result.ExternalID)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		byID := models.Transaction{ID: id}
+		t, err = byID.GetTransaction()
+		if err == nil && t.Provider != provider {
+			return nil, pgx.ErrNoRows
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return applyResult(t, result)
+}
+
+// applyResult maps a provider status to a transaction status
+func applyResult(t *models.Transaction, result providers.PaymentResult) (*models.Transaction, error) {
+	r := models.TransactionStatusRequest{
+		TransactionID:     t.ID,
+		ProviderReference: result.Reference,
+		Reason:            result.Reason,
+	}
+	switch result.Status {
+	case providers.StatusSuccessful:
+		r.Status = models.TransactionCompleted
+	case providers.StatusFailed:
+		r.Status = models.TransactionFailed
+	default:
+		r.Status = models.TransactionProcessing
+	}
+
+	// A late pending status must not move a settled transaction back
+	if r.Status == models.TransactionProcessing && t.Status != models.TransactionPending {
+		return t, nil
+	}
+
+	updated, err := r.UpdateStatus()
+	if err != nil {
+		return nil, err
+	}
+	PublishTransactionEvent(updated)
+	return updated, nil
+}
+
+// pollProviderTransactions refreshes in-flight transactions from their provider
+func pollProviderTransactions() error {
+	transactions, err := models.GetInFlightTransactions(time.Now().Add(-time.Minute), 100)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range transactions {
+		provider, err := providers.Get(t.Provider)
+		if err != nil {
+			log.Printf("Skipping transaction %s: %v\n", t.ID, err)
+			continue
+		}
+
+		direction := providers.CashIn
+		if t.Type == models.TransactionWithdrawal {
+			direction = providers.CashOut
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+		result, err := provider.Status(ctx, direction, t.ProviderReference)
+		cancel()
+		if providers.IsNotFound(err) && time.Since(t.CreatedAt) > providerLostAfter {
+			// The payment never reached the provider
+			if _, err := failPayment(&t, err); err != nil {
+				log.Printf("Failed to update transaction %s: %v\n", t.ID, err)
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to get %s status of transaction %s: %v\n", t.Provider, t.ID, err)
+			continue
+		}
+		if _, err := applyResult(&t, *result); err != nil {
+			log.Printf("Failed to update transaction %s: %v\n", t.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/google/uuid"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// payoutBatch bounds the payout lines paid on each tick
+const payoutBatch = 1000
+
+// PayoutFees returns the fee of a payout line from PAYOUT_FEE_FIXED and PAYOUT_FEE_BPS,
+// credited to PAYOUT_FEE_WALLET_ID. Payouts are free without a fee wallet.
+func PayoutFees() models.PayoutFees {
+	fees := models.PayoutFees{}
+	walletID, err := uuid.Parse(os.Getenv("PAYOUT_FEE_WALLET_ID"))
+	if err != nil {
+		return fees
+	}
+	fees.WalletID = walletID
+	if fixed, err := strconv.ParseInt(os.Getenv("PAYOUT_FEE_FIXED"), 10, 64); err == nil && fixed > 0 {
+		fees.Fixed = fixed
+	}
+	if bps, err := strconv.ParseInt(os.Getenv("PAYOUT_FEE_BPS"), 10, 64); err == nil && bps > 0 {
+		fees.BPS = bps
+	}
+	return fees
+}
+
+// ProcessPayoutsNow pays the queued payout lines without waiting for the next tick, e.g. after a confirmation
+func ProcessPayoutsNow() {
+	go runJob("payouts", processPayouts)
+}
+
+// processPayouts pays the queued payout lines and notifies the finished batches.
+// It stops after a pass where every line failed, those lines are retried on the next tick.
+func processPayouts() error {
+	feeWalletID := PayoutFees().WalletID
+	for {
+		pending, err := models.GetPendingPayoutLines(payoutBatch)
+		if err != nil {
+			return err
+		}
+		progress := false
+		for _, lineID := range pending {
+			line, transfers, batch, err := models.ExecutePayoutLine(lineID, feeWalletID)
+			if err != nil {
+				log.Printf("Error paying payout line %s: %v\n", lineID, err)
+				continue
+			}
+			progress = true
+			if line == nil {
+				continue
+			}
+			for _, transfer := range transfers {
+				PublishTransferEvents(transfer)
+			}
+			if batch != nil {
+				PublishPayoutBatchEvent(batch)
+			}
+		}
+		if len(pending) < payoutBatch || !progress {
+			return nil
+		}
+	}
+}
+
+// PublishPayoutBatchEvent notifies the owner of a batch on wallet.payout.<processing|completed|partial|failed|canceled>
+func PublishPayoutBatchEvent(b *models.PayoutBatch) {
+	if nc == nil {
+		return
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		log.Printf("Error marshaling payout batch: %v\n", err)
+		return
+	}
+	if err := nc.Publish(SubjectPayout+"."+strings.ToLower(b.Status), data); err != nil {
+		log.Printf("Failed to publish payout batch %s: %v\n", b.ID, err)
+	}
+}
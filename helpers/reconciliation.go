@@ -0,0 +1,86 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// reconcileRecheckDelay lets in-flight log writes land before a mismatch of the nightly run is confirmed
+const reconcileRecheckDelay = 5 * time.Second
+
+// ReconcileWallets recomputes the wallets from their history, or a single one when walletID is set.
+// Every balance change writes its log in the same transaction, so a single snapshot is consistent.
+// With a recheck delay, the mismatches are checked again after it and only the confirmed ones are kept.
+// The mismatches are recorded and published.
+func ReconcileWallets(walletID uuid.UUID, recheckDelay time.Duration) (*models.ReconciliationRun, error) {
+	run := &models.ReconciliationRun{StartedAt: time.Now()}
+	if walletID != uuid.Nil {
+		run.WalletID = &walletID
+	}
+
+	checked, suspects, err := models.CheckWalletBalances(walletID)
+	if err != nil {
+		return nil, err
+	}
+	run.WalletsChecked = checked
+
+	run.Discrepancies = suspects
+	if recheckDelay > 0 && len(suspects) > 0 {
+		time.Sleep(recheckDelay)
+		confirmed := make([]models.WalletDiscrepancy, 0, len(suspects))
+		for _, suspect := range suspects {
+			_, still, err := models.CheckWalletBalances(suspect.WalletID)
+			if err != nil {
+				return nil, err
+			}
+			confirmed = append(confirmed, still...)
+		}
+		run.Discrepancies = confirmed
+	}
+	run.FinishedAt = time.Now()
+
+	if err := run.CreateReconciliationRun(); err != nil {
+		return nil, err
+	}
+	for _, d := range run.Discrepancies {
+		log.Printf(
+			"Wallet %s does not reconcile: balance %d expected %d, held %d expected %d\n",
+			d.WalletID, d.StoredBalance, d.ExpectedBalance, d.StoredHeld, d.ExpectedHeld,
+		)
+		publishDiscrepancy(d)
+	}
+	return run, nil
+}
+
+// publishDiscrepancy raises a reconciliation discrepancy for alerting
+func publishDiscrepancy(d models.WalletDiscrepancy) {
+	if nc == nil {
+		return
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		log.Printf("Error marshaling discrepancy: %v\n", err)
+		return
+	}
+	if err := nc.Publish(SubjectWalletReconciliationDiscrepancy, data); err != nil {
+		log.Printf("Failed to publish discrepancy of wallet %s: %v\n", d.WalletID, err)
+	}
+}
+
+// reconcileNightly runs the full reconciliation once a day
+func reconcileNightly() error {
+	exists, err := models.FullReconciliationSince(time.Now().UTC().Truncate(24 * time.Hour))
+	if err != nil || exists {
+		return err
+	}
+
+	run, err := ReconcileWallets(uuid.Nil, reconcileRecheckDelay)
+	if err != nil {
+		return err
+	}
+	log.Printf("Reconciliation %s checked %d wallets, %d discrepancies\n", run.ID, run.WalletsChecked, len(run.Discrepancies))
+	return nil
+}
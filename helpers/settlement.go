@@ -0,0 +1,46 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/emmadal/feeti-wallet/providers"
+	"time"
+)
+
+// ImportSettlementFile parses a provider settlement file with the provider layout and reconciles it
+func ImportSettlementFile(provider string, date time.Time, filename string, content []byte, importedBy string) (*models.SettlementImport, error) {
+	layout, err := providers.SettlementLayoutFor(provider)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := providers.ParseSettlementFile(bytes.NewReader(content), layout)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]models.SettlementLine, 0, len(parsed))
+	for _, line := range parsed {
+		lines = append(lines, models.SettlementLine{
+			Line:       line.Line,
+			Reference:  line.Reference,
+			ExternalID: line.ExternalID,
+			Amount:     line.Amount,
+			Currency:   line.Currency,
+		})
+	}
+
+	checksum := sha256.Sum256(content)
+	settlement := &models.SettlementImport{
+		Provider:       provider,
+		SettlementDate: date,
+		Filename:       filename,
+		Checksum:       hex.EncodeToString(checksum[:]),
+		ImportedBy:     importedBy,
+	}
+	if err := settlement.ReconcileSettlement(lines); err != nil {
+		return nil, err
+	}
+	return settlement, nil
+}
@@ -0,0 +1,80 @@
+package helpers
+
+import (
+	"encoding/json"
+	"github.com/emmadal/feeti-wallet/models"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// standingOrderBatch bounds the orders executed on each tick
+const standingOrderBatch = 500
+
+// standingOrderRetryInterval returns the delay between two tries of an occurrence, from STANDING_ORDER_RETRY_INTERVAL
+func standingOrderRetryInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("STANDING_ORDER_RETRY_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = time.Hour
+	}
+	return interval
+}
+
+// standingOrderMaxAttempts returns how many times an occurrence is tried, from STANDING_ORDER_MAX_ATTEMPTS
+func standingOrderMaxAttempts() int {
+	attempts, err := strconv.Atoi(os.Getenv("STANDING_ORDER_MAX_ATTEMPTS"))
+	if err != nil || attempts <= 0 {
+		attempts = 4
+	}
+	return attempts
+}
+
+// executeStandingOrders executes the due standing orders and notifies their outcome
+func executeStandingOrders() error {
+	now := time.Now()
+	retryInterval, maxAttempts := standingOrderRetryInterval(), standingOrderMaxAttempts()
+
+	due, err := models.GetDueStandingOrders(now, standingOrderBatch)
+	if err != nil {
+		return err
+	}
+	for _, orderID := range due {
+		run, transfer, err := models.ExecuteStandingOrder(orderID, now, retryInterval, maxAttempts)
+		if err != nil {
+			log.Printf("Error executing standing order %s: %v\n", orderID, err)
+			continue
+		}
+		if run == nil {
+			continue
+		}
+		if transfer != nil {
+			PublishTransferEvents(transfer)
+		}
+		publishStandingOrderRun(run)
+	}
+	return nil
+}
+
+// publishStandingOrderRun notifies the outcome of a standing order occurrence
+func publishStandingOrderRun(run *models.StandingOrderRun) {
+	if nc == nil {
+		return
+	}
+	subject := SubjectStandingOrderSucceeded
+	switch run.Status {
+	case models.StandingOrderRunRetrying:
+		subject = SubjectStandingOrderRetrying
+	case models.StandingOrderRunFailed:
+		subject = SubjectStandingOrderFailed
+	}
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		log.Printf("Error marshaling standing order run: %v\n", err)
+		return
+	}
+	if err := nc.Publish(subject, data); err != nil {
+		log.Printf("Failed to publish run of standing order %s: %v\n", run.OrderID, err)
+	}
+}
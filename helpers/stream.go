@@ -0,0 +1,109 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"log"
+	"sync"
+)
+
+// streamBufferSize bounds the events queued for a slow stream client
+const streamBufferSize = 16
+
+// walletStreams fans out wallet events to the stream clients of this replica
+var walletStreams = struct {
+	mu      sync.RWMutex
+	clients map[uuid.UUID]map[chan models.WalletEvent]struct{}
+}{clients: make(map[uuid.UUID]map[chan models.WalletEvent]struct{})}
+
+// SubscribeWalletStream registers a stream client for the events of a user.
+// The returned function must be called when the client disconnects.
+func SubscribeWalletStream(userID uuid.UUID) (<-chan models.WalletEvent, func()) {
+	ch := make(chan models.WalletEvent, streamBufferSize)
+
+	walletStreams.mu.Lock()
+	if walletStreams.clients[userID] == nil {
+		walletStreams.clients[userID] = make(map[chan models.WalletEvent]struct{})
+	}
+	walletStreams.clients[userID][ch] = struct{}{}
+	walletStreams.mu.Unlock()
+
+	return ch, func() {
+		walletStreams.mu.Lock()
+		defer walletStreams.mu.Unlock()
+		delete(walletStreams.clients[userID], ch)
+		if len(walletStreams.clients[userID]) == 0 {
+			delete(walletStreams.clients, userID)
+		}
+	}
+}
+
+// dispatchWalletEvent sends an event to the stream clients of its user without blocking
+func dispatchWalletEvent(event models.WalletEvent) {
+	walletStreams.mu.RLock()
+	defer walletStreams.mu.RUnlock()
+
+	for ch := range walletStreams.clients[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			// The client is too slow, it gets a fresh snapshot when it reconnects
+			log.Printf("Dropping wallet event %s for a slow stream client\n", event.ID)
+		}
+	}
+}
+
+// subscribeToWalletEventsForStreams forwards wallet events to the local stream clients.
+// There is no queue group: every replica receives every event for its own clients.
+func subscribeToWalletEventsForStreams(wg *sync.WaitGroup) error {
+	defer wg.Done()
+	// Subscribe to the "wallet.events.>" subjects
+	sub, err := nc.Subscribe(SubjectWalletEvents+".>", func(msg *nats.Msg) {
+		// Add recovery to prevent crashes
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Recovered from panic in wallet.events stream handler: %v\n", r)
+			}
+		}()
+
+		var event models.WalletEvent
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			log.Printf("Unable to unmarshal wallet event: %v\n", err)
+			return
+		}
+		dispatchWalletEvent(event)
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to wallet.events: %w", err)
+	}
+
+	// Keep subscription active - don't auto-unsubscribe
+	if err := sub.SetPendingLimits(-1, -1); err != nil {
+		log.Printf("Failed to set pending limits for wallet.events: %v\n", err)
+	}
+
+	// Register this subscription for cleanup
+	RegisterSubscription(sub)
+
+	return nil
+}
+
+// UnlessPath skips a middleware on the given routes, e.g. a response timeout on streams
+func UnlessPath(middleware gin.HandlerFunc, paths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		skip[p] = true
+	}
+	return func(c *gin.Context) {
+		if skip[c.FullPath()] {
+			c.Next()
+			return
+		}
+		middleware(c)
+	}
+}
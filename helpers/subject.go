@@ -0,0 +1,53 @@
+package helpers
+
+// Wallet subjects handled by this service in addition to feeti-module/subject
+const (
+	SubjectWalletReverse           = "wallet.reverse"
+	SubjectWalletTransactionStatus = "wallet.transaction.status"
+	SubjectWalletEvents            = "wallet.events"
+
+	// SubjectWalletReconciliationDiscrepancy is published for every wallet that does not reconcile
+	SubjectWalletReconciliationDiscrepancy = "wallet.reconciliation.discrepancy"
+
+	// Standing order runs, for the notification service
+	SubjectStandingOrderSucceeded = "wallet.standing_order.succeeded"
+	SubjectStandingOrderRetrying  = "wallet.standing_order.retrying"
+	SubjectStandingOrderFailed    = "wallet.standing_order.failed"
+
+	// SubjectPaymentRequest prefixes the payment request events, e.g. wallet.request.accepted
+	SubjectPaymentRequest = "wallet.request"
+
+	// Bill split events
+	SubjectBillSplitCreated  = "wallet.split.created"
+	SubjectBillSplitPaid     = "wallet.split.paid" // a share was paid
+	SubjectBillSplitSettled  = "wallet.split.settled"
+	SubjectBillSplitCanceled = "wallet.split.canceled"
+	SubjectBillSplitReminder = "wallet.split.reminder" // a participant still owes a share
+
+	// SubjectMerchantPaymentReceived is published for every payment of a merchant QR code
+	SubjectMerchantPaymentReceived = "wallet.merchant.paid"
+
+	// SubjectEscrow prefixes the escrow events, e.g. wallet.escrow.released
+	SubjectEscrow = "wallet.escrow"
+
+	// SubjectDispute prefixes the dispute events, e.g. wallet.dispute.opened
+	SubjectDispute = "wallet.dispute"
+
+	// SubjectPayout prefixes the payout batch events, e.g. wallet.payout.completed
+	SubjectPayout = "wallet.payout"
+
+	// SubjectOrganizationOperation prefixes the organization operation events, e.g. wallet.organization.operation.approved
+	SubjectOrganizationOperation = "wallet.organization.operation"
+
+	// SubjectDependentInvitation prefixes the dependent invitation events, e.g. wallet.dependent.invitation.pending
+	SubjectDependentInvitation = "wallet.dependent.invitation"
+
+	// Agent network events
+	SubjectAgent           = "wallet.agent" // prefixes the operations, e.g. wallet.agent.cash_in.completed
+	SubjectAgentCashOutOTP = "wallet.agent.cash_out.otp"
+	SubjectAgentFloatLow   = "wallet.agent.float_low"
+	SubjectAgentSummary    = "wallet.agent.summary"
+
+	// SubjectCommissionPaid is published with the statement of every commission payout
+	SubjectCommissionPaid = "wallet.commission.paid"
+)
@@ -0,0 +1,96 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	status "github.com/emmadal/feeti-module/status"
+	"github.com/gin-gonic/gin"
+)
+
+// Webhook signature headers
+const (
+	SignatureHeader = "X-Feeti-Signature"
+	TimestampHeader = "X-Feeti-Timestamp"
+)
+
+// Gin context keys set by VerifyProviderSignature
+const (
+	WebhookBodyKey      = "webhook_body"
+	WebhookSignatureKey = "webhook_signature"
+)
+
+// maxWebhookBody bounds the size of a callback body
+const maxWebhookBody = 1 << 20 // 1 MB
+
+// webhookTolerance returns the accepted clock skew of a signed callback
+func webhookTolerance() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("WEBHOOK_TOLERANCE")); err == nil && d > 0 {
+		return d
+	}
+	return 5 * time.Minute
+}
+
+// providerSecret returns the HMAC secret of a provider, e.g. WEBHOOK_SECRET_MTN_MOMO
+func providerSecret(provider string) []byte {
+	return []byte(os.Getenv("WEBHOOK_SECRET_" + strings.ToUpper(provider)))
+}
+
+// SignPayload returns the hex HMAC-SHA256 of "timestamp.body"
+func SignPayload(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyProviderSignature checks the HMAC signature and timestamp of a provider callback.
+// The raw body and signature are stored in the context for the handler.
+func VerifyProviderSignature() gin.HandlerFunc {
+	tolerance := webhookTolerance()
+	return func(c *gin.Context) {
+		secret := providerSecret(c.Param("provider"))
+		if len(secret) == 0 {
+			status.HandleError(c, http.StatusNotFound, "unknown provider", nil)
+			c.Abort()
+			return
+		}
+
+		// Reject callbacks outside the tolerance window to stop replays
+		timestamp := c.GetHeader(TimestampHeader)
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || math.Abs(time.Since(time.Unix(seconds, 0)).Seconds()) > tolerance.Seconds() {
+			status.HandleError(c, http.StatusUnauthorized, "invalid timestamp", err)
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+		if err != nil {
+			status.HandleError(c, http.StatusBadRequest, "invalid request", err)
+			c.Abort()
+			return
+		}
+
+		signature := c.GetHeader(SignatureHeader)
+		expected := SignPayload(secret, timestamp, body)
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			status.HandleError(c, http.StatusUnauthorized, "invalid signature", nil)
+			c.Abort()
+			return
+		}
+
+		c.Set(WebhookBodyKey, body)
+		c.Set(WebhookSignatureKey, signature)
+		c.Next()
+	}
+}
@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/emmadal/feeti-wallet/models"
+	"github.com/nats-io/nats.go"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Outbound webhook retry policy
+const (
+	webhookMaxAttempts = 8
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+)
+
+// Outbound webhook headers
+const (
+	EventHeader    = "X-Feeti-Event"
+	DeliveryHeader = "X-Feeti-Delivery"
+)
+
+// webhookClient sends the partner deliveries
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// subscribeToWalletEventsForWebhooks turns wallet events into partner deliveries.
+// The queue group makes a single replica enqueue each event.
+func subscribeToWalletEventsForWebhooks(wg *sync.WaitGroup) error {
+	defer wg.Done()
+	// Subscribe to the "wallet.events.>" subjects
+	sub, err := nc.QueueSubscribe(SubjectWalletEvents+".>", "wallet-webhooks", func(msg *nats.Msg) {
+		// Add recovery to prevent crashes
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Recovered from panic in wallet.events handler: %v\n", r)
+			}
+		}()
+
+		var event models.WalletEvent
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			log.Printf("Unable to unmarshal wallet event: %v\n", err)
+			return
+		}
+		if err := models.EnqueueWebhookDeliveries(event); err != nil {
+			log.Printf("Failed to enqueue webhook deliveries for event %s: %v\n", event.ID, err)
+		}
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to wallet.events: %w", err)
+	}
+
+	// Keep subscription active - don't auto-unsubscribe
+	if err := sub.SetPendingLimits(-1, -1); err != nil {
+		log.Printf("Failed to set pending limits for wallet.events: %v\n", err)
+	}
+
+	// Register this subscription for cleanup
+	RegisterSubscription(sub)
+
+	return nil
+}
+
+// deliverWebhooks sends the due deliveries and schedules retries
+func deliverWebhooks() error {
+	deliveries, err := models.GetDueWebhookDeliveries(100)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deliveries {
+		if err := sendWebhook(d); err != nil {
+			attempts := d.Attempts + 1
+			dead := attempts >= webhookMaxAttempts
+			if err := d.MarkFailed(err.Error(), time.Now().Add(webhookBackoff(attempts)), dead); err != nil {
+				log.Printf("Failed to record webhook delivery %s: %v\n", d.ID, err)
+			}
+			if dead {
+				log.Printf("Webhook delivery %s dead-lettered after %d attempts: %v\n", d.ID, attempts, err)
+			}
+			continue
+		}
+		if err := d.MarkDelivered(); err != nil {
+			log.Printf("Failed to record webhook delivery %s: %v\n", d.ID, err)
+		}
+	}
+	return nil
+}
+
+// webhookBackoff returns the exponential delay before the next attempt
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff << (attempts - 1)
+	if backoff <= 0 || backoff > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	return backoff
+}
+
+// sendWebhook posts a signed delivery to the partner
+func sendWebhook(d models.WebhookDelivery) error {
+	body := []byte(d.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, d.EventType)
+	req.Header.Set(DeliveryHeader, d.ID.String())
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, SignPayload([]byte(d.Secret), timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("partner responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -15,6 +15,7 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // schedule timezones on images without zoneinfo
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/gzip"
@@ -22,6 +23,9 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// streamPath is the Server-Sent Events route of the wallet updates
+const streamPath = "/api/v1/stream"
+
 func main() {
 	// Load environment variables from the.env file if it exists,
 	// This is now optional since we're using Docker env variables
@@ -56,13 +60,17 @@ func main() {
 			},
 		),
 	)
-	server.Use(gzip.Gzip(gzip.BestCompression))
-	server.Use(middleware.Timeout(30 * time.Second))
+	// streams are neither compressed nor bound by the request timeout
+	server.Use(gzip.Gzip(gzip.BestCompression, gzip.WithExcludedPaths([]string{streamPath})))
+	server.Use(helpers.UnlessPath(middleware.Timeout(30*time.Second), streamPath))
 	server.Use(middleware.Recover())
 
 	// Set api version group
 	v1 := server.Group("/api/v1")
 
+	// Set provider webhooks group, outside of the JWT protected routes
+	webhooks := server.Group("/webhooks/v1")
+
 	// initialize server
 	s := &http.Server{
 		Handler:        server,
@@ -81,16 +89,141 @@ func main() {
 	v1.POST("/deposit", jwt.AuthGin(jwtKey), controllers.TopupWallet)
 	v1.POST("/withdraw", jwt.AuthGin(jwtKey), controllers.WithdrawWallet)
 	v1.POST("/unlock", jwt.AuthGin(jwtKey), controllers.UnLockWalletByUser)
+	v1.GET("/transactions/:transactionID", jwt.AuthGin(jwtKey), controllers.GetTransactionStatus)
+	v1.GET("/stream", jwt.AuthGin(jwtKey), controllers.StreamWallet)
+	v1.GET("/wallets/:walletID/balance", jwt.AuthGin(jwtKey), controllers.GetBalanceAt)
+	v1.POST("/pockets", jwt.AuthGin(jwtKey), controllers.CreatePocket)
+	v1.POST("/pockets/update", jwt.AuthGin(jwtKey), controllers.UpdatePocket)
+	v1.POST("/pockets/transfer", jwt.AuthGin(jwtKey), controllers.TransferPocket)
+	v1.POST("/pockets/close", jwt.AuthGin(jwtKey), controllers.ClosePocket)
+	v1.POST("/standing-orders", jwt.AuthGin(jwtKey), controllers.CreateStandingOrder)
+	v1.POST("/standing-orders/status", jwt.AuthGin(jwtKey), controllers.SetStandingOrderStatus)
+	v1.GET("/standing-orders/:userID", jwt.AuthGin(jwtKey), controllers.ListStandingOrders)
+	v1.GET("/standing-orders/:userID/:orderID/runs", jwt.AuthGin(jwtKey), controllers.ListStandingOrderRuns)
+	v1.POST("/payment-requests", jwt.AuthGin(jwtKey), controllers.CreatePaymentRequest)
+	v1.POST("/payment-requests/respond", jwt.AuthGin(jwtKey), controllers.RespondPaymentRequest)
+	v1.POST("/payment-requests/cancel", jwt.AuthGin(jwtKey), controllers.CancelPaymentRequest)
+	v1.GET("/payment-requests/:userID", jwt.AuthGin(jwtKey), controllers.ListPaymentRequests)
+	v1.POST("/bill-splits", jwt.AuthGin(jwtKey), controllers.CreateBillSplit)
+	v1.POST("/bill-splits/pay", jwt.AuthGin(jwtKey), controllers.PayBillSplitShare)
+	v1.POST("/bill-splits/remind", jwt.AuthGin(jwtKey), controllers.RemindBillSplit)
+	v1.POST("/bill-splits/cancel", jwt.AuthGin(jwtKey), controllers.CancelBillSplit)
+	v1.GET("/bill-splits/:userID", jwt.AuthGin(jwtKey), controllers.ListBillSplits)
+	v1.GET("/bill-splits/:userID/:splitID", jwt.AuthGin(jwtKey), controllers.GetBillSplit)
+	v1.POST("/merchants", jwt.AuthGin(jwtKey), controllers.RegisterMerchant)
+	v1.POST("/merchants/qr", jwt.AuthGin(jwtKey), controllers.GenerateMerchantQR)
+	v1.POST("/merchants/pay", jwt.AuthGin(jwtKey), controllers.PayMerchantQR)
+	v1.GET("/merchants/:merchantID/payments", jwt.AuthGin(jwtKey), controllers.ListMerchantPayments)
+	v1.GET("/merchants/:merchantID/links", jwt.AuthGin(jwtKey), controllers.ListPaymentLinks)
+	v1.GET("/payment-links/:code", controllers.ResolvePaymentLink)
+	v1.POST("/payment-links", jwt.AuthGin(jwtKey), controllers.CreatePaymentLink)
+	v1.POST("/payment-links/disable", jwt.AuthGin(jwtKey), controllers.DisablePaymentLink)
+	v1.POST("/payment-links/pay", jwt.AuthGin(jwtKey), controllers.PayPaymentLink)
+	v1.POST("/escrows", jwt.AuthGin(jwtKey), controllers.CreateEscrow)
+	v1.POST("/escrows/confirm", jwt.AuthGin(jwtKey), controllers.ConfirmEscrow)
+	v1.POST("/escrows/cancel", jwt.AuthGin(jwtKey), controllers.CancelEscrow)
+	v1.POST("/escrows/dispute", jwt.AuthGin(jwtKey), controllers.DisputeEscrow)
+	v1.GET("/escrows/:userID", jwt.AuthGin(jwtKey), controllers.ListEscrows)
+	v1.GET("/escrows/:userID/:escrowID", jwt.AuthGin(jwtKey), controllers.GetEscrow)
+	v1.POST("/disputes", jwt.AuthGin(jwtKey), controllers.OpenDispute)
+	v1.POST("/disputes/evidence", jwt.AuthGin(jwtKey), controllers.AddDisputeEvidence)
+	v1.POST("/disputes/withdraw", jwt.AuthGin(jwtKey), controllers.WithdrawDispute)
+	v1.GET("/disputes/:userID", jwt.AuthGin(jwtKey), controllers.ListDisputes)
+	v1.GET("/disputes/:userID/:disputeID", jwt.AuthGin(jwtKey), controllers.GetDispute)
+	v1.POST("/payouts", jwt.AuthGin(jwtKey), controllers.UploadPayoutBatch)
+	v1.POST("/payouts/confirm", jwt.AuthGin(jwtKey), controllers.ConfirmPayoutBatch)
+	v1.POST("/payouts/cancel", jwt.AuthGin(jwtKey), controllers.CancelPayoutBatch)
+	v1.POST("/payouts/resume", jwt.AuthGin(jwtKey), controllers.ResumePayoutBatch)
+	v1.GET("/payouts/:userID", jwt.AuthGin(jwtKey), controllers.ListPayoutBatches)
+	v1.GET("/payouts/:userID/:batchID", jwt.AuthGin(jwtKey), controllers.GetPayoutBatch)
+	v1.GET("/payouts/:userID/:batchID/result", jwt.AuthGin(jwtKey), controllers.DownloadPayoutResult)
+	v1.POST("/organizations", jwt.AuthGin(jwtKey), controllers.CreateOrganization)
+	v1.POST("/organizations/members", jwt.AuthGin(jwtKey), controllers.SetOrganizationMember)
+	v1.POST("/organizations/policy", jwt.AuthGin(jwtKey), controllers.SetOrganizationPolicy)
+	v1.POST("/organizations/operations/approve", jwt.AuthGin(jwtKey), controllers.ApproveOrganizationOperation)
+	v1.POST("/organizations/operations/reject", jwt.AuthGin(jwtKey), controllers.RejectOrganizationOperation)
+	v1.POST("/organizations/operations/cancel", jwt.AuthGin(jwtKey), controllers.CancelOrganizationOperation)
+	v1.GET("/organizations/:userID", jwt.AuthGin(jwtKey), controllers.ListOrganizations)
+	v1.GET("/organizations/:userID/:organizationID", jwt.AuthGin(jwtKey), controllers.GetOrganization)
+	v1.GET("/organizations/:userID/:organizationID/operations", jwt.AuthGin(jwtKey), controllers.ListOrganizationOperations)
+	v1.POST("/dependents", jwt.AuthGin(jwtKey), controllers.CreateDependent)
+	v1.POST("/dependents/controls", jwt.AuthGin(jwtKey), controllers.SetDependentControls)
+	v1.POST("/dependents/allowance", jwt.AuthGin(jwtKey), controllers.CreateDependentAllowance)
+	v1.POST("/dependents/invitations/accept", jwt.AuthGin(jwtKey), controllers.AcceptDependentInvitation)
+	v1.POST("/dependents/invitations/decline", jwt.AuthGin(jwtKey), controllers.DeclineDependentInvitation)
+	v1.GET("/dependents/:userID", jwt.AuthGin(jwtKey), controllers.ListDependents)
+	v1.GET("/dependents/:userID/invitations", jwt.AuthGin(jwtKey), controllers.ListDependentInvitations)
+	v1.GET("/dependents/:userID/:childID/history", jwt.AuthGin(jwtKey), controllers.GetDependentHistory)
+	v1.POST("/agents/cash-in", jwt.AuthGin(jwtKey), controllers.AgentCashIn)
+	v1.POST("/agents/cash-out", jwt.AuthGin(jwtKey), controllers.AgentCashOut)
+	v1.POST("/agents/cash-out/confirm", jwt.AuthGin(jwtKey), controllers.ConfirmAgentCashOut)
+	v1.POST("/agents/float/transfer", jwt.AuthGin(jwtKey), controllers.RebalanceAgentFloat)
+	v1.GET("/agents/:userID/operations", jwt.AuthGin(jwtKey), controllers.ListAgentOperations)
+	v1.GET("/agents/:userID/summaries", jwt.AuthGin(jwtKey), controllers.ListAgentSummaries)
+	v1.GET("/commissions/:userID", jwt.AuthGin(jwtKey), controllers.GetCommissionBalance)
+	v1.GET("/commissions/:userID/statements", jwt.AuthGin(jwtKey), controllers.ListCommissionStatements)
+	v1.GET("/commissions/:userID/statements/:payoutID", jwt.AuthGin(jwtKey), controllers.GetCommissionStatement)
+	v1.GET("/commissions/:userID/statements/:payoutID/download", jwt.AuthGin(jwtKey), controllers.DownloadCommissionStatement)
+
+	// admin routes
+	admin := v1.Group("/admin", jwt.AuthGin(jwtKey), helpers.AdminOnly())
+	admin.POST("/reports", controllers.GenerateComplianceReport)
+	admin.GET("/reports", controllers.ListComplianceReports)
+	admin.GET("/reports/:reportID/download", controllers.DownloadComplianceReport)
+	admin.GET("/reports/month-end", controllers.GetMonthEndBalances)
+	admin.POST("/reversals", controllers.ReverseTransaction)
+	admin.POST("/webhooks", controllers.CreateWebhookSubscription)
+	admin.GET("/webhooks", controllers.ListWebhookSubscriptions)
+	admin.POST("/webhooks/:subscriptionID/disable", controllers.DisableWebhookSubscription)
+	admin.GET("/webhooks/deliveries", controllers.ListWebhookDeliveries)
+	admin.POST("/webhooks/deliveries/:deliveryID/replay", controllers.ReplayWebhookDelivery)
+	admin.GET("/access-audits", controllers.ListAccessAudits)
+	admin.GET("/wallets/:walletID/log-chain/verify", controllers.VerifyWalletLogChain)
+	admin.GET("/log-chain/anchors/latest", controllers.GetLatestChainAnchor)
+	admin.POST("/wallets/:walletID/reconcile", controllers.ReconcileWallet)
+	admin.GET("/reconciliation/discrepancies", controllers.ListWalletDiscrepancies)
+	admin.POST("/settlements", controllers.ImportSettlement)
+	admin.GET("/settlements", controllers.ListSettlementImports)
+	admin.GET("/settlements/:importID", controllers.GetSettlementReport)
+	admin.GET("/settlement-exceptions", controllers.ListSettlementExceptions)
+	admin.POST("/settlement-exceptions/:itemID/resolve", controllers.ResolveSettlementException)
+	admin.GET("/escrows", controllers.ListDisputedEscrows)
+	admin.POST("/escrows/resolve", controllers.ResolveEscrow)
+	admin.GET("/disputes", controllers.ListDisputesAdmin)
+	admin.GET("/disputes/:disputeID", controllers.GetDisputeAdmin)
+	admin.POST("/disputes/evidence", controllers.AddDisputeEvidenceAdmin)
+	admin.POST("/disputes/provisional", controllers.ProvisionalDispute)
+	admin.POST("/disputes/resolve", controllers.ResolveDispute)
+	admin.POST("/agents", controllers.RegisterAgent)
+	admin.POST("/agents/status", controllers.SetAgentStatus)
+	admin.POST("/agents/float", controllers.MoveAgentFloat)
+	admin.POST("/dependents/invitations/accept", controllers.ApproveDependentInvitation)
+	admin.GET("/agents", controllers.ListAgents)
+	admin.POST("/commissions/rules", controllers.CreateCommissionRule)
+	admin.POST("/commissions/rules/:ruleID/disable", controllers.DisableCommissionRule)
+	admin.GET("/commissions/rules", controllers.ListCommissionRules)
+	admin.POST("/commissions/partners", controllers.RegisterCommissionPartner)
+	admin.GET("/commissions/payouts", controllers.ListCommissionPayouts)
+
+	// webhook routes
+	webhooks.POST("/providers/:provider", helpers.VerifyProviderSignature(), controllers.ProviderCallback)
+
+	// Payment providers
+	helpers.LoadProviders()
 
 	// Subscription is now handled inside NatsConnect
 	if err := helpers.NatsConnect(); err != nil {
 		log.Fatalf("Failed to connect to NATS: %v", err)
 	}
 
+	// Background jobs run until shutdown
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+
 	// start server
 	go func() {
 		// Database connection
 		models.DBConnect()
+		helpers.StartJobs(jobsCtx)
 		_, err := fmt.Fprintf(os.Stdout, "Server started on port %s\n", port)
 		if err != nil {
 			log.Fatalln("Error writing to stdout")
@@ -107,6 +240,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutdown Server ...")
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Access audit actions
+const (
+	AccessReadBalance     = "READ_BALANCE"
+	AccessReadTransaction = "READ_TRANSACTION"
+	AccessStreamWallet    = "STREAM_WALLET"
+	AccessDownloadReport  = "DOWNLOAD_REPORT"
+	AccessReadHistory     = "READ_HISTORY"
+)
+
+// AccessAudit is the struct for a read of wallet data, kept apart from the wallet logs
+type AccessAudit struct {
+	ID         uuid.UUID `json:"id" db:"id,omitempty"`
+	ActorID    uuid.UUID `json:"actor_id" db:"actor_id"`
+	Action     string    `json:"action" db:"action"`
+	ResourceID uuid.UUID `json:"resource_id" db:"resource_id"`
+	IPAddress  string    `json:"ip_address" db:"ip_address"`
+	UserAgent  string    `json:"user_agent" db:"user_agent"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
+// CreateAccessAudit records a read
+func (a *AccessAudit) CreateAccessAudit() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err := DB.Exec(
+		ctx,
+		`INSERT INTO access_audits (actor_id, action, resource_id, ip_address, user_agent) VALUES ($1, $2, $3, $4, $5)`,
+		a.ActorID,
+		a.Action,
+		a.ResourceID,
+		a.IPAddress,
+		a.UserAgent,
+	)
+	return err
+}
+
+// GetAccessAudits lists the latest reads of an actor, or of everyone when actorID is nil
+func GetAccessAudits(actorID uuid.UUID, limit int) ([]AccessAudit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT id, actor_id, action, resource_id, ip_address, user_agent, created_at FROM access_audits
+		WHERE $1::uuid IS NULL OR actor_id = $1 ORDER BY created_at DESC LIMIT $2`,
+		uuidOrNil(actorID),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	audits := make([]AccessAudit, 0)
+	for rows.Next() {
+		a := AccessAudit{}
+		if err := rows.Scan(&a.ID, &a.ActorID, &a.Action, &a.ResourceID, &a.IPAddress, &a.UserAgent, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		audits = append(audits, a)
+	}
+	return audits, nil
+}
+
+// PurgeAccessAudits deletes the reads older than the retention period
+func PurgeAccessAudits(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tag, err := DB.Exec(ctx, `DELETE FROM access_audits WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// uuidOrNil maps the zero uuid to a SQL NULL
+func uuidOrNil(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
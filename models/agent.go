@@ -0,0 +1,764 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"math/big"
+	"time"
+)
+
+// Agent statuses
+const (
+	AgentActive    = "ACTIVE"
+	AgentSuspended = "SUSPENDED"
+)
+
+// Agent operation kinds, also the transfer sources
+const (
+	AgentCashIn  = "CASH_IN"
+	AgentCashOut = "CASH_OUT"
+)
+
+// Transfer sources of the agent network
+const (
+	TransferSourceAgentCashIn  = "agent_cash_in"
+	TransferSourceAgentCashOut = "agent_cash_out"
+	TransferSourceAgentFloat   = "agent_float"
+)
+
+// Agent operation statuses
+const (
+	AgentOperationPending   = "PENDING" // cash-out waiting for the customer
+	AgentOperationCompleted = "COMPLETED"
+	AgentOperationExpired   = "EXPIRED"
+	AgentOperationFailed    = "FAILED" // too many wrong OTPs
+)
+
+// Float movements between the treasury and an agent
+const (
+	FloatTopUp    = "TOPUP"
+	FloatWithdraw = "WITHDRAW"
+)
+
+// agentOTPAttempts bounds the wrong OTPs of a cash-out
+const agentOTPAttempts = 3
+
+// Agent errors
+var (
+	ErrAgentNotFound = errors.New("active agent not found")
+	ErrAgentOTP      = errors.New("invalid otp")
+	ErrAgentExpired  = errors.New("cash-out expired")
+)
+
+// Agent is a user whose wallet is a float used to serve customers in cash
+type Agent struct {
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	WalletID  uuid.UUID `json:"wallet_id" db:"wallet_id"`
+	Name      string    `json:"name" db:"name"`
+	Location  string    `json:"location" db:"location"`
+	Status    string    `json:"status" db:"status"`
+	MinFloat  int64     `json:"min_float" db:"min_float"` // a lower float is reported after an operation
+	Float     int64     `json:"float" db:"-"`
+	CreatedAt time.Time `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// AgentOperation is a cash-in or cash-out served by an agent
+type AgentOperation struct {
+	ID           uuid.UUID  `json:"id" db:"id,omitempty"`
+	AgentID      uuid.UUID  `json:"agent_id" db:"agent_id"`
+	CustomerID   uuid.UUID  `json:"customer_id" db:"customer_id"`
+	Kind         string     `json:"kind" db:"kind"`
+	Amount       int64      `json:"amount" db:"amount"`
+	Currency     string     `json:"currency" db:"currency"`
+	Commission   int64      `json:"commission" db:"commission"` // from the commission rules once completed
+	Reference    string     `json:"reference" db:"reference"`
+	Status       string     `json:"status" db:"status"`
+	OTP          string     `json:"-" db:"-"` // only set when created, sent to the customer
+	OTPAttempts  int        `json:"-" db:"otp_attempts"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	TransferID   *uuid.UUID `json:"transfer_id,omitempty" db:"transfer_id"`
+	AgentFloat   int64      `json:"agent_float" db:"-"` // after the operation
+	CreatedAt    time.Time  `json:"created_at" db:"created_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	otpHash      string
+	agentMinimum int64
+}
+
+// AgentDailySummary is the activity of an agent over a UTC day
+type AgentDailySummary struct {
+	AgentID       uuid.UUID `json:"agent_id" db:"agent_id"`
+	Day           time.Time `json:"day" db:"day"`
+	CashInCount   int       `json:"cash_in_count" db:"cash_in_count"`
+	CashInAmount  int64     `json:"cash_in_amount" db:"cash_in_amount"`
+	CashOutCount  int       `json:"cash_out_count" db:"cash_out_count"`
+	CashOutAmount int64     `json:"cash_out_amount" db:"cash_out_amount"`
+	Commission    int64     `json:"commission" db:"commission"`
+	OpeningFloat  int64     `json:"opening_float" db:"opening_float"`
+	ClosingFloat  int64     `json:"closing_float" db:"closing_float"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
+// AgentRequest is the struct for registering an agent
+type AgentRequest struct {
+	UserID   uuid.UUID `json:"user_id" binding:"required"`
+	Name     string    `json:"name" binding:"required,max=100"`
+	Location string    `json:"location" binding:"max=255"`
+	MinFloat int64     `json:"min_float" binding:"min=0"`
+}
+
+// AgentStatusRequest is the struct for suspending or reactivating an agent
+type AgentStatusRequest struct {
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+	Status string    `json:"status" binding:"required,oneof=ACTIVE SUSPENDED"`
+}
+
+// AgentOperationRequest is the struct for a cash-in or cash-out of a customer at the calling agent
+type AgentOperationRequest struct {
+	UserID     uuid.UUID `json:"user_id" binding:"required"`
+	CustomerID uuid.UUID `json:"customer_id" binding:"required"`
+	Amount     int64     `json:"amount" binding:"required,numeric,gt=0,min=100,max=2000000"`
+	Reference  string    `json:"reference" binding:"max=100"` // receipt number, an operation is only made once per reference
+}
+
+// AgentConfirmRequest is the struct for confirming a cash-out, by the agent with the customer OTP
+// or by the customer without it
+type AgentConfirmRequest struct {
+	UserID      uuid.UUID `json:"user_id" binding:"required"`
+	OperationID uuid.UUID `json:"operation_id" binding:"required"`
+	OTP         string    `json:"otp" binding:"omitempty,numeric,len=6"`
+}
+
+// FloatRequest is the struct for a float top-up or withdrawal between the treasury and an agent
+type FloatRequest struct {
+	AgentID   uuid.UUID `json:"agent_id" binding:"required"`
+	Amount    int64     `json:"amount" binding:"required,gt=0"`
+	Direction string    `json:"direction" binding:"required,oneof=TOPUP WITHDRAW"`
+	Reference string    `json:"reference" binding:"required,max=100"` // bank or cash receipt, used once
+}
+
+// FloatRebalanceRequest is the struct for moving float from the calling agent to another agent
+type FloatRebalanceRequest struct {
+	UserID    uuid.UUID `json:"user_id" binding:"required"`
+	ToAgentID uuid.UUID `json:"to_agent_id" binding:"required"`
+	Amount    int64     `json:"amount" binding:"required,gt=0"`
+	Reference string    `json:"reference" binding:"required,max=100"`
+}
+
+// agentColumns is the column list scanned by scanAgent
+const agentColumns = `user_id, wallet_id, name, location, status, min_float, created_at, updated_at`
+
+// scanAgent scans an agent row
+func scanAgent(row pgx.Row) (*Agent, error) {
+	a := &Agent{}
+	err := row.Scan(
+		&a.UserID,
+		&a.WalletID,
+		&a.Name,
+		&a.Location,
+		&a.Status,
+		&a.MinFloat,
+		&a.CreatedAt,
+		&a.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// agentOperationColumns is the column list scanned by scanAgentOperation
+const agentOperationColumns = `id, agent_id, customer_id, kind, amount, currency, commission, reference, status, otp_hash,
+	otp_attempts, expires_at, transfer_id, created_at, completed_at`
+
+// scanAgentOperation scans an agent operation row
+func scanAgentOperation(row pgx.Row) (*AgentOperation, error) {
+	o := &AgentOperation{}
+	err := row.Scan(
+		&o.ID,
+		&o.AgentID,
+		&o.CustomerID,
+		&o.Kind,
+		&o.Amount,
+		&o.Currency,
+		&o.Commission,
+		&o.Reference,
+		&o.Status,
+		&o.otpHash,
+		&o.OTPAttempts,
+		&o.ExpiresAt,
+		&o.TransferID,
+		&o.CreatedAt,
+		&o.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// FloatLow checks if the float of the agent fell under its minimum with the operation
+func (o *AgentOperation) FloatLow() bool {
+	return o.Status == AgentOperationCompleted && o.AgentFloat < o.agentMinimum
+}
+
+// RegisterAgent makes a user with an active wallet an agent, its wallet becomes its float
+func (r *AgentRequest) RegisterAgent() (*Agent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanAgent(DB.QueryRow(
+		ctx,
+		`INSERT INTO agents (user_id, wallet_id, name, location, min_float)
+		SELECT user_id, id, $2, $3, $4 FROM wallets WHERE user_id = $1 AND is_active = true
+		ON CONFLICT (user_id) DO UPDATE SET name = EXCLUDED.name, location = EXCLUDED.location,
+		min_float = EXCLUDED.min_float, updated_at = CURRENT_TIMESTAMP
+		RETURNING `+agentColumns,
+		r.UserID,
+		r.Name,
+		r.Location,
+		r.MinFloat,
+	))
+}
+
+// SetAgentStatus suspends or reactivates an agent
+func (r *AgentStatusRequest) SetAgentStatus() (*Agent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanAgent(DB.QueryRow(
+		ctx,
+		`UPDATE agents SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2 RETURNING `+agentColumns,
+		r.Status,
+		r.UserID,
+	))
+}
+
+// activeAgent returns an active agent
+func activeAgent(ctx context.Context, q queryer, agentID uuid.UUID) (*Agent, error) {
+	agent, err := scanAgent(q.QueryRow(
+		ctx,
+		`SELECT `+agentColumns+` FROM agents WHERE user_id = $1 AND status = 'ACTIVE'`,
+		agentID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAgentNotFound
+	}
+	return agent, err
+}
+
+// agentTransferKey returns the idempotency key of an agent transfer, nil without a reference
+func agentTransferKey(source string, agentID uuid.UUID, reference string) *string {
+	if reference == "" {
+		return nil
+	}
+	key := source + ":" + agentID.String() + ":" + reference
+	return &key
+}
+
+// CashIn moves float of the calling agent to the customer wallet against cash
+func (r *AgentOperationRequest) CashIn() (*AgentOperation, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	agent, err := activeAgent(ctx, tx, r.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	operationID := uuid.New()
+	transfer := &Transfer{
+		FromWalletID:   agent.WalletID,
+		FromUserID:     agent.UserID,
+		ToUserID:       r.CustomerID,
+		Amount:         r.Amount,
+		Source:         TransferSourceAgentCashIn,
+		SourceID:       &operationID,
+		IdempotencyKey: agentTransferKey(TransferSourceAgentCashIn, agent.UserID, r.Reference),
+	}
+	if err := transfer.transfer(ctx, tx); err != nil {
+		return nil, nil, err
+	}
+	commission, err := commissionFor(ctx, tx, agent.UserID, TransferSourceAgentCashIn, r.Amount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	operation, err := scanAgentOperation(tx.QueryRow(
+		ctx,
+		`INSERT INTO agent_operations (id, agent_id, customer_id, kind, amount, currency, commission, reference, status,
+		transfer_id, completed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 'COMPLETED', $9, CURRENT_TIMESTAMP) RETURNING `+agentOperationColumns,
+		operationID,
+		agent.UserID,
+		transfer.ToUserID,
+		AgentCashIn,
+		r.Amount,
+		transfer.Currency,
+		commission,
+		r.Reference,
+		transfer.ID,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	operation.AgentFloat, operation.agentMinimum = transfer.FromBalance, agent.MinFloat
+	return operation, transfer, nil
+}
+
+// newAgentOTP returns a random 6 digit code
+func newAgentOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashAgentOTP hashes an OTP with its operation so equal codes differ in storage
+func hashAgentOTP(operationID uuid.UUID, otp string) string {
+	sum := sha256.Sum256([]byte(operationID.String() + ":" + otp))
+	return hex.EncodeToString(sum[:])
+}
+
+// CashOut asks the customer to confirm paying the amount to the calling agent against cash.
+// The returned operation carries the OTP to send to the customer.
+func (r *AgentOperationRequest) CashOut(ttl time.Duration) (*AgentOperation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	agent, err := activeAgent(ctx, DB, r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if agent.UserID == r.CustomerID {
+		return nil, ErrSameWallet
+	}
+	var currency string
+	err = DB.QueryRow(
+		ctx,
+		`SELECT c.currency FROM wallets c JOIN wallets a ON a.id = $2
+		WHERE c.user_id = $1 AND c.is_active = true AND c.currency = a.currency`,
+		r.CustomerID,
+		agent.WalletID,
+	).Scan(&currency)
+	if err != nil {
+		return nil, err
+	}
+
+	otp, err := newAgentOTP()
+	if err != nil {
+		return nil, err
+	}
+	operationID := uuid.New()
+	operation, err := scanAgentOperation(DB.QueryRow(
+		ctx,
+		`INSERT INTO agent_operations (id, agent_id, customer_id, kind, amount, currency, reference, status,
+		otp_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, 'PENDING', $8, $9) RETURNING `+agentOperationColumns,
+		operationID,
+		agent.UserID,
+		r.CustomerID,
+		AgentCashOut,
+		r.Amount,
+		currency,
+		r.Reference,
+		hashAgentOTP(operationID, otp),
+		time.Now().Add(ttl),
+	))
+	if err != nil {
+		return nil, err
+	}
+	operation.OTP = otp
+	return operation, nil
+}
+
+// ConfirmCashOut pays a pending cash-out from the customer wallet to the agent float.
+// The agent confirms with the OTP of the customer, the customer confirms without it from its own session.
+// A wrong OTP counts against the attempts, the last one fails the cash-out.
+func (r *AgentConfirmRequest) ConfirmCashOut() (*AgentOperation, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	operation, err := scanAgentOperation(tx.QueryRow(
+		ctx,
+		`SELECT `+agentOperationColumns+` FROM agent_operations
+		WHERE id = $1 AND kind = 'CASH_OUT' AND status = 'PENDING' AND (agent_id = $2 OR customer_id = $2) FOR UPDATE`,
+		r.OperationID,
+		r.UserID,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+	if operation.ExpiresAt != nil && time.Now().After(*operation.ExpiresAt) {
+		if _, err := tx.Exec(ctx, `UPDATE agent_operations SET status = 'EXPIRED' WHERE id = $1`, operation.ID); err != nil {
+			return nil, nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrAgentExpired
+	}
+	if r.UserID == operation.AgentID {
+		expected := hashAgentOTP(operation.ID, r.OTP)
+		if r.OTP == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(operation.otpHash)) != 1 {
+			_, err := tx.Exec(
+				ctx,
+				`UPDATE agent_operations SET otp_attempts = otp_attempts + 1,
+				status = CASE WHEN otp_attempts + 1 >= $2 THEN 'FAILED' ELSE status END WHERE id = $1`,
+				operation.ID,
+				agentOTPAttempts,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := tx.Commit(ctx); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, ErrAgentOTP
+		}
+	}
+
+	agent, err := activeAgent(ctx, tx, operation.AgentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	transfer := &Transfer{
+		FromUserID: operation.CustomerID,
+		ToWalletID: agent.WalletID,
+		Amount:     operation.Amount,
+		Source:     TransferSourceAgentCashOut,
+		SourceID:   &operation.ID,
+	}
+	if err := transfer.transfer(ctx, tx); err != nil {
+		return nil, nil, err
+	}
+	commission, err := commissionFor(ctx, tx, agent.UserID, TransferSourceAgentCashOut, operation.Amount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	operation, err = scanAgentOperation(tx.QueryRow(
+		ctx,
+		`UPDATE agent_operations SET status = 'COMPLETED', transfer_id = $1, commission = $2, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $3 RETURNING `+agentOperationColumns,
+		transfer.ID,
+		commission,
+		operation.ID,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	operation.AgentFloat, operation.agentMinimum = transfer.ToBalance, agent.MinFloat
+	return operation, transfer, nil
+}
+
+// ExpireAgentCashOuts expires the unconfirmed cash-outs and returns them
+func ExpireAgentCashOuts(now time.Time) ([]AgentOperation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`UPDATE agent_operations SET status = 'EXPIRED'
+		WHERE status = 'PENDING' AND expires_at <= $1 RETURNING `+agentOperationColumns,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	operations := make([]AgentOperation, 0)
+	for rows.Next() {
+		operation, err := scanAgentOperation(rows)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, *operation)
+	}
+	return operations, rows.Err()
+}
+
+// MoveFloat tops up the float of an agent from the treasury wallet, or withdraws float back to it
+func (r *FloatRequest) MoveFloat(treasuryWalletID uuid.UUID) (*Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	agent, err := activeAgent(ctx, tx, r.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	transfer := &Transfer{
+		Amount:         r.Amount,
+		Source:         TransferSourceAgentFloat,
+		IdempotencyKey: agentTransferKey(TransferSourceAgentFloat+"_"+r.Direction, agent.UserID, r.Reference),
+	}
+	if r.Direction == FloatTopUp {
+		transfer.ToWalletID = agent.WalletID
+		err = tx.QueryRow(ctx, `SELECT id, user_id FROM wallets WHERE id = $1`, treasuryWalletID).
+			Scan(&transfer.FromWalletID, &transfer.FromUserID)
+	} else {
+		transfer.FromWalletID, transfer.FromUserID, transfer.ToWalletID = agent.WalletID, agent.UserID, treasuryWalletID
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := transfer.transfer(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// RebalanceFloat moves float from the calling agent to another agent, e.g. from a dealer to its sub-agents
+func (r *FloatRebalanceRequest) RebalanceFloat() (*Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	from, err := activeAgent(ctx, tx, r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := activeAgent(ctx, tx, r.ToAgentID)
+	if err != nil {
+		return nil, err
+	}
+	transfer := &Transfer{
+		FromWalletID:   from.WalletID,
+		FromUserID:     from.UserID,
+		ToWalletID:     to.WalletID,
+		Amount:         r.Amount,
+		Source:         TransferSourceAgentFloat,
+		IdempotencyKey: agentTransferKey(TransferSourceAgentFloat, from.UserID, r.Reference),
+	}
+	if err := transfer.transfer(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// GetAgents lists the agents with their float
+func GetAgents(status string) ([]Agent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT a.user_id, a.wallet_id, a.name, a.location, a.status, a.min_float, a.created_at, a.updated_at, w.balance
+		FROM agents a JOIN wallets w ON w.id = a.wallet_id WHERE $1 = '' OR a.status = $1 ORDER BY a.name`,
+		status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	agents := make([]Agent, 0)
+	for rows.Next() {
+		var a Agent
+		err := rows.Scan(&a.UserID, &a.WalletID, &a.Name, &a.Location, &a.Status, &a.MinFloat, &a.CreatedAt, &a.UpdatedAt, &a.Float)
+		if err != nil {
+			return nil, err
+		}
+		agents = append(agents, a)
+	}
+	return agents, rows.Err()
+}
+
+// GetAgentOperations lists the operations of an agent or of a customer, newest first
+func GetAgentOperations(userID uuid.UUID, limit int) ([]AgentOperation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+agentOperationColumns+` FROM agent_operations
+		WHERE agent_id = $1 OR customer_id = $1 ORDER BY created_at DESC LIMIT $2`,
+		userID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	operations := make([]AgentOperation, 0)
+	for rows.Next() {
+		operation, err := scanAgentOperation(rows)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, *operation)
+	}
+	return operations, rows.Err()
+}
+
+// agentSummaryColumns is the column list of an agent daily summary
+const agentSummaryColumns = `agent_id, day, cash_in_count, cash_in_amount, cash_out_count, cash_out_amount, commission,
+	opening_float, closing_float, created_at`
+
+// scanAgentSummary scans an agent daily summary row
+func scanAgentSummary(row pgx.Row) (*AgentDailySummary, error) {
+	s := &AgentDailySummary{}
+	err := row.Scan(
+		&s.AgentID,
+		&s.Day,
+		&s.CashInCount,
+		&s.CashInAmount,
+		&s.CashOutCount,
+		&s.CashOutAmount,
+		&s.Commission,
+		&s.OpeningFloat,
+		&s.ClosingFloat,
+		&s.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// CreateAgentDailySummaries summarizes the completed operations and the float of every agent over a UTC day.
+// The opening float is the closing float of the previous summary, or the balance at midnight replayed from the
+// nearest balance snapshot, and the closing float adds the log deltas of the day, so a day without logs keeps it.
+// It returns the summaries not made yet, so it can run more than once a day.
+func CreateAgentDailySummaries(day time.Time) ([]AgentDailySummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	from := day.UTC().Truncate(24 * time.Hour)
+	to := from.AddDate(0, 0, 1)
+	rows, err := DB.Query(
+		ctx,
+		`INSERT INTO agent_daily_summaries (agent_id, day, cash_in_count, cash_in_amount, cash_out_count, cash_out_amount,
+			commission, opening_float, closing_float)
+		SELECT a.user_id, $3::date,
+			count(o.id) FILTER (WHERE o.kind = 'CASH_IN'),
+			COALESCE(sum(o.amount) FILTER (WHERE o.kind = 'CASH_IN'), 0),
+			count(o.id) FILTER (WHERE o.kind = 'CASH_OUT'),
+			COALESCE(sum(o.amount) FILTER (WHERE o.kind = 'CASH_OUT'), 0),
+			COALESCE(sum(o.commission), 0),
+			f.opening,
+			f.opening + COALESCE((SELECT sum(new_balance - old_balance) FROM wallet_logs
+				WHERE wallet_id = a.wallet_id AND created_at >= $1 AND created_at < $2), 0)
+		FROM agents a
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(
+				(SELECT closing_float FROM agent_daily_summaries WHERE agent_id = a.user_id AND day = $4::date),
+				(SELECT s.balance + COALESCE((SELECT sum(l.new_balance - l.old_balance) FROM wallet_logs l
+					WHERE l.wallet_id = a.wallet_id AND l.created_at >= s.snapshot_at AND l.created_at < $1), 0)
+				FROM wallet_balance_snapshots s WHERE s.wallet_id = a.wallet_id AND s.snapshot_at <= $1
+				ORDER BY s.snapshot_at DESC LIMIT 1),
+				(SELECT COALESCE(sum(new_balance - old_balance), 0) FROM wallet_logs WHERE wallet_id = a.wallet_id AND created_at < $1)
+			) AS opening
+		) f
+		LEFT JOIN agent_operations o ON o.agent_id = a.user_id AND o.status = 'COMPLETED'
+			AND o.completed_at >= $1 AND o.completed_at < $2
+		WHERE a.created_at < $2
+		GROUP BY a.user_id, a.wallet_id, f.opening
+		ON CONFLICT (agent_id, day) DO NOTHING RETURNING `+agentSummaryColumns,
+		from,
+		to,
+		from.Format(time.DateOnly),
+		from.AddDate(0, 0, -1).Format(time.DateOnly),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make([]AgentDailySummary, 0)
+	for rows.Next() {
+		summary, err := scanAgentSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, *summary)
+	}
+	return summaries, rows.Err()
+}
+
+// GetAgentDailySummaries lists the latest daily summaries of an agent
+func GetAgentDailySummaries(agentID uuid.UUID, limit int) ([]AgentDailySummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+agentSummaryColumns+` FROM agent_daily_summaries WHERE agent_id = $1 ORDER BY day DESC LIMIT $2`,
+		agentID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make([]AgentDailySummary, 0)
+	for rows.Next() {
+		summary, err := scanAgentSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, *summary)
+	}
+	return summaries, rows.Err()
+}
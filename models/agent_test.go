@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAgentOTP(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		otp, err := newAgentOTP()
+		if err != nil {
+			t.Fatalf("newAgentOTP: %v", err)
+		}
+		if len(otp) != 6 || strings.Trim(otp, "0123456789") != "" {
+			t.Fatalf("newAgentOTP() = %q, want 6 digits", otp)
+		}
+		seen[otp] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("newAgentOTP() returned %d distinct codes out of 50", len(seen))
+	}
+}
+
+func TestHashAgentOTP(t *testing.T) {
+	operation, other := uuid.New(), uuid.New()
+	hash := hashAgentOTP(operation, "123456")
+	tests := []struct {
+		name        string
+		operationID uuid.UUID
+		otp         string
+		want        bool
+	}{
+		{"same operation and code", operation, "123456", true},
+		{"other code", operation, "123457", false},
+		{"other operation", other, "123456", false},
+		{"empty code", operation, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hashAgentOTP(tt.operationID, tt.otp) == hash; got != tt.want {
+				t.Errorf("hashAgentOTP(%s, %q) matches = %v, want %v", tt.operationID, tt.otp, got, tt.want)
+			}
+		})
+	}
+	if len(hash) != 64 || strings.Trim(hash, "0123456789abcdef") != "" {
+		t.Errorf("hashAgentOTP() = %q, want a hex SHA-256", hash)
+	}
+}
+
+func TestAgentDailySummaryCarriesFloat(t *testing.T) {
+	testDB(t)
+
+	float := testWallet(t, 0)
+	if _, err := (&AgentRequest{UserID: float.UserID, Name: "agent"}).RegisterAgent(); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	_, err := DB.Exec(
+		context.Background(),
+		`INSERT INTO agent_daily_summaries (agent_id, day, cash_in_count, cash_in_amount, cash_out_count, cash_out_amount,
+			commission, opening_float, closing_float) VALUES ($1, $2, 0, 0, 0, 0, 0, 700, 700)`,
+		float.UserID,
+		today.AddDate(0, 0, -1).Format(time.DateOnly),
+	)
+	if err != nil {
+		t.Fatalf("insert summary: %v", err)
+	}
+
+	summaries, err := CreateAgentDailySummaries(today)
+	if err != nil {
+		t.Fatalf("CreateAgentDailySummaries: %v", err)
+	}
+	for _, s := range summaries {
+		if s.AgentID != float.UserID {
+			continue
+		}
+		// No log today, the float of the previous day is carried forward
+		if s.OpeningFloat != 700 || s.ClosingFloat != 700 {
+			t.Fatalf("float = %d to %d, want 700 to 700", s.OpeningFloat, s.ClosingFloat)
+		}
+		return
+	}
+	t.Fatalf("no summary for agent %s", float.UserID)
+}
@@ -0,0 +1,448 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Bill split statuses
+const (
+	BillSplitOpen     = "OPEN"
+	BillSplitSettled  = "SETTLED" // every share is paid
+	BillSplitCanceled = "CANCELED"
+)
+
+// Bill split share statuses
+const (
+	BillSplitSharePending = "PENDING"
+	BillSplitSharePaid    = "PAID"
+)
+
+// Bill split modes
+const (
+	BillSplitEqual  = "EQUAL"
+	BillSplitCustom = "CUSTOM"
+)
+
+// TransferSourceBillSplit is the source of the transfers paying a share
+const TransferSourceBillSplit = "bill_split"
+
+// ErrSplitShares is returned when the shares do not add up to the total or a participant is repeated
+var ErrSplitShares = errors.New("shares must be unique and add up to the total amount")
+
+// BillSplit is the struct for an amount shared among participants and settled to the creator
+type BillSplit struct {
+	ID              uuid.UUID        `json:"id" db:"id,omitempty"`
+	CreatorID       uuid.UUID        `json:"creator_id" db:"creator_id"`
+	CreatorWalletID uuid.UUID        `json:"creator_wallet_id" db:"creator_wallet_id"`
+	Title           string           `json:"title" db:"title"`
+	TotalAmount     int64            `json:"total_amount" db:"total_amount"`
+	PaidAmount      int64            `json:"paid_amount" db:"paid_amount"`
+	Currency        string           `json:"currency" db:"currency"`
+	Status          string           `json:"status" db:"status"`
+	Shares          []BillSplitShare `json:"shares" db:"-"`
+	CreatedAt       time.Time        `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt       time.Time        `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// BillSplitShare is the part of a split owed by a participant
+type BillSplitShare struct {
+	ID         uuid.UUID  `json:"id" db:"id,omitempty"`
+	SplitID    uuid.UUID  `json:"split_id" db:"split_id"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	Amount     int64      `json:"amount" db:"amount"`
+	Status     string     `json:"status" db:"status"`
+	TransferID *uuid.UUID `json:"transfer_id,omitempty" db:"transfer_id"`
+	PaidAt     *time.Time `json:"paid_at,omitempty" db:"paid_at"`
+	RemindedAt *time.Time `json:"reminded_at,omitempty" db:"reminded_at"`
+
+	// Split details for the notifications
+	CreatorID uuid.UUID `json:"creator_id" db:"-"`
+	Title     string    `json:"title" db:"-"`
+	Currency  string    `json:"currency" db:"-"`
+}
+
+// BillSplitParticipant is a participant of a new split, the amount is only read for custom shares
+type BillSplitParticipant struct {
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+	Amount int64     `json:"amount" binding:"omitempty,gt=0"`
+}
+
+// BillSplitRequest is the struct for creating a split
+type BillSplitRequest struct {
+	UserID       uuid.UUID              `json:"user_id" binding:"required"`
+	WalletID     uuid.UUID              `json:"wallet_id" binding:"required"`
+	Title        string                 `json:"title" binding:"required,max=100"`
+	TotalAmount  int64                  `json:"total_amount" binding:"required,numeric,gt=0,min=100,max=2000000"`
+	Mode         string                 `json:"mode" binding:"required,oneof=EQUAL CUSTOM"`
+	Participants []BillSplitParticipant `json:"participants" binding:"required,min=1,max=50,dive"`
+}
+
+// BillSplitAction is the struct for paying a share, reminding or canceling a split
+type BillSplitAction struct {
+	UserID  uuid.UUID `json:"user_id" binding:"required"`
+	SplitID uuid.UUID `json:"split_id" binding:"required"`
+}
+
+// shareAmounts returns the amount owed by each participant.
+// Equal shares give the remainder to the first participants, one unit each.
+func (r *BillSplitRequest) shareAmounts() ([]int64, error) {
+	seen := make(map[uuid.UUID]bool, len(r.Participants))
+	amounts := make([]int64, len(r.Participants))
+	n := int64(len(r.Participants))
+	var sum int64
+	for i, p := range r.Participants {
+		if seen[p.UserID] {
+			return nil, ErrSplitShares
+		}
+		seen[p.UserID] = true
+
+		amounts[i] = p.Amount
+		if r.Mode == BillSplitEqual {
+			amounts[i] = r.TotalAmount / n
+			if int64(i) < r.TotalAmount%n {
+				amounts[i]++
+			}
+		}
+		if amounts[i] <= 0 {
+			return nil, ErrSplitShares
+		}
+		sum += amounts[i]
+	}
+	if sum != r.TotalAmount {
+		return nil, ErrSplitShares
+	}
+	return amounts, nil
+}
+
+// CreateBillSplit creates a split settled to a wallet of the user.
+// The share of the creator, when listed, is paid from the start.
+func (r *BillSplitRequest) CreateBillSplit() (*BillSplit, error) {
+	amounts, err := r.shareAmounts()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	split, err := scanBillSplit(tx.QueryRow(
+		ctx,
+		`INSERT INTO bill_splits (creator_id, creator_wallet_id, title, total_amount, currency)
+		SELECT user_id, id, $3, $4, currency FROM wallets WHERE id = $1 AND user_id = $2 AND is_active = true
+		RETURNING `+billSplitColumns,
+		r.WalletID,
+		r.UserID,
+		r.Title,
+		r.TotalAmount,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, p := range r.Participants {
+		status, paidAt := BillSplitSharePending, (*time.Time)(nil)
+		if p.UserID == r.UserID {
+			status, paidAt = BillSplitSharePaid, &split.CreatedAt
+			split.PaidAmount += amounts[i]
+		}
+		_, err := tx.Exec(
+			ctx,
+			`INSERT INTO bill_split_shares (split_id, user_id, amount, status, paid_at) VALUES ($1, $2, $3, $4, $5)`,
+			split.ID,
+			p.UserID,
+			amounts[i],
+			status,
+			paidAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := split.settle(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return split, nil
+}
+
+// PayBillSplitShare pays the share of the user from their wallet to the creator
+func (r *BillSplitAction) PayBillSplitShare() (*BillSplit, *BillSplitShare, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	split, err := scanBillSplit(tx.QueryRow(
+		ctx,
+		`SELECT `+billSplitColumns+` FROM bill_splits WHERE id = $1 AND status = 'OPEN' FOR UPDATE`,
+		r.SplitID,
+	))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	share := &BillSplitShare{CreatorID: split.CreatorID, Title: split.Title, Currency: split.Currency}
+	err = tx.QueryRow(
+		ctx,
+		`SELECT id, split_id, user_id, amount FROM bill_split_shares WHERE split_id = $1 AND user_id = $2 AND status = 'PENDING'`,
+		split.ID,
+		r.UserID,
+	).Scan(&share.ID, &share.SplitID, &share.UserID, &share.Amount)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	key := TransferSourceBillSplit + ":" + share.ID.String()
+	transfer := &Transfer{
+		FromUserID:     share.UserID,
+		ToWalletID:     split.CreatorWalletID,
+		Amount:         share.Amount,
+		Source:         TransferSourceBillSplit,
+		SourceID:       &split.ID,
+		IdempotencyKey: &key,
+	}
+	if err := transfer.transfer(ctx, tx); err != nil {
+		return nil, nil, nil, err
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`UPDATE bill_split_shares SET status = 'PAID', transfer_id = $1, paid_at = CURRENT_TIMESTAMP WHERE id = $2
+		RETURNING status, transfer_id, paid_at, reminded_at`,
+		transfer.ID,
+		share.ID,
+	).Scan(&share.Status, &share.TransferID, &share.PaidAt, &share.RemindedAt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	split.PaidAmount += share.Amount
+	if err := split.settle(ctx, tx); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, nil, err
+	}
+	return split, share, transfer, nil
+}
+
+// CancelBillSplit stops collecting the unpaid shares of a split of the creator, paid shares are kept
+func (r *BillSplitAction) CancelBillSplit() (*BillSplit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	split, err := scanBillSplit(DB.QueryRow(
+		ctx,
+		`UPDATE bill_splits SET status = 'CANCELED', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND creator_id = $2 AND status = 'OPEN' RETURNING `+billSplitColumns,
+		r.SplitID,
+		r.UserID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if split.Shares, err = getBillSplitShares(ctx, DB, split); err != nil {
+		return nil, err
+	}
+	return split, nil
+}
+
+// GetBillSplit returns a split with its shares, for its creator or a participant
+func GetBillSplit(splitID, userID uuid.UUID) (*BillSplit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	split, err := scanBillSplit(DB.QueryRow(
+		ctx,
+		`SELECT `+billSplitColumns+` FROM bill_splits s WHERE id = $1 AND (creator_id = $2
+		OR EXISTS (SELECT 1 FROM bill_split_shares p WHERE p.split_id = s.id AND p.user_id = $2))`,
+		splitID,
+		userID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if split.Shares, err = getBillSplitShares(ctx, DB, split); err != nil {
+		return nil, err
+	}
+	return split, nil
+}
+
+// GetBillSplits lists the splits a user created or takes part in, newest first, without their shares
+func GetBillSplits(userID uuid.UUID, limit int) ([]BillSplit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+billSplitColumns+` FROM bill_splits s WHERE creator_id = $1
+		OR EXISTS (SELECT 1 FROM bill_split_shares p WHERE p.split_id = s.id AND p.user_id = $1)
+		ORDER BY created_at DESC LIMIT $2`,
+		userID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	splits := make([]BillSplit, 0)
+	for rows.Next() {
+		split, err := scanBillSplit(rows)
+		if err != nil {
+			return nil, err
+		}
+		splits = append(splits, *split)
+	}
+	return splits, nil
+}
+
+// RemindBillSplitShares marks the unpaid shares of open splits not reminded within an interval and returns them.
+// splitID and creatorID limit it to a split of its creator, both nil remind every split.
+func RemindBillSplitShares(splitID, creatorID uuid.UUID, interval time.Duration) ([]BillSplitShare, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`UPDATE bill_split_shares p SET reminded_at = CURRENT_TIMESTAMP
+		FROM bill_splits s
+		WHERE s.id = p.split_id AND s.status = 'OPEN' AND p.status = 'PENDING'
+			AND ($1::uuid IS NULL OR (s.id = $1 AND s.creator_id = $2))
+			AND COALESCE(p.reminded_at, p.created_at) <= $3
+		RETURNING p.id, p.split_id, p.user_id, p.amount, p.status, p.reminded_at, s.creator_id, s.title, s.currency`,
+		uuidOrNil(splitID),
+		creatorID,
+		time.Now().Add(-interval),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := make([]BillSplitShare, 0)
+	for rows.Next() {
+		share := BillSplitShare{}
+		err := rows.Scan(
+			&share.ID,
+			&share.SplitID,
+			&share.UserID,
+			&share.Amount,
+			&share.Status,
+			&share.RemindedAt,
+			&share.CreatorID,
+			&share.Title,
+			&share.Currency,
+		)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+// billSplitColumns is the column list scanned by scanBillSplit
+const billSplitColumns = `id, creator_id, creator_wallet_id, title, total_amount, paid_amount, currency, status, created_at, updated_at`
+
+// scanBillSplit scans a bill split row
+func scanBillSplit(row pgx.Row) (*BillSplit, error) {
+	s := &BillSplit{}
+	err := row.Scan(
+		&s.ID,
+		&s.CreatorID,
+		&s.CreatorWalletID,
+		&s.Title,
+		&s.TotalAmount,
+		&s.PaidAmount,
+		&s.Currency,
+		&s.Status,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// settle stores the paid amount of a split and settles it once every share is paid, then loads its shares
+func (s *BillSplit) settle(ctx context.Context, tx pgx.Tx) error {
+	if s.PaidAmount >= s.TotalAmount {
+		s.Status = BillSplitSettled
+	}
+	err := tx.QueryRow(
+		ctx,
+		`UPDATE bill_splits SET paid_amount = $1, status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3 RETURNING updated_at`,
+		s.PaidAmount,
+		s.Status,
+		s.ID,
+	).Scan(&s.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	s.Shares, err = getBillSplitShares(ctx, tx, s)
+	return err
+}
+
+// queryer runs queries on the pool or inside a transaction
+type queryer interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// getBillSplitShares lists the shares of a split
+func getBillSplitShares(ctx context.Context, q queryer, s *BillSplit) ([]BillSplitShare, error) {
+	rows, err := q.Query(
+		ctx,
+		`SELECT id, split_id, user_id, amount, status, transfer_id, paid_at, reminded_at
+		FROM bill_split_shares WHERE split_id = $1 ORDER BY created_at, id`,
+		s.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := make([]BillSplitShare, 0)
+	for rows.Next() {
+		share := BillSplitShare{CreatorID: s.CreatorID, Title: s.Title, Currency: s.Currency}
+		err := rows.Scan(
+			&share.ID,
+			&share.SplitID,
+			&share.UserID,
+			&share.Amount,
+			&share.Status,
+			&share.TransferID,
+			&share.PaidAt,
+			&share.RemindedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
@@ -0,0 +1,726 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TransferSourceCommission is the source of the commission payouts
+const TransferSourceCommission = "commission"
+
+// Commission entry statuses
+const (
+	CommissionAccrued = "ACCRUED"
+	CommissionPaid    = "PAID"
+)
+
+// Commission payout periods
+const (
+	CommissionDaily   = "daily"
+	CommissionWeekly  = "weekly"
+	CommissionMonthly = "monthly"
+)
+
+// ErrCommissionTiers is returned for tiers without a tier starting at 0 or with a repeated start
+var ErrCommissionTiers = errors.New("tiers must start at 0 with distinct min_amount")
+
+// ErrCommissionSource is returned for a rule on the commission payouts, which would earn commissions on themselves
+var ErrCommissionSource = errors.New("commission payouts cannot earn commissions")
+
+// CommissionTier is the commission of the operations from MinAmount up to the next tier
+type CommissionTier struct {
+	MinAmount int64 `json:"min_amount" binding:"min=0"`
+	Fixed     int64 `json:"fixed" binding:"min=0"`
+	BPS       int64 `json:"bps" binding:"min=0,max=10000"`
+}
+
+// CommissionRule is the tiered commission of an operation source, for one partner or for every partner.
+// Rules are never edited: a new rule replaces the active one, so past operations keep the rule of their time.
+type CommissionRule struct {
+	ID         uuid.UUID        `json:"id" db:"id,omitempty"`
+	PartnerID  *uuid.UUID       `json:"partner_id" db:"partner_id"` // every partner when nil
+	Source     string           `json:"source" db:"source"`         // transfer source in wallet_logs, e.g. agent_cash_in
+	Tiers      []CommissionTier `json:"tiers" db:"tiers"`
+	CreatedBy  uuid.UUID        `json:"created_by" db:"created_by"`
+	CreatedAt  time.Time        `json:"created_at" db:"created_at,omitempty"`
+	DisabledAt *time.Time       `json:"disabled_at,omitempty" db:"disabled_at"`
+}
+
+// CommissionRuleRequest is the struct for creating a commission rule
+type CommissionRuleRequest struct {
+	PartnerID *uuid.UUID       `json:"partner_id"`
+	Source    string           `json:"source" binding:"required,max=50"`
+	Tiers     []CommissionTier `json:"tiers" binding:"required,min=1,max=20,dive"`
+}
+
+// CommissionPartner is a user earning commissions who is not an agent, e.g. a distributor or a merchant aggregator
+type CommissionPartner struct {
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	WalletID  uuid.UUID `json:"wallet_id" db:"wallet_id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
+// CommissionPartnerRequest is the struct for registering a partner
+type CommissionPartnerRequest struct {
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+	Name   string    `json:"name" binding:"required,max=100"`
+}
+
+// CommissionEntry is the commission earned on one wallet log of a partner
+type CommissionEntry struct {
+	ID          uuid.UUID  `json:"id" db:"id,omitempty"`
+	PartnerID   uuid.UUID  `json:"partner_id" db:"partner_id"`
+	WalletLogID uuid.UUID  `json:"wallet_log_id" db:"wallet_log_id"`
+	RuleID      uuid.UUID  `json:"rule_id" db:"rule_id"`
+	Source      string     `json:"source" db:"source"`
+	Amount      int64      `json:"amount" db:"amount"`         // negative for a dispute clawback
+	Commission  int64      `json:"commission" db:"commission"` // negative for a dispute clawback
+	Currency    string     `json:"currency" db:"currency"`
+	Status      string     `json:"status" db:"status"`
+	PayoutID    *uuid.UUID `json:"payout_id,omitempty" db:"payout_id"`
+	OperationAt time.Time  `json:"operation_at" db:"operation_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at,omitempty"`
+}
+
+// CommissionPayout is the statement of the commissions paid to a partner for a period
+type CommissionPayout struct {
+	ID          uuid.UUID         `json:"id" db:"id,omitempty"`
+	PartnerID   uuid.UUID         `json:"partner_id" db:"partner_id"`
+	PeriodStart time.Time         `json:"period_start" db:"period_start"`
+	PeriodEnd   time.Time         `json:"period_end" db:"period_end"`
+	Operations  int               `json:"operations" db:"operations"`
+	Amount      int64             `json:"amount" db:"amount"` // of the operations
+	Commission  int64             `json:"commission" db:"commission"`
+	Currency    string            `json:"currency" db:"currency"`
+	TransferID  *uuid.UUID        `json:"transfer_id,omitempty" db:"transfer_id"`
+	CreatedAt   time.Time         `json:"created_at" db:"created_at,omitempty"`
+	Entries     []CommissionEntry `json:"entries,omitempty" db:"-"`
+}
+
+// CommissionBalance is what a partner earned and was not paid yet
+type CommissionBalance struct {
+	PartnerID  uuid.UUID `json:"partner_id"`
+	Operations int       `json:"operations"`
+	Commission int64     `json:"commission"`
+}
+
+// Commission returns the commission of an operation amount with the tier it falls in
+func (r *CommissionRule) Commission(amount int64) int64 {
+	var tier *CommissionTier
+	for i := range r.Tiers {
+		if r.Tiers[i].MinAmount <= amount && (tier == nil || r.Tiers[i].MinAmount > tier.MinAmount) {
+			tier = &r.Tiers[i]
+		}
+	}
+	if tier == nil {
+		return 0
+	}
+	return tier.Fixed + amount*tier.BPS/10000
+}
+
+// activeAt checks if the rule applied at a time
+func (r *CommissionRule) activeAt(at time.Time) bool {
+	return !r.CreatedAt.After(at) && (r.DisabledAt == nil || r.DisabledAt.After(at))
+}
+
+// matchCommissionRule returns the rule of a partner operation at a time, the partner rule before the default one
+func matchCommissionRule(rules []CommissionRule, partnerID uuid.UUID, source string, at time.Time) *CommissionRule {
+	var match *CommissionRule
+	for i := range rules {
+		r := &rules[i]
+		if r.Source != source || !r.activeAt(at) {
+			continue
+		}
+		if r.PartnerID != nil && *r.PartnerID == partnerID {
+			return r
+		}
+		if r.PartnerID == nil {
+			match = r
+		}
+	}
+	return match
+}
+
+// commissionRuleColumns is the column list scanned by scanCommissionRule
+const commissionRuleColumns = `id, partner_id, source, tiers, created_by, created_at, disabled_at`
+
+// scanCommissionRule scans a commission rule row
+func scanCommissionRule(row pgx.Row) (*CommissionRule, error) {
+	r := &CommissionRule{}
+	var tiers []byte
+	err := row.Scan(&r.ID, &r.PartnerID, &r.Source, &tiers, &r.CreatedBy, &r.CreatedAt, &r.DisabledAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(tiers, &r.Tiers); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CreateCommissionRule replaces the active rule of the partner, or the default one, for the source
+func (r *CommissionRuleRequest) CreateCommissionRule(adminID uuid.UUID) (*CommissionRule, error) {
+	if r.Source == TransferSourceCommission {
+		return nil, ErrCommissionSource
+	}
+	sort.Slice(r.Tiers, func(i, j int) bool { return r.Tiers[i].MinAmount < r.Tiers[j].MinAmount })
+	if r.Tiers[0].MinAmount != 0 {
+		return nil, ErrCommissionTiers
+	}
+	for i := 1; i < len(r.Tiers); i++ {
+		if r.Tiers[i].MinAmount == r.Tiers[i-1].MinAmount {
+			return nil, ErrCommissionTiers
+		}
+	}
+	tiers, err := json.Marshal(r.Tiers)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE commission_rules SET disabled_at = CURRENT_TIMESTAMP
+		WHERE source = $1 AND partner_id IS NOT DISTINCT FROM $2 AND disabled_at IS NULL`,
+		r.Source,
+		r.PartnerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	rule, err := scanCommissionRule(tx.QueryRow(
+		ctx,
+		`INSERT INTO commission_rules (partner_id, source, tiers, created_by) VALUES ($1, $2, $3, $4)
+		RETURNING `+commissionRuleColumns,
+		r.PartnerID,
+		r.Source,
+		tiers,
+		adminID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// DisableCommissionRule stops a rule, the operations of its source earn the default rule or nothing from now on
+func DisableCommissionRule(ruleID uuid.UUID) (*CommissionRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanCommissionRule(DB.QueryRow(
+		ctx,
+		`UPDATE commission_rules SET disabled_at = CURRENT_TIMESTAMP WHERE id = $1 AND disabled_at IS NULL
+		RETURNING `+commissionRuleColumns,
+		ruleID,
+	))
+}
+
+// GetCommissionRules lists the commission rules, or only the active ones
+func GetCommissionRules(activeOnly bool) ([]CommissionRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return getCommissionRules(ctx, DB, activeOnly)
+}
+
+// getCommissionRules lists the commission rules with a queryer
+func getCommissionRules(ctx context.Context, q queryer, activeOnly bool) ([]CommissionRule, error) {
+	rows, err := q.Query(
+		ctx,
+		`SELECT `+commissionRuleColumns+` FROM commission_rules
+		WHERE NOT $1 OR disabled_at IS NULL ORDER BY source, partner_id NULLS FIRST, created_at DESC`,
+		activeOnly,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make([]CommissionRule, 0)
+	for rows.Next() {
+		rule, err := scanCommissionRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, rows.Err()
+}
+
+// commissionFor returns the commission a partner earns now on an operation, 0 without a rule
+func commissionFor(ctx context.Context, q queryer, partnerID uuid.UUID, source string, amount int64) (int64, error) {
+	rules, err := getCommissionRules(ctx, q, true)
+	if err != nil {
+		return 0, err
+	}
+	rule := matchCommissionRule(rules, partnerID, source, time.Now())
+	if rule == nil {
+		return 0, nil
+	}
+	return rule.Commission(amount), nil
+}
+
+// RegisterCommissionPartner makes a user with an active wallet a commission partner, paid into that wallet
+func (r *CommissionPartnerRequest) RegisterCommissionPartner() (*CommissionPartner, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	p := &CommissionPartner{}
+	err := DB.QueryRow(
+		ctx,
+		`INSERT INTO commission_partners (user_id, wallet_id, name)
+		SELECT user_id, id, $2 FROM wallets WHERE user_id = $1 AND is_active = true
+		ON CONFLICT (user_id) DO UPDATE SET name = EXCLUDED.name
+		RETURNING user_id, wallet_id, name, created_at`,
+		r.UserID,
+		r.Name,
+	).Scan(&p.UserID, &p.WalletID, &p.Name, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// commissionPartners selects the agents and the partners with the wallet their operations are logged on
+const commissionPartners = `SELECT user_id, wallet_id FROM agents UNION SELECT user_id, wallet_id FROM commission_partners`
+
+// AccrueCommissions records the commission of the partner wallet logs with a rule at their time,
+// from since on. A wallet log is accrued once, the returned count is the new entries.
+func AccrueCommissions(since time.Time, limit int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	rules, err := getCommissionRules(ctx, tx, false)
+	if err != nil {
+		return 0, err
+	}
+	if len(rules) == 0 {
+		return 0, nil
+	}
+
+	rows, err := tx.Query(
+		ctx,
+		`SELECT l.id, p.user_id, l.metadata->>'source', l.activity_amount - COALESCE(d.amount, 0), l.currency, l.created_at
+		FROM (`+commissionPartners+`) p
+		JOIN wallet_logs l ON l.wallet_id = p.wallet_id
+		LEFT JOIN commission_entries e ON e.wallet_log_id = l.id
+		LEFT JOIN disputes d ON d.transfer_id = l.reference_id AND d.status = 'RESOLVED_PAYER'
+		WHERE l.created_at >= $1 AND e.id IS NULL AND l.metadata->>'source' <> '`+TransferSourceCommission+`' AND EXISTS (
+			SELECT 1 FROM commission_rules r WHERE r.source = l.metadata->>'source'
+			AND (r.partner_id IS NULL OR r.partner_id = p.user_id)
+			AND r.created_at <= l.created_at AND (r.disabled_at IS NULL OR r.disabled_at > l.created_at)
+		)
+		ORDER BY l.created_at LIMIT $2`,
+		since,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+	entries := make([]CommissionEntry, 0)
+	for rows.Next() {
+		e := CommissionEntry{}
+		if err := rows.Scan(&e.WalletLogID, &e.PartnerID, &e.Source, &e.Amount, &e.Currency, &e.OperationAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		rule := matchCommissionRule(rules, e.PartnerID, e.Source, e.OperationAt)
+		if rule == nil || e.Amount <= 0 {
+			continue
+		}
+		e.RuleID, e.Commission = rule.ID, rule.Commission(e.Amount)
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	accrued := 0
+	for _, e := range entries {
+		tag, err := tx.Exec(
+			ctx,
+			`INSERT INTO commission_entries (partner_id, wallet_log_id, rule_id, source, amount, commission, currency, operation_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (wallet_log_id) DO NOTHING`,
+			e.PartnerID,
+			e.WalletLogID,
+			e.RuleID,
+			e.Source,
+			e.Amount,
+			e.Commission,
+			e.Currency,
+			e.OperationAt,
+		)
+		if err != nil {
+			return 0, err
+		}
+		accrued += int(tag.RowsAffected())
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return accrued, nil
+}
+
+// CommissionPeriodStart returns the start of the payout period containing a time, in UTC.
+// Weeks start on Monday.
+func CommissionPeriodStart(period string, at time.Time) time.Time {
+	day := at.UTC().Truncate(24 * time.Hour)
+	switch period {
+	case CommissionDaily:
+		return day
+	case CommissionWeekly:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	default:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// DueCommission is a partner with accrued commissions in a currency
+type DueCommission struct {
+	PartnerID uuid.UUID
+	Currency  string
+}
+
+// GetDueCommissions lists the partners and currencies with accrued commissions from before the period end
+func GetDueCommissions(periodEnd time.Time) ([]DueCommission, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT DISTINCT partner_id, currency FROM commission_entries WHERE status = 'ACCRUED' AND operation_at < $1`,
+		periodEnd,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	due := make([]DueCommission, 0)
+	for rows.Next() {
+		var d DueCommission
+		if err := rows.Scan(&d.PartnerID, &d.Currency); err != nil {
+			return nil, err
+		}
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+// PayCommissions pays a partner the commissions in a currency accrued before the period end from the commission
+// wallet and records the statement. It returns nil when there was nothing left to pay.
+func (d DueCommission) PayCommissions(periodStart, periodEnd time.Time, commissionWalletID uuid.UUID) (*CommissionPayout, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	// The statement exists before the entries reference it
+	payout := &CommissionPayout{
+		ID:          uuid.New(),
+		PartnerID:   d.PartnerID,
+		PeriodStart: periodStart,
+		PeriodEnd:   periodEnd,
+		Currency:    d.Currency,
+	}
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO commission_payouts (id, partner_id, period_start, period_end, operations, amount, commission, currency)
+		VALUES ($1, $2, $3, $4, 0, 0, 0, $5) RETURNING created_at`,
+		payout.ID,
+		payout.PartnerID,
+		payout.PeriodStart,
+		payout.PeriodEnd,
+		payout.Currency,
+	).Scan(&payout.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`WITH paid AS (
+			UPDATE commission_entries SET status = 'PAID', payout_id = $1
+			WHERE partner_id = $2 AND currency = $3 AND status = 'ACCRUED' AND operation_at < $4
+			RETURNING amount, commission
+		)
+		SELECT count(*), COALESCE(sum(amount), 0), COALESCE(sum(commission), 0) FROM paid`,
+		payout.ID,
+		d.PartnerID,
+		d.Currency,
+		periodEnd,
+	).Scan(&payout.Operations, &payout.Amount, &payout.Commission)
+	if err != nil {
+		return nil, nil, err
+	}
+	// A net clawback is left accrued, to be taken from the next commissions
+	if payout.Operations == 0 || payout.Commission < 0 {
+		return nil, nil, nil
+	}
+
+	var transfer *Transfer
+	if payout.Commission > 0 {
+		key := TransferSourceCommission + ":" + d.PartnerID.String() + ":" + d.Currency + ":" + periodEnd.Format(time.DateOnly)
+		transfer = &Transfer{
+			FromWalletID:   commissionWalletID,
+			ToUserID:       d.PartnerID,
+			Amount:         payout.Commission,
+			Source:         TransferSourceCommission,
+			SourceID:       &payout.ID,
+			IdempotencyKey: &key,
+		}
+		err = tx.QueryRow(ctx, `SELECT user_id FROM wallets WHERE id = $1`, commissionWalletID).Scan(&transfer.FromUserID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := transfer.transfer(ctx, tx); err != nil {
+			return nil, nil, err
+		}
+		if transfer.Currency != d.Currency {
+			return nil, nil, ErrCurrencyMismatch
+		}
+		payout.TransferID = &transfer.ID
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE commission_payouts SET operations = $1, amount = $2, commission = $3, transfer_id = $4 WHERE id = $5`,
+		payout.Operations,
+		payout.Amount,
+		payout.Commission,
+		payout.TransferID,
+		payout.ID,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return payout, transfer, nil
+}
+
+// reverseDisputedCommissions claws back the commissions earned on a transfer refunded to the payer by a dispute.
+// Each partner gets a negative entry on its resolution log, in proportion to the refunded amount: an entry
+// not paid yet nets out in the same payout and a paid one is taken from the next commissions.
+func reverseDisputedCommissions(ctx context.Context, tx pgx.Tx, dispute *Dispute, activity string) error {
+	_, err := tx.Exec(
+		ctx,
+		`INSERT INTO commission_entries (partner_id, wallet_log_id, rule_id, source, amount, commission, currency, operation_at)
+		SELECT e.partner_id, r.id, e.rule_id, e.source, -LEAST($2, e.amount), -(e.commission * LEAST($2, e.amount) / e.amount),
+			e.currency, r.created_at
+		FROM commission_entries e
+		JOIN wallet_logs l ON l.id = e.wallet_log_id
+		JOIN wallet_logs r ON r.wallet_id = l.wallet_id AND r.reference_id = $3 AND r.activity = $4
+		WHERE l.reference_id = $1 AND e.amount > 0
+		ON CONFLICT (wallet_log_id) DO NOTHING`,
+		dispute.TransferID,
+		dispute.Amount,
+		dispute.ID,
+		activity,
+	)
+	return err
+}
+
+// commissionPayoutColumns is the column list scanned by scanCommissionPayout
+const commissionPayoutColumns = `id, partner_id, period_start, period_end, operations, amount, commission, currency,
+	transfer_id, created_at`
+
+// scanCommissionPayout scans a commission payout row
+func scanCommissionPayout(row pgx.Row) (*CommissionPayout, error) {
+	p := &CommissionPayout{}
+	err := row.Scan(
+		&p.ID,
+		&p.PartnerID,
+		&p.PeriodStart,
+		&p.PeriodEnd,
+		&p.Operations,
+		&p.Amount,
+		&p.Commission,
+		&p.Currency,
+		&p.TransferID,
+		&p.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetCommissionPayouts lists the latest statements of a partner, or of every partner when partnerID is nil
+func GetCommissionPayouts(partnerID uuid.UUID, limit int) ([]CommissionPayout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+commissionPayoutColumns+` FROM commission_payouts
+		WHERE $1::uuid IS NULL OR partner_id = $1 ORDER BY created_at DESC LIMIT $2`,
+		uuidOrNil(partnerID),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payouts := make([]CommissionPayout, 0)
+	for rows.Next() {
+		payout, err := scanCommissionPayout(rows)
+		if err != nil {
+			return nil, err
+		}
+		payouts = append(payouts, *payout)
+	}
+	return payouts, rows.Err()
+}
+
+// commissionEntryColumns is the column list scanned by getCommissionEntries
+const commissionEntryColumns = `id, partner_id, wallet_log_id, rule_id, source, amount, commission, currency, status,
+	payout_id, operation_at, created_at`
+
+// getCommissionEntries lists the entries of a partner matching a condition on $2
+func getCommissionEntries(ctx context.Context, partnerID uuid.UUID, where string, arg any) ([]CommissionEntry, error) {
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+commissionEntryColumns+` FROM commission_entries WHERE partner_id = $1 AND `+where+` ORDER BY operation_at`,
+		partnerID,
+		arg,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]CommissionEntry, 0)
+	for rows.Next() {
+		e := CommissionEntry{}
+		err := rows.Scan(
+			&e.ID,
+			&e.PartnerID,
+			&e.WalletLogID,
+			&e.RuleID,
+			&e.Source,
+			&e.Amount,
+			&e.Commission,
+			&e.Currency,
+			&e.Status,
+			&e.PayoutID,
+			&e.OperationAt,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetCommissionPayout returns a statement of a partner with its entries
+func GetCommissionPayout(payoutID, partnerID uuid.UUID) (*CommissionPayout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	payout, err := scanCommissionPayout(DB.QueryRow(
+		ctx,
+		`SELECT `+commissionPayoutColumns+` FROM commission_payouts WHERE id = $1 AND partner_id = $2`,
+		payoutID,
+		partnerID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if payout.Entries, err = getCommissionEntries(ctx, partnerID, `payout_id = $2`, payoutID); err != nil {
+		return nil, err
+	}
+	return payout, nil
+}
+
+// GetAccruedCommissions returns the unpaid commission of a partner with its entries
+func GetAccruedCommissions(partnerID uuid.UUID) (*CommissionBalance, []CommissionEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entries, err := getCommissionEntries(ctx, partnerID, `status = $2`, CommissionAccrued)
+	if err != nil {
+		return nil, nil, err
+	}
+	balance := &CommissionBalance{PartnerID: partnerID, Operations: len(entries)}
+	for _, e := range entries {
+		balance.Commission += e.Commission
+	}
+	return balance, entries, nil
+}
+
+// RenderCommissionStatement writes a statement and its entries as CSV
+func RenderCommissionStatement(payout *CommissionPayout) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{"operation_at", "source", "amount", "commission", "currency", "wallet_log_id"}); err != nil {
+		return nil, err
+	}
+	for _, e := range payout.Entries {
+		record := []string{
+			e.OperationAt.UTC().Format(time.RFC3339),
+			e.Source,
+			strconv.FormatInt(e.Amount, 10),
+			strconv.FormatInt(e.Commission, 10),
+			e.Currency,
+			e.WalletLogID.String(),
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	total := []string{"total", "", strconv.FormatInt(payout.Amount, 10), strconv.FormatInt(payout.Commission, 10), payout.Currency, ""}
+	if err := w.Write(total); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
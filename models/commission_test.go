@@ -0,0 +1,221 @@
+package models
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+func TestCommissionRuleCommission(t *testing.T) {
+	rule := CommissionRule{Tiers: []CommissionTier{
+		{MinAmount: 10000, Fixed: 50, BPS: 50},
+		{MinAmount: 0, Fixed: 25, BPS: 100},
+		{MinAmount: 100000, Fixed: 0, BPS: 20},
+	}}
+	tests := []struct {
+		name   string
+		amount int64
+		want   int64
+	}{
+		{"first tier", 5000, 25 + 50},
+		{"tier start", 10000, 50 + 50},
+		{"middle tier", 50000, 50 + 250},
+		{"last tier", 200000, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rule.Commission(tt.amount); got != tt.want {
+				t.Errorf("Commission(%d) = %d, want %d", tt.amount, got, tt.want)
+			}
+		})
+	}
+
+	if got := (&CommissionRule{Tiers: []CommissionTier{{MinAmount: 1000, BPS: 100}}}).Commission(500); got != 0 {
+		t.Errorf("Commission below every tier = %d, want 0", got)
+	}
+}
+
+func TestMatchCommissionRule(t *testing.T) {
+	partner, other := uuid.New(), uuid.New()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	disabled := start.AddDate(0, 1, 0)
+	rules := []CommissionRule{
+		{ID: uuid.New(), Source: "agent_cash_in", CreatedAt: start},
+		{ID: uuid.New(), Source: "agent_cash_in", PartnerID: &partner, CreatedAt: start, DisabledAt: &disabled},
+		{ID: uuid.New(), Source: "agent_cash_out", CreatedAt: disabled},
+	}
+	tests := []struct {
+		name    string
+		partner uuid.UUID
+		source  string
+		at      time.Time
+		want    *CommissionRule
+	}{
+		{"partner rule first", partner, "agent_cash_in", start.AddDate(0, 0, 1), &rules[1]},
+		{"default after partner rule ends", partner, "agent_cash_in", disabled, &rules[0]},
+		{"default for other partner", other, "agent_cash_in", start.AddDate(0, 0, 1), &rules[0]},
+		{"before rule exists", other, "agent_cash_in", start.Add(-time.Second), nil},
+		{"rule not started", partner, "agent_cash_out", start, nil},
+		{"unknown source", partner, "transfer", disabled, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchCommissionRule(rules, tt.partner, tt.source, tt.at); got != tt.want {
+				t.Errorf("matchCommissionRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommissionPeriodStart(t *testing.T) {
+	at := time.Date(2026, 10, 15, 13, 30, 0, 0, time.FixedZone("WAT", 3600)) // Thursday
+	tests := []struct {
+		period string
+		at     time.Time
+		want   time.Time
+	}{
+		{CommissionDaily, at, time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)},
+		{CommissionWeekly, at, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)},
+		{CommissionWeekly, time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC), time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)},
+		{CommissionWeekly, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{CommissionMonthly, at, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{"", at, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.period+" "+tt.at.String(), func(t *testing.T) {
+			if got := CommissionPeriodStart(tt.period, tt.at); !got.Equal(tt.want) {
+				t.Errorf("CommissionPeriodStart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayCommissions(t *testing.T) {
+	testDB(t)
+
+	treasury := testWallet(t, 1000000)
+	customer := testWallet(t, 100000)
+	partner := testWallet(t, 0)
+	source := "test_sale_" + partner.UserID.String()[:8]
+
+	if _, err := (&CommissionPartnerRequest{UserID: partner.UserID, Name: "partner"}).RegisterCommissionPartner(); err != nil {
+		t.Fatalf("RegisterCommissionPartner: %v", err)
+	}
+	rule := CommissionRuleRequest{PartnerID: &partner.UserID, Source: source, Tiers: []CommissionTier{{MinAmount: 0, Fixed: 10, BPS: 100}}}
+	if _, err := rule.CreateCommissionRule(uuid.New()); err != nil {
+		t.Fatalf("CreateCommissionRule: %v", err)
+	}
+	for _, amount := range []int64{10000, 20000} {
+		transfer := Transfer{FromUserID: customer.UserID, ToUserID: partner.UserID, Amount: amount, Source: source}
+		if err := transfer.CreateTransfer(); err != nil {
+			t.Fatalf("CreateTransfer: %v", err)
+		}
+	}
+
+	if accrued, err := AccrueCommissions(time.Now().Add(-time.Hour), 1000); err != nil || accrued < 2 {
+		t.Fatalf("AccrueCommissions() = %d, %v, want at least 2", accrued, err)
+	}
+	if accrued, err := AccrueCommissions(time.Now().Add(-time.Hour), 1000); err != nil {
+		t.Fatalf("AccrueCommissions again: %v", err)
+	} else if balance, _, _ := GetAccruedCommissions(partner.UserID); balance.Operations != 2 {
+		t.Fatalf("accrued %d operations after a second run (%d new), want 2", balance.Operations, accrued)
+	}
+
+	periodEnd := time.Now().Add(time.Minute)
+	due := DueCommission{PartnerID: partner.UserID, Currency: partner.Currency}
+	payout, transfer, err := due.PayCommissions(periodEnd.AddDate(0, -1, 0), periodEnd, treasury.ID)
+	if err != nil {
+		t.Fatalf("PayCommissions: %v", err)
+	}
+	want := int64(10 + 100 + 10 + 200)
+	if payout == nil || transfer == nil || payout.Commission != want || payout.Operations != 2 || payout.Amount != 30000 {
+		t.Fatalf("PayCommissions() = %+v, %+v, want commission %d on 2 operations", payout, transfer, want)
+	}
+	if got := testBalance(t, partner.ID); got != 30000+want {
+		t.Errorf("partner balance = %d, want %d", got, 30000+want)
+	}
+	if got := testBalance(t, treasury.ID); got != 1000000-want {
+		t.Errorf("treasury balance = %d, want %d", got, 1000000-want)
+	}
+
+	statement, err := GetCommissionPayout(payout.ID, partner.UserID)
+	if err != nil || len(statement.Entries) != 2 || statement.TransferID == nil || *statement.TransferID != transfer.ID {
+		t.Fatalf("GetCommissionPayout() = %+v, %v", statement, err)
+	}
+	if again, _, err := due.PayCommissions(periodEnd.AddDate(0, -1, 0), periodEnd, treasury.ID); err != nil || again != nil {
+		t.Errorf("second PayCommissions() = %+v, %v, want nothing to pay", again, err)
+	}
+
+	ctx := context.Background()
+	var paid int
+	if err := DB.QueryRow(ctx, `SELECT count(*) FROM commission_entries WHERE payout_id = $1 AND status = 'PAID'`, payout.ID).Scan(&paid); err != nil || paid != 2 {
+		t.Errorf("paid entries = %d, %v, want 2", paid, err)
+	}
+}
+
+func TestReverseDisputedCommissions(t *testing.T) {
+	testDB(t)
+
+	treasury := testWallet(t, 1000000)
+	customer := testWallet(t, 100000)
+	partner := testWallet(t, 0)
+	source := "test_sale_" + partner.UserID.String()[:8]
+
+	if _, err := (&CommissionPartnerRequest{UserID: partner.UserID, Name: "partner"}).RegisterCommissionPartner(); err != nil {
+		t.Fatalf("RegisterCommissionPartner: %v", err)
+	}
+	rule := CommissionRuleRequest{PartnerID: &partner.UserID, Source: TransferSourceCommission, Tiers: []CommissionTier{{MinAmount: 0, Fixed: 10}}}
+	if _, err := rule.CreateCommissionRule(uuid.New()); err != ErrCommissionSource {
+		t.Fatalf("CreateCommissionRule(commission) error = %v, want %v", err, ErrCommissionSource)
+	}
+	rule.Source, rule.Tiers = source, []CommissionTier{{MinAmount: 0, Fixed: 10, BPS: 100}}
+	if _, err := rule.CreateCommissionRule(uuid.New()); err != nil {
+		t.Fatalf("CreateCommissionRule: %v", err)
+	}
+
+	disputed := Transfer{FromUserID: customer.UserID, ToUserID: partner.UserID, Amount: 10000, Source: source}
+	if err := disputed.CreateTransfer(); err != nil {
+		t.Fatalf("CreateTransfer: %v", err)
+	}
+	if _, err := AccrueCommissions(time.Now().Add(-time.Hour), 1000); err != nil {
+		t.Fatalf("AccrueCommissions: %v", err)
+	}
+	periodEnd := time.Now().Add(time.Minute)
+	due := DueCommission{PartnerID: partner.UserID, Currency: partner.Currency}
+	if payout, _, err := due.PayCommissions(periodEnd.AddDate(0, -1, 0), periodEnd, treasury.ID); err != nil || payout == nil || payout.Commission != 110 {
+		t.Fatalf("PayCommissions() = %+v, %v, want commission 110", payout, err)
+	}
+
+	// Half of the paid operation is refunded, half of its commission comes back
+	dispute, err := (&DisputeRequest{UserID: customer.UserID, TransferID: disputed.ID, Amount: 5000, Category: "OTHER", Reason: "test"}).OpenDispute()
+	if err != nil {
+		t.Fatalf("OpenDispute: %v", err)
+	}
+	if _, err := (&DisputeResolveRequest{DisputeID: dispute.ID, InFavorOf: "PAYER", Note: "test"}).ResolveDispute(uuid.New()); err != nil {
+		t.Fatalf("ResolveDispute: %v", err)
+	}
+	if balance, _, err := GetAccruedCommissions(partner.UserID); err != nil || balance.Commission != -55 {
+		t.Fatalf("GetAccruedCommissions() = %+v, %v, want commission -55", balance, err)
+	}
+	periodEnd = time.Now().Add(time.Minute)
+	if payout, _, err := due.PayCommissions(periodEnd.AddDate(0, -1, 0), periodEnd, treasury.ID); err != nil || payout != nil {
+		t.Fatalf("PayCommissions() of a clawback = %+v, %v, want nothing paid", payout, err)
+	}
+
+	next := Transfer{FromUserID: customer.UserID, ToUserID: partner.UserID, Amount: 20000, Source: source}
+	if err := next.CreateTransfer(); err != nil {
+		t.Fatalf("CreateTransfer: %v", err)
+	}
+	if _, err := AccrueCommissions(time.Now().Add(-time.Hour), 1000); err != nil {
+		t.Fatalf("AccrueCommissions: %v", err)
+	}
+	periodEnd = time.Now().Add(time.Minute)
+	payout, _, err := due.PayCommissions(periodEnd.AddDate(0, -1, 0), periodEnd, treasury.ID)
+	if err != nil || payout == nil || payout.Commission != 210-55 {
+		t.Fatalf("PayCommissions() = %+v, %v, want commission %d", payout, err, 210-55)
+	}
+	if got := testBalance(t, treasury.ID); got != 1000000-110-155 {
+		t.Errorf("treasury balance = %d, want %d", got, 1000000-110-155)
+	}
+}
@@ -40,6 +40,37 @@ func DBConnect() {
 			if err := createTables(); err != nil {
 				log.Printf("Unable to create tables: %v\n", err)
 			}
+
+			// Migrate the data before the jobs and the routes start, a single replica runs it
+			if _, err := RunExclusive("migrate_balance_reads", migrateBalanceReads); err != nil {
+				log.Printf("Unable to migrate balance reads: %v\n", err)
+			}
 		},
 	)
 }
+
+// RunExclusive runs fn only if no other replica holds the named lock
+func RunExclusive(name string, fn func() error) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := DB.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+
+	var acquired bool
+	err = conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, name).Scan(&acquired)
+	if err != nil {
+		return false, err
+	}
+	if !acquired {
+		return false, nil
+	}
+	defer func() {
+		_, _ = conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, name)
+	}()
+
+	return true, fn()
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"os"
+	"testing"
+	"time"
+)
+
+// testDB connects DB to TEST_DATABASE_URL and creates the tables, the test is skipped without it.
+// The database must be disposable: the tests write rows they do not clean up.
+func testDB(t *testing.T) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	if DB == nil {
+		pool, err := pgxpool.New(context.Background(), url)
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		DB = pool
+		if err := createTables(); err != nil {
+			t.Fatalf("create tables: %v", err)
+		}
+	}
+}
+
+// testWallet creates an active wallet holding a balance for a new user
+func testWallet(t *testing.T, balance int64) *Wallet {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	w := &Wallet{UserID: uuid.New()}
+	err := DB.QueryRow(
+		ctx,
+		`INSERT INTO wallets (user_id, balance) VALUES ($1, $2) RETURNING id, balance, currency`,
+		w.UserID,
+		balance,
+	).Scan(&w.ID, &w.Balance, &w.Currency)
+	if err != nil {
+		t.Fatalf("create wallet: %v", err)
+	}
+	return w
+}
+
+// testBalance returns the balance of a wallet
+func testBalance(t *testing.T, walletID uuid.UUID) int64 {
+	t.Helper()
+	var balance int64
+	if err := DB.QueryRow(context.Background(), `SELECT balance FROM wallets WHERE id = $1`, walletID).Scan(&balance); err != nil {
+		t.Fatalf("get balance: %v", err)
+	}
+	return balance
+}
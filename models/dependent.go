@@ -0,0 +1,568 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Dependent errors
+var (
+	ErrDependentWallet     = errors.New("user already has a wallet")
+	ErrDependentInvitation = errors.New("child already invited")
+	ErrGuardianControl     = errors.New("refused by guardian controls")
+)
+
+// Dependent invitation statuses
+const (
+	InvitationPending  = "PENDING"
+	InvitationAccepted = "ACCEPTED"
+	InvitationDeclined = "DECLINED" // by the child
+	InvitationCanceled = "CANCELED" // by the guardian, or another guardian was accepted
+)
+
+// Dependent is a wallet of a child run under the controls of a guardian
+type Dependent struct {
+	ChildID             uuid.UUID `json:"child_id" db:"child_id"`
+	WalletID            uuid.UUID `json:"wallet_id" db:"wallet_id"`
+	GuardianID          uuid.UUID `json:"guardian_id" db:"guardian_id"`
+	GuardianWalletID    uuid.UUID `json:"guardian_wallet_id" db:"guardian_wallet_id"`
+	Currency            string    `json:"currency" db:"currency"`
+	PerTransactionLimit int64     `json:"per_transaction_limit" db:"per_transaction_limit"` // 0 for no limit
+	DailyLimit          int64     `json:"daily_limit" db:"daily_limit"`                     // spent per UTC day, 0 for no limit
+	BlockedCategories   []string  `json:"blocked_categories" db:"blocked_categories"`       // merchant category codes
+	GuardianLocked      bool      `json:"guardian_locked" db:"guardian_locked"`             // only the guardian unlocks the wallet
+	Balance             int64     `json:"balance" db:"-"`
+	SpentToday          int64     `json:"spent_today" db:"-"`
+	CreatedAt           time.Time `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt           time.Time `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// DependentInvitation is a guardian request to open the wallet of a child, waiting for the child or an admin
+type DependentInvitation struct {
+	ID               uuid.UUID  `json:"id" db:"id,omitempty"`
+	ChildID          uuid.UUID  `json:"child_id" db:"child_id"`
+	GuardianID       uuid.UUID  `json:"guardian_id" db:"guardian_id"`
+	GuardianWalletID uuid.UUID  `json:"guardian_wallet_id" db:"guardian_wallet_id"`
+	Currency         string     `json:"currency" db:"currency"`
+	Status           string     `json:"status" db:"status"`
+	ExpiresAt        time.Time  `json:"expires_at" db:"expires_at"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at,omitempty"`
+	DecidedAt        *time.Time `json:"decided_at,omitempty" db:"decided_at"`
+}
+
+// DependentInvitationAction is the struct for accepting or declining an invitation, user_id is the caller
+type DependentInvitationAction struct {
+	UserID       uuid.UUID `json:"user_id"`
+	InvitationID uuid.UUID `json:"invitation_id" binding:"required"`
+}
+
+// dependentInvitationColumns is the column list scanned by scanDependentInvitation
+const dependentInvitationColumns = `id, child_id, guardian_id, guardian_wallet_id, currency, status, expires_at, created_at, decided_at`
+
+// scanDependentInvitation scans a dependent invitation row
+func scanDependentInvitation(row pgx.Row) (*DependentInvitation, error) {
+	i := &DependentInvitation{}
+	err := row.Scan(
+		&i.ID,
+		&i.ChildID,
+		&i.GuardianID,
+		&i.GuardianWalletID,
+		&i.Currency,
+		&i.Status,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.DecidedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// DependentRequest is the struct for inviting a child to open a wallet
+type DependentRequest struct {
+	UserID  uuid.UUID `json:"user_id" binding:"required"`
+	ChildID uuid.UUID `json:"child_id" binding:"required"`
+}
+
+// DependentControlsRequest is the struct for the spending controls of a child wallet
+type DependentControlsRequest struct {
+	UserID              uuid.UUID `json:"user_id" binding:"required"`
+	ChildID             uuid.UUID `json:"child_id" binding:"required"`
+	PerTransactionLimit int64     `json:"per_transaction_limit" binding:"min=0"`
+	DailyLimit          int64     `json:"daily_limit" binding:"min=0"`
+	BlockedCategories   []string  `json:"blocked_categories" binding:"max=50,dive,numeric,len=4"`
+}
+
+// DependentAllowanceRequest is the struct for a pocket money schedule, run as a standing order of the guardian
+type DependentAllowanceRequest struct {
+	UserID   uuid.UUID  `json:"user_id" binding:"required"`
+	ChildID  uuid.UUID  `json:"child_id" binding:"required"`
+	Amount   int64      `json:"amount" binding:"required,numeric,gt=0,min=100,max=2000000"`
+	Schedule string     `json:"schedule" binding:"required,max=100"`
+	Timezone string     `json:"timezone" binding:"max=64"`
+	StartAt  time.Time  `json:"start_at" binding:"required"`
+	EndAt    *time.Time `json:"end_at"`
+}
+
+// dependentColumns is the column list scanned by scanDependent
+const dependentColumns = `child_id, wallet_id, guardian_id, guardian_wallet_id, currency, per_transaction_limit, daily_limit,
+	blocked_categories, guardian_locked, created_at, updated_at`
+
+// scanDependent scans a dependent row
+func scanDependent(row pgx.Row) (*Dependent, error) {
+	d := &Dependent{}
+	err := row.Scan(
+		&d.ChildID,
+		&d.WalletID,
+		&d.GuardianID,
+		&d.GuardianWalletID,
+		&d.Currency,
+		&d.PerTransactionLimit,
+		&d.DailyLimit,
+		&d.BlockedCategories,
+		&d.GuardianLocked,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// InviteDependent invites a child without a wallet to open one under the guardian, in the currency of the
+// guardian wallet. Nothing is linked until the child, or an admin after checking the relationship, accepts.
+// A dependent cannot be the guardian of another child.
+func (r *DependentRequest) InviteDependent(ttl time.Duration) (*DependentInvitation, error) {
+	if r.ChildID == r.UserID {
+		return nil, ErrSameWallet
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var guardianWalletID uuid.UUID
+	var currency string
+	err := DB.QueryRow(
+		ctx,
+		`SELECT id, currency FROM wallets WHERE user_id = $1 AND is_active = true
+		AND NOT EXISTS (SELECT 1 FROM dependents WHERE child_id = $1)`,
+		r.UserID,
+	).Scan(&guardianWalletID, &currency)
+	if err != nil {
+		return nil, err
+	}
+	var hasWallet bool
+	err = DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM wallets WHERE user_id = $1 AND is_active = true)`, r.ChildID).Scan(&hasWallet)
+	if err != nil {
+		return nil, err
+	}
+	if hasWallet {
+		return nil, ErrDependentWallet
+	}
+
+	invitation, err := scanDependentInvitation(DB.QueryRow(
+		ctx,
+		`INSERT INTO dependent_invitations (child_id, guardian_id, guardian_wallet_id, currency, expires_at)
+		VALUES ($1, $2, $3, $4, $5) ON CONFLICT (child_id, guardian_id) WHERE status = 'PENDING' DO NOTHING
+		RETURNING `+dependentInvitationColumns,
+		r.ChildID,
+		r.UserID,
+		guardianWalletID,
+		currency,
+		time.Now().Add(ttl),
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDependentInvitation
+	}
+	return invitation, err
+}
+
+// AcceptDependentInvitation opens the wallet of the child and links it to the guardian.
+// The child accepts its own invitations, admins pass uuid.Nil to accept any of them.
+func AcceptDependentInvitation(invitationID, childID uuid.UUID) (*Dependent, *DependentInvitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	invitation, err := scanDependentInvitation(tx.QueryRow(
+		ctx,
+		`UPDATE dependent_invitations SET status = 'ACCEPTED', decided_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND ($2::uuid IS NULL OR child_id = $2) AND status = 'PENDING' AND expires_at > CURRENT_TIMESTAMP
+		RETURNING `+dependentInvitationColumns,
+		invitationID,
+		uuidOrNil(childID),
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var walletID uuid.UUID
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO wallets (user_id, currency) SELECT $1, $2
+		WHERE NOT EXISTS (SELECT 1 FROM wallets WHERE user_id = $1 AND is_active = true) RETURNING id`,
+		invitation.ChildID,
+		invitation.Currency,
+	).Scan(&walletID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, ErrDependentWallet
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dependent, err := scanDependent(tx.QueryRow(
+		ctx,
+		`INSERT INTO dependents (child_id, wallet_id, guardian_id, guardian_wallet_id, currency)
+		VALUES ($1, $2, $3, $4, $5) RETURNING `+dependentColumns,
+		invitation.ChildID,
+		walletID,
+		invitation.GuardianID,
+		invitation.GuardianWalletID,
+		invitation.Currency,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The other invitations of the child are void once it has a guardian
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE dependent_invitations SET status = 'CANCELED', decided_at = CURRENT_TIMESTAMP
+		WHERE child_id = $1 AND status = 'PENDING'`,
+		invitation.ChildID,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return dependent, invitation, nil
+}
+
+// DeclineDependentInvitation closes a pending invitation, declined by the child or canceled by the guardian
+func DeclineDependentInvitation(invitationID, userID uuid.UUID) (*DependentInvitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanDependentInvitation(DB.QueryRow(
+		ctx,
+		`UPDATE dependent_invitations
+		SET status = CASE WHEN child_id = $2 THEN 'DECLINED' ELSE 'CANCELED' END, decided_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (child_id = $2 OR guardian_id = $2) AND status = 'PENDING'
+		RETURNING `+dependentInvitationColumns,
+		invitationID,
+		userID,
+	))
+}
+
+// GetDependentInvitations lists the latest invitations sent or received by a user
+func GetDependentInvitations(userID uuid.UUID) ([]DependentInvitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+dependentInvitationColumns+` FROM dependent_invitations
+		WHERE child_id = $1 OR guardian_id = $1 ORDER BY created_at DESC LIMIT 50`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := make([]DependentInvitation, 0)
+	for rows.Next() {
+		invitation, err := scanDependentInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *invitation)
+	}
+	return invitations, rows.Err()
+}
+
+// SetDependentControls replaces the spending controls of a child of the guardian
+func (r *DependentControlsRequest) SetDependentControls() (*Dependent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if r.BlockedCategories == nil {
+		r.BlockedCategories = []string{}
+	}
+	return scanDependent(DB.QueryRow(
+		ctx,
+		`UPDATE dependents SET per_transaction_limit = $1, daily_limit = $2, blocked_categories = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE child_id = $4 AND guardian_id = $5 RETURNING `+dependentColumns,
+		r.PerTransactionLimit,
+		r.DailyLimit,
+		r.BlockedCategories,
+		r.ChildID,
+		r.UserID,
+	))
+}
+
+// CreateAllowance schedules pocket money from the guardian wallet to the child,
+// it is paused or canceled like any standing order of the guardian
+func (r *DependentAllowanceRequest) CreateAllowance() (*StandingOrder, error) {
+	dependent, err := GetDependent(r.ChildID, r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	order := StandingOrderRequest{
+		UserID:      dependent.GuardianID,
+		WalletID:    dependent.GuardianWalletID,
+		ToUserID:    dependent.ChildID,
+		Amount:      r.Amount,
+		Description: "Allowance",
+		Schedule:    r.Schedule,
+		Timezone:    r.Timezone,
+		StartAt:     r.StartAt,
+		EndAt:       r.EndAt,
+	}
+	return order.CreateStandingOrder()
+}
+
+// setGuardianLock records that the guardian locked or unlocked the wallet of a child,
+// it does nothing for a caller who is not the guardian
+func setGuardianLock(ctx context.Context, tx pgx.Tx, childID, guardianID uuid.UUID, locked bool) error {
+	_, err := tx.Exec(
+		ctx,
+		`UPDATE dependents SET guardian_locked = $1, updated_at = CURRENT_TIMESTAMP WHERE child_id = $2 AND guardian_id = $3`,
+		locked,
+		childID,
+		guardianID,
+	)
+	return err
+}
+
+// IsGuardianLocked checks if the wallet of a child was locked by its guardian
+func IsGuardianLocked(childID uuid.UUID) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var locked bool
+	err := DB.QueryRow(ctx, `SELECT guardian_locked FROM dependents WHERE child_id = $1`, childID).Scan(&locked)
+	return err == nil && locked
+}
+
+// IsGuardian checks if a user is the guardian of a child
+func IsGuardian(childID, guardianID uuid.UUID) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var guardian bool
+	err := DB.QueryRow(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM dependents WHERE child_id = $1 AND guardian_id = $2)`,
+		childID,
+		guardianID,
+	).Scan(&guardian)
+	return err == nil && guardian
+}
+
+// spentToday returns what a wallet spent since the start of the UTC day: the transfers it sent, the escrows
+// it funded and its withdrawals. A withdrawal counts from its hold unless it failed, so queued withdrawals cannot
+// pass the limit, and the withdrawals of the payment service count from their log. Holds released, reversals
+// and escrow refunds are not spending.
+func spentToday(ctx context.Context, q queryer, walletID uuid.UUID) (int64, error) {
+	var spent int64
+	err := q.QueryRow(
+		ctx,
+		`WITH today AS (SELECT date_trunc('day', CURRENT_TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS start)
+		SELECT
+			(SELECT COALESCE(sum(activity_amount), 0) FROM wallet_logs, today
+			WHERE wallet_id = $1 AND created_at >= today.start
+			AND (activity = $2 OR (activity = $7 AND new_balance < old_balance)))
+			+
+			(SELECT COALESCE(sum(old_balance - new_balance), 0) FROM wallet_logs, today
+			WHERE wallet_id = $1 AND created_at >= today.start AND activity LIKE $8 AND new_balance < old_balance)
+			+
+			(SELECT COALESCE(sum(amount), 0) FROM transactions, today
+			WHERE wallet_id = $1 AND type = $3 AND status IN ($4, $5, $6) AND created_at >= today.start)`,
+		walletID,
+		ActivityTransferOut,
+		TransactionWithdrawal,
+		TransactionPending,
+		TransactionProcessing,
+		TransactionCompleted,
+		ActivityWithdrawal,
+		escrowActivityPrefix+"%",
+	).Scan(&spent)
+	return spent, err
+}
+
+// checkDependentSpending applies the guardian controls to a debit of a child wallet, inside the transaction
+// that locked the wallet. Money sent back to the guardian is not limited, toWalletID is uuid.Nil for a withdrawal.
+func checkDependentSpending(ctx context.Context, tx pgx.Tx, walletID, toWalletID uuid.UUID, amount int64) error {
+	dependent, err := scanDependent(tx.QueryRow(
+		ctx,
+		`SELECT `+dependentColumns+` FROM dependents WHERE wallet_id = $1`,
+		walletID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if toWalletID == dependent.GuardianWalletID {
+		return nil
+	}
+
+	if dependent.PerTransactionLimit > 0 && amount > dependent.PerTransactionLimit {
+		return fmt.Errorf("%w: amount above the limit of %d", ErrGuardianControl, dependent.PerTransactionLimit)
+	}
+	if dependent.DailyLimit > 0 {
+		spent, err := spentToday(ctx, tx, walletID)
+		if err != nil {
+			return err
+		}
+		if spent+amount > dependent.DailyLimit {
+			return fmt.Errorf("%w: daily limit of %d reached", ErrGuardianControl, dependent.DailyLimit)
+		}
+	}
+	if len(dependent.BlockedCategories) > 0 && toWalletID != uuid.Nil {
+		var blocked bool
+		err := tx.QueryRow(
+			ctx,
+			`SELECT EXISTS (SELECT 1 FROM merchants WHERE wallet_id = $1 AND category_code = ANY($2))`,
+			toWalletID,
+			dependent.BlockedCategories,
+		).Scan(&blocked)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return fmt.Errorf("%w: merchant category blocked", ErrGuardianControl)
+		}
+	}
+	return nil
+}
+
+// GetDependents lists the children of a guardian with their balance and today's spending
+func GetDependents(guardianID uuid.UUID) ([]Dependent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+dependentColumns+` FROM dependents WHERE guardian_id = $1 ORDER BY created_at`,
+		guardianID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dependents := make([]Dependent, 0)
+	for rows.Next() {
+		dependent, err := scanDependent(rows)
+		if err != nil {
+			return nil, err
+		}
+		dependents = append(dependents, *dependent)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range dependents {
+		if err := dependents[i].loadSpending(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return dependents, nil
+}
+
+// GetDependent returns a child of a guardian with its balance and today's spending
+func GetDependent(childID, guardianID uuid.UUID) (*Dependent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	dependent, err := scanDependent(DB.QueryRow(
+		ctx,
+		`SELECT `+dependentColumns+` FROM dependents WHERE child_id = $1 AND guardian_id = $2`,
+		childID,
+		guardianID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if err := dependent.loadSpending(ctx); err != nil {
+		return nil, err
+	}
+	return dependent, nil
+}
+
+// loadSpending reads the balance of the child wallet and what was spent today
+func (d *Dependent) loadSpending(ctx context.Context) error {
+	if err := DB.QueryRow(ctx, `SELECT balance FROM wallets WHERE id = $1`, d.WalletID).Scan(&d.Balance); err != nil {
+		return err
+	}
+	var err error
+	d.SpentToday, err = spentToday(ctx, DB, d.WalletID)
+	return err
+}
+
+// GetDependentHistory lists the latest logs of the wallet of a child of the guardian
+func GetDependentHistory(childID, guardianID uuid.UUID, limit int) ([]WalletLog, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT l.id, l.user_id, l.wallet_id, l.activity, l.old_balance, l.new_balance, l.activity_amount, l.currency,
+		l.metadata, l.reference_id, l.created_at
+		FROM wallet_logs l JOIN dependents d ON d.wallet_id = l.wallet_id
+		WHERE d.child_id = $1 AND d.guardian_id = $2 ORDER BY l.created_at DESC LIMIT $3`,
+		childID,
+		guardianID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	walletLogs := make([]WalletLog, 0)
+	for rows.Next() {
+		walletLog := WalletLog{}
+		err := rows.Scan(
+			&walletLog.ID,
+			&walletLog.UserID,
+			&walletLog.WalletID,
+			&walletLog.Activity,
+			&walletLog.OldBalance,
+			&walletLog.NewBalance,
+			&walletLog.ActivityAmount,
+			&walletLog.Currency,
+			&walletLog.Metadata,
+			&walletLog.ReferenceID,
+			&walletLog.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		walletLogs = append(walletLogs, walletLog)
+	}
+	return walletLogs, rows.Err()
+}
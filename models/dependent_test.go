@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"testing"
+	"time"
+)
+
+func TestDependentInvitation(t *testing.T) {
+	testDB(t)
+
+	guardian := testWallet(t, 0)
+	childID := uuid.New()
+	request := DependentRequest{UserID: guardian.UserID, ChildID: childID}
+
+	invitation, err := request.InviteDependent(time.Hour)
+	if err != nil {
+		t.Fatalf("InviteDependent: %v", err)
+	}
+	if _, err := request.InviteDependent(time.Hour); !errors.Is(err, ErrDependentInvitation) {
+		t.Fatalf("second InviteDependent = %v, want ErrDependentInvitation", err)
+	}
+
+	var wallets int
+	if err := DB.QueryRow(context.Background(), `SELECT COUNT(*) FROM wallets WHERE user_id = $1`, childID).Scan(&wallets); err != nil || wallets != 0 {
+		t.Fatalf("child has %d wallets before accepting (%v), want 0", wallets, err)
+	}
+
+	// Only the invited child can accept
+	if _, _, err := AcceptDependentInvitation(invitation.ID, uuid.New()); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("AcceptDependentInvitation by another user = %v, want ErrNoRows", err)
+	}
+	dependent, accepted, err := AcceptDependentInvitation(invitation.ID, childID)
+	if err != nil {
+		t.Fatalf("AcceptDependentInvitation: %v", err)
+	}
+	if accepted.Status != InvitationAccepted || dependent.GuardianID != guardian.UserID || dependent.Currency != guardian.Currency {
+		t.Fatalf("accepted %+v as %+v", accepted, dependent)
+	}
+	if _, _, err := AcceptDependentInvitation(invitation.ID, childID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("accepting twice = %v, want ErrNoRows", err)
+	}
+	if _, err := request.InviteDependent(time.Hour); !errors.Is(err, ErrDependentWallet) {
+		t.Fatalf("InviteDependent after accepting = %v, want ErrDependentWallet", err)
+	}
+}
+
+func TestSpentToday(t *testing.T) {
+	testDB(t)
+
+	child := testWallet(t, 10000)
+	friend := testWallet(t, 0)
+
+	transfer := Transfer{FromUserID: child.UserID, ToUserID: friend.UserID, Amount: 1000, Source: "test"}
+	if err := transfer.CreateTransfer(); err != nil {
+		t.Fatalf("CreateTransfer: %v", err)
+	}
+	failed, err := (&Transaction{UserID: child.UserID, WalletID: child.ID, Amount: 500}).CreateWithdrawal()
+	if err != nil {
+		t.Fatalf("CreateWithdrawal: %v", err)
+	}
+	if _, err := (&TransactionStatusRequest{TransactionID: failed.ID, Status: TransactionFailed}).UpdateStatus(); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+	if _, err := (&Transaction{UserID: child.UserID, WalletID: child.ID, Amount: 300}).CreateWithdrawal(); err != nil {
+		t.Fatalf("CreateWithdrawal: %v", err)
+	}
+
+	// The transfer and the pending withdrawal, not the failed one
+	spent, err := spentToday(context.Background(), DB, child.ID)
+	if err != nil || spent != 1300 {
+		t.Fatalf("spentToday() = %d, %v, want 1300", spent, err)
+	}
+
+	// Funding an escrow is spending
+	escrow := EscrowRequest{UserID: child.UserID, SellerID: friend.UserID, Amount: 700, Description: "test"}
+	if _, err := escrow.CreateEscrow(); err != nil {
+		t.Fatalf("CreateEscrow: %v", err)
+	}
+	spent, err = spentToday(context.Background(), DB, child.ID)
+	if err != nil || spent != 2000 {
+		t.Fatalf("spentToday() after an escrow = %d, %v, want 2000", spent, err)
+	}
+}
@@ -0,0 +1,418 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Dispute statuses, a resolved or withdrawn dispute is final
+const (
+	DisputeOpen              = "OPEN"
+	DisputeInReview          = "IN_REVIEW" // worked by an admin
+	DisputeResolvedPayer     = "RESOLVED_PAYER"
+	DisputeResolvedRecipient = "RESOLVED_RECIPIENT"
+	DisputeWithdrawn         = "WITHDRAWN"
+)
+
+// Dispute categories
+const (
+	DisputeUnauthorized   = "UNAUTHORIZED"
+	DisputeNotReceived    = "NOT_RECEIVED"
+	DisputeNotAsDescribed = "NOT_AS_DESCRIBED"
+	DisputeDuplicate      = "DUPLICATE"
+	DisputeOther          = "OTHER"
+)
+
+// Where the disputed amount is. A provisional hold or credit moves it while the dispute is worked,
+// the resolution moves it to its final party.
+const (
+	DisputeFundsRecipient = "RECIPIENT"
+	DisputeFundsHeld      = "HELD"
+	DisputeFundsPayer     = "PAYER"
+)
+
+// disputeActivityPrefix prefixes the activity of the dispute wallet logs: DISPUTE_HELD, DISPUTE_CREDITED or DISPUTE_<final status>
+const disputeActivityPrefix = "DISPUTE_"
+
+// DisputeWindow is how long after a transfer its payer can dispute it
+const DisputeWindow = 90 * 24 * time.Hour
+
+// Dispute errors
+var (
+	ErrDisputeWindow = errors.New("transfer is too old to be disputed")
+	ErrDisputeAmount = errors.New("disputed amount is above the transfer amount")
+	ErrDisputeExists = errors.New("transfer already disputed")
+	ErrDisputeFunds  = errors.New("dispute funds are already there")
+)
+
+// Dispute is the struct for a case opened by the payer of a transfer against its recipient
+type Dispute struct {
+	ID                uuid.UUID         `json:"id" db:"id,omitempty"`
+	TransferID        uuid.UUID         `json:"transfer_id" db:"transfer_id"`
+	TransferSource    string            `json:"transfer_source" db:"transfer_source"` // e.g. merchant_payment
+	PayerID           uuid.UUID         `json:"payer_id" db:"payer_id"`
+	PayerWalletID     uuid.UUID         `json:"payer_wallet_id" db:"payer_wallet_id"`
+	RecipientID       uuid.UUID         `json:"recipient_id" db:"recipient_id"`
+	RecipientWalletID uuid.UUID         `json:"recipient_wallet_id" db:"recipient_wallet_id"`
+	Amount            int64             `json:"amount" db:"amount"`
+	Currency          string            `json:"currency" db:"currency"`
+	Category          string            `json:"category" db:"category"`
+	Reason            string            `json:"reason" db:"reason"`
+	Status            string            `json:"status" db:"status"`
+	Funds             string            `json:"funds" db:"funds"`
+	ResolvedBy        *uuid.UUID        `json:"resolved_by,omitempty" db:"resolved_by"`
+	ResolutionNote    string            `json:"resolution_note,omitempty" db:"resolution_note"`
+	ResolvedAt        *time.Time        `json:"resolved_at,omitempty" db:"resolved_at"`
+	Receivable        int64             `json:"receivable" db:"receivable"` // taken below zero from a drained wallet, owed by its party
+	Evidence          []DisputeEvidence `json:"evidence,omitempty" db:"-"`
+	CreatedAt         time.Time         `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt         time.Time         `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// DisputeEvidence is a note added to a dispute by a party or an admin
+type DisputeEvidence struct {
+	ID         uuid.UUID `json:"id" db:"id,omitempty"`
+	DisputeID  uuid.UUID `json:"dispute_id" db:"dispute_id"`
+	AuthorID   uuid.UUID `json:"author_id" db:"author_id"`
+	AuthorRole string    `json:"author_role" db:"author_role"` // payer, recipient or admin
+	Note       string    `json:"note" db:"note"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
+// DisputeRequest is the struct for the payer disputing a transfer, a zero amount disputes all of it
+type DisputeRequest struct {
+	UserID     uuid.UUID `json:"user_id" binding:"required"`
+	TransferID uuid.UUID `json:"transfer_id" binding:"required"`
+	Amount     int64     `json:"amount" binding:"omitempty,gt=0"`
+	Category   string    `json:"category" binding:"required,oneof=UNAUTHORIZED NOT_RECEIVED NOT_AS_DESCRIBED DUPLICATE OTHER"`
+	Reason     string    `json:"reason" binding:"required,max=500"`
+}
+
+// DisputeEvidenceRequest is the struct for adding a note to a dispute, the user is set from the token for an admin
+type DisputeEvidenceRequest struct {
+	UserID    uuid.UUID `json:"user_id"`
+	DisputeID uuid.UUID `json:"dispute_id" binding:"required"`
+	Note      string    `json:"note" binding:"required,max=2000"`
+}
+
+// DisputeAction is the struct for the payer withdrawing a dispute
+type DisputeAction struct {
+	UserID    uuid.UUID `json:"user_id" binding:"required"`
+	DisputeID uuid.UUID `json:"dispute_id" binding:"required"`
+}
+
+// DisputeProvisionalRequest is the struct for an admin holding the disputed amount or crediting it to the payer
+type DisputeProvisionalRequest struct {
+	DisputeID uuid.UUID `json:"dispute_id" binding:"required"`
+	Action    string    `json:"action" binding:"required,oneof=HOLD CREDIT"`
+}
+
+// DisputeResolveRequest is the struct for an admin resolving a dispute
+type DisputeResolveRequest struct {
+	DisputeID uuid.UUID `json:"dispute_id" binding:"required"`
+	InFavorOf string    `json:"in_favor_of" binding:"required,oneof=PAYER RECIPIENT"`
+	Note      string    `json:"note" binding:"required,max=500"`
+}
+
+// disputeColumns is the column list scanned by scanDispute
+const disputeColumns = `id, transfer_id, transfer_source, payer_id, payer_wallet_id, recipient_id, recipient_wallet_id, amount,
+	currency, category, reason, status, funds, resolved_by, resolution_note, resolved_at, receivable, created_at, updated_at`
+
+// scanDispute scans a dispute row
+func scanDispute(row pgx.Row) (*Dispute, error) {
+	d := &Dispute{}
+	err := row.Scan(
+		&d.ID,
+		&d.TransferID,
+		&d.TransferSource,
+		&d.PayerID,
+		&d.PayerWalletID,
+		&d.RecipientID,
+		&d.RecipientWalletID,
+		&d.Amount,
+		&d.Currency,
+		&d.Category,
+		&d.Reason,
+		&d.Status,
+		&d.Funds,
+		&d.ResolvedBy,
+		&d.ResolutionNote,
+		&d.ResolvedAt,
+		&d.Receivable,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// OpenDispute opens a case against a transfer of the payer, within the dispute window
+func (r *DisputeRequest) OpenDispute() (*Dispute, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var amount int64
+	var createdAt time.Time
+	err := DB.QueryRow(
+		ctx,
+		`SELECT amount, created_at FROM transfers WHERE id = $1 AND from_user_id = $2`,
+		r.TransferID,
+		r.UserID,
+	).Scan(&amount, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(createdAt) > DisputeWindow {
+		return nil, ErrDisputeWindow
+	}
+	if r.Amount == 0 {
+		r.Amount = amount
+	}
+	if r.Amount > amount {
+		return nil, ErrDisputeAmount
+	}
+
+	dispute, err := scanDispute(DB.QueryRow(
+		ctx,
+		`INSERT INTO disputes (transfer_id, transfer_source, payer_id, payer_wallet_id, recipient_id, recipient_wallet_id, amount, currency, category, reason)
+		SELECT id, source, from_user_id, from_wallet_id, to_user_id, to_wallet_id, $2, currency, $3, $4 FROM transfers WHERE id = $1
+		ON CONFLICT (transfer_id) DO NOTHING RETURNING `+disputeColumns,
+		r.TransferID,
+		r.Amount,
+		r.Category,
+		r.Reason,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDisputeExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dispute, nil
+}
+
+// AddDisputeEvidence adds a note of a party, or of an admin, to an unresolved dispute
+func (r *DisputeEvidenceRequest) AddDisputeEvidence(admin bool) (*DisputeEvidence, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	evidence := &DisputeEvidence{DisputeID: r.DisputeID, AuthorID: r.UserID, Note: r.Note}
+	err := DB.QueryRow(
+		ctx,
+		`INSERT INTO dispute_evidence (dispute_id, author_id, author_role, note)
+		SELECT id, $2, CASE WHEN $4 THEN 'admin' WHEN $2 = payer_id THEN 'payer' ELSE 'recipient' END, $3
+		FROM disputes WHERE id = $1 AND ($4 OR $2 IN (payer_id, recipient_id)) AND status IN ('OPEN', 'IN_REVIEW')
+		RETURNING author_role, id, created_at`,
+		r.DisputeID,
+		r.UserID,
+		r.Note,
+		admin,
+	).Scan(&evidence.AuthorRole, &evidence.ID, &evidence.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return evidence, nil
+}
+
+// ProvisionalDispute holds the disputed amount out of the recipient wallet or credits it to the payer
+// while the dispute is worked. It moves the case in review.
+func (r *DisputeProvisionalRequest) ProvisionalDispute() (*Dispute, error) {
+	funds := DisputeFundsHeld
+	if r.Action == "CREDIT" {
+		funds = DisputeFundsPayer
+	}
+	return moveDispute(r.DisputeID, uuid.Nil, DisputeInReview, funds, nil, "")
+}
+
+// ResolveDispute resolves a dispute in favor of the payer or the recipient and moves the funds accordingly
+func (r *DisputeResolveRequest) ResolveDispute(adminID uuid.UUID) (*Dispute, error) {
+	status, funds := DisputeResolvedRecipient, DisputeFundsRecipient
+	if r.InFavorOf == "PAYER" {
+		status, funds = DisputeResolvedPayer, DisputeFundsPayer
+	}
+	return moveDispute(r.DisputeID, uuid.Nil, status, funds, &adminID, r.Note)
+}
+
+// WithdrawDispute closes an unresolved dispute of the payer, any hold or provisional credit goes back to the recipient
+func (r *DisputeAction) WithdrawDispute() (*Dispute, error) {
+	return moveDispute(r.DisputeID, r.UserID, DisputeWithdrawn, DisputeFundsRecipient, nil, "")
+}
+
+// disputeFundsPositions gives, for a location of the funds, the amount the payer got back and the amount the recipient gave
+func disputeFundsPositions(funds string, amount int64) (payer, recipient int64) {
+	switch funds {
+	case DisputeFundsPayer:
+		return amount, amount
+	case DisputeFundsHeld:
+		return 0, amount
+	default:
+		return 0, 0
+	}
+}
+
+// moveDispute moves an unresolved dispute, of a payer when payerID is set, to a status and its funds to a location,
+// with the matching ledger adjustments on both wallets, in one transaction
+func moveDispute(disputeID, payerID uuid.UUID, status, funds string, resolvedBy *uuid.UUID, note string) (*Dispute, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	dispute, err := scanDispute(tx.QueryRow(
+		ctx,
+		`SELECT `+disputeColumns+` FROM disputes
+		WHERE id = $1 AND ($2::uuid IS NULL OR payer_id = $2) AND status IN ('OPEN', 'IN_REVIEW') FOR UPDATE`,
+		disputeID,
+		uuidOrNil(payerID),
+	))
+	if err != nil {
+		return nil, err
+	}
+	if status == DisputeInReview && dispute.Funds == funds {
+		return nil, ErrDisputeFunds
+	}
+
+	payerBefore, recipientBefore := disputeFundsPositions(dispute.Funds, dispute.Amount)
+	payerAfter, recipientAfter := disputeFundsPositions(funds, dispute.Amount)
+	final := status != DisputeInReview
+
+	dispute, err = scanDispute(tx.QueryRow(
+		ctx,
+		`UPDATE disputes SET status = $1, funds = $2, resolved_by = $3, resolution_note = $4,
+		resolved_at = CASE WHEN $5 THEN CURRENT_TIMESTAMP END, updated_at = CURRENT_TIMESTAMP WHERE id = $6 RETURNING `+disputeColumns,
+		status,
+		funds,
+		resolvedBy,
+		note,
+		final,
+		dispute.ID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	activity := disputeActivityPrefix + status
+	switch {
+	case final:
+	case funds == DisputeFundsHeld:
+		activity = disputeActivityPrefix + "HELD"
+	default:
+		activity = disputeActivityPrefix + "CREDITED"
+	}
+	m := &ledgerMove{
+		activity: activity,
+		source:   "dispute",
+		sourceID: dispute.ID,
+		amount:   dispute.Amount,
+		currency: dispute.Currency,
+		forced:   true,
+		overdraw: true,
+		sides: [2]ledgerSide{
+			{walletID: dispute.PayerWalletID, userID: dispute.PayerID, role: "payer", delta: payerAfter - payerBefore},
+			{walletID: dispute.RecipientWalletID, userID: dispute.RecipientID, role: "recipient", delta: recipientBefore - recipientAfter},
+		},
+	}
+	if err := m.apply(ctx, tx); err != nil {
+		return nil, err
+	}
+	if m.deficit > 0 {
+		dispute, err = scanDispute(tx.QueryRow(
+			ctx,
+			`UPDATE disputes SET receivable = receivable + $1 WHERE id = $2 RETURNING `+disputeColumns,
+			m.deficit,
+			dispute.ID,
+		))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if status == DisputeResolvedPayer {
+		if err := reverseDisputedCommissions(ctx, tx, dispute, activity); err != nil {
+			return nil, err
+		}
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return dispute, nil
+}
+
+// GetDispute returns a dispute with its evidence, of a party when userID is set
+func GetDispute(disputeID, userID uuid.UUID) (*Dispute, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	dispute, err := scanDispute(DB.QueryRow(
+		ctx,
+		`SELECT `+disputeColumns+` FROM disputes WHERE id = $1 AND ($2::uuid IS NULL OR $2 IN (payer_id, recipient_id))`,
+		disputeID,
+		uuidOrNil(userID),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT id, dispute_id, author_id, author_role, note, created_at FROM dispute_evidence WHERE dispute_id = $1 ORDER BY created_at`,
+		dispute.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dispute.Evidence = make([]DisputeEvidence, 0)
+	for rows.Next() {
+		e := DisputeEvidence{}
+		if err := rows.Scan(&e.ID, &e.DisputeID, &e.AuthorID, &e.AuthorRole, &e.Note, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		dispute.Evidence = append(dispute.Evidence, e)
+	}
+	return dispute, rows.Err()
+}
+
+// GetDisputes lists the disputes of a user as payer or recipient, every dispute when userID is nil, newest first.
+// No statuses lists every status.
+func GetDisputes(userID uuid.UUID, statuses []string, limit int) ([]Dispute, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+disputeColumns+` FROM disputes
+		WHERE ($1::uuid IS NULL OR $1 IN (payer_id, recipient_id)) AND (cardinality($2::text[]) = 0 OR status = ANY($2))
+		ORDER BY created_at DESC LIMIT $3`,
+		uuidOrNil(userID),
+		statuses,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	disputes := make([]Dispute, 0)
+	for rows.Next() {
+		dispute, err := scanDispute(rows)
+		if err != nil {
+			return nil, err
+		}
+		disputes = append(disputes, *dispute)
+	}
+	return disputes, nil
+}
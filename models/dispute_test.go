@@ -0,0 +1,41 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestResolveDisputeDrainedRecipient(t *testing.T) {
+	testDB(t)
+
+	payer := testWallet(t, 10000)
+	recipient := testWallet(t, 0)
+	other := testWallet(t, 0)
+
+	paid := Transfer{FromUserID: payer.UserID, ToUserID: recipient.UserID, Amount: 3000, Source: "test"}
+	if err := paid.CreateTransfer(); err != nil {
+		t.Fatalf("CreateTransfer: %v", err)
+	}
+	spent := Transfer{FromUserID: recipient.UserID, ToUserID: other.UserID, Amount: 2000, Source: "test"}
+	if err := spent.CreateTransfer(); err != nil {
+		t.Fatalf("CreateTransfer: %v", err)
+	}
+
+	dispute, err := (&DisputeRequest{UserID: payer.UserID, TransferID: paid.ID, Category: "OTHER", Reason: "test"}).OpenDispute()
+	if err != nil {
+		t.Fatalf("OpenDispute: %v", err)
+	}
+	resolved, err := (&DisputeResolveRequest{DisputeID: dispute.ID, InFavorOf: "PAYER", Note: "test"}).ResolveDispute(uuid.New())
+	if err != nil {
+		t.Fatalf("ResolveDispute against a drained recipient: %v", err)
+	}
+	if resolved.Status != DisputeResolvedPayer || resolved.Receivable != 2000 {
+		t.Fatalf("ResolveDispute() = %s with receivable %d, want %s with 2000", resolved.Status, resolved.Receivable, DisputeResolvedPayer)
+	}
+	if got := testBalance(t, payer.ID); got != 10000 {
+		t.Errorf("payer balance = %d, want 10000", got)
+	}
+	if got := testBalance(t, recipient.ID); got != -2000 {
+		t.Errorf("recipient balance = %d, want -2000", got)
+	}
+}
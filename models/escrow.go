@@ -0,0 +1,361 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Escrow statuses, every status but FUNDED and DISPUTED is final
+const (
+	EscrowFunded   = "FUNDED"   // held until the buyer confirms the delivery
+	EscrowDisputed = "DISPUTED" // held until an admin resolves it
+	EscrowReleased = "RELEASED" // paid to the seller
+	EscrowRefunded = "REFUNDED" // paid back to the buyer
+	EscrowSplit    = "SPLIT"    // shared by an admin between both parties
+)
+
+// escrowActivityPrefix prefixes the status in the activity of the escrow wallet logs, e.g. ESCROW_RELEASED
+const escrowActivityPrefix = "ESCROW_"
+
+// Escrow errors
+var (
+	ErrEscrowExists     = errors.New("escrow already exists for this reference")
+	ErrEscrowResolution = errors.New("seller amount is above the escrow amount")
+)
+
+// Escrow is the struct for buyer funds held until a marketplace order is delivered
+type Escrow struct {
+	ID             uuid.UUID  `json:"id" db:"id,omitempty"`
+	BuyerID        uuid.UUID  `json:"buyer_id" db:"buyer_id"`
+	BuyerWalletID  uuid.UUID  `json:"buyer_wallet_id" db:"buyer_wallet_id"`
+	SellerID       uuid.UUID  `json:"seller_id" db:"seller_id"`
+	SellerWalletID uuid.UUID  `json:"seller_wallet_id" db:"seller_wallet_id"`
+	Amount         int64      `json:"amount" db:"amount"`
+	Currency       string     `json:"currency" db:"currency"`
+	Reference      string     `json:"reference" db:"reference"` // marketplace order id
+	Description    string     `json:"description" db:"description"`
+	Status         string     `json:"status" db:"status"`
+	ReleasedAmount int64      `json:"released_amount" db:"released_amount"` // paid to the seller
+	RefundedAmount int64      `json:"refunded_amount" db:"refunded_amount"` // paid back to the buyer
+	DisputedBy     *uuid.UUID `json:"disputed_by,omitempty" db:"disputed_by"`
+	DisputeReason  string     `json:"dispute_reason,omitempty" db:"dispute_reason"`
+	ResolvedBy     *uuid.UUID `json:"resolved_by,omitempty" db:"resolved_by"` // admin of a disputed escrow
+	ResolutionNote string     `json:"resolution_note,omitempty" db:"resolution_note"`
+	ClosedAt       *time.Time `json:"closed_at,omitempty" db:"closed_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// EscrowRequest is the struct for the buyer funding an escrow for a seller
+type EscrowRequest struct {
+	UserID      uuid.UUID `json:"user_id" binding:"required"`
+	SellerID    uuid.UUID `json:"seller_id" binding:"required"`
+	Amount      int64     `json:"amount" binding:"required,numeric,gt=0,min=100,max=2000000"`
+	Reference   string    `json:"reference" binding:"max=100"`
+	Description string    `json:"description" binding:"required,max=255"`
+}
+
+// EscrowAction is the struct for confirming or canceling an escrow
+type EscrowAction struct {
+	UserID   uuid.UUID `json:"user_id" binding:"required"`
+	EscrowID uuid.UUID `json:"escrow_id" binding:"required"`
+}
+
+// EscrowDisputeRequest is the struct for a party disputing an escrow
+type EscrowDisputeRequest struct {
+	UserID   uuid.UUID `json:"user_id" binding:"required"`
+	EscrowID uuid.UUID `json:"escrow_id" binding:"required"`
+	Reason   string    `json:"reason" binding:"required,max=500"`
+}
+
+// EscrowResolveRequest is the struct for an admin sharing a disputed escrow, the buyer gets the rest
+type EscrowResolveRequest struct {
+	EscrowID     uuid.UUID `json:"escrow_id" binding:"required"`
+	SellerAmount int64     `json:"seller_amount" binding:"min=0"`
+	Note         string    `json:"note" binding:"required,max=500"`
+}
+
+// escrowColumns is the column list scanned by scanEscrow
+const escrowColumns = `id, buyer_id, buyer_wallet_id, seller_id, seller_wallet_id, amount, currency, reference, description,
+	status, released_amount, refunded_amount, disputed_by, dispute_reason, resolved_by, resolution_note, closed_at,
+	created_at, updated_at`
+
+// scanEscrow scans an escrow row
+func scanEscrow(row pgx.Row) (*Escrow, error) {
+	e := &Escrow{}
+	err := row.Scan(
+		&e.ID,
+		&e.BuyerID,
+		&e.BuyerWalletID,
+		&e.SellerID,
+		&e.SellerWalletID,
+		&e.Amount,
+		&e.Currency,
+		&e.Reference,
+		&e.Description,
+		&e.Status,
+		&e.ReleasedAmount,
+		&e.RefundedAmount,
+		&e.DisputedBy,
+		&e.DisputeReason,
+		&e.ResolvedBy,
+		&e.ResolutionNote,
+		&e.ClosedAt,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// CreateEscrow debits the buyer wallet and holds the amount for the seller, in one transaction.
+// The seller needs an active wallet in the same currency.
+func (r *EscrowRequest) CreateEscrow() (*Escrow, error) {
+	if r.SellerID == r.UserID {
+		return nil, ErrSameWallet
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	var buyerWalletID, sellerWalletID uuid.UUID
+	var currency string
+	err = tx.QueryRow(
+		ctx,
+		`SELECT b.id, s.id, b.currency FROM wallets b JOIN wallets s ON s.user_id = $2 AND s.is_active = true AND s.currency = b.currency
+		WHERE b.user_id = $1 AND b.is_active = true`,
+		r.UserID,
+		r.SellerID,
+	).Scan(&buyerWalletID, &sellerWalletID, &currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// A marketplace retrying the same order gets a conflict instead of a second debit
+	escrow, err := scanEscrow(tx.QueryRow(
+		ctx,
+		`INSERT INTO escrows (buyer_id, buyer_wallet_id, seller_id, seller_wallet_id, amount, currency, reference, description)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (buyer_id, reference) WHERE reference <> '' DO NOTHING
+		RETURNING `+escrowColumns,
+		r.UserID,
+		buyerWalletID,
+		r.SellerID,
+		sellerWalletID,
+		r.Amount,
+		currency,
+		r.Reference,
+		r.Description,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrEscrowExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := escrow.move(ctx, tx, -escrow.Amount, 0); err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return escrow, nil
+}
+
+// ConfirmEscrow releases a funded escrow to the seller once the buyer confirms the delivery
+func (r *EscrowAction) ConfirmEscrow() (*Escrow, error) {
+	return closeEscrow(r.EscrowID, "buyer_id = $2", r.UserID, EscrowFunded, func(e *Escrow) int64 {
+		return e.Amount
+	}, "")
+}
+
+// CancelEscrow refunds a funded escrow to the buyer when the seller cancels the order
+func (r *EscrowAction) CancelEscrow() (*Escrow, error) {
+	return closeEscrow(r.EscrowID, "seller_id = $2", r.UserID, EscrowFunded, func(*Escrow) int64 {
+		return 0
+	}, "")
+}
+
+// ResolveEscrow pays a disputed escrow to both parties as decided by an admin
+func (r *EscrowResolveRequest) ResolveEscrow(adminID uuid.UUID) (*Escrow, error) {
+	return closeEscrow(r.EscrowID, "$2::uuid IS NOT NULL", adminID, EscrowDisputed, func(*Escrow) int64 {
+		return r.SellerAmount
+	}, r.Note)
+}
+
+// closeEscrow pays an escrow of a status to the seller and the buyer and records the final status, in one transaction.
+// The party condition on $2 restricts who can close it, sellerAmount gives the share of the seller.
+func closeEscrow(escrowID uuid.UUID, party string, userID uuid.UUID, from string, sellerAmount func(*Escrow) int64, note string) (*Escrow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	escrow, err := scanEscrow(tx.QueryRow(
+		ctx,
+		`SELECT `+escrowColumns+` FROM escrows WHERE id = $1 AND `+party+` AND status = $3 FOR UPDATE`,
+		escrowID,
+		userID,
+		from,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	released := sellerAmount(escrow)
+	if released < 0 || released > escrow.Amount {
+		return nil, ErrEscrowResolution
+	}
+	refunded := escrow.Amount - released
+
+	status := EscrowSplit
+	switch {
+	case refunded == 0:
+		status = EscrowReleased
+	case released == 0:
+		status = EscrowRefunded
+	}
+	var resolvedBy *uuid.UUID
+	if from == EscrowDisputed {
+		resolvedBy = &userID
+	}
+
+	escrow, err = scanEscrow(tx.QueryRow(
+		ctx,
+		`UPDATE escrows SET status = $1, released_amount = $2, refunded_amount = $3, resolved_by = $4, resolution_note = $5,
+		closed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $6 RETURNING `+escrowColumns,
+		status,
+		released,
+		refunded,
+		resolvedBy,
+		note,
+		escrow.ID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if err := escrow.move(ctx, tx, refunded, released); err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return escrow, nil
+}
+
+// DisputeEscrow freezes a funded escrow of the buyer or the seller until an admin resolves it
+func (r *EscrowDisputeRequest) DisputeEscrow() (*Escrow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	escrow, err := scanEscrow(tx.QueryRow(
+		ctx,
+		`UPDATE escrows SET status = 'DISPUTED', disputed_by = $2, dispute_reason = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND $2 IN (buyer_id, seller_id) AND status = 'FUNDED' RETURNING `+escrowColumns,
+		r.EscrowID,
+		r.UserID,
+		r.Reason,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if err := escrow.move(ctx, tx, 0, 0); err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return escrow, nil
+}
+
+// move applies the balance changes of the current escrow status to both wallets and logs the status on both,
+// so each party sees every step of the escrow in its history
+func (e *Escrow) move(ctx context.Context, tx pgx.Tx, buyerDelta, sellerDelta int64) error {
+	m := &ledgerMove{
+		activity:  escrowActivityPrefix + e.Status,
+		source:    "escrow",
+		sourceID:  e.ID,
+		amount:    e.Amount,
+		currency:  e.Currency,
+		reference: e.Reference,
+		sides: [2]ledgerSide{
+			{walletID: e.BuyerWalletID, userID: e.BuyerID, role: "buyer", delta: buyerDelta},
+			{walletID: e.SellerWalletID, userID: e.SellerID, role: "seller", delta: sellerDelta},
+		},
+	}
+	return m.apply(ctx, tx)
+}
+
+// GetEscrow returns an escrow of the buyer or the seller, any escrow when userID is nil
+func GetEscrow(escrowID, userID uuid.UUID) (*Escrow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanEscrow(DB.QueryRow(
+		ctx,
+		`SELECT `+escrowColumns+` FROM escrows WHERE id = $1 AND ($2::uuid IS NULL OR $2 IN (buyer_id, seller_id))`,
+		escrowID,
+		uuidOrNil(userID),
+	))
+}
+
+// GetEscrows lists the escrows of a user as buyer or seller, every escrow when userID is nil, newest first
+func GetEscrows(userID uuid.UUID, status string, limit int) ([]Escrow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+escrowColumns+` FROM escrows
+		WHERE ($1::uuid IS NULL OR $1 IN (buyer_id, seller_id)) AND ($2 = '' OR status = $2) ORDER BY created_at DESC LIMIT $3`,
+		uuidOrNil(userID),
+		status,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	escrows := make([]Escrow, 0)
+	for rows.Next() {
+		escrow, err := scanEscrow(rows)
+		if err != nil {
+			return nil, err
+		}
+		escrows = append(escrows, *escrow)
+	}
+	return escrows, nil
+}
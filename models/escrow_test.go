@@ -0,0 +1,38 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestConfirmEscrowInactiveSeller(t *testing.T) {
+	testDB(t)
+
+	buyer := testWallet(t, 5000)
+	seller := testWallet(t, 0)
+
+	escrow, err := (&EscrowRequest{UserID: buyer.UserID, SellerID: seller.UserID, Amount: 1000, Description: "test"}).CreateEscrow()
+	if err != nil {
+		t.Fatalf("CreateEscrow: %v", err)
+	}
+	if _, err := DB.Exec(context.Background(), `UPDATE wallets SET is_active = false WHERE id = $1`, seller.ID); err != nil {
+		t.Fatalf("disable wallet: %v", err)
+	}
+
+	_, err = (&EscrowAction{UserID: buyer.UserID, EscrowID: escrow.ID}).ConfirmEscrow()
+	if !errors.Is(err, ErrWalletInactive) {
+		t.Fatalf("ConfirmEscrow to a disabled seller error = %v, want ErrWalletInactive", err)
+	}
+	if got := testBalance(t, seller.ID); got != 0 {
+		t.Errorf("seller balance = %d, want 0", got)
+	}
+
+	disputed, err := (&EscrowDisputeRequest{UserID: buyer.UserID, EscrowID: escrow.ID, Reason: "seller left"}).DisputeEscrow()
+	if err != nil {
+		t.Fatalf("DisputeEscrow: %v", err)
+	}
+	if disputed.Status != EscrowDisputed {
+		t.Errorf("DisputeEscrow() status = %s, want %s", disputed.Status, EscrowDisputed)
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Wallet event types
+const (
+	EventWalletCredited = "wallet.credited"
+	EventWalletDebited  = "wallet.debited"
+	EventWalletLocked   = "wallet.locked"
+	EventWalletUnlocked = "wallet.unlocked"
+	EventWalletDisabled = "wallet.disabled"
+)
+
+// WalletEvent is a change of a wallet published to partners and clients
+type WalletEvent struct {
+	ID         uuid.UUID `json:"id"`
+	Type       string    `json:"type"`
+	UserID     uuid.UUID `json:"user_id"`
+	WalletID   uuid.UUID `json:"wallet_id"`
+	Amount     int64     `json:"amount"`
+	Balance    int64     `json:"balance"`
+	Currency   string    `json:"currency"`
+	Reference  string    `json:"reference,omitempty"` // transaction, log or reversal id
+	OccurredAt time.Time `json:"occurred_at"`
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ledgerSide is one of the two wallets of a ledgerMove
+type ledgerSide struct {
+	walletID uuid.UUID
+	userID   uuid.UUID
+	role     string // e.g. buyer or seller
+	delta    int64
+}
+
+// ledgerMove changes the balances of two parties against funds kept outside of their wallets,
+// e.g. by an escrow, and logs the step on both wallets
+type ledgerMove struct {
+	activity  string
+	source    string // feature of the move, its id is logged as <source>_id
+	sourceID  uuid.UUID
+	amount    int64
+	currency  string
+	reference string
+	forced    bool // debits ignore the wallet lock, for admin adjustments
+	overdraw  bool // forced debits may take the balance below zero, the party then owes the deficit
+	sides     [2]ledgerSide
+	deficit   int64 // set by apply, what an overdrawn debit took below zero
+}
+
+// apply locks both wallets in id order, applies the deltas and writes a log on each wallet,
+// with an unchanged balance for a party whose balance does not move.
+// Only a debit checks the balance, unless overdrawn, and, unless forced, the lock of its wallet and the guardian controls.
+// A credit to a disabled wallet is refused, even forced.
+func (m *ledgerMove) apply(ctx context.Context, tx pgx.Tx) error {
+	rows, err := tx.Query(
+		ctx,
+		`SELECT id, balance, locked, is_active FROM wallets WHERE id IN ($1, $2) ORDER BY id FOR UPDATE`,
+		m.sides[0].walletID,
+		m.sides[1].walletID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	balances := make(map[uuid.UUID]int64, 2)
+	locks := make(map[uuid.UUID]bool, 2)
+	active := make(map[uuid.UUID]bool, 2)
+	for rows.Next() {
+		var id uuid.UUID
+		var balance int64
+		var locked, isActive bool
+		if err := rows.Scan(&id, &balance, &locked, &isActive); err != nil {
+			return err
+		}
+		balances[id] = balance
+		locks[id] = locked
+		active[id] = isActive
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	if len(balances) != 2 {
+		return pgx.ErrNoRows
+	}
+
+	for i, side := range m.sides {
+		if side.delta > 0 && !active[side.walletID] {
+			return ErrWalletInactive
+		}
+		if side.delta >= 0 {
+			continue
+		}
+		switch {
+		case locks[side.walletID] && !m.forced:
+			return ErrWalletLocked
+		case balances[side.walletID] < -side.delta && !(m.forced && m.overdraw):
+			return ErrInsufficientFunds
+		}
+		if !m.forced {
+			if err := checkDependentSpending(ctx, tx, side.walletID, m.sides[1-i].walletID, -side.delta); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, side := range m.sides {
+		other := m.sides[1-i]
+		balance := balances[side.walletID]
+		if side.delta != 0 {
+			if _, err := tx.Exec(ctx, `UPDATE wallets SET balance = balance + $1 WHERE id = $2`, side.delta, side.walletID); err != nil {
+				return err
+			}
+		}
+		if side.delta < 0 {
+			m.deficit += max(0, -(balance+side.delta)) - max(0, -balance)
+		}
+
+		metadata, err := json.Marshal(map[string]string{
+			"source":               m.source,
+			m.source + "_id":       m.sourceID.String(),
+			"role":                 side.role,
+			"counterparty_user_id": other.userID.String(),
+			"reference":            m.reference,
+		})
+		if err != nil {
+			return err
+		}
+		walletLog := WalletLog{
+			UserID:         side.userID,
+			WalletID:       side.walletID,
+			Activity:       m.activity,
+			OldBalance:     balance,
+			NewBalance:     balance + side.delta,
+			ActivityAmount: m.amount,
+			Currency:       m.currency,
+			Metadata:       string(metadata),
+			ReferenceID:    &m.sourceID,
+		}
+		if err := walletLog.insert(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
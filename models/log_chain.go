@@ -0,0 +1,360 @@
+package models
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"strings"
+	"time"
+)
+
+// ErrNoSigningKey is returned when chain heads cannot be signed
+var ErrNoSigningKey = errors.New("wallet log signing key not configured")
+
+// ChainHead is the last chained log of a wallet
+type ChainHead struct {
+	WalletID uuid.UUID `json:"wallet_id"`
+	Seq      int64     `json:"seq"`
+	Hash     string    `json:"hash"`
+}
+
+// ChainAnchor is a signed snapshot of every wallet chain head, meant to be published externally
+type ChainAnchor struct {
+	ID        uuid.UUID   `json:"id" db:"id,omitempty"`
+	Heads     []ChainHead `json:"heads" db:"heads"`
+	Digest    string      `json:"digest" db:"digest"`       // sha256 of the heads
+	Signature string      `json:"signature" db:"signature"` // hex ed25519 signature of the digest
+	PublicKey string      `json:"public_key" db:"public_key"`
+	CreatedAt time.Time   `json:"created_at" db:"created_at,omitempty"`
+}
+
+// ChainVerification is the result of walking the log chain of a wallet
+type ChainVerification struct {
+	WalletID uuid.UUID  `json:"wallet_id"`
+	Valid    bool       `json:"valid"`
+	Checked  int64      `json:"checked"`
+	HeadSeq  int64      `json:"head_seq"`
+	HeadHash string     `json:"head_hash"`
+	BrokenAt int64      `json:"broken_at,omitempty"` // seq of the first broken link
+	LogID    *uuid.UUID `json:"log_id,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+}
+
+// chainedLog is a wallet log with the columns covered by its hash
+type chainedLog struct {
+	WalletLog
+	Seq      int64
+	PrevHash string
+	Hash     string
+}
+
+// hashWalletLog returns the hex sha256 of a log content chained to the previous hash
+func hashWalletLog(prevHash string, seq int64, wl *WalletLog) string {
+	reference := ""
+	if wl.ReferenceID != nil {
+		reference = wl.ReferenceID.String()
+	}
+	content := strings.Join([]string{
+		prevHash,
+		fmt.Sprint(seq),
+		wl.ID.String(),
+		wl.UserID.String(),
+		wl.WalletID.String(),
+		wl.Activity,
+		fmt.Sprint(wl.OldBalance),
+		fmt.Sprint(wl.NewBalance),
+		fmt.Sprint(wl.ActivityAmount),
+		wl.Currency,
+		wl.Metadata,
+		reference,
+		wl.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}, "|")
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// chainedLogColumns is the column list of a chained log, metadata as stored text
+const chainedLogColumns = `id, user_id, wallet_id, activity, old_balance, new_balance, activity_amount, currency,
+	COALESCE(metadata::text, ''), reference_id, created_at, COALESCE(chain_seq, 0), COALESCE(prev_hash, ''), COALESCE(hash, '')`
+
+// scanChainedLog scans a row selected with chainedLogColumns
+func scanChainedLog(row pgx.Row) (*chainedLog, error) {
+	l := &chainedLog{}
+	err := row.Scan(
+		&l.ID,
+		&l.UserID,
+		&l.WalletID,
+		&l.Activity,
+		&l.OldBalance,
+		&l.NewBalance,
+		&l.ActivityAmount,
+		&l.Currency,
+		&l.Metadata,
+		&l.ReferenceID,
+		&l.CreatedAt,
+		&l.Seq,
+		&l.PrevHash,
+		&l.Hash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// chainWalletLogs links the unchained logs of a wallet to its chain head, in insertion order.
+// Former balance reads are left out, the startup migration moves them out of wallet_logs.
+// The transaction-level lock serializes the chain of a wallet across replicas.
+func chainWalletLogs(ctx context.Context, tx pgx.Tx, walletID uuid.UUID) error {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('wallet_log_chain:' || $1))`, walletID.String()); err != nil {
+		return err
+	}
+
+	var seq int64
+	var prevHash string
+	err := tx.QueryRow(
+		ctx,
+		`SELECT chain_seq, hash FROM wallet_logs WHERE wallet_id = $1 AND hash IS NOT NULL ORDER BY chain_seq DESC LIMIT 1`,
+		walletID,
+	).Scan(&seq, &prevHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	rows, err := tx.Query(
+		ctx,
+		`SELECT `+chainedLogColumns+` FROM wallet_logs WHERE wallet_id = $1 AND hash IS NULL AND activity <> 'GET_BALANCE'
+		ORDER BY created_at, id`,
+		walletID,
+	)
+	if err != nil {
+		return err
+	}
+	pending := make([]*chainedLog, 0, 1)
+	for rows.Next() {
+		l, err := scanChainedLog(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, l := range pending {
+		seq++
+		hash := hashWalletLog(prevHash, seq, &l.WalletLog)
+		_, err := tx.Exec(
+			ctx,
+			`UPDATE wallet_logs SET chain_seq = $1, prev_hash = $2, hash = $3 WHERE id = $4`,
+			seq,
+			prevHash,
+			hash,
+			l.ID,
+		)
+		if err != nil {
+			return err
+		}
+		prevHash = hash
+	}
+	return nil
+}
+
+// ChainPendingWalletLogs chains the logs written before the hash chain existed
+func ChainPendingWalletLogs() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	rows, err := DB.Query(ctx, `SELECT DISTINCT wallet_id FROM wallet_logs WHERE hash IS NULL AND activity <> 'GET_BALANCE'`)
+	if err != nil {
+		return err
+	}
+	walletIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return err
+	}
+
+	for _, walletID := range walletIDs {
+		tx, err := DB.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		if err := chainWalletLogs(ctx, tx, walletID); err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyWalletLogChain walks the log chain of a wallet and reports the first broken link.
+// The head is also checked against the latest signed anchor to catch a rewritten chain tail.
+func VerifyWalletLogChain(walletID uuid.UUID) (*ChainVerification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	result := &ChainVerification{WalletID: walletID, Valid: true}
+	broken := func(l *chainedLog, reason string) {
+		id := l.ID
+		result.Valid = false
+		result.BrokenAt = l.Seq
+		result.LogID = &id
+		result.Reason = reason
+	}
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+chainedLogColumns+` FROM wallet_logs WHERE wallet_id = $1 AND hash IS NOT NULL ORDER BY chain_seq`,
+		walletID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := make(map[int64]string)
+	prevHash := ""
+	for rows.Next() {
+		l, err := scanChainedLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case l.Seq != result.Checked+1:
+			broken(l, fmt.Sprintf("sequence gap, expected %d", result.Checked+1))
+		case l.PrevHash != prevHash:
+			broken(l, "previous hash mismatch")
+		case l.Hash != hashWalletLog(prevHash, l.Seq, &l.WalletLog):
+			broken(l, "content hash mismatch")
+		}
+		if !result.Valid {
+			return result, nil
+		}
+		result.Checked++
+		result.HeadSeq = l.Seq
+		result.HeadHash = l.Hash
+		hashes[l.Seq] = l.Hash
+		prevHash = l.Hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	anchor, err := GetLatestChainAnchor()
+	if errors.Is(err, pgx.ErrNoRows) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, head := range anchor.Heads {
+		if head.WalletID != walletID {
+			continue
+		}
+		if hashes[head.Seq] != head.Hash {
+			result.Valid = false
+			result.BrokenAt = head.Seq
+			result.Reason = fmt.Sprintf("chain differs from anchor %s", anchor.ID)
+		}
+		break
+	}
+	return result, nil
+}
+
+// digestChainHeads returns the hex sha256 of the heads, one "wallet:seq:hash" line each
+func digestChainHeads(heads []ChainHead) string {
+	h := sha256.New()
+	for _, head := range heads {
+		_, _ = fmt.Fprintf(h, "%s:%d:%s\n", head.WalletID, head.Seq, head.Hash)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CreateChainAnchor signs the current head of every wallet chain
+func CreateChainAnchor(key ed25519.PrivateKey) (*ChainAnchor, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, ErrNoSigningKey
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT DISTINCT ON (wallet_id) wallet_id, chain_seq, hash FROM wallet_logs
+		WHERE hash IS NOT NULL ORDER BY wallet_id, chain_seq DESC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	heads := make([]ChainHead, 0)
+	for rows.Next() {
+		head := ChainHead{}
+		if err := rows.Scan(&head.WalletID, &head.Seq, &head.Hash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		heads = append(heads, head)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	digest := digestChainHeads(heads)
+	anchor := &ChainAnchor{
+		Heads:     heads,
+		Digest:    digest,
+		Signature: hex.EncodeToString(ed25519.Sign(key, []byte(digest))),
+		PublicKey: hex.EncodeToString(key.Public().(ed25519.PublicKey)),
+	}
+	payload, err := json.Marshal(heads)
+	if err != nil {
+		return nil, err
+	}
+
+	err = DB.QueryRow(
+		ctx,
+		`INSERT INTO wallet_log_anchors (heads, digest, signature, public_key) VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
+		string(payload),
+		anchor.Digest,
+		anchor.Signature,
+		anchor.PublicKey,
+	).Scan(&anchor.ID, &anchor.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return anchor, nil
+}
+
+// GetLatestChainAnchor gets the last signed chain heads
+func GetLatestChainAnchor() (*ChainAnchor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	anchor := &ChainAnchor{}
+	var heads string
+	err := DB.QueryRow(
+		ctx,
+		`SELECT id, heads::text, digest, signature, public_key, created_at FROM wallet_log_anchors ORDER BY created_at DESC LIMIT 1`,
+	).Scan(&anchor.ID, &heads, &anchor.Digest, &anchor.Signature, &anchor.PublicKey, &anchor.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(heads), &anchor.Heads); err != nil {
+		return nil, err
+	}
+	return anchor, nil
+}
@@ -0,0 +1,369 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// TransferSourceMerchant is the source of the transfers paying a merchant
+const TransferSourceMerchant = "merchant_payment"
+
+// DefaultMerchantQRExpiry is how long a dynamic QR code can be paid when no expiry is set
+const DefaultMerchantQRExpiry = 15 * time.Minute
+
+// Merchant QR errors
+var (
+	ErrInvalidMerchantQR = errors.New("invalid merchant QR code")
+	ErrMerchantQRUsed    = errors.New("merchant QR code already paid")
+	ErrMerchantQRExpired = errors.New("merchant QR code expired")
+)
+
+// Merchant is the struct for the profile of a merchant wallet
+type Merchant struct {
+	ID           uuid.UUID `json:"id" db:"id,omitempty"`
+	UserID       uuid.UUID `json:"user_id" db:"user_id"`
+	WalletID     uuid.UUID `json:"wallet_id" db:"wallet_id"`
+	Name         string    `json:"name" db:"name"`
+	City         string    `json:"city" db:"city"`
+	CategoryCode string    `json:"category_code" db:"category_code"` // ISO 18245 merchant category code
+	CountryCode  string    `json:"country_code" db:"country_code"`   // ISO 3166-1 alpha-2
+	Currency     string    `json:"currency" db:"-"`
+	IsActive     bool      `json:"is_active" db:"is_active"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// MerchantRequest is the struct for turning a wallet into a merchant wallet.
+// Name and city are bounded by the EMVCo QR fields.
+type MerchantRequest struct {
+	UserID       uuid.UUID `json:"user_id" binding:"required"`
+	WalletID     uuid.UUID `json:"wallet_id" binding:"required"`
+	Name         string    `json:"name" binding:"required,max=25"`
+	City         string    `json:"city" binding:"required,max=15"`
+	CategoryCode string    `json:"category_code" binding:"required,numeric,len=4"`
+	CountryCode  string    `json:"country_code" binding:"omitempty,alpha,len=2"`
+}
+
+// MerchantQRRequest is the struct for generating a QR code, a zero amount gives a static code
+type MerchantQRRequest struct {
+	UserID           uuid.UUID `json:"user_id" binding:"required"`
+	MerchantID       uuid.UUID `json:"merchant_id" binding:"required"`
+	Amount           int64     `json:"amount" binding:"omitempty,gt=0,min=100,max=2000000"`
+	Reference        string    `json:"reference" binding:"max=25"`
+	ExpiresInMinutes int       `json:"expires_in_minutes" binding:"omitempty,gt=0,max=1440"`
+}
+
+// MerchantQR is the content of a merchant-presented QR code.
+// A dynamic code has an amount and an id, and can only be paid once.
+type MerchantQR struct {
+	ID           uuid.UUID  `json:"id,omitempty"` // dynamic codes only
+	Dynamic      bool       `json:"dynamic"`
+	MerchantID   uuid.UUID  `json:"merchant_id"`
+	WalletID     uuid.UUID  `json:"wallet_id"`
+	Name         string     `json:"name"`
+	City         string     `json:"city"`
+	CategoryCode string     `json:"category_code"`
+	CountryCode  string     `json:"country_code"`
+	Currency     string     `json:"currency"`
+	Amount       int64      `json:"amount,omitempty"`
+	Reference    string     `json:"reference,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Payload      string     `json:"payload"`
+}
+
+// MerchantPayRequest is the struct for paying a scanned QR code.
+// The amount is entered by the payer for a static code and must match a dynamic one.
+type MerchantPayRequest struct {
+	UserID         uuid.UUID `json:"user_id" binding:"required"`
+	Payload        string    `json:"payload" binding:"required,max=512"`
+	Amount         int64     `json:"amount" binding:"omitempty,gt=0,min=100,max=2000000"`
+	IdempotencyKey string    `json:"idempotency_key" binding:"max=100"`
+}
+
+// MerchantPayment is a payment received by a merchant
+type MerchantPayment struct {
+	ID         uuid.UUID  `json:"id" db:"id,omitempty"`
+	MerchantID uuid.UUID  `json:"merchant_id" db:"merchant_id"`
+	QRCodeID   *uuid.UUID `json:"qr_code_id,omitempty" db:"qr_code_id"`
+	LinkID     *uuid.UUID `json:"link_id,omitempty" db:"link_id"`
+	TransferID uuid.UUID  `json:"transfer_id" db:"transfer_id"`
+	PayerID    uuid.UUID  `json:"payer_id" db:"payer_id"`
+	Amount     int64      `json:"amount" db:"amount"`
+	Currency   string     `json:"currency" db:"currency"`
+	Reference  string     `json:"reference" db:"reference"` // QR reference or link code
+
+	// PayerReference is the order or invoice number given by the payer of a link
+	PayerReference string    `json:"payer_reference,omitempty" db:"payer_reference"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
+// merchantColumns is the column list scanned by scanMerchant
+const merchantColumns = `m.id, m.user_id, m.wallet_id, m.name, m.city, m.category_code, m.country_code, w.currency,
+	m.is_active, m.created_at, m.updated_at`
+
+// scanMerchant scans a merchant row joined with its wallet
+func scanMerchant(row pgx.Row) (*Merchant, error) {
+	m := &Merchant{}
+	err := row.Scan(
+		&m.ID,
+		&m.UserID,
+		&m.WalletID,
+		&m.Name,
+		&m.City,
+		&m.CategoryCode,
+		&m.CountryCode,
+		&m.Currency,
+		&m.IsActive,
+		&m.CreatedAt,
+		&m.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CreateMerchant creates the merchant profile of a wallet of the user, or updates it
+func (r *MerchantRequest) CreateMerchant() (*Merchant, error) {
+	if r.CountryCode == "" {
+		r.CountryCode = "CM"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanMerchant(DB.QueryRow(
+		ctx,
+		`WITH m AS (
+			INSERT INTO merchants (user_id, wallet_id, name, city, category_code, country_code)
+			SELECT user_id, id, $3, $4, $5, upper($6) FROM wallets WHERE id = $1 AND user_id = $2 AND is_active = true
+			ON CONFLICT (wallet_id) DO UPDATE SET name = EXCLUDED.name, city = EXCLUDED.city, category_code = EXCLUDED.category_code,
+				country_code = EXCLUDED.country_code, is_active = true, updated_at = CURRENT_TIMESTAMP
+			RETURNING *
+		)
+		SELECT `+merchantColumns+` FROM m JOIN wallets w ON w.id = m.wallet_id`,
+		r.WalletID,
+		r.UserID,
+		r.Name,
+		r.City,
+		r.CategoryCode,
+		r.CountryCode,
+	))
+}
+
+// GetMerchant returns an active merchant, of a given owner when userID is set
+func GetMerchant(merchantID, userID uuid.UUID) (*Merchant, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanMerchant(DB.QueryRow(
+		ctx,
+		`SELECT `+merchantColumns+` FROM merchants m JOIN wallets w ON w.id = m.wallet_id
+		WHERE m.id = $1 AND ($2::uuid IS NULL OR m.user_id = $2) AND m.is_active = true AND w.is_active = true`,
+		merchantID,
+		uuidOrNil(userID),
+	))
+}
+
+// CreateMerchantQR describes the QR code of a merchant of the user.
+// A dynamic code is stored so it can only be paid once before it expires.
+func (r *MerchantQRRequest) CreateMerchantQR() (*MerchantQR, error) {
+	merchant, err := GetMerchant(r.MerchantID, r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	qr := &MerchantQR{
+		MerchantID:   merchant.ID,
+		WalletID:     merchant.WalletID,
+		Name:         merchant.Name,
+		City:         merchant.City,
+		CategoryCode: merchant.CategoryCode,
+		CountryCode:  merchant.CountryCode,
+		Currency:     merchant.Currency,
+		Reference:    r.Reference,
+	}
+	if r.Amount == 0 {
+		return qr, nil
+	}
+
+	expiry := DefaultMerchantQRExpiry
+	if r.ExpiresInMinutes > 0 {
+		expiry = time.Duration(r.ExpiresInMinutes) * time.Minute
+	}
+	expiresAt := time.Now().Add(expiry)
+	qr.Dynamic, qr.Amount, qr.ExpiresAt = true, r.Amount, &expiresAt
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err = DB.QueryRow(
+		ctx,
+		`INSERT INTO merchant_qr_codes (merchant_id, amount, currency, reference, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		qr.MerchantID,
+		qr.Amount,
+		qr.Currency,
+		qr.Reference,
+		expiresAt,
+	).Scan(&qr.ID)
+	if err != nil {
+		return nil, err
+	}
+	return qr, nil
+}
+
+// PayMerchant pays a parsed QR code from the wallet of the payer in one transaction.
+// The merchant, wallet and currency of the code must match the merchant profile.
+func (r *MerchantPayRequest) PayMerchant(qr *MerchantQR) (*MerchantPayment, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	merchant, err := scanMerchant(tx.QueryRow(
+		ctx,
+		`SELECT `+merchantColumns+` FROM merchants m JOIN wallets w ON w.id = m.wallet_id
+		WHERE m.id = $1 AND m.is_active = true AND w.is_active = true`,
+		qr.MerchantID,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+	if merchant.WalletID != qr.WalletID || merchant.Currency != qr.Currency {
+		return nil, nil, ErrInvalidMerchantQR
+	}
+
+	payment := &MerchantPayment{
+		MerchantID: merchant.ID,
+		PayerID:    r.UserID,
+		Amount:     r.Amount,
+		Currency:   merchant.Currency,
+		Reference:  qr.Reference,
+	}
+	var key *string
+	if qr.Dynamic {
+		var amount int64
+		var expiresAt time.Time
+		var paidAt *time.Time
+		err := tx.QueryRow(
+			ctx,
+			`SELECT amount, reference, expires_at, paid_at FROM merchant_qr_codes WHERE id = $1 AND merchant_id = $2 FOR UPDATE`,
+			qr.ID,
+			merchant.ID,
+		).Scan(&amount, &payment.Reference, &expiresAt, &paidAt)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, nil, ErrInvalidMerchantQR
+		case err != nil:
+			return nil, nil, err
+		case paidAt != nil:
+			return nil, nil, ErrMerchantQRUsed
+		case !time.Now().Before(expiresAt):
+			return nil, nil, ErrMerchantQRExpired
+		case amount != qr.Amount || (r.Amount != 0 && r.Amount != amount):
+			return nil, nil, ErrInvalidMerchantQR
+		}
+		payment.Amount = amount
+		payment.QRCodeID = &qr.ID
+		k := fmt.Sprintf("%s:qr:%s", TransferSourceMerchant, qr.ID)
+		key = &k
+	} else if r.IdempotencyKey != "" {
+		k := fmt.Sprintf("%s:%s:%s:%s", TransferSourceMerchant, merchant.ID, r.UserID, r.IdempotencyKey)
+		key = &k
+	}
+	if payment.Amount <= 0 {
+		return nil, nil, ErrInvalidMerchantQR
+	}
+
+	transfer := &Transfer{
+		FromUserID:     r.UserID,
+		ToWalletID:     merchant.WalletID,
+		Amount:         payment.Amount,
+		Source:         TransferSourceMerchant,
+		SourceID:       &merchant.ID,
+		IdempotencyKey: key,
+	}
+	if err := transfer.transfer(ctx, tx); err != nil {
+		return nil, nil, err
+	}
+	payment.TransferID = transfer.ID
+
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO merchant_payments (merchant_id, qr_code_id, transfer_id, payer_id, amount, currency, reference)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`,
+		payment.MerchantID,
+		payment.QRCodeID,
+		payment.TransferID,
+		payment.PayerID,
+		payment.Amount,
+		payment.Currency,
+		payment.Reference,
+	).Scan(&payment.ID, &payment.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if qr.Dynamic {
+		_, err := tx.Exec(ctx, `UPDATE merchant_qr_codes SET paid_at = CURRENT_TIMESTAMP, transfer_id = $1 WHERE id = $2`, transfer.ID, qr.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return payment, transfer, nil
+}
+
+// GetMerchantPayments lists the latest payments received by a merchant, optionally through a single link
+func GetMerchantPayments(merchantID, linkID uuid.UUID, limit int) ([]MerchantPayment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT id, merchant_id, qr_code_id, link_id, transfer_id, payer_id, amount, currency, reference, payer_reference, created_at
+		FROM merchant_payments WHERE merchant_id = $1 AND ($2::uuid IS NULL OR link_id = $2) ORDER BY created_at DESC LIMIT $3`,
+		merchantID,
+		uuidOrNil(linkID),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := make([]MerchantPayment, 0)
+	for rows.Next() {
+		p := MerchantPayment{}
+		err := rows.Scan(
+			&p.ID,
+			&p.MerchantID,
+			&p.QRCodeID,
+			&p.LinkID,
+			&p.TransferID,
+			&p.PayerID,
+			&p.Amount,
+			&p.Currency,
+			&p.Reference,
+			&p.PayerReference,
+			&p.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, nil
+}
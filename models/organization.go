@@ -0,0 +1,879 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Organization member roles
+const (
+	OrganizationViewer    = "VIEWER"    // sees the wallet and its operations
+	OrganizationInitiator = "INITIATOR" // also submits operations
+	OrganizationApprover  = "APPROVER"  // also approves or rejects the operations of others
+	OrganizationAdmin     = "ADMIN"     // everything, plus the members, the policy and the wallet lock
+)
+
+// Permissions checked on the wallet of an organization
+const (
+	PermissionView     = "view"
+	PermissionInitiate = "initiate"
+	PermissionApprove  = "approve"
+	PermissionManage   = "manage"
+)
+
+// organizationRoles lists the permissions granted by each role
+var organizationRoles = map[string][]string{
+	OrganizationViewer:    {PermissionView},
+	OrganizationInitiator: {PermissionView, PermissionInitiate},
+	OrganizationApprover:  {PermissionView, PermissionApprove},
+	OrganizationAdmin:     {PermissionView, PermissionInitiate, PermissionApprove, PermissionManage},
+}
+
+// RoleGrants checks if an organization role grants a permission
+func RoleGrants(role, permission string) bool {
+	for _, p := range organizationRoles[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Organization operation statuses
+const (
+	OperationPending   = "PENDING"   // waiting for approvals
+	OperationApproved  = "APPROVED"  // waiting for the execution job
+	OperationExecuting = "EXECUTING" // claimed by the execution job, sent to the provider
+	OperationRejected  = "REJECTED"
+	OperationCanceled  = "CANCELED" // by its initiator
+	OperationExecuted  = "EXECUTED"
+	OperationFailed    = "FAILED"
+)
+
+// OperationWithdrawal is the kind of a withdrawal from the organization wallet
+const OperationWithdrawal = "WITHDRAWAL"
+
+// Organization errors
+var (
+	ErrOrganizationRole   = errors.New("role does not allow this operation")
+	ErrLastAdmin          = errors.New("an organization needs an admin")
+	ErrApprovalPolicy     = errors.New("required approvals exceed the number of approvers")
+	ErrSelfApproval       = errors.New("the initiator cannot approve its own operation")
+	ErrAlreadyDecided     = errors.New("operation already approved or rejected by this member")
+	ErrOrganizationWallet = errors.New("wallet does not belong to the organization")
+)
+
+// Organization is a company whose wallet is run by several members.
+// Its id owns the wallet, as user_id, so the wallet works like any other.
+type Organization struct {
+	ID                uuid.UUID            `json:"id" db:"id,omitempty"`
+	Name              string               `json:"name" db:"name"`
+	WalletID          uuid.UUID            `json:"wallet_id" db:"wallet_id"`
+	Currency          string               `json:"currency" db:"currency"`
+	ApprovalThreshold int64                `json:"approval_threshold" db:"approval_threshold"` // operations from this amount need approvals
+	RequiredApprovals int                  `json:"required_approvals" db:"required_approvals"`
+	CreatedBy         uuid.UUID            `json:"created_by" db:"created_by"`
+	Role              string               `json:"role,omitempty" db:"-"` // of the caller
+	Members           []OrganizationMember `json:"members,omitempty" db:"-"`
+	CreatedAt         time.Time            `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt         time.Time            `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// OrganizationMember is a user with a role in an organization
+type OrganizationMember struct {
+	OrganizationID uuid.UUID `json:"organization_id" db:"organization_id"`
+	UserID         uuid.UUID `json:"user_id" db:"user_id"`
+	Role           string    `json:"role" db:"role"`
+	AddedBy        uuid.UUID `json:"added_by" db:"added_by"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// OrganizationOperation is an operation on the organization wallet submitted by a member
+type OrganizationOperation struct {
+	ID                uuid.UUID           `json:"id" db:"id,omitempty"`
+	OrganizationID    uuid.UUID           `json:"organization_id" db:"organization_id"`
+	WalletID          uuid.UUID           `json:"wallet_id" db:"wallet_id"`
+	Kind              string              `json:"kind" db:"kind"`
+	Amount            int64               `json:"amount" db:"amount"`
+	Currency          string              `json:"currency" db:"currency"`
+	Provider          string              `json:"provider" db:"provider"`
+	PhoneNumber       string              `json:"phone_number" db:"phone_number"`
+	Status            string              `json:"status" db:"status"`
+	InitiatedBy       uuid.UUID           `json:"initiated_by" db:"initiated_by"`
+	RequiredApprovals int                 `json:"required_approvals" db:"required_approvals"` // from the policy when submitted
+	ApprovalCount     int                 `json:"approval_count" db:"approval_count"`
+	TransactionID     *uuid.UUID          `json:"transaction_id,omitempty" db:"transaction_id"`
+	Error             string              `json:"error,omitempty" db:"error"`
+	Decisions         []OperationDecision `json:"decisions,omitempty" db:"-"`
+	CreatedAt         time.Time           `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt         time.Time           `json:"updated_at" db:"updated_at,omitempty"`
+	ExecutedAt        *time.Time          `json:"executed_at,omitempty" db:"executed_at"`
+}
+
+// OperationDecision is the approval or rejection of an operation by a member
+type OperationDecision struct {
+	OperationID uuid.UUID `json:"operation_id" db:"operation_id"`
+	UserID      uuid.UUID `json:"user_id" db:"user_id"`
+	Approved    bool      `json:"approved" db:"approved"`
+	Note        string    `json:"note" db:"note"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
+// OrganizationRequest is the struct for creating an organization with its wallet
+type OrganizationRequest struct {
+	UserID   uuid.UUID `json:"user_id" binding:"required"`
+	Name     string    `json:"name" binding:"required,max=100"`
+	Currency string    `json:"currency" binding:"required,oneof=XAF USD XOF"`
+}
+
+// OrganizationMemberRequest is the struct for adding a member, changing its role or removing it without a role
+type OrganizationMemberRequest struct {
+	UserID         uuid.UUID `json:"user_id" binding:"required"`
+	OrganizationID uuid.UUID `json:"organization_id" binding:"required"`
+	MemberID       uuid.UUID `json:"member_id" binding:"required"`
+	Role           string    `json:"role" binding:"omitempty,oneof=VIEWER INITIATOR APPROVER ADMIN"`
+}
+
+// OrganizationPolicyRequest is the struct for the approval policy: operations from ApprovalThreshold need RequiredApprovals approvers
+type OrganizationPolicyRequest struct {
+	UserID            uuid.UUID `json:"user_id" binding:"required"`
+	OrganizationID    uuid.UUID `json:"organization_id" binding:"required"`
+	ApprovalThreshold int64     `json:"approval_threshold" binding:"min=0"`
+	RequiredApprovals int       `json:"required_approvals" binding:"required,min=1,max=10"`
+}
+
+// OperationDecisionRequest is the struct for approving, rejecting or canceling an operation
+type OperationDecisionRequest struct {
+	UserID      uuid.UUID `json:"user_id" binding:"required"`
+	OperationID uuid.UUID `json:"operation_id" binding:"required"`
+	Note        string    `json:"note" binding:"max=255"`
+}
+
+// organizationColumns is the column list scanned by scanOrganization
+const organizationColumns = `id, name, wallet_id, currency, approval_threshold, required_approvals, created_by, created_at, updated_at`
+
+// scanOrganization scans an organization row
+func scanOrganization(row pgx.Row) (*Organization, error) {
+	o := &Organization{}
+	err := row.Scan(
+		&o.ID,
+		&o.Name,
+		&o.WalletID,
+		&o.Currency,
+		&o.ApprovalThreshold,
+		&o.RequiredApprovals,
+		&o.CreatedBy,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// operationColumns is the column list scanned by scanOperation
+const operationColumns = `id, organization_id, wallet_id, kind, amount, currency, provider, phone_number, status, initiated_by,
+	required_approvals, approval_count, transaction_id, error, created_at, updated_at, executed_at`
+
+// scanOperation scans an organization operation row
+func scanOperation(row pgx.Row) (*OrganizationOperation, error) {
+	o := &OrganizationOperation{}
+	err := row.Scan(
+		&o.ID,
+		&o.OrganizationID,
+		&o.WalletID,
+		&o.Kind,
+		&o.Amount,
+		&o.Currency,
+		&o.Provider,
+		&o.PhoneNumber,
+		&o.Status,
+		&o.InitiatedBy,
+		&o.RequiredApprovals,
+		&o.ApprovalCount,
+		&o.TransactionID,
+		&o.Error,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+		&o.ExecutedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// CreateOrganization creates an organization, its wallet and the caller as its admin
+func (r *OrganizationRequest) CreateOrganization() (*Organization, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	id := uuid.New()
+	var walletID uuid.UUID
+	err = tx.QueryRow(ctx, `INSERT INTO wallets (user_id, currency) VALUES ($1, $2) RETURNING id`, id, r.Currency).Scan(&walletID)
+	if err != nil {
+		return nil, err
+	}
+	organization, err := scanOrganization(tx.QueryRow(
+		ctx,
+		`INSERT INTO organizations (id, name, wallet_id, currency, created_by) VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+organizationColumns,
+		id,
+		r.Name,
+		walletID,
+		r.Currency,
+		r.UserID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO organization_members (organization_id, user_id, role, added_by) VALUES ($1, $2, $3, $2)`,
+		organization.ID,
+		r.UserID,
+		OrganizationAdmin,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	organization.Role = OrganizationAdmin
+	return organization, nil
+}
+
+// lockOrganization locks an organization for a change by an admin member
+func lockOrganization(ctx context.Context, tx pgx.Tx, organizationID, adminID uuid.UUID) (*Organization, error) {
+	organization, err := scanOrganization(tx.QueryRow(
+		ctx,
+		`SELECT `+organizationColumns+` FROM organizations WHERE id = $1 FOR UPDATE`,
+		organizationID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	role, err := organizationRole(ctx, tx, organizationID, adminID)
+	if err != nil {
+		return nil, err
+	}
+	if !RoleGrants(role, PermissionManage) {
+		return nil, ErrOrganizationRole
+	}
+	return organization, nil
+}
+
+// checkOrganizationPolicy verifies that the organization keeps an admin and enough approvers for its policy
+func checkOrganizationPolicy(ctx context.Context, tx pgx.Tx, organizationID uuid.UUID, requiredApprovals int) error {
+	var admins, approvers int
+	err := tx.QueryRow(
+		ctx,
+		`SELECT count(*) FILTER (WHERE role = 'ADMIN'), count(*) FILTER (WHERE role IN ('ADMIN', 'APPROVER'))
+		FROM organization_members WHERE organization_id = $1`,
+		organizationID,
+	).Scan(&admins, &approvers)
+	if err != nil {
+		return err
+	}
+	if admins == 0 {
+		return ErrLastAdmin
+	}
+	if approvers < requiredApprovals {
+		return ErrApprovalPolicy
+	}
+	return nil
+}
+
+// SetOrganizationMember adds a member, changes its role or removes it when the role is empty
+func (r *OrganizationMemberRequest) SetOrganizationMember() (*Organization, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	organization, err := lockOrganization(ctx, tx, r.OrganizationID, r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if r.Role == "" {
+		_, err = tx.Exec(
+			ctx,
+			`DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2`,
+			organization.ID,
+			r.MemberID,
+		)
+	} else {
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO organization_members (organization_id, user_id, role, added_by) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (organization_id, user_id) DO UPDATE SET role = EXCLUDED.role, updated_at = CURRENT_TIMESTAMP`,
+			organization.ID,
+			r.MemberID,
+			r.Role,
+			r.UserID,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOrganizationPolicy(ctx, tx, organization.ID, organization.RequiredApprovals); err != nil {
+		return nil, err
+	}
+	if organization.Members, err = organizationMembers(ctx, tx, organization.ID); err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+// SetOrganizationPolicy changes the approval policy, the pending operations keep the policy they were submitted with
+func (r *OrganizationPolicyRequest) SetOrganizationPolicy() (*Organization, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	if _, err := lockOrganization(ctx, tx, r.OrganizationID, r.UserID); err != nil {
+		return nil, err
+	}
+	if err := checkOrganizationPolicy(ctx, tx, r.OrganizationID, r.RequiredApprovals); err != nil {
+		return nil, err
+	}
+	organization, err := scanOrganization(tx.QueryRow(
+		ctx,
+		`UPDATE organizations SET approval_threshold = $1, required_approvals = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 RETURNING `+organizationColumns,
+		r.ApprovalThreshold,
+		r.RequiredApprovals,
+		r.OrganizationID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+// organizationRole returns the role of a user in an organization
+func organizationRole(ctx context.Context, q queryer, organizationID, userID uuid.UUID) (string, error) {
+	var role string
+	err := q.QueryRow(
+		ctx,
+		`SELECT role FROM organization_members WHERE organization_id = $1 AND user_id = $2`,
+		organizationID,
+		userID,
+	).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrOrganizationRole
+	}
+	return role, err
+}
+
+// GetOrganizationRole returns the role of a user in an organization, ErrOrganizationRole for a non-member
+func GetOrganizationRole(organizationID, userID uuid.UUID) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return organizationRole(ctx, DB, organizationID, userID)
+}
+
+// SubmitOrganizationWithdrawal queues a withdrawal from the organization wallet by a member and holds its funds,
+// so approvals cannot be spent twice. Below the approval threshold it is approved at once and only needs to be executed.
+func SubmitOrganizationWithdrawal(organizationID, walletID, initiatorID uuid.UUID, amount int64, provider, phoneNumber string) (*OrganizationOperation, *Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	organization, err := scanOrganization(tx.QueryRow(
+		ctx,
+		`SELECT `+organizationColumns+` FROM organizations WHERE id = $1`,
+		organizationID,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+	if organization.WalletID != walletID {
+		return nil, nil, ErrOrganizationWallet
+	}
+	role, err := organizationRole(ctx, tx, organization.ID, initiatorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !RoleGrants(role, PermissionInitiate) {
+		return nil, nil, ErrOrganizationRole
+	}
+
+	t := Transaction{UserID: organization.ID, WalletID: organization.WalletID, Amount: amount, Provider: provider}
+	transaction, err := t.holdWithdrawal(ctx, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	status, required := OperationPending, organization.RequiredApprovals
+	if amount < organization.ApprovalThreshold {
+		status, required = OperationApproved, 0
+	}
+	operation, err := scanOperation(tx.QueryRow(
+		ctx,
+		`INSERT INTO organization_operations
+		(organization_id, wallet_id, kind, amount, currency, provider, phone_number, status, initiated_by, required_approvals, transaction_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING `+operationColumns,
+		organization.ID,
+		organization.WalletID,
+		OperationWithdrawal,
+		amount,
+		organization.Currency,
+		provider,
+		phoneNumber,
+		status,
+		initiatorID,
+		required,
+		transaction.ID,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return operation, transaction, nil
+}
+
+// ApproveOperation records the approval of a member other than the initiator,
+// the operation is approved once it has the approvals required when it was submitted
+func (r *OperationDecisionRequest) ApproveOperation() (*OrganizationOperation, error) {
+	return r.decide(true)
+}
+
+// RejectOperation rejects a pending operation, a single rejection is final
+func (r *OperationDecisionRequest) RejectOperation() (*OrganizationOperation, error) {
+	return r.decide(false)
+}
+
+// decide records the decision of an approver on a pending operation
+func (r *OperationDecisionRequest) decide(approved bool) (*OrganizationOperation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	operation, err := scanOperation(tx.QueryRow(
+		ctx,
+		`SELECT `+operationColumns+` FROM organization_operations WHERE id = $1 AND status = 'PENDING' FOR UPDATE`,
+		r.OperationID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	role, err := organizationRole(ctx, tx, operation.OrganizationID, r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !RoleGrants(role, PermissionApprove):
+		return nil, ErrOrganizationRole
+	case operation.InitiatedBy == r.UserID:
+		return nil, ErrSelfApproval
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`INSERT INTO organization_operation_decisions (operation_id, user_id, approved, note) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (operation_id, user_id) DO NOTHING`,
+		operation.ID,
+		r.UserID,
+		approved,
+		r.Note,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrAlreadyDecided
+	}
+
+	status, count := OperationRejected, operation.ApprovalCount
+	if approved {
+		count++
+		status = OperationPending
+		if count >= operation.RequiredApprovals {
+			status = OperationApproved
+		}
+	}
+	operation, err = scanOperation(tx.QueryRow(
+		ctx,
+		`UPDATE organization_operations SET status = $1, approval_count = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 RETURNING `+operationColumns,
+		status,
+		count,
+		operation.ID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if status == OperationRejected {
+		if err := operation.releaseFunds(ctx, tx, "operation rejected"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return operation, nil
+}
+
+// CancelOperation withdraws a pending operation of its initiator and releases its funds
+func (r *OperationDecisionRequest) CancelOperation() (*OrganizationOperation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	operation, err := scanOperation(tx.QueryRow(
+		ctx,
+		`UPDATE organization_operations SET status = 'CANCELED', error = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND initiated_by = $3 AND status = 'PENDING' RETURNING `+operationColumns,
+		r.Note,
+		r.OperationID,
+		r.UserID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if err := operation.releaseFunds(ctx, tx, "operation canceled"); err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return operation, nil
+}
+
+// releaseFunds fails the withdrawal holding the funds of an operation that will not be executed
+func (o *OrganizationOperation) releaseFunds(ctx context.Context, tx pgx.Tx, reason string) error {
+	if o.TransactionID == nil {
+		return nil
+	}
+	r := TransactionStatusRequest{TransactionID: *o.TransactionID, Status: TransactionFailed, Reason: reason}
+	_, err := r.apply(ctx, tx)
+	return err
+}
+
+// OperationLease is how long an executing operation stays claimed, a crash leaves it to be claimed again after it
+const OperationLease = 5 * time.Minute
+
+// ClaimApprovedOperation claims the oldest approved operation, or an executing one whose lease expired, and marks
+// it EXECUTING in a short transaction so the provider is called with no transaction open. Operations approved
+// before their funds were held get their hold first, an operation whose funds cannot be held fails. It returns
+// nil when no operation is waiting.
+func ClaimApprovedOperation() (*OrganizationOperation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	operation, err := scanOperation(tx.QueryRow(
+		ctx,
+		`SELECT `+operationColumns+` FROM organization_operations
+		WHERE status = 'APPROVED' OR (status = 'EXECUTING' AND updated_at < $1)
+		ORDER BY updated_at LIMIT 1 FOR UPDATE SKIP LOCKED`,
+		time.Now().Add(-OperationLease),
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if operation.TransactionID == nil {
+		t := Transaction{UserID: operation.OrganizationID, WalletID: operation.WalletID, Amount: operation.Amount, Provider: operation.Provider}
+		transaction, err := t.holdWithdrawal(ctx, tx)
+		switch {
+		case errors.Is(err, ErrInsufficientFunds), errors.Is(err, ErrGuardianControl):
+			if err := operation.complete(ctx, tx, nil, err); err != nil {
+				return nil, err
+			}
+			if err := tx.Commit(ctx); err != nil {
+				return nil, err
+			}
+			return operation, nil
+		case err != nil:
+			return nil, err
+		}
+		operation.TransactionID = &transaction.ID
+	}
+
+	operation.Status = OperationExecuting
+	err = tx.QueryRow(
+		ctx,
+		`UPDATE organization_operations SET status = $1, transaction_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 RETURNING updated_at`,
+		operation.Status,
+		operation.TransactionID,
+		operation.ID,
+	).Scan(&operation.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return operation, nil
+}
+
+// CompleteOperation records the withdrawal sent for a claimed operation, a failed withdrawal fails the operation
+func (o *OrganizationOperation) CompleteOperation(transaction *Transaction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	var failure error
+	if transaction.Status == TransactionFailed {
+		failure = errors.New(transaction.FailureReason)
+	}
+	if err := o.complete(ctx, tx, &transaction.ID, failure); err != nil {
+		return err
+	}
+
+	// Then commit transaction
+	return tx.Commit(ctx)
+}
+
+// complete records the outcome of a claimed operation, its transaction or the error that stopped it
+func (o *OrganizationOperation) complete(ctx context.Context, tx pgx.Tx, transactionID *uuid.UUID, failure error) error {
+	o.Status, o.TransactionID, o.Error = OperationExecuted, transactionID, ""
+	if failure != nil {
+		o.Status, o.Error = OperationFailed, failure.Error()
+	}
+	return tx.QueryRow(
+		ctx,
+		`UPDATE organization_operations SET status = $1, transaction_id = $2, error = $3, executed_at = CURRENT_TIMESTAMP,
+		updated_at = CURRENT_TIMESTAMP WHERE id = $4 AND status IN ('APPROVED', 'EXECUTING') RETURNING executed_at, updated_at`,
+		o.Status,
+		o.TransactionID,
+		o.Error,
+		o.ID,
+	).Scan(&o.ExecutedAt, &o.UpdatedAt)
+}
+
+// organizationMembers lists the members of an organization
+func organizationMembers(ctx context.Context, q queryer, organizationID uuid.UUID) ([]OrganizationMember, error) {
+	rows, err := q.Query(
+		ctx,
+		`SELECT organization_id, user_id, role, added_by, created_at, updated_at FROM organization_members
+		WHERE organization_id = $1 ORDER BY created_at`,
+		organizationID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]OrganizationMember, 0)
+	for rows.Next() {
+		var m OrganizationMember
+		if err := rows.Scan(&m.OrganizationID, &m.UserID, &m.Role, &m.AddedBy, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// GetOrganizations lists the organizations of a member with its role
+func GetOrganizations(userID uuid.UUID) ([]Organization, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT o.id, o.name, o.wallet_id, o.currency, o.approval_threshold, o.required_approvals, o.created_by,
+		o.created_at, o.updated_at, m.role
+		FROM organizations o JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = $1 ORDER BY o.name`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	organizations := make([]Organization, 0)
+	for rows.Next() {
+		var o Organization
+		err := rows.Scan(
+			&o.ID,
+			&o.Name,
+			&o.WalletID,
+			&o.Currency,
+			&o.ApprovalThreshold,
+			&o.RequiredApprovals,
+			&o.CreatedBy,
+			&o.CreatedAt,
+			&o.UpdatedAt,
+			&o.Role,
+		)
+		if err != nil {
+			return nil, err
+		}
+		organizations = append(organizations, o)
+	}
+	return organizations, rows.Err()
+}
+
+// GetOrganization returns an organization of a member with its members
+func GetOrganization(organizationID, userID uuid.UUID) (*Organization, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	role, err := organizationRole(ctx, DB, organizationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	organization, err := scanOrganization(DB.QueryRow(
+		ctx,
+		`SELECT `+organizationColumns+` FROM organizations WHERE id = $1`,
+		organizationID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	organization.Role = role
+	if organization.Members, err = organizationMembers(ctx, DB, organization.ID); err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+// GetOrganizationOperations lists the operations of an organization with their decisions, of a status when set
+func GetOrganizationOperations(organizationID uuid.UUID, status string, limit int) ([]OrganizationOperation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+operationColumns+` FROM organization_operations
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2) ORDER BY created_at DESC LIMIT $3`,
+		organizationID,
+		status,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	operations := make([]OrganizationOperation, 0)
+	index := make(map[uuid.UUID]int)
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		operation, err := scanOperation(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[operation.ID] = len(operations)
+		ids = append(ids, operation.ID)
+		operations = append(operations, *operation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = DB.Query(
+		ctx,
+		`SELECT operation_id, user_id, approved, note, created_at FROM organization_operation_decisions
+		WHERE operation_id = ANY($1) ORDER BY created_at`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d OperationDecision
+		if err := rows.Scan(&d.OperationID, &d.UserID, &d.Approved, &d.Note, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		operation := &operations[index[d.OperationID]]
+		operation.Decisions = append(operation.Decisions, d)
+	}
+	return operations, rows.Err()
+}
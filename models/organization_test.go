@@ -0,0 +1,49 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestOrganizationWithdrawalHold(t *testing.T) {
+	testDB(t)
+
+	adminID := uuid.New()
+	organization, err := (&OrganizationRequest{UserID: adminID, Name: "test", Currency: "XAF"}).CreateOrganization()
+	if err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	if _, err := DB.Exec(context.Background(), `UPDATE wallets SET balance = 1000 WHERE id = $1`, organization.WalletID); err != nil {
+		t.Fatalf("fund wallet: %v", err)
+	}
+	policy := OrganizationPolicyRequest{UserID: adminID, OrganizationID: organization.ID, ApprovalThreshold: 100, RequiredApprovals: 1}
+	if _, err := policy.SetOrganizationPolicy(); err != nil {
+		t.Fatalf("SetOrganizationPolicy: %v", err)
+	}
+
+	operation, transaction, err := SubmitOrganizationWithdrawal(organization.ID, organization.WalletID, adminID, 800, "simulator", "237600000000")
+	if err != nil {
+		t.Fatalf("SubmitOrganizationWithdrawal: %v", err)
+	}
+	if operation.Status != OperationPending || operation.TransactionID == nil || *operation.TransactionID != transaction.ID {
+		t.Fatalf("submitted %+v", operation)
+	}
+	if balance := testBalance(t, organization.WalletID); balance != 200 {
+		t.Fatalf("balance after submit = %d, want 200", balance)
+	}
+
+	// The held funds cannot be submitted twice
+	if _, _, err := SubmitOrganizationWithdrawal(organization.ID, organization.WalletID, adminID, 800, "simulator", "237600000000"); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("second SubmitOrganizationWithdrawal = %v, want ErrInsufficientFunds", err)
+	}
+
+	cancel := OperationDecisionRequest{UserID: adminID, OperationID: operation.ID}
+	if _, err := cancel.CancelOperation(); err != nil {
+		t.Fatalf("CancelOperation: %v", err)
+	}
+	if balance := testBalance(t, organization.WalletID); balance != 1000 {
+		t.Fatalf("balance after cancel = %d, want 1000", balance)
+	}
+}
@@ -0,0 +1,385 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"math/big"
+	"time"
+)
+
+// Payment link statuses
+const (
+	PaymentLinkActive   = "ACTIVE"
+	PaymentLinkDisabled = "DISABLED"
+)
+
+// TransferSourcePaymentLink is the source of the transfers paying a link
+const TransferSourcePaymentLink = "payment_link"
+
+// paymentLinkCodeAlphabet and paymentLinkCodeLength shape the public code of a link
+const (
+	paymentLinkCodeAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	paymentLinkCodeLength   = 12
+)
+
+// Payment link errors
+var (
+	ErrPaymentLinkUnavailable = errors.New("payment link is disabled, expired or used up")
+	ErrPaymentLinkAmount      = errors.New("amount does not match the payment link")
+)
+
+// PaymentLink is the struct for a shareable link paying a merchant
+type PaymentLink struct {
+	ID             uuid.UUID  `json:"id" db:"id,omitempty"`
+	MerchantID     uuid.UUID  `json:"merchant_id" db:"merchant_id"`
+	Code           string     `json:"code" db:"code"`
+	Amount         *int64     `json:"amount,omitempty" db:"amount"` // nil lets the payer choose between min and max
+	MinAmount      int64      `json:"min_amount" db:"min_amount"`
+	MaxAmount      int64      `json:"max_amount" db:"max_amount"`
+	Currency       string     `json:"currency" db:"currency"`
+	Description    string     `json:"description" db:"description"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	MaxUses        *int       `json:"max_uses,omitempty" db:"max_uses"` // 1 for a single-use link, nil for unlimited
+	UseCount       int        `json:"use_count" db:"use_count"`
+	TotalCollected int64      `json:"total_collected" db:"total_collected"`
+	Status         string     `json:"status" db:"status"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// PaymentLinkView is the public description of a link, without the merchant wallet
+type PaymentLinkView struct {
+	Code          string     `json:"code"`
+	MerchantName  string     `json:"merchant_name"`
+	MerchantCity  string     `json:"merchant_city"`
+	Amount        *int64     `json:"amount,omitempty"`
+	MinAmount     int64      `json:"min_amount"`
+	MaxAmount     int64      `json:"max_amount"`
+	Currency      string     `json:"currency"`
+	Description   string     `json:"description"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	RemainingUses *int       `json:"remaining_uses,omitempty"`
+	Payable       bool       `json:"payable"`
+}
+
+// PaymentLinkRequest is the struct for creating a payment link of a merchant
+type PaymentLinkRequest struct {
+	UserID           uuid.UUID `json:"user_id" binding:"required"`
+	MerchantID       uuid.UUID `json:"merchant_id" binding:"required"`
+	Amount           int64     `json:"amount" binding:"omitempty,min=100,max=2000000"` // zero for a payer-chosen amount
+	MinAmount        int64     `json:"min_amount" binding:"omitempty,min=100,max=2000000"`
+	MaxAmount        int64     `json:"max_amount" binding:"omitempty,min=100,max=2000000"`
+	Currency         string    `json:"currency" binding:"required,oneof=XAF USD XOF"`
+	Description      string    `json:"description" binding:"required,max=255"`
+	ExpiresInMinutes int       `json:"expires_in_minutes" binding:"omitempty,gt=0,max=525600"`
+	MaxUses          int       `json:"max_uses" binding:"omitempty,gt=0"`
+}
+
+// PaymentLinkDisableRequest is the struct for disabling a payment link
+type PaymentLinkDisableRequest struct {
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+	LinkID uuid.UUID `json:"link_id" binding:"required"`
+}
+
+// PaymentLinkPayRequest is the struct for paying a payment link.
+// The reference is the payer's order or invoice number, kept for the merchant reconciliation.
+type PaymentLinkPayRequest struct {
+	UserID         uuid.UUID `json:"user_id" binding:"required"`
+	Code           string    `json:"code" binding:"required,alphanum,max=32"`
+	Amount         int64     `json:"amount" binding:"omitempty,min=100,max=2000000"`
+	Reference      string    `json:"reference" binding:"max=100"`
+	IdempotencyKey string    `json:"idempotency_key" binding:"max=100"`
+}
+
+// paymentLinkColumns is the column list scanned by scanPaymentLink
+const paymentLinkColumns = `id, merchant_id, code, amount, min_amount, max_amount, currency, description, expires_at,
+	max_uses, use_count, total_collected, status, created_at, updated_at`
+
+// scanPaymentLink scans a payment link row
+func scanPaymentLink(row pgx.Row) (*PaymentLink, error) {
+	l := &PaymentLink{}
+	err := row.Scan(
+		&l.ID,
+		&l.MerchantID,
+		&l.Code,
+		&l.Amount,
+		&l.MinAmount,
+		&l.MaxAmount,
+		&l.Currency,
+		&l.Description,
+		&l.ExpiresAt,
+		&l.MaxUses,
+		&l.UseCount,
+		&l.TotalCollected,
+		&l.Status,
+		&l.CreatedAt,
+		&l.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// payable checks if a link can still be paid at a time
+func (l *PaymentLink) payable(now time.Time) bool {
+	return l.Status == PaymentLinkActive &&
+		(l.ExpiresAt == nil || now.Before(*l.ExpiresAt)) &&
+		(l.MaxUses == nil || l.UseCount < *l.MaxUses)
+}
+
+// newPaymentLinkCode returns a random public code without look-alike characters
+func newPaymentLinkCode() (string, error) {
+	code := make([]byte, paymentLinkCodeLength)
+	max := big.NewInt(int64(len(paymentLinkCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = paymentLinkCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// CreatePaymentLink creates a link paying a merchant of the user, in the currency of the merchant wallet
+func (r *PaymentLinkRequest) CreatePaymentLink() (*PaymentLink, error) {
+	var amount *int64
+	if r.Amount > 0 {
+		amount = &r.Amount
+	}
+	if r.MinAmount == 0 {
+		r.MinAmount = 100
+	}
+	if r.MaxAmount == 0 {
+		r.MaxAmount = 2000000
+	}
+	if r.MinAmount > r.MaxAmount {
+		return nil, fmt.Errorf("%w: min_amount is above max_amount", ErrPaymentLinkAmount)
+	}
+	var expiresAt *time.Time
+	if r.ExpiresInMinutes > 0 {
+		at := time.Now().Add(time.Duration(r.ExpiresInMinutes) * time.Minute)
+		expiresAt = &at
+	}
+	var maxUses *int
+	if r.MaxUses > 0 {
+		maxUses = &r.MaxUses
+	}
+	code, err := newPaymentLinkCode()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	link, err := scanPaymentLink(DB.QueryRow(
+		ctx,
+		`INSERT INTO payment_links (merchant_id, code, amount, min_amount, max_amount, currency, description, expires_at, max_uses)
+		SELECT m.id, $3, $4, $5, $6, w.currency, $8, $9, $10
+		FROM merchants m JOIN wallets w ON w.id = m.wallet_id
+		WHERE m.id = $1 AND m.user_id = $2 AND m.is_active = true AND w.is_active = true AND w.currency = $7
+		RETURNING `+paymentLinkColumns,
+		r.MerchantID,
+		r.UserID,
+		code,
+		amount,
+		r.MinAmount,
+		r.MaxAmount,
+		r.Currency,
+		r.Description,
+		expiresAt,
+		maxUses,
+	))
+	if err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// DisablePaymentLink stops a link of a merchant of the user from being paid
+func (r *PaymentLinkDisableRequest) DisablePaymentLink() (*PaymentLink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanPaymentLink(DB.QueryRow(
+		ctx,
+		`UPDATE payment_links SET status = 'DISABLED', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND merchant_id IN (SELECT id FROM merchants WHERE user_id = $2) RETURNING `+paymentLinkColumns,
+		r.LinkID,
+		r.UserID,
+	))
+}
+
+// ResolvePaymentLink returns the public description of a link by its code
+func ResolvePaymentLink(code string) (*PaymentLinkView, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	view := &PaymentLinkView{}
+	link, err := scanPaymentLink(DB.QueryRow(
+		ctx,
+		`SELECT `+paymentLinkColumns+` FROM payment_links WHERE code = $1`,
+		code,
+	))
+	if err != nil {
+		return nil, err
+	}
+	err = DB.QueryRow(ctx, `SELECT name, city, is_active FROM merchants WHERE id = $1`, link.MerchantID).
+		Scan(&view.MerchantName, &view.MerchantCity, &view.Payable)
+	if err != nil {
+		return nil, err
+	}
+
+	view.Code = link.Code
+	view.Amount = link.Amount
+	view.MinAmount = link.MinAmount
+	view.MaxAmount = link.MaxAmount
+	view.Currency = link.Currency
+	view.Description = link.Description
+	view.ExpiresAt = link.ExpiresAt
+	view.Payable = view.Payable && link.payable(time.Now())
+	if link.MaxUses != nil {
+		remaining := max(*link.MaxUses-link.UseCount, 0)
+		view.RemainingUses = &remaining
+	}
+	return view, nil
+}
+
+// PayPaymentLink pays a link from the wallet of the payer and records the payment for the merchant, in one transaction
+func (r *PaymentLinkPayRequest) PayPaymentLink() (*MerchantPayment, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	// The link row serializes the payments so the usage limit holds
+	link, err := scanPaymentLink(tx.QueryRow(
+		ctx,
+		`SELECT `+paymentLinkColumns+` FROM payment_links WHERE code = $1 FOR UPDATE`,
+		r.Code,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !link.payable(time.Now()) {
+		return nil, nil, ErrPaymentLinkUnavailable
+	}
+	amount := r.Amount
+	switch {
+	case link.Amount != nil && (amount == 0 || amount == *link.Amount):
+		amount = *link.Amount
+	case link.Amount != nil, amount < link.MinAmount, amount > link.MaxAmount:
+		return nil, nil, ErrPaymentLinkAmount
+	}
+
+	merchant, err := scanMerchant(tx.QueryRow(
+		ctx,
+		`SELECT `+merchantColumns+` FROM merchants m JOIN wallets w ON w.id = m.wallet_id
+		WHERE m.id = $1 AND m.is_active = true AND w.is_active = true`,
+		link.MerchantID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, ErrPaymentLinkUnavailable
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var key *string
+	if r.IdempotencyKey != "" {
+		k := fmt.Sprintf("%s:%s:%s:%s", TransferSourcePaymentLink, link.ID, r.UserID, r.IdempotencyKey)
+		key = &k
+	}
+	transfer := &Transfer{
+		FromUserID:     r.UserID,
+		ToWalletID:     merchant.WalletID,
+		Amount:         amount,
+		Source:         TransferSourcePaymentLink,
+		SourceID:       &link.ID,
+		IdempotencyKey: key,
+	}
+	if err := transfer.transfer(ctx, tx); err != nil {
+		return nil, nil, err
+	}
+
+	payment := &MerchantPayment{
+		MerchantID:     merchant.ID,
+		LinkID:         &link.ID,
+		TransferID:     transfer.ID,
+		PayerID:        r.UserID,
+		Amount:         amount,
+		Currency:       transfer.Currency,
+		Reference:      link.Code,
+		PayerReference: r.Reference,
+	}
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO merchant_payments (merchant_id, link_id, transfer_id, payer_id, amount, currency, reference, payer_reference)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`,
+		payment.MerchantID,
+		payment.LinkID,
+		payment.TransferID,
+		payment.PayerID,
+		payment.Amount,
+		payment.Currency,
+		payment.Reference,
+		payment.PayerReference,
+	).Scan(&payment.ID, &payment.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE payment_links SET use_count = use_count + 1, total_collected = total_collected + $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+		amount,
+		link.ID,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return payment, transfer, nil
+}
+
+// GetPaymentLinks lists the links of a merchant, newest first
+func GetPaymentLinks(merchantID uuid.UUID, limit int) ([]PaymentLink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+paymentLinkColumns+` FROM payment_links WHERE merchant_id = $1 ORDER BY created_at DESC LIMIT $2`,
+		merchantID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]PaymentLink, 0)
+	for rows.Next() {
+		link, err := scanPaymentLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *link)
+	}
+	return links, nil
+}
@@ -0,0 +1,277 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Payment request statuses
+const (
+	PaymentRequestPending  = "PENDING"
+	PaymentRequestAccepted = "ACCEPTED"
+	PaymentRequestDeclined = "DECLINED"
+	PaymentRequestExpired  = "EXPIRED"
+	PaymentRequestCanceled = "CANCELED"
+)
+
+// Payment request answers of the payer
+const (
+	PaymentRequestAccept  = "ACCEPT"
+	PaymentRequestDecline = "DECLINE"
+)
+
+// TransferSourcePaymentRequest is the source of the transfers paying a request
+const TransferSourcePaymentRequest = "payment_request"
+
+// DefaultPaymentRequestExpiry is how long a request waits for an answer when none is set
+const DefaultPaymentRequestExpiry = 7 * 24 * time.Hour
+
+// ErrPaymentRequestExpired is returned when a request is answered after it expired
+var ErrPaymentRequestExpired = errors.New("payment request expired")
+
+// PaymentRequest is the struct for a request of money from another user
+type PaymentRequest struct {
+	ID                uuid.UUID  `json:"id" db:"id,omitempty"`
+	RequesterID       uuid.UUID  `json:"requester_id" db:"requester_id"`
+	RequesterWalletID uuid.UUID  `json:"requester_wallet_id" db:"requester_wallet_id"`
+	PayerID           uuid.UUID  `json:"payer_id" db:"payer_id"`
+	Amount            int64      `json:"amount" db:"amount"`
+	Currency          string     `json:"currency" db:"currency"`
+	Note              string     `json:"note" db:"note"`
+	Status            string     `json:"status" db:"status"`
+	ExpiresAt         time.Time  `json:"expires_at" db:"expires_at"`
+	TransferID        *uuid.UUID `json:"transfer_id,omitempty" db:"transfer_id"`
+	RespondedAt       *time.Time `json:"responded_at,omitempty" db:"responded_at"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt         time.Time  `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// PaymentRequestCreate is the struct for asking another user to pay
+type PaymentRequestCreate struct {
+	UserID         uuid.UUID `json:"user_id" binding:"required"`
+	WalletID       uuid.UUID `json:"wallet_id" binding:"required"`
+	PayerID        uuid.UUID `json:"payer_id" binding:"required"`
+	Amount         int64     `json:"amount" binding:"required,numeric,gt=0,min=100,max=2000000"`
+	Note           string    `json:"note" binding:"max=255"`
+	ExpiresInHours int       `json:"expires_in_hours" binding:"omitempty,gt=0,max=720"`
+}
+
+// PaymentRequestResponse is the struct for the payer accepting or declining a request
+type PaymentRequestResponse struct {
+	UserID    uuid.UUID `json:"user_id" binding:"required"`
+	RequestID uuid.UUID `json:"request_id" binding:"required"`
+	Action    string    `json:"action" binding:"required,oneof=ACCEPT DECLINE"`
+}
+
+// PaymentRequestCancel is the struct for the requester withdrawing a request
+type PaymentRequestCancel struct {
+	UserID    uuid.UUID `json:"user_id" binding:"required"`
+	RequestID uuid.UUID `json:"request_id" binding:"required"`
+}
+
+// paymentRequestColumns is the column list scanned by scanPaymentRequest
+const paymentRequestColumns = `id, requester_id, requester_wallet_id, payer_id, amount, currency, note, status,
+	expires_at, transfer_id, responded_at, created_at, updated_at`
+
+// scanPaymentRequest scans a payment request row
+func scanPaymentRequest(row pgx.Row) (*PaymentRequest, error) {
+	r := &PaymentRequest{}
+	err := row.Scan(
+		&r.ID,
+		&r.RequesterID,
+		&r.RequesterWalletID,
+		&r.PayerID,
+		&r.Amount,
+		&r.Currency,
+		&r.Note,
+		&r.Status,
+		&r.ExpiresAt,
+		&r.TransferID,
+		&r.RespondedAt,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CreatePaymentRequest asks the payer for money into a wallet of the user.
+// The payer needs an active wallet in the same currency.
+func (r *PaymentRequestCreate) CreatePaymentRequest() (*PaymentRequest, error) {
+	if r.PayerID == r.UserID {
+		return nil, ErrSameWallet
+	}
+	expiry := DefaultPaymentRequestExpiry
+	if r.ExpiresInHours > 0 {
+		expiry = time.Duration(r.ExpiresInHours) * time.Hour
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanPaymentRequest(DB.QueryRow(
+		ctx,
+		`INSERT INTO payment_requests (requester_id, requester_wallet_id, payer_id, amount, currency, note, expires_at)
+		SELECT w.user_id, w.id, $3, $4, w.currency, $5, $6
+		FROM wallets w JOIN wallets p ON p.user_id = $3 AND p.is_active = true AND p.currency = w.currency
+		WHERE w.id = $1 AND w.user_id = $2 AND w.is_active = true
+		RETURNING `+paymentRequestColumns,
+		r.WalletID,
+		r.UserID,
+		r.PayerID,
+		r.Amount,
+		r.Note,
+		time.Now().Add(expiry),
+	))
+}
+
+// RespondPaymentRequest accepts or declines a pending request of the payer.
+// Accepting pays the request and marks it accepted in one transaction.
+func (r *PaymentRequestResponse) RespondPaymentRequest() (*PaymentRequest, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	request, err := scanPaymentRequest(tx.QueryRow(
+		ctx,
+		`SELECT `+paymentRequestColumns+` FROM payment_requests WHERE id = $1 AND payer_id = $2 AND status = 'PENDING' FOR UPDATE`,
+		r.RequestID,
+		r.UserID,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !time.Now().Before(request.ExpiresAt) {
+		return nil, nil, ErrPaymentRequestExpired
+	}
+
+	var transfer *Transfer
+	status := PaymentRequestDeclined
+	if r.Action == PaymentRequestAccept {
+		key := TransferSourcePaymentRequest + ":" + request.ID.String()
+		transfer = &Transfer{
+			FromUserID:     request.PayerID,
+			ToWalletID:     request.RequesterWalletID,
+			Amount:         request.Amount,
+			Source:         TransferSourcePaymentRequest,
+			SourceID:       &request.ID,
+			IdempotencyKey: &key,
+		}
+		if err := transfer.transfer(ctx, tx); err != nil {
+			return nil, nil, err
+		}
+		status = PaymentRequestAccepted
+	}
+
+	request, err = scanPaymentRequest(tx.QueryRow(
+		ctx,
+		`UPDATE payment_requests SET status = $1, transfer_id = $2, responded_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 RETURNING `+paymentRequestColumns,
+		status,
+		transferID(transfer),
+		request.ID,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return request, transfer, nil
+}
+
+// CancelPaymentRequest withdraws a pending request of the requester
+func (r *PaymentRequestCancel) CancelPaymentRequest() (*PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanPaymentRequest(DB.QueryRow(
+		ctx,
+		`UPDATE payment_requests SET status = 'CANCELED', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND requester_id = $2 AND status = 'PENDING' RETURNING `+paymentRequestColumns,
+		r.RequestID,
+		r.UserID,
+	))
+}
+
+// GetPaymentRequests lists the requests received by a user, or sent when outgoing is set, newest first
+func GetPaymentRequests(userID uuid.UUID, outgoing bool, status string, limit int) ([]PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	column := "payer_id"
+	if outgoing {
+		column = "requester_id"
+	}
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+paymentRequestColumns+` FROM payment_requests
+		WHERE `+column+` = $1 AND ($2 = '' OR status = $2) ORDER BY created_at DESC LIMIT $3`,
+		userID,
+		status,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := make([]PaymentRequest, 0)
+	for rows.Next() {
+		request, err := scanPaymentRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *request)
+	}
+	return requests, nil
+}
+
+// ExpirePaymentRequests expires the pending requests past their expiry and returns them
+func ExpirePaymentRequests(now time.Time) ([]PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`UPDATE payment_requests SET status = 'EXPIRED', updated_at = CURRENT_TIMESTAMP
+		WHERE status = 'PENDING' AND expires_at <= $1 RETURNING `+paymentRequestColumns,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := make([]PaymentRequest, 0)
+	for rows.Next() {
+		request, err := scanPaymentRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *request)
+	}
+	return requests, rows.Err()
+}
+
+// transferID returns the id of a transfer, nil when there is none
+func transferID(t *Transfer) *uuid.UUID {
+	if t == nil {
+		return nil
+	}
+	return &t.ID
+}
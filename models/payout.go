@@ -0,0 +1,714 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Payout batch statuses
+const (
+	PayoutBatchDraft      = "DRAFT"      // validated, waiting for confirmation
+	PayoutBatchProcessing = "PROCESSING" // lines being paid
+	PayoutBatchCompleted  = "COMPLETED"  // every valid line paid
+	PayoutBatchPartial    = "PARTIAL"    // some lines failed, they can be resumed
+	PayoutBatchFailed     = "FAILED"     // no line paid
+	PayoutBatchCanceled   = "CANCELED"
+)
+
+// Payout line statuses
+const (
+	PayoutLineValid     = "VALID"
+	PayoutLineInvalid   = "INVALID"
+	PayoutLinePending   = "PENDING"
+	PayoutLineSucceeded = "SUCCEEDED"
+	PayoutLineFailed    = "FAILED"
+)
+
+// Transfer sources of the payout lines
+const (
+	TransferSourcePayout    = "payout"
+	TransferSourcePayoutFee = "payout_fee"
+)
+
+// MaxPayoutLines bounds the number of recipients of a batch
+const MaxPayoutLines = 5000
+
+// Payout errors
+var (
+	ErrPayoutFile  = errors.New("invalid payout file")
+	ErrPayoutEmpty = errors.New("payout file has no valid line")
+)
+
+// PayoutFees is the fee charged to the source wallet for every paid line, credited to the fee wallet
+type PayoutFees struct {
+	Fixed    int64     // per line
+	BPS      int64     // basis points of the line amount
+	WalletID uuid.UUID // no fee is charged without a fee wallet
+}
+
+// Fee returns the fee of a line amount
+func (f PayoutFees) Fee(amount int64) int64 {
+	if f.WalletID == uuid.Nil {
+		return 0
+	}
+	return f.Fixed + amount*f.BPS/10000
+}
+
+// PayoutBatch is the struct for a batch of payouts uploaded as CSV, e.g. salaries
+type PayoutBatch struct {
+	ID               uuid.UUID    `json:"id" db:"id,omitempty"`
+	UserID           uuid.UUID    `json:"user_id" db:"user_id"`
+	WalletID         uuid.UUID    `json:"wallet_id" db:"wallet_id"`
+	Currency         string       `json:"currency" db:"currency"`
+	Filename         string       `json:"filename" db:"filename"`
+	Status           string       `json:"status" db:"status"`
+	LineCount        int          `json:"line_count" db:"line_count"`
+	ValidCount       int          `json:"valid_count" db:"valid_count"`
+	TotalAmount      int64        `json:"total_amount" db:"total_amount"` // of the valid lines
+	TotalFee         int64        `json:"total_fee" db:"total_fee"`
+	SucceededCount   int          `json:"succeeded_count" db:"succeeded_count"`
+	SucceededAmount  int64        `json:"succeeded_amount" db:"succeeded_amount"`
+	SucceededFee     int64        `json:"succeeded_fee" db:"succeeded_fee"`
+	FailedCount      int          `json:"failed_count" db:"failed_count"`
+	AvailableBalance int64        `json:"available_balance" db:"-"` // of the source wallet, to check the totals before confirming
+	Lines            []PayoutLine `json:"lines,omitempty" db:"-"`
+	ConfirmedAt      *time.Time   `json:"confirmed_at,omitempty" db:"confirmed_at"`
+	CompletedAt      *time.Time   `json:"completed_at,omitempty" db:"completed_at"`
+	CreatedAt        time.Time    `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt        time.Time    `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// PayoutLine is a recipient of a payout batch
+type PayoutLine struct {
+	ID            uuid.UUID  `json:"id" db:"id,omitempty"`
+	BatchID       uuid.UUID  `json:"batch_id" db:"batch_id"`
+	Line          int        `json:"line" db:"line"` // in the uploaded file
+	RecipientID   *uuid.UUID `json:"recipient_id,omitempty" db:"recipient_id"`
+	Amount        int64      `json:"amount" db:"amount"`
+	Fee           int64      `json:"fee" db:"fee"`
+	Reference     string     `json:"reference" db:"reference"`
+	Status        string     `json:"status" db:"status"`
+	Error         string     `json:"error,omitempty" db:"error"`
+	TransferID    *uuid.UUID `json:"transfer_id,omitempty" db:"transfer_id"`
+	FeeTransferID *uuid.UUID `json:"fee_transfer_id,omitempty" db:"fee_transfer_id"`
+	ProcessedAt   *time.Time `json:"processed_at,omitempty" db:"processed_at"`
+}
+
+// PayoutBatchAction is the struct for confirming, canceling or resuming a batch
+type PayoutBatchAction struct {
+	UserID  uuid.UUID `json:"user_id" binding:"required"`
+	BatchID uuid.UUID `json:"batch_id" binding:"required"`
+}
+
+// ParsePayoutFile reads the lines of a payout CSV file with a user_id and an amount column, and an optional reference.
+// A line that cannot be read is kept as invalid so the whole file can be reviewed at once.
+func ParsePayoutFile(r io.Reader) ([]PayoutLine, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing header: %v", ErrPayoutFile, err)
+	}
+	columns := map[string]int{"reference": -1}
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff") // UTF-8 BOM of spreadsheet exports
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"user_id", "amount"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrPayoutFile, name)
+		}
+	}
+	field := func(record []string, name string) string {
+		i := columns[name]
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	lines := make([]PayoutLine, 0)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrPayoutFile, err)
+		}
+		lineNumber, _ := reader.FieldPos(0)
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(lines) == MaxPayoutLines {
+			return nil, fmt.Errorf("%w: more than %d lines", ErrPayoutFile, MaxPayoutLines)
+		}
+
+		line := PayoutLine{Line: lineNumber, Reference: field(record, "reference"), Status: PayoutLineValid}
+		recipient, err := uuid.Parse(field(record, "user_id"))
+		if err == nil {
+			line.RecipientID = &recipient
+		}
+		line.Amount, _ = strconv.ParseInt(field(record, "amount"), 10, 64)
+		switch {
+		case line.RecipientID == nil:
+			line.Status, line.Error = PayoutLineInvalid, "invalid user id"
+		case line.Amount < 100 || line.Amount > 2000000:
+			line.Status, line.Error = PayoutLineInvalid, "amount must be a whole number between 100 and 2000000"
+		case len(line.Reference) > 100:
+			line.Status, line.Error = PayoutLineInvalid, "reference longer than 100 characters"
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// payoutBatchColumns is the column list scanned by scanPayoutBatch
+const payoutBatchColumns = `id, user_id, wallet_id, currency, filename, status, line_count, valid_count, total_amount, total_fee,
+	succeeded_count, succeeded_amount, succeeded_fee, failed_count, confirmed_at, completed_at, created_at, updated_at`
+
+// scanPayoutBatch scans a payout batch row
+func scanPayoutBatch(row pgx.Row) (*PayoutBatch, error) {
+	b := &PayoutBatch{}
+	err := row.Scan(
+		&b.ID,
+		&b.UserID,
+		&b.WalletID,
+		&b.Currency,
+		&b.Filename,
+		&b.Status,
+		&b.LineCount,
+		&b.ValidCount,
+		&b.TotalAmount,
+		&b.TotalFee,
+		&b.SucceededCount,
+		&b.SucceededAmount,
+		&b.SucceededFee,
+		&b.FailedCount,
+		&b.ConfirmedAt,
+		&b.CompletedAt,
+		&b.CreatedAt,
+		&b.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// payoutLineColumns is the column list scanned by scanPayoutLine
+const payoutLineColumns = `id, batch_id, line, recipient_id, amount, fee, reference, status, error, transfer_id, fee_transfer_id, processed_at`
+
+// scanPayoutLine scans a payout line row
+func scanPayoutLine(row pgx.Row) (*PayoutLine, error) {
+	l := &PayoutLine{}
+	err := row.Scan(
+		&l.ID,
+		&l.BatchID,
+		&l.Line,
+		&l.RecipientID,
+		&l.Amount,
+		&l.Fee,
+		&l.Reference,
+		&l.Status,
+		&l.Error,
+		&l.TransferID,
+		&l.FeeTransferID,
+		&l.ProcessedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// CreatePayoutBatch validates the parsed lines against the wallets and stores them as a draft of the user wallet,
+// with the totals and fees of the valid lines
+func CreatePayoutBatch(userID, walletID uuid.UUID, filename string, lines []PayoutLine, fees PayoutFees) (*PayoutBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	batch := &PayoutBatch{UserID: userID, WalletID: walletID, Filename: filename, Status: PayoutBatchDraft, LineCount: len(lines)}
+	err = tx.QueryRow(
+		ctx,
+		`SELECT currency, balance FROM wallets WHERE id = $1 AND user_id = $2 AND is_active = true`,
+		walletID,
+		userID,
+	).Scan(&batch.Currency, &batch.AvailableBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	// The recipients need an active wallet in the batch currency
+	recipients := make([]uuid.UUID, 0, len(lines))
+	for _, line := range lines {
+		if line.RecipientID != nil {
+			recipients = append(recipients, *line.RecipientID)
+		}
+	}
+	rows, err := tx.Query(
+		ctx,
+		`SELECT user_id, currency FROM wallets WHERE user_id = ANY($1) AND is_active = true`,
+		recipients,
+	)
+	if err != nil {
+		return nil, err
+	}
+	currencies := make(map[uuid.UUID]string, len(recipients))
+	for rows.Next() {
+		var user uuid.UUID
+		var currency string
+		if err := rows.Scan(&user, &currency); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		currencies[user] = currency
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	references := make(map[string]int, len(lines))
+	for i := range lines {
+		line := &lines[i]
+		if line.Status != PayoutLineValid {
+			continue
+		}
+		currency, ok := currencies[*line.RecipientID]
+		previous, duplicate := references[line.RecipientID.String()+"/"+line.Reference]
+		switch {
+		case *line.RecipientID == userID:
+			line.Status, line.Error = PayoutLineInvalid, "cannot pay the source wallet"
+		case !ok:
+			line.Status, line.Error = PayoutLineInvalid, "recipient has no active wallet"
+		case currency != batch.Currency:
+			line.Status, line.Error = PayoutLineInvalid, "recipient wallet has another currency"
+		case duplicate && line.Reference != "":
+			line.Status, line.Error = PayoutLineInvalid, fmt.Sprintf("duplicate of line %d", previous)
+		}
+		if line.Status != PayoutLineValid {
+			continue
+		}
+		references[line.RecipientID.String()+"/"+line.Reference] = line.Line
+		line.Fee = fees.Fee(line.Amount)
+		batch.ValidCount++
+		batch.TotalAmount += line.Amount
+		batch.TotalFee += line.Fee
+	}
+	if batch.ValidCount == 0 {
+		return nil, ErrPayoutEmpty
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO payout_batches (user_id, wallet_id, currency, filename, line_count, valid_count, total_amount, total_fee)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at, updated_at`,
+		batch.UserID,
+		batch.WalletID,
+		batch.Currency,
+		batch.Filename,
+		batch.LineCount,
+		batch.ValidCount,
+		batch.TotalAmount,
+		batch.TotalFee,
+	).Scan(&batch.ID, &batch.CreatedAt, &batch.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"payout_lines"},
+		[]string{"batch_id", "line", "recipient_id", "amount", "fee", "reference", "status", "error"},
+		pgx.CopyFromSlice(len(lines), func(i int) ([]any, error) {
+			l := lines[i]
+			return []any{batch.ID, l.Line, l.RecipientID, l.Amount, l.Fee, l.Reference, l.Status, l.Error}, nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	batch.Lines = lines
+	return batch, nil
+}
+
+// ConfirmPayoutBatch queues the valid lines of a draft of the user
+func (r *PayoutBatchAction) ConfirmPayoutBatch() (*PayoutBatch, error) {
+	return updatePayoutBatch(r.BatchID, r.UserID, []string{PayoutBatchDraft}, PayoutBatchProcessing, PayoutLineValid, PayoutLinePending)
+}
+
+// CancelPayoutBatch cancels a draft of the user, nothing was paid
+func (r *PayoutBatchAction) CancelPayoutBatch() (*PayoutBatch, error) {
+	return updatePayoutBatch(r.BatchID, r.UserID, []string{PayoutBatchDraft}, PayoutBatchCanceled, "", "")
+}
+
+// ResumePayoutBatch queues the failed lines of a batch of the user again, e.g. once the wallet is funded
+func (r *PayoutBatchAction) ResumePayoutBatch() (*PayoutBatch, error) {
+	return updatePayoutBatch(r.BatchID, r.UserID, []string{PayoutBatchPartial, PayoutBatchFailed}, PayoutBatchProcessing, PayoutLineFailed, PayoutLinePending)
+}
+
+// updatePayoutBatch moves a batch of the user from one of some statuses to another, and its lines of a status to another
+func updatePayoutBatch(batchID, userID uuid.UUID, from []string, to, lineFrom, lineTo string) (*PayoutBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	batch, err := scanPayoutBatch(tx.QueryRow(
+		ctx,
+		`UPDATE payout_batches SET status = $1, failed_count = CASE WHEN $4 = 'FAILED' THEN 0 ELSE failed_count END,
+		confirmed_at = COALESCE(confirmed_at, CASE WHEN $1 = 'PROCESSING' THEN CURRENT_TIMESTAMP END),
+		completed_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND user_id = $3 AND status = ANY($5) RETURNING `+payoutBatchColumns,
+		to,
+		batchID,
+		userID,
+		lineFrom,
+		from,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if lineFrom != "" {
+		_, err = tx.Exec(
+			ctx,
+			`UPDATE payout_lines SET status = $1, error = '' WHERE batch_id = $2 AND status = $3`,
+			lineTo,
+			batch.ID,
+			lineFrom,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// GetPendingPayoutLines returns the queued lines, oldest batch first
+func GetPendingPayoutLines(limit int) ([]uuid.UUID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT l.id FROM payout_lines l JOIN payout_batches b ON b.id = l.batch_id
+		WHERE l.status = 'PENDING' AND b.status = 'PROCESSING' ORDER BY b.confirmed_at, l.line LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ExecutePayoutLine pays a queued line and its fee from the batch wallet and updates the batch, in one transaction.
+// A refused transfer fails the line only, the batch is finished once no line is queued.
+// It returns the line, its transfers when paid, and the batch when it finished.
+func ExecutePayoutLine(lineID uuid.UUID, feeWalletID uuid.UUID) (*PayoutLine, []*Transfer, *PayoutBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	line, err := scanPayoutLine(tx.QueryRow(
+		ctx,
+		`SELECT `+payoutLineColumns+` FROM payout_lines WHERE id = $1 AND status = 'PENDING' FOR UPDATE SKIP LOCKED`,
+		lineID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, nil, nil // already paid, or being paid by another replica
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	batch, err := scanPayoutBatch(tx.QueryRow(
+		ctx,
+		`SELECT `+payoutBatchColumns+` FROM payout_batches WHERE id = $1 AND status = 'PROCESSING' FOR UPDATE`,
+		line.BatchID,
+	))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	key := TransferSourcePayout + ":" + line.ID.String()
+	transfers := []*Transfer{{
+		FromWalletID:   batch.WalletID,
+		FromUserID:     batch.UserID,
+		ToUserID:       *line.RecipientID,
+		Amount:         line.Amount,
+		Source:         TransferSourcePayout,
+		SourceID:       &line.ID,
+		IdempotencyKey: &key,
+	}}
+	if line.Fee > 0 {
+		feeKey := TransferSourcePayoutFee + ":" + line.ID.String()
+		transfers = append(transfers, &Transfer{
+			FromWalletID:   batch.WalletID,
+			FromUserID:     batch.UserID,
+			ToWalletID:     feeWalletID,
+			Amount:         line.Fee,
+			Source:         TransferSourcePayoutFee,
+			SourceID:       &line.ID,
+			IdempotencyKey: &feeKey,
+		})
+	}
+
+	// The transfers run in a savepoint so a refused line is still recorded
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	line.Status = PayoutLineSucceeded
+	if line.Fee > 0 {
+		// checked up front so the line amount is not paid without its fee
+		err = savepoint.QueryRow(ctx, `SELECT balance FROM wallets WHERE id = $1`, batch.WalletID).Scan(&batch.AvailableBalance)
+		if err == nil && batch.AvailableBalance < line.Amount+line.Fee {
+			err = ErrInsufficientFunds
+		}
+	}
+	for _, t := range transfers {
+		if err != nil {
+			break
+		}
+		err = t.transfer(ctx, savepoint)
+	}
+	switch {
+	case err == nil:
+		if err := savepoint.Commit(ctx); err != nil {
+			return nil, nil, nil, err
+		}
+		line.TransferID = &transfers[0].ID
+		if line.Fee > 0 {
+			line.FeeTransferID = &transfers[1].ID
+		}
+	case errors.Is(err, ErrInsufficientFunds), errors.Is(err, ErrWalletLocked), errors.Is(err, pgx.ErrNoRows),
+		errors.Is(err, ErrCurrencyMismatch), errors.Is(err, ErrSameWallet), errors.Is(err, ErrTransferExists),
+		errors.Is(err, ErrGuardianControl):
+		line.Status, line.Error = PayoutLineFailed, err.Error()
+		transfers = nil
+		if err := savepoint.Rollback(ctx); err != nil {
+			return nil, nil, nil, err
+		}
+	default:
+		return nil, nil, nil, err
+	}
+
+	line, err = scanPayoutLine(tx.QueryRow(
+		ctx,
+		`UPDATE payout_lines SET status = $1, error = $2, transfer_id = $3, fee_transfer_id = $4, processed_at = CURRENT_TIMESTAMP
+		WHERE id = $5 RETURNING `+payoutLineColumns,
+		line.Status,
+		line.Error,
+		line.TransferID,
+		line.FeeTransferID,
+		line.ID,
+	))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	succeeded := line.Status == PayoutLineSucceeded
+	batch, err = scanPayoutBatch(tx.QueryRow(
+		ctx,
+		`UPDATE payout_batches SET
+			succeeded_count = succeeded_count + CASE WHEN $1 THEN 1 ELSE 0 END,
+			succeeded_amount = succeeded_amount + CASE WHEN $1 THEN $2 ELSE 0 END,
+			succeeded_fee = succeeded_fee + CASE WHEN $1 THEN $3 ELSE 0 END,
+			failed_count = failed_count + CASE WHEN $1 THEN 0 ELSE 1 END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4 RETURNING `+payoutBatchColumns,
+		succeeded,
+		line.Amount,
+		line.Fee,
+		batch.ID,
+	))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// The batch is finished once no line is queued
+	var finished *PayoutBatch
+	var pending bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM payout_lines WHERE batch_id = $1 AND status = 'PENDING')`, batch.ID).Scan(&pending)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !pending {
+		status := PayoutBatchPartial
+		switch batch.SucceededCount {
+		case batch.ValidCount:
+			status = PayoutBatchCompleted
+		case 0:
+			status = PayoutBatchFailed
+		}
+		finished, err = scanPayoutBatch(tx.QueryRow(
+			ctx,
+			`UPDATE payout_batches SET status = $1, completed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2 RETURNING `+payoutBatchColumns,
+			status,
+			batch.ID,
+		))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, nil, err
+	}
+	return line, transfers, finished, nil
+}
+
+// GetPayoutBatch returns a batch of the user with its lines and the balance of its wallet
+func GetPayoutBatch(batchID, userID uuid.UUID) (*PayoutBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	batch, err := scanPayoutBatch(DB.QueryRow(
+		ctx,
+		`SELECT `+payoutBatchColumns+` FROM payout_batches WHERE id = $1 AND user_id = $2`,
+		batchID,
+		userID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	err = DB.QueryRow(ctx, `SELECT balance FROM wallets WHERE id = $1`, batch.WalletID).Scan(&batch.AvailableBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+payoutLineColumns+` FROM payout_lines WHERE batch_id = $1 ORDER BY line`,
+		batch.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batch.Lines = make([]PayoutLine, 0, batch.LineCount)
+	for rows.Next() {
+		line, err := scanPayoutLine(rows)
+		if err != nil {
+			return nil, err
+		}
+		batch.Lines = append(batch.Lines, *line)
+	}
+	return batch, rows.Err()
+}
+
+// GetPayoutBatches lists the batches of a user without their lines, newest first
+func GetPayoutBatches(userID uuid.UUID, limit int) ([]PayoutBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+payoutBatchColumns+` FROM payout_batches WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2`,
+		userID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := make([]PayoutBatch, 0)
+	for rows.Next() {
+		batch, err := scanPayoutBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, *batch)
+	}
+	return batches, nil
+}
+
+// RenderPayoutResult renders the outcome of every line of a batch as CSV
+func RenderPayoutResult(batch *PayoutBatch) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{"line", "user_id", "amount", "fee", "currency", "reference", "status", "error", "transfer_id"}); err != nil {
+		return nil, err
+	}
+	for _, l := range batch.Lines {
+		recipient, transfer := "", ""
+		if l.RecipientID != nil {
+			recipient = l.RecipientID.String()
+		}
+		if l.TransferID != nil {
+			transfer = l.TransferID.String()
+		}
+		record := []string{
+			strconv.Itoa(l.Line),
+			recipient,
+			strconv.FormatInt(l.Amount, 10),
+			strconv.FormatInt(l.Fee, 10),
+			batch.Currency,
+			l.Reference,
+			l.Status,
+			l.Error,
+			transfer,
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,349 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"time"
+)
+
+// Pocket activities recorded in wallet_logs, the balances are the main balance
+const (
+	ActivityPocketIn  = "POCKET_IN"  // main balance to pocket
+	ActivityPocketOut = "POCKET_OUT" // pocket to main balance
+)
+
+// Pocket transfer directions
+const (
+	PocketToPocket = "TO_POCKET"
+	PocketToMain   = "TO_MAIN"
+)
+
+// ErrWalletLocked is returned when a locked wallet is moved
+var ErrWalletLocked = errors.New("wallet is locked")
+
+// ErrPocketExists is returned when an open pocket of the wallet already has the name
+var ErrPocketExists = errors.New("pocket name already used")
+
+// pocketNameError maps the unique violation of the pocket names to ErrPocketExists
+func pocketNameError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrPocketExists
+	}
+	return err
+}
+
+// Pocket is the struct for a savings pocket under a wallet
+type Pocket struct {
+	ID         uuid.UUID  `json:"id" db:"id,omitempty"`
+	WalletID   uuid.UUID  `json:"wallet_id" db:"wallet_id"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Balance    int64      `json:"balance" db:"balance"`
+	GoalAmount *int64     `json:"goal_amount,omitempty" db:"goal_amount"`
+	TargetDate *time.Time `json:"target_date,omitempty" db:"target_date"`
+	IsActive   bool       `json:"is_active" db:"is_active"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// PocketRequest is the struct for creating or updating a pocket
+type PocketRequest struct {
+	UserID     uuid.UUID `json:"user_id" binding:"required"`
+	WalletID   uuid.UUID `json:"wallet_id" binding:"required"`
+	PocketID   uuid.UUID `json:"pocket_id"` // set on update
+	Name       string    `json:"name" binding:"required,max=50"`
+	GoalAmount *int64    `json:"goal_amount" binding:"omitempty,gt=0"`
+	TargetDate string    `json:"target_date" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// PocketTransferRequest is the struct for a move between the main balance and a pocket
+type PocketTransferRequest struct {
+	UserID    uuid.UUID `json:"user_id" binding:"required"`
+	PocketID  uuid.UUID `json:"pocket_id" binding:"required"`
+	Amount    int64     `json:"amount" binding:"required,gt=0"`
+	Direction string    `json:"direction" binding:"required,oneof=TO_POCKET TO_MAIN"`
+}
+
+// PocketCloseRequest is the struct for closing a pocket
+type PocketCloseRequest struct {
+	UserID   uuid.UUID `json:"user_id" binding:"required"`
+	PocketID uuid.UUID `json:"pocket_id" binding:"required"`
+}
+
+// PocketTransfer is the result of a move, with both balances after it
+type PocketTransfer struct {
+	Pocket      *Pocket `json:"pocket"`
+	MainBalance int64   `json:"main_balance"`
+	Currency    string  `json:"currency"`
+}
+
+// pocketColumns is the column list scanned by scanPocket
+const pocketColumns = `id, wallet_id, user_id, name, balance, goal_amount, target_date, is_active, created_at, updated_at`
+
+// scanPocket scans a pocket row
+func scanPocket(row pgx.Row) (*Pocket, error) {
+	p := &Pocket{}
+	err := row.Scan(
+		&p.ID,
+		&p.WalletID,
+		&p.UserID,
+		&p.Name,
+		&p.Balance,
+		&p.GoalAmount,
+		&p.TargetDate,
+		&p.IsActive,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// targetDate parses the optional target date of a request
+func (r *PocketRequest) targetDate() *time.Time {
+	if r.TargetDate == "" {
+		return nil
+	}
+	date, err := time.Parse(time.DateOnly, r.TargetDate)
+	if err != nil {
+		return nil
+	}
+	return &date
+}
+
+// CreatePocket creates an empty pocket under a wallet of the user
+func (r *PocketRequest) CreatePocket() (*Pocket, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	pocket, err := scanPocket(DB.QueryRow(
+		ctx,
+		`INSERT INTO pockets (wallet_id, user_id, name, goal_amount, target_date)
+		SELECT id, user_id, $3, $4, $5 FROM wallets WHERE id = $1 AND user_id = $2 AND is_active = true
+		RETURNING `+pocketColumns,
+		r.WalletID,
+		r.UserID,
+		r.Name,
+		r.GoalAmount,
+		r.targetDate(),
+	))
+	if err != nil {
+		return nil, pocketNameError(err)
+	}
+	return pocket, nil
+}
+
+// UpdatePocket renames a pocket or changes its goal
+func (r *PocketRequest) UpdatePocket() (*Pocket, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	pocket, err := scanPocket(DB.QueryRow(
+		ctx,
+		`UPDATE pockets SET name = $1, goal_amount = $2, target_date = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND wallet_id = $5 AND user_id = $6 AND is_active = true RETURNING `+pocketColumns,
+		r.Name,
+		r.GoalAmount,
+		r.targetDate(),
+		r.PocketID,
+		r.WalletID,
+		r.UserID,
+	))
+	if err != nil {
+		return nil, pocketNameError(err)
+	}
+	return pocket, nil
+}
+
+// GetPockets lists the open pockets of a wallet
+func GetPockets(walletID uuid.UUID) ([]Pocket, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+pocketColumns+` FROM pockets WHERE wallet_id = $1 AND is_active = true ORDER BY created_at`,
+		walletID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pockets := make([]Pocket, 0)
+	for rows.Next() {
+		p, err := scanPocket(rows)
+		if err != nil {
+			return nil, err
+		}
+		pockets = append(pockets, *p)
+	}
+	return pockets, nil
+}
+
+// TransferPocket moves money between the main balance and a pocket in one transaction
+func (r *PocketTransferRequest) TransferPocket() (*PocketTransfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	transfer, err := movePocket(ctx, tx, r.UserID, r.PocketID, r.Amount, r.Direction)
+	if err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// ClosePocket moves what is left in a pocket back to the main balance and closes it
+func (r *PocketCloseRequest) ClosePocket() (*PocketTransfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	// Lock the wallet before the pocket, in the same order as movePocket
+	var walletID uuid.UUID
+	err = tx.QueryRow(
+		ctx,
+		`SELECT wallet_id FROM pockets WHERE id = $1 AND user_id = $2 AND is_active = true`,
+		r.PocketID,
+		r.UserID,
+	).Scan(&walletID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `SELECT id FROM wallets WHERE id = $1 FOR UPDATE`, walletID); err != nil {
+		return nil, err
+	}
+	pocket, err := scanPocket(tx.QueryRow(
+		ctx,
+		`SELECT `+pocketColumns+` FROM pockets WHERE id = $1 AND is_active = true FOR UPDATE`,
+		r.PocketID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	transfer := &PocketTransfer{Pocket: pocket}
+	if pocket.Balance > 0 {
+		transfer, err = movePocket(ctx, tx, r.UserID, r.PocketID, pocket.Balance, PocketToMain)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE pockets SET is_active = false, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, r.PocketID); err != nil {
+		return nil, err
+	}
+	transfer.Pocket.IsActive = false
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// movePocket moves an amount between the main balance and a pocket inside an existing transaction.
+// The wallet row is locked first, like every other balance change.
+func movePocket(ctx context.Context, tx pgx.Tx, userID, pocketID uuid.UUID, amount int64, direction string) (*PocketTransfer, error) {
+	var walletID uuid.UUID
+	err := tx.QueryRow(
+		ctx,
+		`SELECT wallet_id FROM pockets WHERE id = $1 AND user_id = $2 AND is_active = true`,
+		pocketID,
+		userID,
+	).Scan(&walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	var balance int64
+	var currency string
+	var locked bool
+	err = tx.QueryRow(
+		ctx,
+		`SELECT balance, currency, locked FROM wallets WHERE id = $1 AND is_active = true FOR UPDATE`,
+		walletID,
+	).Scan(&balance, &currency, &locked)
+	if err != nil {
+		return nil, err
+	}
+	if locked {
+		return nil, ErrWalletLocked
+	}
+
+	pocket, err := scanPocket(tx.QueryRow(
+		ctx,
+		`SELECT `+pocketColumns+` FROM pockets WHERE id = $1 FOR UPDATE`,
+		pocketID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	delta, activity := -amount, ActivityPocketIn
+	if direction == PocketToMain {
+		delta, activity = amount, ActivityPocketOut
+	}
+	if balance+delta < 0 || pocket.Balance-delta < 0 {
+		return nil, ErrInsufficientFunds
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE wallets SET balance = balance + $1 WHERE id = $2`, delta, walletID); err != nil {
+		return nil, err
+	}
+	pocket, err = scanPocket(tx.QueryRow(
+		ctx,
+		`UPDATE pockets SET balance = balance - $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 RETURNING `+pocketColumns,
+		delta,
+		pocketID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := json.Marshal(map[string]string{"source": "pocket", "pocket_id": pocketID.String(), "pocket": pocket.Name})
+	if err != nil {
+		return nil, err
+	}
+	walletLog := WalletLog{
+		UserID:         userID,
+		WalletID:       walletID,
+		Activity:       activity,
+		OldBalance:     balance,
+		NewBalance:     balance + delta,
+		ActivityAmount: amount,
+		Currency:       currency,
+		Metadata:       string(metadata),
+	}
+	if err := walletLog.insert(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	return &PocketTransfer{Pocket: pocket, MainBalance: balance + delta, Currency: currency}, nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+// ProviderCallback is the struct for a verified provider callback
+type ProviderCallback struct {
+	ID            uuid.UUID  `json:"id" db:"id,omitempty"`
+	Provider      string     `json:"provider" db:"provider"`
+	Signature     string     `json:"signature" db:"signature"`
+	Payload       string     `json:"payload" db:"payload"`
+	TransactionID *uuid.UUID `json:"transaction_id,omitempty" db:"transaction_id"`
+	Status        string     `json:"status" db:"status"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at,omitempty"`
+}
+
+// CallbackProcessed checks if a callback with the same signature was already processed
+func (pc *ProviderCallback) CallbackProcessed() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := DB.QueryRow(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM provider_callbacks WHERE provider = $1 AND signature = $2)`,
+		pc.Provider,
+		pc.Signature,
+	).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// CreateProviderCallback records a processed callback, duplicates are ignored
+func (pc *ProviderCallback) CreateProviderCallback() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err := DB.Exec(
+		ctx,
+		`INSERT INTO provider_callbacks (provider, signature, payload, transaction_id, status) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (provider, signature) DO NOTHING`,
+		pc.Provider,
+		pc.Signature,
+		pc.Payload,
+		pc.TransactionID,
+		pc.Status,
+	)
+	return err
+}
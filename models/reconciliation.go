@@ -0,0 +1,200 @@
+package models
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+// ReconciliationRun is the struct for a run of the ledger reconciliation
+type ReconciliationRun struct {
+	ID             uuid.UUID           `json:"id" db:"id,omitempty"`
+	WalletID       *uuid.UUID          `json:"wallet_id,omitempty" db:"wallet_id"` // set for a single wallet run
+	WalletsChecked int64               `json:"wallets_checked" db:"wallets_checked"`
+	Discrepancies  []WalletDiscrepancy `json:"discrepancies" db:"-"`
+	StartedAt      time.Time           `json:"started_at" db:"started_at"`
+	FinishedAt     time.Time           `json:"finished_at" db:"finished_at"`
+}
+
+// WalletDiscrepancy is a wallet whose stored balances do not match its history
+type WalletDiscrepancy struct {
+	ID              uuid.UUID  `json:"id" db:"id,omitempty"`
+	RunID           uuid.UUID  `json:"run_id" db:"run_id"`
+	WalletID        uuid.UUID  `json:"wallet_id" db:"wallet_id"`
+	UserID          uuid.UUID  `json:"user_id" db:"user_id"`
+	StoredBalance   int64      `json:"stored_balance" db:"stored_balance"`
+	ExpectedBalance int64      `json:"expected_balance" db:"expected_balance"` // sum of the log deltas
+	StoredHeld      int64      `json:"stored_held" db:"stored_held"`
+	ExpectedHeld    int64      `json:"expected_held" db:"expected_held"` // sum of the in-flight withdrawals
+	LogCount        int64      `json:"log_count" db:"log_count"`
+	LastLogAt       *time.Time `json:"last_log_at,omitempty" db:"last_log_at"`
+	Currency        string     `json:"currency" db:"currency"`
+	DetectedAt      time.Time  `json:"detected_at" db:"detected_at,omitempty"`
+}
+
+// reconcileQuery recomputes the balances of the wallets from their history, $1 limits it to a wallet
+const reconcileQuery = `SELECT w.id, w.user_id, w.balance, COALESCE(l.expected, 0), w.held_balance, COALESCE(t.held, 0),
+	COALESCE(l.log_count, 0), l.last_log_at, w.currency
+	FROM wallets w
+	LEFT JOIN (
+		SELECT wallet_id, SUM(new_balance - old_balance) AS expected, COUNT(*) AS log_count, MAX(created_at) AS last_log_at
+		FROM wallet_logs WHERE $1::uuid IS NULL OR wallet_id = $1 GROUP BY wallet_id
+	) l ON l.wallet_id = w.id
+	LEFT JOIN (
+		SELECT wallet_id, SUM(amount) AS held FROM transactions
+		WHERE type = 'WITHDRAWAL' AND status IN ('PENDING', 'PROCESSING') AND ($1::uuid IS NULL OR wallet_id = $1)
+		GROUP BY wallet_id
+	) t ON t.wallet_id = w.id
+	WHERE $1::uuid IS NULL OR w.id = $1`
+
+// CheckWalletBalances compares the stored balances with the history, in a single consistent snapshot.
+// It returns the number of wallets checked and the mismatches, nothing is recorded.
+func CheckWalletBalances(walletID uuid.UUID) (int64, []WalletDiscrepancy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	rows, err := DB.Query(ctx, reconcileQuery, uuidOrNil(walletID))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	var checked int64
+	discrepancies := make([]WalletDiscrepancy, 0)
+	for rows.Next() {
+		d := WalletDiscrepancy{}
+		err := rows.Scan(
+			&d.WalletID,
+			&d.UserID,
+			&d.StoredBalance,
+			&d.ExpectedBalance,
+			&d.StoredHeld,
+			&d.ExpectedHeld,
+			&d.LogCount,
+			&d.LastLogAt,
+			&d.Currency,
+		)
+		if err != nil {
+			return 0, nil, err
+		}
+		checked++
+		if d.StoredBalance != d.ExpectedBalance || d.StoredHeld != d.ExpectedHeld {
+			discrepancies = append(discrepancies, d)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	return checked, discrepancies, nil
+}
+
+// CreateReconciliationRun records a run and its discrepancies
+func (r *ReconciliationRun) CreateReconciliationRun() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO reconciliation_runs (wallet_id, wallets_checked, discrepancy_count, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		r.WalletID,
+		r.WalletsChecked,
+		len(r.Discrepancies),
+		r.StartedAt,
+		r.FinishedAt,
+	).Scan(&r.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := range r.Discrepancies {
+		d := &r.Discrepancies[i]
+		d.RunID = r.ID
+		err := tx.QueryRow(
+			ctx,
+			`INSERT INTO wallet_discrepancies (run_id, wallet_id, user_id, stored_balance, expected_balance, stored_held, expected_held, log_count, last_log_at, currency)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, detected_at`,
+			d.RunID,
+			d.WalletID,
+			d.UserID,
+			d.StoredBalance,
+			d.ExpectedBalance,
+			d.StoredHeld,
+			d.ExpectedHeld,
+			d.LogCount,
+			d.LastLogAt,
+			d.Currency,
+		).Scan(&d.ID, &d.DetectedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// FullReconciliationSince checks if a run over every wallet started after a time
+func FullReconciliationSince(since time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := DB.QueryRow(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM reconciliation_runs WHERE wallet_id IS NULL AND started_at >= $1)`,
+		since,
+	).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// GetWalletDiscrepancies lists the latest discrepancies, optionally of a single wallet
+func GetWalletDiscrepancies(walletID uuid.UUID, limit int) ([]WalletDiscrepancy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT id, run_id, wallet_id, user_id, stored_balance, expected_balance, stored_held, expected_held, log_count, last_log_at, currency, detected_at
+		FROM wallet_discrepancies WHERE $1::uuid IS NULL OR wallet_id = $1 ORDER BY detected_at DESC LIMIT $2`,
+		uuidOrNil(walletID),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	discrepancies := make([]WalletDiscrepancy, 0)
+	for rows.Next() {
+		d := WalletDiscrepancy{}
+		err := rows.Scan(
+			&d.ID,
+			&d.RunID,
+			&d.WalletID,
+			&d.UserID,
+			&d.StoredBalance,
+			&d.ExpectedBalance,
+			&d.StoredHeld,
+			&d.ExpectedHeld,
+			&d.LogCount,
+			&d.LastLogAt,
+			&d.Currency,
+			&d.DetectedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	return discrepancies, nil
+}
@@ -0,0 +1,458 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"github.com/google/uuid"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report formats
+const (
+	ReportFormatCSV = "csv"
+	ReportFormatXML = "xml"
+)
+
+// Report rules
+const (
+	RuleSingleThreshold    = "SINGLE_THRESHOLD"
+	RuleAggregateThreshold = "AGGREGATE_THRESHOLD"
+	RuleStructuring        = "STRUCTURING"
+)
+
+// Report directions
+const (
+	DirectionCashIn      = "CASH_IN"
+	DirectionCashOut     = "CASH_OUT"
+	DirectionTransferIn  = "TRANSFER_IN"
+	DirectionTransferOut = "TRANSFER_OUT"
+)
+
+// reportedActivities lists the wallet activities scanned for reporting. Holds and releases, pockets,
+// reversals, escrow and dispute moves are not scanned: they only adjust operations already reported.
+var reportedActivities = []string{ActivityTopup, ActivityWithdrawal, ActivityTransferIn, ActivityTransferOut}
+
+// reportDirection returns the reporting direction of a wallet log, or "" when it is not reported.
+// Top-ups and withdrawals, from a provider or NATS, are cash. So is the customer side of an agent
+// cash-in or cash-out, the agent side and the float moves being internal to the agent network.
+func reportDirection(activity, source string) string {
+	switch {
+	case activity == ActivityTopup:
+		return DirectionCashIn
+	case activity == ActivityWithdrawal:
+		return DirectionCashOut
+	case source == TransferSourceAgentFloat:
+		return ""
+	case activity == ActivityTransferIn && source == TransferSourceAgentCashIn:
+		return DirectionCashIn
+	case activity == ActivityTransferOut && source == TransferSourceAgentCashOut:
+		return DirectionCashOut
+	case source == TransferSourceAgentCashIn, source == TransferSourceAgentCashOut:
+		return ""
+	case activity == ActivityTransferIn:
+		return DirectionTransferIn
+	case activity == ActivityTransferOut:
+		return DirectionTransferOut
+	}
+	return ""
+}
+
+// ReportConfig holds the thresholds used to flag wallet activity
+type ReportConfig struct {
+	ThresholdAmount     int64
+	StructuringRatio    float64
+	StructuringMinCount int
+}
+
+// DefaultReportConfig returns the reporting configuration from the environment
+func DefaultReportConfig() ReportConfig {
+	config := ReportConfig{
+		ThresholdAmount:     5000000,
+		StructuringRatio:    0.8,
+		StructuringMinCount: 3,
+	}
+	if v, err := strconv.ParseInt(os.Getenv("REPORT_THRESHOLD_AMOUNT"), 10, 64); err == nil && v > 0 {
+		config.ThresholdAmount = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("REPORT_STRUCTURING_RATIO"), 64); err == nil && v > 0 && v < 1 {
+		config.StructuringRatio = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("REPORT_STRUCTURING_MIN_COUNT")); err == nil && v > 1 {
+		config.StructuringMinCount = v
+	}
+	return config
+}
+
+// ComplianceReport is the struct for a generated regulator report
+type ComplianceReport struct {
+	ID          uuid.UUID `json:"id" db:"id,omitempty"`
+	PeriodStart time.Time `json:"period_start" db:"period_start"`
+	PeriodEnd   time.Time `json:"period_end" db:"period_end"`
+	Format      string    `json:"format" db:"format"`
+	Checksum    string    `json:"checksum" db:"checksum"`
+	FlagCount   int       `json:"flag_count" db:"flag_count"`
+	Content     []byte    `json:"-" db:"content"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
+// ComplianceFlag is a single threshold breach or suspicious pattern
+type ComplianceFlag struct {
+	Day         string    `json:"day" xml:"Day"`
+	Rule        string    `json:"rule" xml:"Rule"`
+	Direction   string    `json:"direction" xml:"Direction"`
+	UserID      uuid.UUID `json:"user_id" xml:"UserID"`
+	WalletID    uuid.UUID `json:"wallet_id" xml:"WalletID"`
+	TotalAmount int64     `json:"total_amount" xml:"TotalAmount"`
+	TxCount     int       `json:"tx_count" xml:"TransactionCount"`
+	Currency    string    `json:"currency" xml:"Currency"`
+	LogIDs      string    `json:"log_ids" xml:"LogIDs"`
+}
+
+// complianceXML is the XML document layout of a report
+type complianceXML struct {
+	XMLName     xml.Name         `xml:"ComplianceReport"`
+	PeriodStart string           `xml:"PeriodStart,attr"`
+	PeriodEnd   string           `xml:"PeriodEnd,attr"`
+	Threshold   int64            `xml:"Threshold,attr"`
+	Flags       []ComplianceFlag `xml:"Flags>Flag"`
+}
+
+// ReportRequest is the struct for a report generation request
+type ReportRequest struct {
+	From   string `json:"from" binding:"required,datetime=2006-01-02"`
+	To     string `json:"to" binding:"required,datetime=2006-01-02"`
+	Format string `json:"format" binding:"required,oneof=csv xml"`
+}
+
+// cashActivity is a wallet log row relevant to reporting
+type cashActivity struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	WalletID  uuid.UUID
+	Activity  string
+	Source    string
+	Amount    int64
+	Currency  string
+	CreatedAt time.Time
+}
+
+// flagKey groups activity per wallet, day and direction
+type flagKey struct {
+	WalletID  uuid.UUID
+	Day       string
+	Direction string
+}
+
+// DetectComplianceFlags scans wallet_logs between from and to and returns the flags
+func DetectComplianceFlags(from, to time.Time, config ReportConfig) ([]ComplianceFlag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT id, user_id, wallet_id, activity, COALESCE(metadata->>'source', ''), activity_amount, currency, created_at
+		FROM wallet_logs WHERE activity = ANY($1) AND created_at >= $2 AND created_at < $3
+		ORDER BY wallet_id, created_at, id`,
+		reportedActivities,
+		from,
+		to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make(map[flagKey][]cashActivity)
+	for rows.Next() {
+		a := cashActivity{}
+		if err := rows.Scan(&a.ID, &a.UserID, &a.WalletID, &a.Activity, &a.Source, &a.Amount, &a.Currency, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		direction := reportDirection(a.Activity, a.Source)
+		if direction == "" {
+			continue
+		}
+		key := flagKey{
+			WalletID:  a.WalletID,
+			Day:       a.CreatedAt.UTC().Format(time.DateOnly),
+			Direction: direction,
+		}
+		groups[key] = append(groups[key], a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	flags := make([]ComplianceFlag, 0)
+	nearThreshold := int64(float64(config.ThresholdAmount) * config.StructuringRatio)
+	for key, group := range groups {
+		var total int64
+		var ids, nearIDs []string
+		var nearTotal int64
+		for _, a := range group {
+			total += a.Amount
+			ids = append(ids, a.ID.String())
+
+			// Single operation above the threshold
+			if a.Amount >= config.ThresholdAmount {
+				flags = append(flags, newComplianceFlag(key, RuleSingleThreshold, a.Amount, 1, group[0], []string{a.ID.String()}))
+			}
+
+			// Operations kept just under the threshold
+			if a.Amount >= nearThreshold && a.Amount < config.ThresholdAmount {
+				nearTotal += a.Amount
+				nearIDs = append(nearIDs, a.ID.String())
+			}
+		}
+
+		// Several operations adding up above the threshold
+		if len(group) > 1 && total >= config.ThresholdAmount {
+			flags = append(flags, newComplianceFlag(key, RuleAggregateThreshold, total, len(group), group[0], ids))
+		}
+		if len(nearIDs) >= config.StructuringMinCount {
+			flags = append(flags, newComplianceFlag(key, RuleStructuring, nearTotal, len(nearIDs), group[0], nearIDs))
+		}
+	}
+
+	// Sort flags so the same data always produces the same report
+	sort.Slice(flags, func(i, j int) bool {
+		a, b := flags[i], flags[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.WalletID != b.WalletID {
+			return a.WalletID.String() < b.WalletID.String()
+		}
+		if a.Direction != b.Direction {
+			return a.Direction < b.Direction
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.LogIDs < b.LogIDs
+	})
+	return flags, nil
+}
+
+// newComplianceFlag builds a flag for a wallet group
+func newComplianceFlag(key flagKey, rule string, amount int64, count int, first cashActivity, ids []string) ComplianceFlag {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	return ComplianceFlag{
+		Day:         key.Day,
+		Rule:        rule,
+		Direction:   key.Direction,
+		UserID:      first.UserID,
+		WalletID:    key.WalletID,
+		TotalAmount: amount,
+		TxCount:     count,
+		Currency:    first.Currency,
+		LogIDs:      strings.Join(sorted, ";"),
+	}
+}
+
+// RenderComplianceReport renders the flags in the requested format
+func RenderComplianceReport(from, to time.Time, format string, threshold int64, flags []ComplianceFlag) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case ReportFormatCSV:
+		w := csv.NewWriter(&buf)
+		header := []string{"day", "rule", "direction", "user_id", "wallet_id", "total_amount", "tx_count", "currency", "log_ids"}
+		if err := w.Write(header); err != nil {
+			return nil, err
+		}
+		for _, f := range flags {
+			record := []string{
+				f.Day,
+				f.Rule,
+				f.Direction,
+				f.UserID.String(),
+				f.WalletID.String(),
+				strconv.FormatInt(f.TotalAmount, 10),
+				strconv.Itoa(f.TxCount),
+				f.Currency,
+				f.LogIDs,
+			}
+			if err := w.Write(record); err != nil {
+				return nil, err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+	case ReportFormatXML:
+		doc := complianceXML{
+			PeriodStart: from.UTC().Format(time.DateOnly),
+			PeriodEnd:   to.UTC().Format(time.DateOnly),
+			Threshold:   threshold,
+			Flags:       flags,
+		}
+		buf.WriteString(xml.Header)
+		enc := xml.NewEncoder(&buf)
+		enc.Indent("", "  ")
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported report format: %s", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// GenerateComplianceReport detects flags for the period and stores the report file
+func GenerateComplianceReport(from, to time.Time, format string, config ReportConfig) (*ComplianceReport, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("invalid report period")
+	}
+
+	flags, err := DetectComplianceFlags(from, to, config)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := RenderComplianceReport(from, to, format, config.ThresholdAmount, flags)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+
+	report := &ComplianceReport{
+		PeriodStart: from,
+		PeriodEnd:   to,
+		Format:      format,
+		Checksum:    hex.EncodeToString(sum[:]),
+		FlagCount:   len(flags),
+		Content:     content,
+	}
+	if err := report.save(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// save stores the report, replacing a previous run for the same period and format
+func (r *ComplianceReport) save() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO compliance_reports (period_start, period_end, format, checksum, flag_count, content)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (period_start, period_end, format) DO UPDATE
+		SET checksum = EXCLUDED.checksum, flag_count = EXCLUDED.flag_count, content = EXCLUDED.content, created_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at`,
+		r.PeriodStart,
+		r.PeriodEnd,
+		r.Format,
+		r.Checksum,
+		r.FlagCount,
+		r.Content,
+	).Scan(&r.ID, &r.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetComplianceReports lists generated reports without their content
+func GetComplianceReports() ([]ComplianceReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT id, period_start, period_end, format, checksum, flag_count, created_at FROM compliance_reports ORDER BY period_start DESC, format`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]ComplianceReport, 0)
+	for rows.Next() {
+		report := ComplianceReport{}
+		err := rows.Scan(
+			&report.ID,
+			&report.PeriodStart,
+			&report.PeriodEnd,
+			&report.Format,
+			&report.Checksum,
+			&report.FlagCount,
+			&report.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// GetComplianceReport gets a report with its content
+func (r *ComplianceReport) GetComplianceReport() (*ComplianceReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	report := &ComplianceReport{}
+	err := DB.QueryRow(
+		ctx,
+		`SELECT id, period_start, period_end, format, checksum, flag_count, content, created_at FROM compliance_reports WHERE id = $1`,
+		r.ID,
+	).Scan(
+		&report.ID,
+		&report.PeriodStart,
+		&report.PeriodEnd,
+		&report.Format,
+		&report.Checksum,
+		&report.FlagCount,
+		&report.Content,
+		&report.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ComplianceReportExists checks if a report was already generated for the period
+func ComplianceReportExists(from, to time.Time, format string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := DB.QueryRow(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM compliance_reports WHERE period_start = $1 AND period_end = $2 AND format = $3)`,
+		from,
+		to,
+		format,
+	).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
@@ -0,0 +1,33 @@
+package models
+
+import "testing"
+
+func TestReportDirection(t *testing.T) {
+	tests := []struct {
+		name     string
+		activity string
+		source   string
+		want     string
+	}{
+		{"provider deposit", ActivityTopup, "deposit", DirectionCashIn},
+		{"nats deposit", ActivityTopup, "nats_deposit", DirectionCashIn},
+		{"provider withdrawal", ActivityWithdrawal, "withdrawal", DirectionCashOut},
+		{"nats withdrawal", ActivityWithdrawal, "nats_withdraw", DirectionCashOut},
+		{"agent cash-in customer", ActivityTransferIn, TransferSourceAgentCashIn, DirectionCashIn},
+		{"agent cash-in agent", ActivityTransferOut, TransferSourceAgentCashIn, ""},
+		{"agent cash-out customer", ActivityTransferOut, TransferSourceAgentCashOut, DirectionCashOut},
+		{"agent cash-out agent", ActivityTransferIn, TransferSourceAgentCashOut, ""},
+		{"agent float", ActivityTransferIn, TransferSourceAgentFloat, ""},
+		{"p2p sent", ActivityTransferOut, "", DirectionTransferOut},
+		{"merchant received", ActivityTransferIn, TransferSourceMerchant, DirectionTransferIn},
+		{"withdrawal hold", ActivityWithdrawalHold, "withdrawal", ""},
+		{"reversal", ActivityReversal, "reversal", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reportDirection(tt.activity, tt.source); got != tt.want {
+				t.Errorf("reportDirection(%q, %q) = %q, want %q", tt.activity, tt.source, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Reversal errors
+var (
+	ErrNotReversible           = errors.New("activity cannot be reversed")
+	ErrReversalExceedsOriginal = errors.New("reversal exceeds the remaining original amount")
+	ErrIdempotencyConflict     = errors.New("idempotency key already used for another operation")
+	ErrWalletInactive          = errors.New("wallet is disabled")
+)
+
+// reversibleActivities lists the activities that can be refunded and the
+// balance direction of their reversal (+1 credit, -1 debit)
+var reversibleActivities = map[string]int64{
+	ActivityTopup:      -1,
+	ActivityWithdrawal: 1,
+}
+
+// Reversal is the struct for a reversal of a wallet log
+type Reversal struct {
+	ID             uuid.UUID `json:"id" db:"id,omitempty"`
+	OriginalLogID  uuid.UUID `json:"original_log_id" db:"original_log_id"`
+	ReversalLogID  uuid.UUID `json:"reversal_log_id" db:"reversal_log_id"`
+	WalletID       uuid.UUID `json:"wallet_id" db:"wallet_id"`
+	UserID         uuid.UUID `json:"user_id" db:"-"`
+	Amount         int64     `json:"amount" db:"amount"`
+	Reason         string    `json:"reason" db:"reason"`
+	IdempotencyKey string    `json:"idempotency_key" db:"idempotency_key"`
+	RequestedBy    string    `json:"requested_by" db:"requested_by"`
+	OldBalance     int64     `json:"old_balance" db:"-"`
+	NewBalance     int64     `json:"new_balance" db:"-"`
+	Currency       string    `json:"currency" db:"-"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
+// ReversalRequest is the struct for a reversal request.
+// A zero amount reverses the whole remaining original amount.
+type ReversalRequest struct {
+	LogID          uuid.UUID `json:"log_id" binding:"required"`
+	Amount         int64     `json:"amount" binding:"omitempty,gt=0"`
+	Reason         string    `json:"reason" binding:"required,max=255"`
+	IdempotencyKey string    `json:"idempotency_key" binding:"required,max=100"`
+	forced         bool      // debits ignore the wallet lock, for a reversal reported by the provider
+}
+
+// ReverseWalletLog refunds all or part of a wallet log and links both rows.
+// A disabled wallet is never reversed and a locked one is not debited. The transaction
+// that settled the log is marked REVERSED once its whole amount is refunded.
+// Calling it again with the same idempotency key returns the first reversal.
+func (r *ReversalRequest) ReverseWalletLog(requestedBy string) (*Reversal, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	reversal, err := r.reverse(ctx, tx, requestedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// reverse applies the reversal inside an existing transaction
+func (r *ReversalRequest) reverse(ctx context.Context, tx pgx.Tx, requestedBy string) (*Reversal, error) {
+	// Lock the original log so concurrent reversals are serialized
+	var original WalletLog
+	err := tx.QueryRow(
+		ctx,
+		`SELECT id, user_id, wallet_id, activity, activity_amount, currency FROM wallet_logs WHERE id = $1 FOR UPDATE`,
+		r.LogID,
+	).Scan(
+		&original.ID,
+		&original.UserID,
+		&original.WalletID,
+		&original.Activity,
+		&original.ActivityAmount,
+		&original.Currency,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replay of a reversal already processed
+	existing, err := getReversalByKey(ctx, tx, r.IdempotencyKey)
+	if err == nil {
+		if existing.OriginalLogID != original.ID {
+			return nil, ErrIdempotencyConflict
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	direction, ok := reversibleActivities[original.Activity]
+	if !ok {
+		return nil, ErrNotReversible
+	}
+
+	// Never refund more than what is left of the original amount
+	var reversed int64
+	err = tx.QueryRow(
+		ctx,
+		`SELECT COALESCE(SUM(amount), 0) FROM wallet_reversals WHERE original_log_id = $1`,
+		original.ID,
+	).Scan(&reversed)
+	if err != nil {
+		return nil, err
+	}
+	remaining := original.ActivityAmount - reversed
+	amount := r.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount <= 0 || amount > remaining {
+		return nil, ErrReversalExceedsOriginal
+	}
+
+	// Apply the reversal on the wallet balance
+	var oldBalance, newBalance int64
+	var locked, active bool
+	err = tx.QueryRow(
+		ctx,
+		`SELECT balance, locked, is_active FROM wallets WHERE id = $1 FOR UPDATE`,
+		original.WalletID,
+	).Scan(&oldBalance, &locked, &active)
+	if err != nil {
+		return nil, err
+	}
+	newBalance = oldBalance + direction*amount
+	switch {
+	case !active:
+		return nil, ErrWalletInactive
+	case locked && direction < 0 && !r.forced:
+		return nil, ErrWalletLocked
+	case newBalance < 0:
+		return nil, ErrInsufficientFunds
+	}
+	_, err = tx.Exec(ctx, `UPDATE wallets SET balance = $1 WHERE id = $2`, newBalance, original.WalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record the reversal log linked to the original log
+	metadata, _ := json.Marshal(map[string]any{
+		"source":            "reversal",
+		"reason":            r.Reason,
+		"original_activity": original.Activity,
+		"requested_by":      requestedBy,
+	})
+	reversalLog := WalletLog{
+		UserID:         original.UserID,
+		WalletID:       original.WalletID,
+		Activity:       ActivityReversal,
+		OldBalance:     oldBalance,
+		NewBalance:     newBalance,
+		ActivityAmount: amount,
+		Currency:       original.Currency,
+		Metadata:       string(metadata),
+		ReferenceID:    &original.ID,
+	}
+	if err := reversalLog.insert(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	reversal := &Reversal{
+		OriginalLogID:  original.ID,
+		ReversalLogID:  reversalLog.ID,
+		WalletID:       original.WalletID,
+		UserID:         original.UserID,
+		Amount:         amount,
+		Reason:         r.Reason,
+		IdempotencyKey: r.IdempotencyKey,
+		RequestedBy:    requestedBy,
+		OldBalance:     oldBalance,
+		NewBalance:     newBalance,
+		Currency:       original.Currency,
+	}
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO wallet_reversals (original_log_id, reversal_log_id, wallet_id, amount, reason, idempotency_key, requested_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`,
+		reversal.OriginalLogID,
+		reversal.ReversalLogID,
+		reversal.WalletID,
+		reversal.Amount,
+		reversal.Reason,
+		reversal.IdempotencyKey,
+		reversal.RequestedBy,
+	).Scan(&reversal.ID, &reversal.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if amount == remaining {
+		_, err = tx.Exec(
+			ctx,
+			`UPDATE transactions SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE log_id = $2 AND status = $3`,
+			TransactionReversed,
+			original.ID,
+			TransactionCompleted,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reversal, nil
+}
+
+// getReversalByKey gets a reversal by its idempotency key
+func getReversalByKey(ctx context.Context, tx pgx.Tx, key string) (*Reversal, error) {
+	reversal := &Reversal{}
+	err := tx.QueryRow(
+		ctx,
+		`SELECT r.id, r.original_log_id, r.reversal_log_id, r.wallet_id, r.amount, r.reason, r.idempotency_key, r.requested_by, l.user_id, l.old_balance, l.new_balance, l.currency, r.created_at
+		FROM wallet_reversals r JOIN wallet_logs l ON l.id = r.reversal_log_id WHERE r.idempotency_key = $1`,
+		key,
+	).Scan(
+		&reversal.ID,
+		&reversal.OriginalLogID,
+		&reversal.ReversalLogID,
+		&reversal.WalletID,
+		&reversal.Amount,
+		&reversal.Reason,
+		&reversal.IdempotencyKey,
+		&reversal.RequestedBy,
+		&reversal.UserID,
+		&reversal.OldBalance,
+		&reversal.NewBalance,
+		&reversal.Currency,
+		&reversal.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
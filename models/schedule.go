@@ -0,0 +1,159 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSchedule is returned for a schedule that cannot be parsed
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// scheduleMacros are the calendar shortcuts accepted in place of a cron expression
+var scheduleMacros = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+}
+
+// Schedule is a parsed cron expression: minute hour day-of-month month day-of-week.
+// Fields accept *, lists, ranges and steps, the day of month also accepts L for the last day.
+type Schedule struct {
+	minutes  [60]bool
+	hours    [24]bool
+	days     [32]bool
+	months   [13]bool
+	weekdays [7]bool
+	lastDay  bool
+	anyDay   bool // day of month is *
+	anyWeek  bool // day of week is *
+}
+
+// ParseSchedule parses a five field cron expression or a macro such as @monthly
+func ParseSchedule(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := scheduleMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q needs 5 fields", ErrInvalidSchedule, expr)
+	}
+
+	s := &Schedule{anyDay: fields[2] == "*", anyWeek: fields[4] == "*"}
+	if err := parseScheduleField(fields[0], 0, 59, s.minutes[:]); err != nil {
+		return nil, err
+	}
+	if err := parseScheduleField(fields[1], 0, 23, s.hours[:]); err != nil {
+		return nil, err
+	}
+	days := fields[2]
+	if strings.EqualFold(days, "L") {
+		s.lastDay = true
+	} else if err := parseScheduleField(days, 1, 31, s.days[:]); err != nil {
+		return nil, err
+	}
+	if err := parseScheduleField(fields[3], 1, 12, s.months[:]); err != nil {
+		return nil, err
+	}
+	weekdays := make([]bool, 8)
+	if err := parseScheduleField(fields[4], 0, 7, weekdays); err != nil {
+		return nil, err
+	}
+	copy(s.weekdays[:], weekdays)
+	s.weekdays[0] = s.weekdays[0] || weekdays[7] // 7 is also Sunday
+	return s, nil
+}
+
+// parseScheduleField sets the values of a cron field such as "1,15", "9-17" or "*/5"
+func parseScheduleField(field string, min, max int, values []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if before, after, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(after)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("%w: step %q", ErrInvalidSchedule, part)
+			}
+			rng, step = before, n
+		}
+
+		low, high := min, max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if low, err = strconv.Atoi(from); err != nil {
+				return fmt.Errorf("%w: value %q", ErrInvalidSchedule, part)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(to); err != nil {
+					return fmt.Errorf("%w: value %q", ErrInvalidSchedule, part)
+				}
+			} else if step > 1 {
+				high = max // "5/15" runs from 5 to the end of the range
+			}
+		}
+		if low < min || high > max || low > high {
+			return fmt.Errorf("%w: %q out of range %d-%d", ErrInvalidSchedule, part, min, max)
+		}
+		for v := low; v <= high; v += step {
+			values[v] = true
+		}
+	}
+	return nil
+}
+
+// matchDay checks the day of month, month and day of week of a date.
+// As in cron, a day matches either field when both are restricted.
+func (s *Schedule) matchDay(t time.Time) bool {
+	if !s.months[t.Month()] {
+		return false
+	}
+	day := s.days[t.Day()]
+	if s.lastDay {
+		day = t.AddDate(0, 0, 1).Day() == 1
+	}
+	week := s.weekdays[t.Weekday()]
+	switch {
+	case s.anyDay && s.anyWeek:
+		return true
+	case s.anyDay:
+		return week
+	case s.anyWeek:
+		return day
+	default:
+		return day || week
+	}
+}
+
+// Next returns the first occurrence strictly after a time, in the location of that time.
+// It returns the zero time when nothing matches within five years (e.g. 30 February).
+func (s *Schedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	start := after.Truncate(time.Minute).Add(time.Minute)
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+
+	for i := 0; i < 5*366; i++ {
+		if s.matchDay(day) {
+			for hour := 0; hour < 24; hour++ {
+				if !s.hours[hour] {
+					continue
+				}
+				for minute := 0; minute < 60; minute++ {
+					if !s.minutes[minute] {
+						continue
+					}
+					occurrence := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+					if !occurrence.Before(start) {
+						return occurrence
+					}
+				}
+			}
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseScheduleInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"empty", ""},
+		{"four fields", "* * * *"},
+		{"unknown macro", "@hourly"},
+		{"minute out of range", "60 * * * *"},
+		{"hour out of range", "* 24 * * *"},
+		{"day zero", "* * 0 * *"},
+		{"month out of range", "* * * 13 *"},
+		{"weekday out of range", "* * * * 8"},
+		{"zero step", "*/0 * * * *"},
+		{"reversed range", "5-1 * * * *"},
+		{"not a number", "a * * * *"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSchedule(tt.expr); !errors.Is(err, ErrInvalidSchedule) {
+				t.Errorf("ParseSchedule(%q) error = %v, want ErrInvalidSchedule", tt.expr, err)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	douala, err := time.LoadLocation("Africa/Douala")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	// A Thursday
+	thursday := time.Date(2026, time.January, 15, 10, 7, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{"daily", "@daily", thursday, time.Date(2026, time.January, 16, 0, 0, 0, 0, time.UTC)},
+		{"weekly", "@weekly", thursday, time.Date(2026, time.January, 18, 0, 0, 0, 0, time.UTC)},
+		{"monthly", "@monthly", thursday, time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"yearly", "@yearly", thursday, time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"macro in upper case", "@DAILY", thursday, time.Date(2026, time.January, 16, 0, 0, 0, 0, time.UTC)},
+		{"strictly after", "0 12 * * *", time.Date(2026, time.January, 15, 12, 0, 0, 0, time.UTC), time.Date(2026, time.January, 16, 12, 0, 0, 0, time.UTC)},
+		{"step", "*/15 * * * *", thursday, time.Date(2026, time.January, 15, 10, 15, 0, 0, time.UTC)},
+		{"step from a value", "5/15 * * * *", thursday, time.Date(2026, time.January, 15, 10, 20, 0, 0, time.UTC)},
+		{"step from a value wraps the hour", "5/15 * * * *", time.Date(2026, time.January, 15, 10, 50, 0, 0, time.UTC), time.Date(2026, time.January, 15, 11, 5, 0, 0, time.UTC)},
+		{"range", "0 9-17 * * *", thursday, time.Date(2026, time.January, 15, 11, 0, 0, 0, time.UTC)},
+		{"range wraps the day", "0 9-17 * * *", time.Date(2026, time.January, 15, 17, 30, 0, 0, time.UTC), time.Date(2026, time.January, 16, 9, 0, 0, 0, time.UTC)},
+		{"list", "0 8,12,18 * * *", thursday, time.Date(2026, time.January, 15, 12, 0, 0, 0, time.UTC)},
+		{"range with a step", "0 0 1-31/10 * *", thursday, time.Date(2026, time.January, 21, 0, 0, 0, 0, time.UTC)},
+		{"last day of a leap February", "0 0 L * *", time.Date(2024, time.February, 10, 0, 0, 0, 0, time.UTC), time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"last day of a February", "0 0 L * *", time.Date(2026, time.February, 10, 0, 0, 0, 0, time.UTC), time.Date(2026, time.February, 28, 0, 0, 0, 0, time.UTC)},
+		{"last day after February", "0 0 L * *", time.Date(2026, time.February, 28, 0, 0, 0, 0, time.UTC), time.Date(2026, time.March, 31, 0, 0, 0, 0, time.UTC)},
+		{"both day fields match the week", "0 0 13 * 5", thursday, time.Date(2026, time.January, 16, 0, 0, 0, 0, time.UTC)},
+		{"both day fields match the month", "0 0 17 * 1", thursday, time.Date(2026, time.January, 17, 0, 0, 0, 0, time.UTC)},
+		{"7 is Sunday", "0 0 * * 7", thursday, time.Date(2026, time.January, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 is Sunday", "0 0 * * 0", thursday, time.Date(2026, time.January, 18, 0, 0, 0, 0, time.UTC)},
+		{"month end in Douala", "0 0 1 * *", time.Date(2026, time.January, 31, 23, 30, 0, 0, douala), time.Date(2026, time.February, 1, 0, 0, 0, 0, douala)},
+		{"30 February", "0 0 30 2 *", thursday, time.Time{}},
+		{"31 April", "0 0 31 4 *", thursday, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSchedule(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q): %v", tt.expr, err)
+			}
+			got := s.Next(tt.after)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.after, got, tt.want)
+			}
+			if !got.IsZero() && got.Location() != tt.after.Location() {
+				t.Errorf("Next(%s) location = %s, want %s", tt.after, got.Location(), tt.after.Location())
+			}
+		})
+	}
+}
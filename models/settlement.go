@@ -0,0 +1,446 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Settlement line classifications
+const (
+	SettlementMatched         = "MATCHED"
+	SettlementMissingOurs     = "MISSING_OURS"     // settled by the provider, unknown or not completed here
+	SettlementMissingProvider = "MISSING_PROVIDER" // completed here, absent from the provider files
+	SettlementAmountMismatch  = "AMOUNT_MISMATCH"
+)
+
+// ErrSettlementImported is returned when the same file was already imported for a provider
+var ErrSettlementImported = errors.New("settlement file already imported")
+
+// SettlementLine is a settled payment of a provider file
+type SettlementLine struct {
+	Line       int
+	Reference  string
+	ExternalID string
+	Amount     int64
+	Currency   string
+}
+
+// SettlementImport is the struct for an imported provider settlement file and its report
+type SettlementImport struct {
+	ID              uuid.UUID        `json:"id" db:"id,omitempty"`
+	Provider        string           `json:"provider" db:"provider"`
+	SettlementDate  time.Time        `json:"settlement_date" db:"settlement_date"`
+	Filename        string           `json:"filename" db:"filename"`
+	Checksum        string           `json:"checksum" db:"checksum"` // sha256 of the file
+	LineCount       int              `json:"line_count" db:"line_count"`
+	Matched         int              `json:"matched" db:"matched"`
+	MissingOurs     int              `json:"missing_ours" db:"missing_ours"`
+	MissingProvider int              `json:"missing_provider" db:"missing_provider"`
+	AmountMismatch  int              `json:"amount_mismatch" db:"amount_mismatch"`
+	ImportedBy      string           `json:"imported_by" db:"imported_by"`
+	Items           []SettlementItem `json:"items,omitempty" db:"-"`
+	CreatedAt       time.Time        `json:"created_at" db:"created_at,omitempty"`
+}
+
+// SettlementItem is a classified settlement line or a transaction missing from the provider files
+type SettlementItem struct {
+	ID                uuid.UUID  `json:"id" db:"id,omitempty"`
+	ImportID          uuid.UUID  `json:"import_id" db:"import_id"`
+	Classification    string     `json:"classification" db:"classification"`
+	Line              int        `json:"line,omitempty" db:"line"`
+	ProviderReference string     `json:"provider_reference" db:"provider_reference"`
+	TransactionID     *uuid.UUID `json:"transaction_id,omitempty" db:"transaction_id"`
+	ProviderAmount    *int64     `json:"provider_amount,omitempty" db:"provider_amount"`
+	OurAmount         *int64     `json:"our_amount,omitempty" db:"our_amount"`
+	Detail            string     `json:"detail,omitempty" db:"detail"`
+	ResolvedBy        string     `json:"resolved_by,omitempty" db:"resolved_by"`
+	ResolutionNote    string     `json:"resolution_note,omitempty" db:"resolution_note"`
+	ResolvedAt        *time.Time `json:"resolved_at,omitempty" db:"resolved_at"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at,omitempty"`
+}
+
+// SettlementResolution is the struct for closing a settlement exception
+type SettlementResolution struct {
+	Note string `json:"note" binding:"required,max=500"`
+}
+
+// settlementItemColumns is the column list scanned by scanSettlementItem
+const settlementItemColumns = `id, import_id, classification, line, provider_reference, transaction_id, provider_amount, our_amount,
+	detail, resolved_by, resolution_note, resolved_at, created_at`
+
+// scanSettlementItem scans a settlement item row
+func scanSettlementItem(row pgx.Row) (*SettlementItem, error) {
+	item := &SettlementItem{}
+	err := row.Scan(
+		&item.ID,
+		&item.ImportID,
+		&item.Classification,
+		&item.Line,
+		&item.ProviderReference,
+		&item.TransactionID,
+		&item.ProviderAmount,
+		&item.OurAmount,
+		&item.Detail,
+		&item.ResolvedBy,
+		&item.ResolutionNote,
+		&item.ResolvedAt,
+		&item.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// ReconcileSettlement matches the lines of a provider file with the transactions and stores the report.
+// Completed transactions of the settlement day that no file of the provider matched are missing on the provider side.
+func (s *SettlementImport) ReconcileSettlement(lines []SettlementLine) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	s.LineCount = len(lines)
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO settlement_imports (provider, settlement_date, filename, checksum, line_count, imported_by)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (provider, checksum) DO NOTHING RETURNING id, created_at`,
+		s.Provider,
+		s.SettlementDate,
+		s.Filename,
+		s.Checksum,
+		s.LineCount,
+		s.ImportedBy,
+	).Scan(&s.ID, &s.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrSettlementImported
+	}
+	if err != nil {
+		return err
+	}
+
+	// Load the transactions the file refers to in one query
+	references := make([]string, 0, len(lines))
+	ids := make([]uuid.UUID, 0, len(lines))
+	for _, line := range lines {
+		references = append(references, line.Reference)
+		if id, err := uuid.Parse(line.ExternalID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows, err := tx.Query(
+		ctx,
+		`SELECT `+transactionColumns+` FROM transactions
+		WHERE provider = $1 AND (provider_reference = ANY($2::text[]) OR id = ANY($3::uuid[]))`,
+		s.Provider,
+		references,
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+	byReference := make(map[string]*Transaction)
+	byID := make(map[uuid.UUID]*Transaction)
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if t.ProviderReference != "" {
+			byReference[t.ProviderReference] = t
+		}
+		byID[t.ID] = t
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	items := make([]SettlementItem, 0, len(lines))
+	seen := make(map[uuid.UUID]bool)
+	for _, line := range lines {
+		amount := line.Amount
+		item := SettlementItem{Line: line.Line, ProviderReference: line.Reference, ProviderAmount: &amount}
+
+		t := byReference[line.Reference]
+		if t == nil {
+			if id, err := uuid.Parse(line.ExternalID); err == nil {
+				t = byID[id]
+			}
+		}
+		if t != nil {
+			id, ourAmount := t.ID, t.Amount
+			item.TransactionID = &id
+			item.OurAmount = &ourAmount
+		}
+
+		switch {
+		case t == nil:
+			item.Classification = SettlementMissingOurs
+			item.Detail = "no transaction with this reference"
+		case seen[t.ID]:
+			item.Classification = SettlementMissingOurs
+			item.Detail = "transaction already settled by another line"
+		case t.Status != TransactionCompleted:
+			item.Classification = SettlementMissingOurs
+			item.Detail = fmt.Sprintf("transaction is %s", t.Status)
+		case t.Amount != line.Amount:
+			item.Classification = SettlementAmountMismatch
+			item.Detail = fmt.Sprintf("difference of %d", line.Amount-t.Amount)
+		case line.Currency != "" && line.Currency != t.Currency:
+			item.Classification = SettlementAmountMismatch
+			item.Detail = fmt.Sprintf("currency %s, expected %s", line.Currency, t.Currency)
+		default:
+			item.Classification = SettlementMatched
+		}
+		if t != nil {
+			seen[t.ID] = true
+		}
+		items = append(items, item)
+	}
+
+	// Completed transactions of the day never found in a file of the provider
+	rows, err = tx.Query(
+		ctx,
+		`SELECT `+transactionColumns+` FROM transactions t
+		WHERE t.provider = $1 AND t.status = 'COMPLETED' AND t.updated_at >= $2 AND t.updated_at < $3
+		AND NOT (t.id = ANY($4::uuid[]))
+		AND NOT EXISTS (
+			SELECT 1 FROM settlement_items i JOIN settlement_imports si ON si.id = i.import_id
+			WHERE si.provider = $1 AND i.transaction_id = t.id AND i.classification IN ('MATCHED', 'AMOUNT_MISMATCH')
+		)`,
+		s.Provider,
+		s.SettlementDate,
+		s.SettlementDate.AddDate(0, 0, 1),
+		keys(seen),
+	)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		id, ourAmount := t.ID, t.Amount
+		items = append(items, SettlementItem{
+			Classification:    SettlementMissingProvider,
+			ProviderReference: t.ProviderReference,
+			TransactionID:     &id,
+			OurAmount:         &ourAmount,
+			Detail:            "completed transaction absent from the settlement file",
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range items {
+		item := &items[i]
+		item.ImportID = s.ID
+		err := tx.QueryRow(
+			ctx,
+			`INSERT INTO settlement_items (import_id, classification, line, provider_reference, transaction_id, provider_amount, our_amount, detail)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`,
+			item.ImportID,
+			item.Classification,
+			item.Line,
+			item.ProviderReference,
+			item.TransactionID,
+			item.ProviderAmount,
+			item.OurAmount,
+			item.Detail,
+		).Scan(&item.ID, &item.CreatedAt)
+		if err != nil {
+			return err
+		}
+		switch item.Classification {
+		case SettlementMatched:
+			s.Matched++
+		case SettlementMissingOurs:
+			s.MissingOurs++
+		case SettlementMissingProvider:
+			s.MissingProvider++
+		case SettlementAmountMismatch:
+			s.AmountMismatch++
+		}
+	}
+	s.Items = items
+
+	// A transaction settled in a later file closes the exception raised by an earlier one
+	settled := make([]uuid.UUID, 0, len(items))
+	for _, item := range items {
+		if item.Classification == SettlementMatched {
+			settled = append(settled, *item.TransactionID)
+		}
+	}
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE settlement_items SET resolved_by = $1, resolution_note = 'settled in a later file', resolved_at = CURRENT_TIMESTAMP
+		WHERE classification = 'MISSING_PROVIDER' AND resolved_at IS NULL AND import_id <> $2 AND transaction_id = ANY($3::uuid[])`,
+		"settlement:"+s.ID.String(),
+		s.ID,
+		settled,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE settlement_imports SET matched = $1, missing_ours = $2, missing_provider = $3, amount_mismatch = $4 WHERE id = $5`,
+		s.Matched,
+		s.MissingOurs,
+		s.MissingProvider,
+		s.AmountMismatch,
+		s.ID,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// keys returns the keys of a set
+func keys(set map[uuid.UUID]bool) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// settlementImportColumns is the column list of a settlement import
+const settlementImportColumns = `id, provider, settlement_date, filename, checksum, line_count, matched, missing_ours,
+	missing_provider, amount_mismatch, imported_by, created_at`
+
+// scanSettlementImport scans a settlement import row
+func scanSettlementImport(row pgx.Row) (*SettlementImport, error) {
+	s := &SettlementImport{}
+	err := row.Scan(
+		&s.ID,
+		&s.Provider,
+		&s.SettlementDate,
+		&s.Filename,
+		&s.Checksum,
+		&s.LineCount,
+		&s.Matched,
+		&s.MissingOurs,
+		&s.MissingProvider,
+		&s.AmountMismatch,
+		&s.ImportedBy,
+		&s.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetSettlementImports lists the imported settlement files
+func GetSettlementImports() ([]SettlementImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(ctx, `SELECT `+settlementImportColumns+` FROM settlement_imports ORDER BY created_at DESC LIMIT 200`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	imports := make([]SettlementImport, 0)
+	for rows.Next() {
+		s, err := scanSettlementImport(rows)
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, *s)
+	}
+	return imports, nil
+}
+
+// GetSettlementImport gets the report of an imported settlement file with its items
+func (s *SettlementImport) GetSettlementImport() (*SettlementImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	report, err := scanSettlementImport(DB.QueryRow(ctx, `SELECT `+settlementImportColumns+` FROM settlement_imports WHERE id = $1`, s.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+settlementItemColumns+` FROM settlement_items WHERE import_id = $1 ORDER BY classification, line`,
+		s.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report.Items = make([]SettlementItem, 0)
+	for rows.Next() {
+		item, err := scanSettlementItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		report.Items = append(report.Items, *item)
+	}
+	return report, nil
+}
+
+// GetSettlementExceptions lists the unresolved settlement exceptions, oldest first
+func GetSettlementExceptions(limit int) ([]SettlementItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+settlementItemColumns+` FROM settlement_items
+		WHERE classification <> 'MATCHED' AND resolved_at IS NULL ORDER BY created_at LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]SettlementItem, 0)
+	for rows.Next() {
+		item, err := scanSettlementItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+// ResolveSettlementException closes an exception with the ops resolution
+func (item *SettlementItem) ResolveSettlementException(resolvedBy, note string) (*SettlementItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanSettlementItem(DB.QueryRow(
+		ctx,
+		`UPDATE settlement_items SET resolved_by = $1, resolution_note = $2, resolved_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND classification <> 'MATCHED' AND resolved_at IS NULL RETURNING `+settlementItemColumns,
+		resolvedBy,
+		note,
+		item.ID,
+	))
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// BalanceSnapshot is the balance of a wallet at a day boundary
+type BalanceSnapshot struct {
+	ID         uuid.UUID `json:"id" db:"id,omitempty"`
+	WalletID   uuid.UUID `json:"wallet_id" db:"wallet_id"`
+	SnapshotAt time.Time `json:"snapshot_at" db:"snapshot_at"` // midnight UTC, the balance is the one before it
+	Balance    int64     `json:"balance" db:"balance"`
+	Currency   string    `json:"currency" db:"currency"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at,omitempty"`
+}
+
+// PointInTimeBalance is the balance of a wallet at a given instant
+type PointInTimeBalance struct {
+	WalletID   uuid.UUID  `json:"wallet_id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	At         time.Time  `json:"at"`
+	Balance    int64      `json:"balance"`
+	Currency   string     `json:"currency"`
+	SnapshotAt *time.Time `json:"snapshot_at,omitempty"` // snapshot the logs were replayed from
+	Replayed   int64      `json:"replayed"`              // logs replayed after the snapshot
+}
+
+// CreateBalanceSnapshots snapshots every wallet at a day boundary.
+// Each balance is the previous snapshot plus the log deltas since, existing snapshots are kept.
+func CreateBalanceSnapshots(at time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	tag, err := DB.Exec(
+		ctx,
+		`INSERT INTO wallet_balance_snapshots (wallet_id, snapshot_at, balance, currency)
+		SELECT w.id, $1, COALESCE(prev.balance, 0) + COALESCE(SUM(l.new_balance - l.old_balance), 0), w.currency
+		FROM wallets w
+		LEFT JOIN LATERAL (
+			SELECT s.balance, s.snapshot_at FROM wallet_balance_snapshots s
+			WHERE s.wallet_id = w.id AND s.snapshot_at < $1 ORDER BY s.snapshot_at DESC LIMIT 1
+		) prev ON true
+		LEFT JOIN wallet_logs l ON l.wallet_id = w.id
+			AND l.created_at >= COALESCE(prev.snapshot_at, '-infinity'::timestamptz) AND l.created_at < $1
+		WHERE w.created_at < $1
+		GROUP BY w.id, w.currency, prev.balance
+		ON CONFLICT (wallet_id, snapshot_at) DO NOTHING`,
+		at,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// GetSnapshotDays lists the day boundaries already snapshotted since a date
+func GetSnapshotDays(since time.Time) (map[time.Time]bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(ctx, `SELECT DISTINCT snapshot_at FROM wallet_balance_snapshots WHERE snapshot_at >= $1`, since)
+	if err != nil {
+		return nil, err
+	}
+	days, err := pgx.CollectRows(rows, pgx.RowTo[time.Time])
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotted := make(map[time.Time]bool, len(days))
+	for _, day := range days {
+		snapshotted[day.UTC()] = true
+	}
+	return snapshotted, nil
+}
+
+// BalanceAt replays the logs of a wallet from the nearest snapshot up to an instant
+func (w *Wallet) BalanceAt(at time.Time) (*PointInTimeBalance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := &PointInTimeBalance{WalletID: w.ID, At: at}
+	var createdAt time.Time
+	err := DB.QueryRow(
+		ctx,
+		`SELECT user_id, currency, created_at FROM wallets WHERE id = $1`,
+		w.ID,
+	).Scan(&result.UserID, &result.Currency, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if at.Before(createdAt) {
+		return result, nil
+	}
+
+	from := time.Time{}
+	snapshot := BalanceSnapshot{}
+	err = DB.QueryRow(
+		ctx,
+		`SELECT snapshot_at, balance FROM wallet_balance_snapshots WHERE wallet_id = $1 AND snapshot_at <= $2
+		ORDER BY snapshot_at DESC LIMIT 1`,
+		w.ID,
+		at,
+	).Scan(&snapshot.SnapshotAt, &snapshot.Balance)
+	switch {
+	case err == nil:
+		from = snapshot.SnapshotAt
+		result.Balance = snapshot.Balance
+		result.SnapshotAt = &snapshot.SnapshotAt
+	case !errors.Is(err, pgx.ErrNoRows):
+		return nil, err
+	}
+
+	// Deltas are summed so the replay does not depend on the log order
+	var delta int64
+	err = DB.QueryRow(
+		ctx,
+		`SELECT COALESCE(SUM(new_balance - old_balance), 0), COUNT(*) FROM wallet_logs
+		WHERE wallet_id = $1 AND created_at >= $2 AND created_at <= $3`,
+		w.ID,
+		from,
+		at,
+	).Scan(&delta, &result.Replayed)
+	if err != nil {
+		return nil, err
+	}
+	result.Balance += delta
+	return result, nil
+}
+
+// GetBalanceSnapshots lists the snapshots of every wallet at a day boundary
+func GetBalanceSnapshots(at time.Time) ([]BalanceSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT id, wallet_id, snapshot_at, balance, currency, created_at FROM wallet_balance_snapshots
+		WHERE snapshot_at = $1 ORDER BY wallet_id`,
+		at,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := make([]BalanceSnapshot, 0)
+	for rows.Next() {
+		s := BalanceSnapshot{}
+		if err := rows.Scan(&s.ID, &s.WalletID, &s.SnapshotAt, &s.Balance, &s.Currency, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, nil
+}
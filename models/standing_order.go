@@ -0,0 +1,482 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Standing order statuses
+const (
+	StandingOrderActive    = "ACTIVE"
+	StandingOrderPaused    = "PAUSED"
+	StandingOrderCanceled  = "CANCELED"
+	StandingOrderCompleted = "COMPLETED" // past its end date or a one-off already run
+)
+
+// Standing order run statuses
+const (
+	StandingOrderRunSucceeded = "SUCCEEDED"
+	StandingOrderRunRetrying  = "RETRYING"
+	StandingOrderRunFailed    = "FAILED"
+)
+
+// DefaultTimezone is the timezone of the schedules that do not set one
+const DefaultTimezone = "Africa/Douala"
+
+// TransferSourceStandingOrder is the source of the transfers made by standing orders
+const TransferSourceStandingOrder = "standing_order"
+
+// ErrStandingOrderStatus is returned for a status change the order does not allow
+var ErrStandingOrderStatus = errors.New("standing order cannot change to this status")
+
+// StandingOrder is the struct for a scheduled or recurring transfer
+type StandingOrder struct {
+	ID          uuid.UUID  `json:"id" db:"id,omitempty"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	WalletID    uuid.UUID  `json:"wallet_id" db:"wallet_id"`
+	ToUserID    uuid.UUID  `json:"to_user_id" db:"to_user_id"`
+	Amount      int64      `json:"amount" db:"amount"`
+	Currency    string     `json:"currency" db:"currency"`
+	Description string     `json:"description" db:"description"`
+	Schedule    string     `json:"schedule" db:"schedule"` // cron expression or macro, empty for a one-off transfer
+	Timezone    string     `json:"timezone" db:"timezone"`
+	StartAt     time.Time  `json:"start_at" db:"start_at"`
+	EndAt       *time.Time `json:"end_at,omitempty" db:"end_at"`
+	NextRunAt   *time.Time `json:"next_run_at,omitempty" db:"next_run_at"` // occurrence being executed
+	AttemptAt   *time.Time `json:"attempt_at,omitempty" db:"attempt_at"`   // next try, later than next_run_at on retry
+	Attempts    int        `json:"attempts" db:"attempts"`                 // failed tries of the current occurrence
+	Status      string     `json:"status" db:"status"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// StandingOrderRequest is the struct for creating a standing order
+type StandingOrderRequest struct {
+	UserID      uuid.UUID  `json:"user_id" binding:"required"`
+	WalletID    uuid.UUID  `json:"wallet_id" binding:"required"`
+	ToUserID    uuid.UUID  `json:"to_user_id" binding:"required"`
+	Amount      int64      `json:"amount" binding:"required,numeric,gt=0,min=100,max=2000000"`
+	Description string     `json:"description" binding:"max=255"`
+	Schedule    string     `json:"schedule" binding:"max=100"`
+	Timezone    string     `json:"timezone" binding:"max=64"`
+	StartAt     time.Time  `json:"start_at" binding:"required"`
+	EndAt       *time.Time `json:"end_at"`
+}
+
+// StandingOrderStatusRequest is the struct for pausing, resuming or canceling a standing order
+type StandingOrderStatusRequest struct {
+	UserID  uuid.UUID `json:"user_id" binding:"required"`
+	OrderID uuid.UUID `json:"order_id" binding:"required"`
+	Status  string    `json:"status" binding:"required,oneof=ACTIVE PAUSED CANCELED"`
+}
+
+// StandingOrderRun is the execution of one occurrence of a standing order
+type StandingOrderRun struct {
+	ID           uuid.UUID  `json:"id" db:"id,omitempty"`
+	OrderID      uuid.UUID  `json:"order_id" db:"order_id"`
+	UserID       uuid.UUID  `json:"user_id" db:"user_id"`
+	OccurrenceAt time.Time  `json:"occurrence_at" db:"occurrence_at"`
+	Status       string     `json:"status" db:"status"`
+	Attempts     int        `json:"attempts" db:"attempts"`
+	TransferID   *uuid.UUID `json:"transfer_id,omitempty" db:"transfer_id"`
+	Error        string     `json:"error,omitempty" db:"error"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at,omitempty"`
+}
+
+// standingOrderColumns is the column list scanned by scanStandingOrder
+const standingOrderColumns = `id, user_id, wallet_id, to_user_id, amount, currency, description, schedule, timezone,
+	start_at, end_at, next_run_at, attempt_at, attempts, status, created_at, updated_at`
+
+// scanStandingOrder scans a standing order row
+func scanStandingOrder(row pgx.Row) (*StandingOrder, error) {
+	o := &StandingOrder{}
+	err := row.Scan(
+		&o.ID,
+		&o.UserID,
+		&o.WalletID,
+		&o.ToUserID,
+		&o.Amount,
+		&o.Currency,
+		&o.Description,
+		&o.Schedule,
+		&o.Timezone,
+		&o.StartAt,
+		&o.EndAt,
+		&o.NextRunAt,
+		&o.AttemptAt,
+		&o.Attempts,
+		&o.Status,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// nextOccurrence returns the first occurrence strictly after a time, zero when the order is over
+func (o *StandingOrder) nextOccurrence(after time.Time) (time.Time, error) {
+	if o.Schedule == "" {
+		return time.Time{}, nil
+	}
+	loc, err := time.LoadLocation(o.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	schedule, err := ParseSchedule(o.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := schedule.Next(after.In(loc))
+	if o.EndAt != nil && next.After(*o.EndAt) {
+		return time.Time{}, nil
+	}
+	return next, nil
+}
+
+// CreateStandingOrder validates the schedule and creates the order from a wallet of the user.
+// The recipient needs an active wallet in the same currency.
+func (r *StandingOrderRequest) CreateStandingOrder() (*StandingOrder, error) {
+	if r.ToUserID == r.UserID {
+		return nil, ErrSameWallet
+	}
+	if r.Timezone == "" {
+		r.Timezone = DefaultTimezone
+	}
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidSchedule, r.Timezone)
+	}
+
+	order := &StandingOrder{Schedule: r.Schedule, Timezone: r.Timezone, EndAt: r.EndAt}
+	first := r.StartAt
+	if r.Schedule != "" {
+		// The start itself is the first occurrence when it matches the schedule
+		next, err := order.nextOccurrence(r.StartAt.Add(-time.Nanosecond))
+		if err != nil {
+			return nil, err
+		}
+		first = next
+	}
+	if first.IsZero() || (r.EndAt != nil && first.After(*r.EndAt)) {
+		return nil, fmt.Errorf("%w: no occurrence before the end date", ErrInvalidSchedule)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanStandingOrder(DB.QueryRow(
+		ctx,
+		`INSERT INTO standing_orders (user_id, wallet_id, to_user_id, amount, currency, description, schedule, timezone, start_at, end_at, next_run_at, attempt_at)
+		SELECT w.user_id, w.id, $3, $4, w.currency, $5, $6, $7, $8, $9, $10, $10
+		FROM wallets w JOIN wallets r ON r.user_id = $3 AND r.is_active = true AND r.currency = w.currency
+		WHERE w.id = $1 AND w.user_id = $2 AND w.is_active = true
+		RETURNING `+standingOrderColumns,
+		r.WalletID,
+		r.UserID,
+		r.ToUserID,
+		r.Amount,
+		r.Description,
+		r.Schedule,
+		r.Timezone,
+		r.StartAt,
+		r.EndAt,
+		first,
+	))
+}
+
+// GetStandingOrders lists the standing orders of a user, newest first
+func GetStandingOrders(userID uuid.UUID) ([]StandingOrder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+standingOrderColumns+` FROM standing_orders WHERE user_id = $1 ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]StandingOrder, 0)
+	for rows.Next() {
+		o, err := scanStandingOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *o)
+	}
+	return orders, nil
+}
+
+// SetStandingOrderStatus pauses, resumes or cancels a standing order.
+// Occurrences missed while paused are skipped on resume.
+func (r *StandingOrderStatusRequest) SetStandingOrderStatus() (*StandingOrder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	order, err := scanStandingOrder(tx.QueryRow(
+		ctx,
+		`SELECT `+standingOrderColumns+` FROM standing_orders WHERE id = $1 AND user_id = $2 FOR UPDATE`,
+		r.OrderID,
+		r.UserID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	status, next := r.Status, order.NextRunAt
+	switch {
+	case r.Status == StandingOrderPaused && order.Status == StandingOrderActive:
+	case r.Status == StandingOrderCanceled && (order.Status == StandingOrderActive || order.Status == StandingOrderPaused):
+	case r.Status == StandingOrderActive && order.Status == StandingOrderPaused:
+		now := time.Now()
+		if next != nil && next.Before(now) && order.Schedule != "" {
+			occurrence, err := order.nextOccurrence(now)
+			if err != nil {
+				return nil, err
+			}
+			next = &occurrence
+			if occurrence.IsZero() {
+				status, next = StandingOrderCompleted, nil
+			}
+		}
+	default:
+		return nil, ErrStandingOrderStatus
+	}
+
+	order, err = scanStandingOrder(tx.QueryRow(
+		ctx,
+		`UPDATE standing_orders SET status = $1, next_run_at = $2, attempt_at = $2, attempts = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 RETURNING `+standingOrderColumns,
+		status,
+		next,
+		order.ID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// GetStandingOrderRuns lists the executions of a standing order of a user, newest first
+func GetStandingOrderRuns(orderID, userID uuid.UUID, limit int) ([]StandingOrderRun, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT id, order_id, user_id, occurrence_at, status, attempts, transfer_id, error, created_at, updated_at
+		FROM standing_order_runs WHERE order_id = $1 AND user_id = $2 ORDER BY occurrence_at DESC LIMIT $3`,
+		orderID,
+		userID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]StandingOrderRun, 0)
+	for rows.Next() {
+		run := StandingOrderRun{}
+		err := rows.Scan(
+			&run.ID,
+			&run.OrderID,
+			&run.UserID,
+			&run.OccurrenceAt,
+			&run.Status,
+			&run.Attempts,
+			&run.TransferID,
+			&run.Error,
+			&run.CreatedAt,
+			&run.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// GetDueStandingOrders lists the active orders whose next attempt is due
+func GetDueStandingOrders(now time.Time, limit int) ([]uuid.UUID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT id FROM standing_orders WHERE status = 'ACTIVE' AND attempt_at <= $1 ORDER BY attempt_at LIMIT $2`,
+		now,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
+
+// ExecuteStandingOrder runs the due occurrence of an order and moves it to the next one.
+// The transfer, the run and the schedule move in one transaction, and the transfer is keyed by
+// occurrence, so an occurrence is paid at most once even across replicas. Insufficient funds
+// and locked wallets are retried every retryInterval until maxAttempts or the next occurrence.
+// It returns a nil run when the order is no longer due.
+func ExecuteStandingOrder(orderID uuid.UUID, now time.Time, retryInterval time.Duration, maxAttempts int) (*StandingOrderRun, *Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	order, err := scanStandingOrder(tx.QueryRow(
+		ctx,
+		`SELECT `+standingOrderColumns+` FROM standing_orders
+		WHERE id = $1 AND status = 'ACTIVE' AND attempt_at <= $2 FOR UPDATE SKIP LOCKED`,
+		orderID,
+		now,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, nil // already run, or being run by another replica
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	occurrence := *order.NextRunAt
+	run := &StandingOrderRun{
+		OrderID:      order.ID,
+		UserID:       order.UserID,
+		OccurrenceAt: occurrence,
+		Attempts:     order.Attempts + 1,
+	}
+	key := fmt.Sprintf("%s:%s:%d", TransferSourceStandingOrder, order.ID, occurrence.Unix())
+	transfer := &Transfer{
+		FromWalletID:   order.WalletID,
+		FromUserID:     order.UserID,
+		ToUserID:       order.ToUserID,
+		Amount:         order.Amount,
+		Source:         TransferSourceStandingOrder,
+		SourceID:       &order.ID,
+		IdempotencyKey: &key,
+	}
+
+	// The transfer runs in a savepoint so a refused transfer still records the run
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = transfer.transfer(ctx, savepoint)
+	switch {
+	case err == nil:
+		if err := savepoint.Commit(ctx); err != nil {
+			return nil, nil, err
+		}
+		run.Status = StandingOrderRunSucceeded
+		run.TransferID = &transfer.ID
+	case errors.Is(err, ErrTransferExists):
+		run.Status = StandingOrderRunSucceeded
+		transfer = nil
+	case errors.Is(err, ErrInsufficientFunds), errors.Is(err, ErrWalletLocked), errors.Is(err, ErrGuardianControl):
+		run.Status = StandingOrderRunRetrying
+		run.Error = err.Error()
+		transfer = nil
+	case errors.Is(err, pgx.ErrNoRows), errors.Is(err, ErrCurrencyMismatch), errors.Is(err, ErrSameWallet):
+		run.Status = StandingOrderRunFailed
+		run.Error = err.Error()
+		transfer = nil
+	default:
+		return nil, nil, err
+	}
+	if transfer == nil {
+		if err := savepoint.Rollback(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	next, err := order.nextOccurrence(occurrence)
+	if err != nil {
+		return nil, nil, err
+	}
+	retryAt := now.Add(retryInterval)
+	if run.Status == StandingOrderRunRetrying && (run.Attempts >= maxAttempts || (!next.IsZero() && !retryAt.Before(next))) {
+		run.Status = StandingOrderRunFailed
+	}
+
+	switch {
+	case run.Status == StandingOrderRunRetrying:
+		_, err = tx.Exec(
+			ctx,
+			`UPDATE standing_orders SET attempts = $1, attempt_at = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3`,
+			run.Attempts,
+			retryAt,
+			order.ID,
+		)
+	case next.IsZero():
+		_, err = tx.Exec(
+			ctx,
+			`UPDATE standing_orders SET status = 'COMPLETED', next_run_at = NULL, attempt_at = NULL, attempts = 0, updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+			order.ID,
+		)
+	default:
+		_, err = tx.Exec(
+			ctx,
+			`UPDATE standing_orders SET next_run_at = $1, attempt_at = $1, attempts = 0, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+			next,
+			order.ID,
+		)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO standing_order_runs (order_id, user_id, occurrence_at, status, attempts, transfer_id, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (order_id, occurrence_at) DO UPDATE SET status = EXCLUDED.status, attempts = EXCLUDED.attempts,
+			transfer_id = COALESCE(EXCLUDED.transfer_id, standing_order_runs.transfer_id), error = EXCLUDED.error, updated_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at, updated_at`,
+		run.OrderID,
+		run.UserID,
+		run.OccurrenceAt,
+		run.Status,
+		run.Attempts,
+		run.TransferID,
+		run.Error,
+	).Scan(&run.ID, &run.CreatedAt, &run.UpdatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return run, transfer, nil
+}
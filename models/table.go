@@ -39,6 +39,606 @@ func createTables() error {
     	);`,
 		`CREATE INDEX IF NOT EXISTS idx_wallet_logs_user_id ON wallet_logs (user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_wallets_user_lookup ON wallets (user_id, locked, is_active);`,
+		`CREATE INDEX IF NOT EXISTS idx_wallet_logs_activity_created ON wallet_logs (activity, created_at);`,
+		`ALTER TABLE wallet_logs ADD COLUMN IF NOT EXISTS reference_id UUID REFERENCES wallet_logs (id);`,
+		`CREATE INDEX IF NOT EXISTS idx_wallet_logs_reference_id ON wallet_logs (reference_id);`,
+		`CREATE TABLE IF NOT EXISTS wallet_reversals (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			original_log_id UUID NOT NULL REFERENCES wallet_logs (id),
+			reversal_log_id UUID NOT NULL REFERENCES wallet_logs (id),
+			wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+			amount BIGINT NOT NULL CHECK (amount > 0),
+			reason VARCHAR(255) NOT NULL,
+			idempotency_key VARCHAR(100) NOT NULL UNIQUE,
+			requested_by VARCHAR(100) NOT NULL, -- admin user id or calling service
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_wallet_reversals_original ON wallet_reversals (original_log_id);`,
+		`ALTER TABLE wallets ADD COLUMN IF NOT EXISTS held_balance BIGINT DEFAULT 0 NOT NULL;`,
+		`CREATE TABLE IF NOT EXISTS transactions (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL,
+			wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+			type VARCHAR(20) NOT NULL, -- 'DEPOSIT', 'WITHDRAWAL'
+			amount BIGINT NOT NULL CHECK (amount > 0),
+			currency VARCHAR(3) DEFAULT 'XAF' NOT NULL,
+			status VARCHAR(20) DEFAULT 'PENDING' NOT NULL, -- 'PENDING', 'PROCESSING', 'COMPLETED', 'FAILED', 'REVERSED'
+			provider VARCHAR(50) DEFAULT '' NOT NULL,
+			provider_reference VARCHAR(100) DEFAULT '' NOT NULL,
+			failure_reason VARCHAR(255) DEFAULT '' NOT NULL,
+			log_id UUID REFERENCES wallet_logs (id), -- settlement log
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_wallet ON transactions (wallet_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions (status) WHERE status IN ('PENDING', 'PROCESSING');`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_provider_reference ON transactions (provider, provider_reference);`,
+		`CREATE TABLE IF NOT EXISTS provider_callbacks (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			provider VARCHAR(50) NOT NULL,
+			signature VARCHAR(128) NOT NULL,
+			payload TEXT NOT NULL,
+			transaction_id UUID REFERENCES transactions (id),
+			status VARCHAR(20) NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+
+			CONSTRAINT uq_provider_callback_signature UNIQUE (provider, signature)
+		);`,
+		`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			partner VARCHAR(100) NOT NULL,
+			url TEXT NOT NULL,
+			secret VARCHAR(64) NOT NULL,
+			events TEXT[] NOT NULL, -- event types, '*' for all
+			is_active BOOLEAN DEFAULT TRUE,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`ALTER TABLE webhook_subscriptions ADD COLUMN IF NOT EXISTS user_ids UUID[] DEFAULT '{}' NOT NULL;`, // users whose events the partner receives
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			subscription_id UUID NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+			event_id UUID NOT NULL,
+			event_type VARCHAR(50) NOT NULL,
+			payload JSONB NOT NULL,
+			status VARCHAR(20) DEFAULT 'PENDING' NOT NULL, -- 'PENDING', 'DELIVERED', 'DEAD'
+			attempts INTEGER DEFAULT 0 NOT NULL,
+			last_error TEXT DEFAULT '' NOT NULL,
+			next_attempt_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			delivered_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+
+			CONSTRAINT uq_webhook_delivery_event UNIQUE (subscription_id, event_id)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'PENDING';`,
+		`CREATE TABLE IF NOT EXISTS access_audits (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			actor_id UUID NOT NULL,
+			action VARCHAR(50) NOT NULL,
+			resource_id UUID NOT NULL,
+			ip_address VARCHAR(45) DEFAULT '' NOT NULL,
+			user_agent TEXT DEFAULT '' NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_access_audits_actor_created ON access_audits (actor_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_access_audits_created ON access_audits (created_at);`,
+		`ALTER TABLE wallet_logs ADD COLUMN IF NOT EXISTS chain_seq BIGINT;`,
+		`ALTER TABLE wallet_logs ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64);`,
+		`ALTER TABLE wallet_logs ADD COLUMN IF NOT EXISTS hash VARCHAR(64);`, // sha256 of prev_hash and content
+		`CREATE UNIQUE INDEX IF NOT EXISTS uq_wallet_logs_chain ON wallet_logs (wallet_id, chain_seq) WHERE chain_seq IS NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_wallet_logs_unchained ON wallet_logs (wallet_id) WHERE hash IS NULL;`,
+		`CREATE TABLE IF NOT EXISTS wallet_log_anchors (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			heads JSONB NOT NULL, -- [{wallet_id, seq, hash}]
+			digest VARCHAR(64) NOT NULL,
+			signature VARCHAR(128) NOT NULL, -- ed25519 signature of digest
+			public_key VARCHAR(64) NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS wallet_balance_snapshots (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+			snapshot_at TIMESTAMPTZ NOT NULL, -- midnight UTC, covers the logs before it
+			balance BIGINT NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+
+			CONSTRAINT uq_wallet_balance_snapshot UNIQUE (wallet_id, snapshot_at)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_wallet_logs_wallet_created ON wallet_logs (wallet_id, created_at);`,
+		`CREATE TABLE IF NOT EXISTS reconciliation_runs (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			wallet_id UUID, -- NULL for a run over every wallet
+			wallets_checked BIGINT NOT NULL,
+			discrepancy_count INTEGER NOT NULL,
+			started_at TIMESTAMPTZ NOT NULL,
+			finished_at TIMESTAMPTZ NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_reconciliation_runs_started ON reconciliation_runs (started_at);`,
+		`CREATE TABLE IF NOT EXISTS wallet_discrepancies (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			run_id UUID NOT NULL REFERENCES reconciliation_runs (id) ON DELETE CASCADE,
+			wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+			user_id UUID NOT NULL,
+			stored_balance BIGINT NOT NULL,
+			expected_balance BIGINT NOT NULL, -- sum of the wallet_logs deltas
+			stored_held BIGINT NOT NULL,
+			expected_held BIGINT NOT NULL, -- sum of the in-flight withdrawals
+			log_count BIGINT NOT NULL,
+			last_log_at TIMESTAMPTZ,
+			currency VARCHAR(3) NOT NULL,
+			detected_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_wallet_discrepancies_wallet ON wallet_discrepancies (wallet_id, detected_at);`,
+		`CREATE TABLE IF NOT EXISTS settlement_imports (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			provider VARCHAR(50) NOT NULL,
+			settlement_date DATE NOT NULL,
+			filename VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL, -- sha256 of the file
+			line_count INTEGER NOT NULL,
+			matched INTEGER DEFAULT 0 NOT NULL,
+			missing_ours INTEGER DEFAULT 0 NOT NULL,
+			missing_provider INTEGER DEFAULT 0 NOT NULL,
+			amount_mismatch INTEGER DEFAULT 0 NOT NULL,
+			imported_by VARCHAR(100) NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+
+			CONSTRAINT uq_settlement_import_file UNIQUE (provider, checksum)
+		);`,
+		`CREATE TABLE IF NOT EXISTS settlement_items (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			import_id UUID NOT NULL REFERENCES settlement_imports (id) ON DELETE CASCADE,
+			classification VARCHAR(20) NOT NULL, -- 'MATCHED', 'MISSING_OURS', 'MISSING_PROVIDER', 'AMOUNT_MISMATCH'
+			line INTEGER DEFAULT 0 NOT NULL, -- 0 for MISSING_PROVIDER
+			provider_reference VARCHAR(100) DEFAULT '' NOT NULL,
+			transaction_id UUID REFERENCES transactions (id),
+			provider_amount BIGINT,
+			our_amount BIGINT,
+			detail TEXT DEFAULT '' NOT NULL,
+			resolved_by VARCHAR(100) DEFAULT '' NOT NULL,
+			resolution_note TEXT DEFAULT '' NOT NULL,
+			resolved_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_settlement_items_import ON settlement_items (import_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_settlement_items_transaction ON settlement_items (transaction_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_settlement_items_open ON settlement_items (created_at) WHERE classification <> 'MATCHED' AND resolved_at IS NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_provider_updated ON transactions (provider, status, updated_at);`,
+		`CREATE TABLE IF NOT EXISTS pockets (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			wallet_id UUID NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+			user_id UUID NOT NULL,
+			name VARCHAR(50) NOT NULL,
+			balance BIGINT DEFAULT 0 NOT NULL CHECK (balance >= 0),
+			goal_amount BIGINT CHECK (goal_amount > 0),
+			target_date DATE,
+			is_active BOOLEAN DEFAULT TRUE,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS uq_pockets_wallet_name ON pockets (wallet_id, name) WHERE is_active = true;`,
+		`CREATE TABLE IF NOT EXISTS transfers (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			from_wallet_id UUID NOT NULL REFERENCES wallets (id),
+			from_user_id UUID NOT NULL,
+			to_wallet_id UUID NOT NULL REFERENCES wallets (id),
+			to_user_id UUID NOT NULL,
+			amount BIGINT NOT NULL CHECK (amount > 0),
+			currency VARCHAR(3) NOT NULL,
+			source VARCHAR(50) NOT NULL,
+			source_id UUID,
+			idempotency_key VARCHAR(150) UNIQUE,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_transfers_source ON transfers (source, source_id);`,
+		`CREATE TABLE IF NOT EXISTS standing_orders (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL,
+			wallet_id UUID NOT NULL REFERENCES wallets (id),
+			to_user_id UUID NOT NULL,
+			amount BIGINT NOT NULL CHECK (amount > 0),
+			currency VARCHAR(3) NOT NULL,
+			description VARCHAR(255) DEFAULT '' NOT NULL,
+			schedule VARCHAR(100) DEFAULT '' NOT NULL,
+			timezone VARCHAR(64) DEFAULT 'Africa/Douala' NOT NULL,
+			start_at TIMESTAMPTZ NOT NULL,
+			end_at TIMESTAMPTZ,
+			next_run_at TIMESTAMPTZ,
+			attempt_at TIMESTAMPTZ,
+			attempts INT DEFAULT 0 NOT NULL,
+			status VARCHAR(20) DEFAULT 'ACTIVE' NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_standing_orders_user ON standing_orders (user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_standing_orders_due ON standing_orders (attempt_at) WHERE status = 'ACTIVE';`,
+		`CREATE TABLE IF NOT EXISTS standing_order_runs (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			order_id UUID NOT NULL REFERENCES standing_orders (id) ON DELETE CASCADE,
+			user_id UUID NOT NULL,
+			occurrence_at TIMESTAMPTZ NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			attempts INT DEFAULT 0 NOT NULL,
+			transfer_id UUID REFERENCES transfers (id),
+			error TEXT DEFAULT '' NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (order_id, occurrence_at)
+		);`,
+		`CREATE TABLE IF NOT EXISTS payment_requests (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			requester_id UUID NOT NULL,
+			requester_wallet_id UUID NOT NULL REFERENCES wallets (id),
+			payer_id UUID NOT NULL,
+			amount BIGINT NOT NULL CHECK (amount > 0),
+			currency VARCHAR(3) NOT NULL,
+			note VARCHAR(255) DEFAULT '' NOT NULL,
+			status VARCHAR(20) DEFAULT 'PENDING' NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			transfer_id UUID REFERENCES transfers (id),
+			responded_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_payment_requests_payer ON payment_requests (payer_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_payment_requests_requester ON payment_requests (requester_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_payment_requests_pending ON payment_requests (expires_at) WHERE status = 'PENDING';`,
+		`CREATE TABLE IF NOT EXISTS bill_splits (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			creator_id UUID NOT NULL,
+			creator_wallet_id UUID NOT NULL REFERENCES wallets (id),
+			title VARCHAR(100) NOT NULL,
+			total_amount BIGINT NOT NULL CHECK (total_amount > 0),
+			paid_amount BIGINT DEFAULT 0 NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			status VARCHAR(20) DEFAULT 'OPEN' NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_bill_splits_creator ON bill_splits (creator_id, created_at);`,
+		`CREATE TABLE IF NOT EXISTS bill_split_shares (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			split_id UUID NOT NULL REFERENCES bill_splits (id) ON DELETE CASCADE,
+			user_id UUID NOT NULL,
+			amount BIGINT NOT NULL CHECK (amount > 0),
+			status VARCHAR(20) DEFAULT 'PENDING' NOT NULL,
+			transfer_id UUID REFERENCES transfers (id),
+			paid_at TIMESTAMPTZ,
+			reminded_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (split_id, user_id)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_bill_split_shares_user ON bill_split_shares (user_id);`,
+		`CREATE TABLE IF NOT EXISTS merchants (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL,
+			wallet_id UUID NOT NULL UNIQUE REFERENCES wallets (id),
+			name VARCHAR(25) NOT NULL,
+			city VARCHAR(15) NOT NULL,
+			category_code CHAR(4) NOT NULL,
+			country_code CHAR(2) DEFAULT 'CM' NOT NULL,
+			is_active BOOLEAN DEFAULT TRUE,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS merchant_qr_codes (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			merchant_id UUID NOT NULL REFERENCES merchants (id),
+			amount BIGINT NOT NULL CHECK (amount > 0),
+			currency VARCHAR(3) NOT NULL,
+			reference VARCHAR(25) DEFAULT '' NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			paid_at TIMESTAMPTZ,
+			transfer_id UUID REFERENCES transfers (id),
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS merchant_payments (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			merchant_id UUID NOT NULL REFERENCES merchants (id),
+			qr_code_id UUID UNIQUE REFERENCES merchant_qr_codes (id),
+			transfer_id UUID NOT NULL REFERENCES transfers (id),
+			payer_id UUID NOT NULL,
+			amount BIGINT NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			reference VARCHAR(25) DEFAULT '' NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_merchant_payments_merchant ON merchant_payments (merchant_id, created_at);`,
+		`CREATE TABLE IF NOT EXISTS payment_links (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			merchant_id UUID NOT NULL REFERENCES merchants (id),
+			code VARCHAR(32) NOT NULL UNIQUE,
+			amount BIGINT CHECK (amount > 0),
+			min_amount BIGINT NOT NULL,
+			max_amount BIGINT NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			expires_at TIMESTAMPTZ,
+			max_uses INT CHECK (max_uses > 0),
+			use_count INT DEFAULT 0 NOT NULL,
+			total_collected BIGINT DEFAULT 0 NOT NULL,
+			status VARCHAR(20) DEFAULT 'ACTIVE' NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_payment_links_merchant ON payment_links (merchant_id, created_at);`,
+		`ALTER TABLE merchant_payments ADD COLUMN IF NOT EXISTS link_id UUID REFERENCES payment_links (id);`,
+		`ALTER TABLE merchant_payments ADD COLUMN IF NOT EXISTS payer_reference VARCHAR(100) DEFAULT '' NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_merchant_payments_link ON merchant_payments (link_id) WHERE link_id IS NOT NULL;`,
+		`CREATE TABLE IF NOT EXISTS escrows (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			buyer_id UUID NOT NULL,
+			buyer_wallet_id UUID NOT NULL REFERENCES wallets (id),
+			seller_id UUID NOT NULL,
+			seller_wallet_id UUID NOT NULL REFERENCES wallets (id),
+			amount BIGINT NOT NULL CHECK (amount > 0),
+			currency VARCHAR(3) NOT NULL,
+			reference VARCHAR(100) DEFAULT '' NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			status VARCHAR(20) DEFAULT 'FUNDED' NOT NULL, -- 'FUNDED', 'DISPUTED', 'RELEASED', 'REFUNDED', 'SPLIT'
+			released_amount BIGINT DEFAULT 0 NOT NULL,
+			refunded_amount BIGINT DEFAULT 0 NOT NULL,
+			disputed_by UUID,
+			dispute_reason VARCHAR(500) DEFAULT '' NOT NULL,
+			resolved_by UUID,
+			resolution_note VARCHAR(500) DEFAULT '' NOT NULL,
+			closed_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			CHECK (released_amount + refunded_amount IN (0, amount))
+		);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS uq_escrows_buyer_reference ON escrows (buyer_id, reference) WHERE reference <> '';`,
+		`CREATE INDEX IF NOT EXISTS idx_escrows_buyer ON escrows (buyer_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_escrows_seller ON escrows (seller_id, created_at);`,
+		`CREATE TABLE IF NOT EXISTS disputes (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			transfer_id UUID NOT NULL UNIQUE REFERENCES transfers (id),
+			transfer_source VARCHAR(50) NOT NULL,
+			payer_id UUID NOT NULL,
+			payer_wallet_id UUID NOT NULL REFERENCES wallets (id),
+			recipient_id UUID NOT NULL,
+			recipient_wallet_id UUID NOT NULL REFERENCES wallets (id),
+			amount BIGINT NOT NULL CHECK (amount > 0),
+			currency VARCHAR(3) NOT NULL,
+			category VARCHAR(20) NOT NULL,
+			reason VARCHAR(500) NOT NULL,
+			status VARCHAR(20) DEFAULT 'OPEN' NOT NULL, -- 'OPEN', 'IN_REVIEW', 'RESOLVED_PAYER', 'RESOLVED_RECIPIENT', 'WITHDRAWN'
+			funds VARCHAR(10) DEFAULT 'RECIPIENT' NOT NULL, -- 'RECIPIENT', 'HELD', 'PAYER'
+			resolved_by UUID,
+			resolution_note VARCHAR(500) DEFAULT '' NOT NULL,
+			resolved_at TIMESTAMPTZ,
+			receivable BIGINT DEFAULT 0 NOT NULL, -- taken below zero from a drained wallet
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_disputes_payer ON disputes (payer_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_disputes_recipient ON disputes (recipient_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_disputes_status ON disputes (status, created_at);`,
+		`CREATE TABLE IF NOT EXISTS dispute_evidence (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			dispute_id UUID NOT NULL REFERENCES disputes (id),
+			author_id UUID NOT NULL,
+			author_role VARCHAR(10) NOT NULL, -- 'payer', 'recipient', 'admin'
+			note TEXT NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_dispute_evidence_dispute ON dispute_evidence (dispute_id, created_at);`,
+		`CREATE TABLE IF NOT EXISTS payout_batches (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL,
+			wallet_id UUID NOT NULL REFERENCES wallets (id),
+			currency VARCHAR(3) NOT NULL,
+			filename VARCHAR(255) NOT NULL,
+			status VARCHAR(20) DEFAULT 'DRAFT' NOT NULL, -- 'DRAFT', 'PROCESSING', 'COMPLETED', 'PARTIAL', 'FAILED', 'CANCELED'
+			line_count INT NOT NULL,
+			valid_count INT NOT NULL,
+			total_amount BIGINT NOT NULL,
+			total_fee BIGINT NOT NULL,
+			succeeded_count INT DEFAULT 0 NOT NULL,
+			succeeded_amount BIGINT DEFAULT 0 NOT NULL,
+			succeeded_fee BIGINT DEFAULT 0 NOT NULL,
+			failed_count INT DEFAULT 0 NOT NULL,
+			confirmed_at TIMESTAMPTZ,
+			completed_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_payout_batches_user ON payout_batches (user_id, created_at);`,
+		`CREATE TABLE IF NOT EXISTS payout_lines (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			batch_id UUID NOT NULL REFERENCES payout_batches (id),
+			line INT NOT NULL,
+			recipient_id UUID,
+			amount BIGINT NOT NULL,
+			fee BIGINT DEFAULT 0 NOT NULL,
+			reference VARCHAR(100) DEFAULT '' NOT NULL,
+			status VARCHAR(10) NOT NULL, -- 'VALID', 'INVALID', 'PENDING', 'SUCCEEDED', 'FAILED'
+			error VARCHAR(255) DEFAULT '' NOT NULL,
+			transfer_id UUID REFERENCES transfers (id),
+			fee_transfer_id UUID REFERENCES transfers (id),
+			processed_at TIMESTAMPTZ
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_payout_lines_batch ON payout_lines (batch_id, status, line);`,
+		`CREATE INDEX IF NOT EXISTS idx_payout_lines_pending ON payout_lines (batch_id, line) WHERE status = 'PENDING';`,
+		`CREATE TABLE IF NOT EXISTS organizations (
+			id UUID PRIMARY KEY, -- owner of the wallet, as its user_id
+			name VARCHAR(100) NOT NULL,
+			wallet_id UUID NOT NULL UNIQUE REFERENCES wallets (id),
+			currency VARCHAR(3) NOT NULL,
+			approval_threshold BIGINT DEFAULT 0 NOT NULL,
+			required_approvals INT DEFAULT 1 NOT NULL CHECK (required_approvals > 0),
+			created_by UUID NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS organization_members (
+			organization_id UUID NOT NULL REFERENCES organizations (id),
+			user_id UUID NOT NULL,
+			role VARCHAR(10) NOT NULL, -- 'VIEWER', 'INITIATOR', 'APPROVER', 'ADMIN'
+			added_by UUID NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (organization_id, user_id)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_organization_members_user ON organization_members (user_id);`,
+		`CREATE TABLE IF NOT EXISTS organization_operations (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			organization_id UUID NOT NULL REFERENCES organizations (id),
+			wallet_id UUID NOT NULL REFERENCES wallets (id),
+			kind VARCHAR(20) NOT NULL, -- 'WITHDRAWAL'
+			amount BIGINT NOT NULL CHECK (amount > 0),
+			currency VARCHAR(3) NOT NULL,
+			provider VARCHAR(50) NOT NULL,
+			phone_number VARCHAR(20) NOT NULL,
+			status VARCHAR(10) NOT NULL, -- 'PENDING', 'APPROVED', 'EXECUTING', 'REJECTED', 'CANCELED', 'EXECUTED', 'FAILED'
+			initiated_by UUID NOT NULL,
+			required_approvals INT NOT NULL,
+			approval_count INT DEFAULT 0 NOT NULL,
+			transaction_id UUID REFERENCES transactions (id),
+			error VARCHAR(255) DEFAULT '' NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			executed_at TIMESTAMPTZ
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_organization_operations_organization ON organization_operations (organization_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_organization_operations_approved ON organization_operations (updated_at) WHERE status IN ('APPROVED', 'EXECUTING');`,
+		`CREATE TABLE IF NOT EXISTS organization_operation_decisions (
+			operation_id UUID NOT NULL REFERENCES organization_operations (id),
+			user_id UUID NOT NULL,
+			approved BOOLEAN NOT NULL,
+			note VARCHAR(255) DEFAULT '' NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (operation_id, user_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS dependents (
+			child_id UUID PRIMARY KEY,
+			wallet_id UUID NOT NULL UNIQUE REFERENCES wallets (id),
+			guardian_id UUID NOT NULL,
+			guardian_wallet_id UUID NOT NULL REFERENCES wallets (id),
+			currency VARCHAR(3) NOT NULL,
+			per_transaction_limit BIGINT DEFAULT 0 NOT NULL,
+			daily_limit BIGINT DEFAULT 0 NOT NULL,
+			blocked_categories TEXT[] DEFAULT '{}' NOT NULL,
+			guardian_locked BOOLEAN DEFAULT FALSE NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_dependents_guardian ON dependents (guardian_id);`,
+		`CREATE TABLE IF NOT EXISTS dependent_invitations (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			child_id UUID NOT NULL,
+			guardian_id UUID NOT NULL,
+			guardian_wallet_id UUID NOT NULL REFERENCES wallets (id),
+			currency VARCHAR(3) NOT NULL,
+			status VARCHAR(10) DEFAULT 'PENDING' NOT NULL, -- 'PENDING', 'ACCEPTED', 'DECLINED', 'CANCELED'
+			expires_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			decided_at TIMESTAMPTZ
+		);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_dependent_invitations_pending ON dependent_invitations (child_id, guardian_id) WHERE status = 'PENDING';`,
+		`CREATE INDEX IF NOT EXISTS idx_dependent_invitations_guardian ON dependent_invitations (guardian_id);`,
+		`CREATE TABLE IF NOT EXISTS agents (
+			user_id UUID PRIMARY KEY,
+			wallet_id UUID NOT NULL UNIQUE REFERENCES wallets (id), -- the float
+			name VARCHAR(100) NOT NULL,
+			location VARCHAR(255) DEFAULT '' NOT NULL,
+			status VARCHAR(10) DEFAULT 'ACTIVE' NOT NULL, -- 'ACTIVE', 'SUSPENDED'
+			min_float BIGINT DEFAULT 0 NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS agent_operations (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			agent_id UUID NOT NULL REFERENCES agents (user_id),
+			customer_id UUID NOT NULL,
+			kind VARCHAR(10) NOT NULL, -- 'CASH_IN', 'CASH_OUT'
+			amount BIGINT NOT NULL CHECK (amount > 0),
+			currency VARCHAR(3) NOT NULL,
+			commission BIGINT DEFAULT 0 NOT NULL,
+			reference VARCHAR(100) DEFAULT '' NOT NULL,
+			status VARCHAR(10) NOT NULL, -- 'PENDING', 'COMPLETED', 'EXPIRED', 'FAILED'
+			otp_hash VARCHAR(64) DEFAULT '' NOT NULL,
+			otp_attempts INT DEFAULT 0 NOT NULL,
+			expires_at TIMESTAMPTZ,
+			transfer_id UUID REFERENCES transfers (id),
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			completed_at TIMESTAMPTZ
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_agent_operations_agent ON agent_operations (agent_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_agent_operations_customer ON agent_operations (customer_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_agent_operations_pending ON agent_operations (expires_at) WHERE status = 'PENDING';`,
+		`CREATE INDEX IF NOT EXISTS idx_wallet_logs_wallet_created ON wallet_logs (wallet_id, created_at);`,
+		`CREATE TABLE IF NOT EXISTS agent_daily_summaries (
+			agent_id UUID NOT NULL REFERENCES agents (user_id),
+			day DATE NOT NULL,
+			cash_in_count INT NOT NULL,
+			cash_in_amount BIGINT NOT NULL,
+			cash_out_count INT NOT NULL,
+			cash_out_amount BIGINT NOT NULL,
+			commission BIGINT NOT NULL,
+			opening_float BIGINT NOT NULL,
+			closing_float BIGINT NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (agent_id, day)
+		);`,
+		`CREATE TABLE IF NOT EXISTS commission_rules (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			partner_id UUID, -- every partner when NULL
+			source VARCHAR(50) NOT NULL,
+			tiers JSONB NOT NULL, -- [{"min_amount", "fixed", "bps"}]
+			created_by UUID NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+			disabled_at TIMESTAMPTZ
+		);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_commission_rules_active ON commission_rules (source, COALESCE(partner_id, '00000000-0000-0000-0000-000000000000'))
+			WHERE disabled_at IS NULL;`,
+		`CREATE TABLE IF NOT EXISTS commission_partners (
+			user_id UUID PRIMARY KEY,
+			wallet_id UUID NOT NULL UNIQUE REFERENCES wallets (id),
+			name VARCHAR(100) NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS commission_payouts (
+			id UUID PRIMARY KEY,
+			partner_id UUID NOT NULL,
+			period_start TIMESTAMPTZ NOT NULL,
+			period_end TIMESTAMPTZ NOT NULL,
+			operations INT NOT NULL,
+			amount BIGINT NOT NULL,
+			commission BIGINT NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			transfer_id UUID REFERENCES transfers (id),
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_commission_payouts_partner ON commission_payouts (partner_id, created_at);`,
+		`CREATE TABLE IF NOT EXISTS commission_entries (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			partner_id UUID NOT NULL,
+			wallet_log_id UUID NOT NULL UNIQUE REFERENCES wallet_logs (id),
+			rule_id UUID NOT NULL REFERENCES commission_rules (id),
+			source VARCHAR(50) NOT NULL,
+			amount BIGINT NOT NULL,
+			commission BIGINT NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			status VARCHAR(10) DEFAULT 'ACCRUED' NOT NULL, -- 'ACCRUED', 'PAID'
+			payout_id UUID REFERENCES commission_payouts (id),
+			operation_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_commission_entries_partner ON commission_entries (partner_id, status, operation_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_commission_entries_payout ON commission_entries (payout_id);`,
+		`CREATE TABLE IF NOT EXISTS compliance_reports (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			period_start TIMESTAMPTZ NOT NULL,
+			period_end TIMESTAMPTZ NOT NULL,
+			format VARCHAR(3) NOT NULL, -- 'csv', 'xml'
+			checksum VARCHAR(64) NOT NULL, -- sha256 of content
+			flag_count INTEGER DEFAULT 0 NOT NULL,
+			content BYTEA NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+
+			CONSTRAINT uq_compliance_report_period UNIQUE (period_start, period_end, format)
+		);`,
 	}
 	for _, query := range queries {
 		if _, err := DB.Exec(ctx, query); err != nil {
@@ -47,3 +647,43 @@ func createTables() error {
 	}
 	return nil
 }
+
+// balanceReadBatch is the number of balance reads moved per statement by migrateBalanceReads
+const balanceReadBatch = 5000
+
+// migrateBalanceReads moves the balance reads once logged as wallet activity to the access audit.
+// It runs to completion at startup, in batches each with its own timeout so a large history never holds
+// a long transaction.
+func migrateBalanceReads() error {
+	for {
+		moved, err := migrateBalanceReadBatch()
+		if err != nil {
+			return err
+		}
+		if moved < balanceReadBatch {
+			return nil
+		}
+	}
+}
+
+// migrateBalanceReadBatch moves a batch of balance reads and returns how many were moved
+func migrateBalanceReadBatch() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tag, err := DB.Exec(
+		ctx,
+		`WITH moved AS (
+			DELETE FROM wallet_logs WHERE id IN (
+				SELECT id FROM wallet_logs WHERE activity = 'GET_BALANCE' LIMIT $1 FOR UPDATE SKIP LOCKED
+			) RETURNING user_id, wallet_id, created_at
+		)
+		INSERT INTO access_audits (actor_id, action, resource_id, created_at)
+		SELECT user_id, 'READ_BALANCE', wallet_id, created_at FROM moved`,
+		balanceReadBatch,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
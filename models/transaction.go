@@ -0,0 +1,464 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"slices"
+	"time"
+)
+
+// Transaction statuses
+const (
+	TransactionPending    = "PENDING"
+	TransactionProcessing = "PROCESSING"
+	TransactionCompleted  = "COMPLETED"
+	TransactionFailed     = "FAILED"
+	TransactionReversed   = "REVERSED"
+)
+
+// Transaction types
+const (
+	TransactionDeposit    = "DEPOSIT"
+	TransactionWithdrawal = "WITHDRAWAL"
+)
+
+// Activities of asynchronous withdrawals
+const (
+	ActivityWithdrawalHold    = "WITHDRAWAL_HOLD"
+	ActivityWithdrawalRelease = "WITHDRAWAL_RELEASE"
+)
+
+// transactionTransitions lists the statuses reachable from each status
+var transactionTransitions = map[string][]string{
+	TransactionPending:    {TransactionProcessing, TransactionCompleted, TransactionFailed},
+	TransactionProcessing: {TransactionCompleted, TransactionFailed},
+	TransactionCompleted:  {TransactionReversed},
+}
+
+// ErrInvalidTransition is returned when a status change is not allowed
+var ErrInvalidTransition = errors.New("invalid transaction status transition")
+
+// Transaction is the struct for an asynchronous wallet transaction
+type Transaction struct {
+	ID                uuid.UUID  `json:"id" db:"id,omitempty"`
+	UserID            uuid.UUID  `json:"user_id" db:"user_id"`
+	WalletID          uuid.UUID  `json:"wallet_id" db:"wallet_id"`
+	Type              string     `json:"type" db:"type"`
+	Amount            int64      `json:"amount" db:"amount"`
+	Currency          string     `json:"currency" db:"currency"`
+	Status            string     `json:"status" db:"status"`
+	Provider          string     `json:"provider,omitempty" db:"provider"`
+	ProviderReference string     `json:"provider_reference,omitempty" db:"provider_reference"`
+	FailureReason     string     `json:"failure_reason,omitempty" db:"failure_reason"`
+	LogID             *uuid.UUID `json:"log_id,omitempty" db:"log_id"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt         time.Time  `json:"updated_at" db:"updated_at,omitempty"`
+
+	// PreviousStatus is the status before the last UpdateStatus call
+	PreviousStatus string `json:"-" db:"-"`
+}
+
+// TransactionStatusRequest is the struct for a transaction status update
+type TransactionStatusRequest struct {
+	TransactionID     uuid.UUID `json:"transaction_id" binding:"required"`
+	Status            string    `json:"status" binding:"required,oneof=PROCESSING COMPLETED FAILED REVERSED"`
+	ProviderReference string    `json:"provider_reference"`
+	Reason            string    `json:"reason" binding:"max=255"`
+}
+
+// transactionColumns is the column list scanned by scanTransaction
+const transactionColumns = `id, user_id, wallet_id, type, amount, currency, status, provider, provider_reference, failure_reason, log_id, created_at, updated_at`
+
+// scanTransaction scans a transaction row
+func scanTransaction(row pgx.Row) (*Transaction, error) {
+	t := &Transaction{}
+	err := row.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.WalletID,
+		&t.Type,
+		&t.Amount,
+		&t.Currency,
+		&t.Status,
+		&t.Provider,
+		&t.ProviderReference,
+		&t.FailureReason,
+		&t.LogID,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// CreateWithdrawal creates a pending withdrawal and holds the funds
+func (t *Transaction) CreateWithdrawal() (*Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	transaction, err := t.holdWithdrawal(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// holdWithdrawal inserts a pending withdrawal and holds the funds inside an existing transaction
+func (t *Transaction) holdWithdrawal(ctx context.Context, tx pgx.Tx) (*Transaction, error) {
+	// Move the amount from the balance to the held balance
+	var oldBalance, newBalance int64
+	var currency string
+	err := tx.QueryRow(
+		ctx,
+		`UPDATE wallets SET balance = balance - $1, held_balance = held_balance + $1
+		WHERE user_id = $2 AND id = $3 AND is_active = true AND locked = false AND balance >= $1
+		RETURNING balance + $1, balance, currency`,
+		t.Amount,
+		t.UserID,
+		t.WalletID,
+	).Scan(&oldBalance, &newBalance, &currency)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInsufficientFunds
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDependentSpending(ctx, tx, t.WalletID, uuid.Nil, t.Amount); err != nil {
+		return nil, err
+	}
+
+	t.Type = TransactionWithdrawal
+	t.Currency = currency
+	transaction, err := t.insert(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	holdLog := WalletLog{
+		UserID:         t.UserID,
+		WalletID:       t.WalletID,
+		Activity:       ActivityWithdrawalHold,
+		OldBalance:     oldBalance,
+		NewBalance:     newBalance,
+		ActivityAmount: t.Amount,
+		Currency:       currency,
+		Metadata:       transactionMetadata(transaction, "withdrawal"),
+	}
+	if err := holdLog.insert(ctx, tx); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// CreateDeposit creates a pending deposit, the wallet is credited on completion
+func (t *Transaction) CreateDeposit() (*Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	err = tx.QueryRow(
+		ctx,
+		`SELECT currency FROM wallets WHERE user_id = $1 AND id = $2 AND is_active = true`,
+		t.UserID,
+		t.WalletID,
+	).Scan(&t.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Type = TransactionDeposit
+	transaction, err := t.insert(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// insert writes a pending transaction inside an existing transaction
+func (t *Transaction) insert(ctx context.Context, tx pgx.Tx) (*Transaction, error) {
+	return scanTransaction(tx.QueryRow(
+		ctx,
+		`INSERT INTO transactions (user_id, wallet_id, type, amount, currency, status, provider, provider_reference)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING `+transactionColumns,
+		t.UserID,
+		t.WalletID,
+		t.Type,
+		t.Amount,
+		t.Currency,
+		TransactionPending,
+		t.Provider,
+		t.ProviderReference,
+	))
+}
+
+// GetTransaction gets a transaction by id
+func (t *Transaction) GetTransaction() (*Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanTransaction(DB.QueryRow(
+		ctx,
+		`SELECT `+transactionColumns+` FROM transactions WHERE id = $1`,
+		t.ID,
+	))
+}
+
+// UpdateStatus moves the transaction to a new status and settles or releases the funds.
+// Setting the current status again is a no-op so provider retries are safe.
+func (r *TransactionStatusRequest) UpdateStatus() (*Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	transaction, err := r.apply(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// apply changes the transaction status inside an existing transaction
+func (r *TransactionStatusRequest) apply(ctx context.Context, tx pgx.Tx) (*Transaction, error) {
+	// Lock the transaction so concurrent callbacks are serialized
+	t, err := scanTransaction(tx.QueryRow(
+		ctx,
+		`SELECT `+transactionColumns+` FROM transactions WHERE id = $1 FOR UPDATE`,
+		r.TransactionID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if t.Status == r.Status {
+		t.PreviousStatus = t.Status
+		return t, nil
+	}
+	if !slices.Contains(transactionTransitions[t.Status], r.Status) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, t.Status, r.Status)
+	}
+
+	var logID *uuid.UUID
+	switch {
+	case r.Status == TransactionCompleted && t.Type == TransactionDeposit:
+		// Credit the wallet with the deposited amount
+		w := Wallet{ID: t.WalletID, UserID: t.UserID}
+		wallet, err := w.recharge(ctx, tx, t.Amount)
+		if err != nil {
+			return nil, err
+		}
+		l := WalletLog{
+			UserID:         t.UserID,
+			WalletID:       t.WalletID,
+			Activity:       ActivityTopup,
+			OldBalance:     wallet.Balance - t.Amount,
+			NewBalance:     wallet.Balance,
+			ActivityAmount: t.Amount,
+			Currency:       wallet.Currency,
+			Metadata:       transactionMetadata(t, "deposit"),
+		}
+		if err := l.insert(ctx, tx); err != nil {
+			return nil, err
+		}
+		logID = &l.ID
+
+	case r.Status == TransactionCompleted && t.Type == TransactionWithdrawal:
+		// Settle the held funds, the balance was debited when the hold was taken
+		var balance int64
+		err := tx.QueryRow(
+			ctx,
+			`UPDATE wallets SET held_balance = held_balance - $1 WHERE id = $2 RETURNING balance`,
+			t.Amount,
+			t.WalletID,
+		).Scan(&balance)
+		if err != nil {
+			return nil, err
+		}
+		l := WalletLog{
+			UserID:         t.UserID,
+			WalletID:       t.WalletID,
+			Activity:       ActivityWithdrawal,
+			OldBalance:     balance,
+			NewBalance:     balance,
+			ActivityAmount: t.Amount,
+			Currency:       t.Currency,
+			Metadata:       transactionMetadata(t, "withdrawal"),
+		}
+		if err := l.insert(ctx, tx); err != nil {
+			return nil, err
+		}
+		logID = &l.ID
+
+	case r.Status == TransactionFailed && t.Type == TransactionWithdrawal:
+		// Release the held funds back to the balance
+		var balance int64
+		err := tx.QueryRow(
+			ctx,
+			`UPDATE wallets SET balance = balance + $1, held_balance = held_balance - $1 WHERE id = $2 RETURNING balance`,
+			t.Amount,
+			t.WalletID,
+		).Scan(&balance)
+		if err != nil {
+			return nil, err
+		}
+		l := WalletLog{
+			UserID:         t.UserID,
+			WalletID:       t.WalletID,
+			Activity:       ActivityWithdrawalRelease,
+			OldBalance:     balance - t.Amount,
+			NewBalance:     balance,
+			ActivityAmount: t.Amount,
+			Currency:       t.Currency,
+			Metadata:       transactionMetadata(t, "withdrawal"),
+		}
+		if err := l.insert(ctx, tx); err != nil {
+			return nil, err
+		}
+
+	case r.Status == TransactionReversed:
+		// Refund the remaining amount of the settled operation
+		if t.LogID == nil {
+			return nil, ErrNotReversible
+		}
+		reversal := ReversalRequest{
+			LogID:          *t.LogID,
+			Reason:         r.Reason,
+			IdempotencyKey: "transaction:" + t.ID.String(),
+			forced:         true,
+		}
+		if _, err := reversal.reverse(ctx, tx, "transaction"); err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := scanTransaction(tx.QueryRow(
+		ctx,
+		`UPDATE transactions SET status = $1, failure_reason = $2,
+			provider_reference = COALESCE(NULLIF($3, ''), provider_reference),
+			log_id = COALESCE($4, log_id), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5 RETURNING `+transactionColumns,
+		r.Status,
+		r.Reason,
+		r.ProviderReference,
+		logID,
+		t.ID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	updated.PreviousStatus = t.Status
+	return updated, nil
+}
+
+// transactionMetadata builds the wallet log metadata of a transaction
+func transactionMetadata(t *Transaction, source string) string {
+	metadata, _ := json.Marshal(map[string]any{
+		"source":         source,
+		"transaction_id": t.ID,
+		"provider":       t.Provider,
+	})
+	return string(metadata)
+}
+
+// GetTransactionByProviderReference gets a transaction by its provider reference
+func GetTransactionByProviderReference(provider, reference string) (*Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return scanTransaction(DB.QueryRow(
+		ctx,
+		`SELECT `+transactionColumns+` FROM transactions WHERE provider = $1 AND provider_reference = $2`,
+		provider,
+		reference,
+	))
+}
+
+// SetProviderReference stores the provider reference of a pending transaction before the payment is sent
+func SetProviderReference(transactionID uuid.UUID, reference string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tag, err := DB.Exec(
+		ctx,
+		`UPDATE transactions SET provider_reference = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND status = 'PENDING'`,
+		reference,
+		transactionID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// GetInFlightTransactions lists provider transactions not updated since before
+func GetInFlightTransactions(before time.Time, limit int) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT `+transactionColumns+` FROM transactions
+		WHERE status IN ('PENDING', 'PROCESSING') AND provider <> '' AND provider_reference <> '' AND updated_at < $1
+		ORDER BY updated_at LIMIT $2`,
+		before,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := make([]Transaction, 0)
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, *t)
+	}
+	return transactions, nil
+}
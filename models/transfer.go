@@ -0,0 +1,196 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Transfer activities recorded in wallet_logs
+const (
+	ActivityTransferOut = "TRANSFER_OUT"
+	ActivityTransferIn  = "TRANSFER_IN"
+)
+
+// Transfer errors
+var (
+	ErrSameWallet       = errors.New("cannot transfer to the same wallet")
+	ErrCurrencyMismatch = errors.New("wallets have different currencies")
+	ErrTransferExists   = errors.New("transfer already made")
+)
+
+// Transfer is the struct for an internal move between two wallets
+type Transfer struct {
+	ID             uuid.UUID  `json:"id" db:"id,omitempty"`
+	FromWalletID   uuid.UUID  `json:"from_wallet_id" db:"from_wallet_id"` // resolved from FromUserID when empty
+	FromUserID     uuid.UUID  `json:"from_user_id" db:"from_user_id"`
+	ToWalletID     uuid.UUID  `json:"to_wallet_id" db:"to_wallet_id"` // resolved from ToUserID when empty
+	ToUserID       uuid.UUID  `json:"to_user_id" db:"to_user_id"`
+	Amount         int64      `json:"amount" db:"amount"`
+	Currency       string     `json:"currency" db:"currency"`
+	Source         string     `json:"source" db:"source"`       // feature that made the transfer
+	SourceID       *uuid.UUID `json:"source_id" db:"source_id"` // e.g. the standing order
+	IdempotencyKey *string    `json:"-" db:"idempotency_key"`
+	FromBalance    int64      `json:"from_balance" db:"-"`
+	ToBalance      int64      `json:"-" db:"-"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at,omitempty"`
+}
+
+// CreateTransfer moves money between two wallets in one transaction
+func (t *Transfer) CreateTransfer() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // no-op if already committed
+	}()
+
+	if err := t.transfer(ctx, tx); err != nil {
+		return err
+	}
+
+	// Then commit transaction
+	return tx.Commit(ctx)
+}
+
+// transfer debits the sender and credits the receiver inside an existing transaction.
+// Both wallets are locked in id order so opposite transfers cannot deadlock.
+func (t *Transfer) transfer(ctx context.Context, tx pgx.Tx) error {
+	var err error
+	if t.FromWalletID == uuid.Nil {
+		if t.FromWalletID, err = activeWalletID(ctx, tx, t.FromUserID); err != nil {
+			return err
+		}
+	}
+	if t.ToWalletID == uuid.Nil {
+		if t.ToWalletID, err = activeWalletID(ctx, tx, t.ToUserID); err != nil {
+			return err
+		}
+	}
+	if t.FromWalletID == t.ToWalletID {
+		return ErrSameWallet
+	}
+
+	rows, err := tx.Query(
+		ctx,
+		`SELECT id, user_id, balance, currency, locked FROM wallets WHERE id IN ($1, $2) AND is_active = true ORDER BY id FOR UPDATE`,
+		t.FromWalletID,
+		t.ToWalletID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	wallets := make([]Wallet, 0, 2)
+	for rows.Next() {
+		w := Wallet{}
+		if err := rows.Scan(&w.ID, &w.UserID, &w.Balance, &w.Currency, &w.Locked); err != nil {
+			return err
+		}
+		wallets = append(wallets, w)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	if len(wallets) != 2 {
+		return pgx.ErrNoRows
+	}
+	from, to := wallets[0], wallets[1]
+	if from.ID != t.FromWalletID {
+		from, to = to, from
+	}
+
+	switch {
+	case from.UserID != t.FromUserID:
+		return pgx.ErrNoRows
+	case from.Locked:
+		return ErrWalletLocked
+	case from.Currency != to.Currency:
+		return ErrCurrencyMismatch
+	case from.Balance < t.Amount:
+		return ErrInsufficientFunds
+	}
+	if err := checkDependentSpending(ctx, tx, from.ID, to.ID, t.Amount); err != nil {
+		return err
+	}
+	t.ToUserID = to.UserID
+	t.Currency = from.Currency
+
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO transfers (from_wallet_id, from_user_id, to_wallet_id, to_user_id, amount, currency, source, source_id, idempotency_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (idempotency_key) DO NOTHING RETURNING id, created_at`,
+		t.FromWalletID,
+		t.FromUserID,
+		t.ToWalletID,
+		t.ToUserID,
+		t.Amount,
+		t.Currency,
+		t.Source,
+		t.SourceID,
+		t.IdempotencyKey,
+	).Scan(&t.ID, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTransferExists
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE wallets SET balance = balance - $1 WHERE id = $2`, t.Amount, from.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE wallets SET balance = balance + $1 WHERE id = $2`, t.Amount, to.ID); err != nil {
+		return err
+	}
+	t.FromBalance = from.Balance - t.Amount
+	t.ToBalance = to.Balance + t.Amount
+
+	// One log on each side, both referencing the transfer
+	for _, side := range []struct {
+		wallet     uuid.UUID
+		user       uuid.UUID
+		other      uuid.UUID
+		activity   string
+		oldBalance int64
+		newBalance int64
+	}{
+		{from.ID, from.UserID, to.UserID, ActivityTransferOut, from.Balance, t.FromBalance},
+		{to.ID, to.UserID, from.UserID, ActivityTransferIn, to.Balance, t.ToBalance},
+	} {
+		metadata, err := json.Marshal(map[string]string{"source": t.Source, "counterparty_user_id": side.other.String()})
+		if err != nil {
+			return err
+		}
+		walletLog := WalletLog{
+			UserID:         side.user,
+			WalletID:       side.wallet,
+			Activity:       side.activity,
+			OldBalance:     side.oldBalance,
+			NewBalance:     side.newBalance,
+			ActivityAmount: t.Amount,
+			Currency:       t.Currency,
+			Metadata:       string(metadata),
+			ReferenceID:    &t.ID,
+		}
+		if err := walletLog.insert(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activeWalletID returns the active wallet of a user
+func activeWalletID(ctx context.Context, tx pgx.Tx, userID uuid.UUID) (uuid.UUID, error) {
+	var walletID uuid.UUID
+	err := tx.QueryRow(ctx, `SELECT id FROM wallets WHERE user_id = $1 AND is_active = true`, userID).Scan(&walletID)
+	return walletID, err
+}
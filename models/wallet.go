@@ -2,49 +2,72 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"time"
 )
 
+// Wallet activities recorded in wallet_logs
+const (
+	ActivityTopup      = "TOPUP_WALLET"
+	ActivityWithdrawal = "WITHDRAWAL"
+	ActivityLock       = "LOCK_WALLET"
+	ActivityUnlock     = "UNLOCK_WALLET"
+	ActivityReversal   = "REVERSAL"
+)
+
+// ErrInsufficientFunds is returned when a wallet cannot cover a debit
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
 // Wallet is the struct for a wallet
 type Wallet struct {
-	ID        uuid.UUID `json:"id" db:"id,omitempty"`
-	UserID    uuid.UUID `json:"user_id" db:"user_id" binding:"required"`
-	Balance   int64     `json:"balance" db:"balance"`
-	Currency  string    `json:"currency" db:"currency" binding:"alpha,oneof=XAF,USD,XOF"`
-	Locked    bool      `json:"locked" db:"locked"`
-	IsActive  bool      `json:"is_active" db:"is_active"`
-	CreatedAt time.Time `json:"created_at" db:"created_at,omitempty"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at,omitempty"`
+	ID          uuid.UUID `json:"id" db:"id,omitempty"`
+	UserID      uuid.UUID `json:"user_id" db:"user_id" binding:"required"`
+	Balance     int64     `json:"balance" db:"balance"`
+	HeldBalance int64     `json:"held_balance" db:"held_balance"`
+	Currency    string    `json:"currency" db:"currency" binding:"alpha,oneof=XAF,USD,XOF"`
+	Locked      bool      `json:"locked" db:"locked"`
+	IsActive    bool      `json:"is_active" db:"is_active"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at,omitempty"`
 }
 
 // WalletLog is the struct for a wallet log
 type WalletLog struct {
-	ID             uuid.UUID `json:"id" db:"id,omitempty"`
-	UserID         uuid.UUID `json:"user_id" db:"user_id"`
-	WalletID       uuid.UUID `json:"wallet_id" db:"wallet_id"`
-	Activity       string    `json:"activity" db:"activity"`
-	OldBalance     int64     `json:"old_balance" db:"old_balance"`
-	NewBalance     int64     `json:"new_balance" db:"new_balance"`
-	ActivityAmount int64     `json:"activity_amount" db:"activity_amount"`
-	Currency       string    `json:"currency" db:"currency"`
-	Metadata       string    `json:"metadata" db:"metadata"`
-	CreatedAt      time.Time `json:"created_at" db:"created_at,omitempty"`
+	ID             uuid.UUID  `json:"id" db:"id,omitempty"`
+	UserID         uuid.UUID  `json:"user_id" db:"user_id"`
+	WalletID       uuid.UUID  `json:"wallet_id" db:"wallet_id"`
+	Activity       string     `json:"activity" db:"activity"`
+	OldBalance     int64      `json:"old_balance" db:"old_balance"`
+	NewBalance     int64      `json:"new_balance" db:"new_balance"`
+	ActivityAmount int64      `json:"activity_amount" db:"activity_amount"`
+	Currency       string     `json:"currency" db:"currency"`
+	Metadata       string     `json:"metadata" db:"metadata"`
+	ReferenceID    *uuid.UUID `json:"reference_id,omitempty" db:"reference_id"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at,omitempty"`
 }
 
 // WalletResponse is the struct for a wallet response
 type WalletResponse struct {
-	ID       uuid.UUID `json:"id"`
-	Currency string    `json:"currency"`
-	Balance  int64     `json:"balance"`
+	ID          uuid.UUID `json:"id"`
+	Currency    string    `json:"currency"`
+	Balance     int64     `json:"balance"`
+	HeldBalance int64     `json:"held_balance,omitempty"`
+
+	// TotalBalance is the main balance plus the pockets, only the main balance can be withdrawn
+	TotalBalance int64    `json:"total_balance"`
+	Pockets      []Pocket `json:"pockets,omitempty"`
 }
 
 // Request is the struct for a request
 type Request struct {
-	Amount   int64     `json:"amount" binding:"required,numeric,gt=0,min=100,max=2000000"`
-	UserID   uuid.UUID `json:"user_id" binding:"required"`
-	WalletID uuid.UUID `json:"wallet_id" binding:"required"`
+	Amount      int64     `json:"amount" binding:"required,numeric,gt=0,min=100,max=2000000"`
+	UserID      uuid.UUID `json:"user_id" binding:"required"`
+	WalletID    uuid.UUID `json:"wallet_id" binding:"required"`
+	Provider    string    `json:"provider" binding:"required,max=50"`
+	PhoneNumber string    `json:"phone_number" binding:"required,e164"`
 }
 
 // LockRequest is the struct for a lock request
@@ -61,9 +84,11 @@ type UnLockRequest struct {
 
 // WithdrawRequest is the struct for a withdrawal request
 type WithdrawRequest struct {
-	Amount   int64     `json:"amount" binding:"required,numeric,gt=0,min=100,max=2000000"`
-	UserID   uuid.UUID `json:"user_id" binding:"required"`
-	WalletID uuid.UUID `json:"wallet_id" binding:"required"`
+	Amount      int64     `json:"amount" binding:"required,numeric,gt=0,min=100,max=2000000"`
+	UserID      uuid.UUID `json:"user_id" binding:"required"`
+	WalletID    uuid.UUID `json:"wallet_id" binding:"required"`
+	Provider    string    `json:"provider" binding:"required,max=50"`
+	PhoneNumber string    `json:"phone_number" binding:"required,e164"`
 }
 
 // CreateWallet creates a new wallet
@@ -101,8 +126,8 @@ func (w *Wallet) CreateWallet() (*Wallet, error) {
 	return &newWallet, nil
 }
 
-// LockWallet locks a wallet
-func (w *Wallet) LockWallet() error {
+// LockWallet locks a wallet for a caller and logs it
+func (w *Wallet) LockWallet(callerID uuid.UUID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
@@ -115,12 +140,7 @@ func (w *Wallet) LockWallet() error {
 	}()
 
 	// Lock wallet
-	_, err = tx.Exec(
-		ctx,
-		`UPDATE wallets SET locked = true WHERE user_id = $1 AND is_active = true`,
-		w.UserID,
-	)
-	if err != nil {
+	if err := w.setLocked(ctx, tx, true, callerID); err != nil {
 		return err
 	}
 
@@ -132,8 +152,8 @@ func (w *Wallet) LockWallet() error {
 	return nil
 }
 
-// UnlockWallet unlocks a wallet
-func (w *Wallet) UnlockWallet() error {
+// UnlockWallet unlocks a wallet for a caller and logs it
+func (w *Wallet) UnlockWallet(callerID uuid.UUID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
@@ -146,21 +166,53 @@ func (w *Wallet) UnlockWallet() error {
 	}()
 
 	// Unlock wallet
-	_, err = tx.Exec(
+	if err := w.setLocked(ctx, tx, false, callerID); err != nil {
+		return err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// setLocked locks or unlocks the wallet and logs it inside an existing transaction.
+// A guardian caller also sets or lifts the guardian lock of its child.
+func (w *Wallet) setLocked(ctx context.Context, tx pgx.Tx, locked bool, callerID uuid.UUID) error {
+	var wallet Wallet
+	err := tx.QueryRow(
 		ctx,
-		`UPDATE wallets SET locked = false WHERE user_id = $1 AND id = $2 AND is_active = true`,
+		`UPDATE wallets SET locked = $1 WHERE user_id = $2 AND id = $3 AND is_active = true RETURNING id, balance, currency`,
+		locked,
 		w.UserID,
 		w.ID,
+	).Scan(
+		&wallet.ID,
+		&wallet.Balance,
+		&wallet.Currency,
 	)
 	if err != nil {
 		return err
 	}
 
-	// Then commit transaction
-	if err := tx.Commit(ctx); err != nil {
+	walletLog := WalletLog{
+		UserID:         w.UserID,
+		WalletID:       wallet.ID,
+		Activity:       ActivityLock,
+		OldBalance:     wallet.Balance,
+		NewBalance:     wallet.Balance,
+		ActivityAmount: 0,
+		Currency:       wallet.Currency,
+		Metadata:       `{"source": "lock_wallet"}`,
+	}
+	if !locked {
+		walletLog.Activity, walletLog.Metadata = ActivityUnlock, `{"source": "unlock_wallet"}`
+	}
+	if err := walletLog.insert(ctx, tx); err != nil {
 		return err
 	}
-	return nil
+	return setGuardianLock(ctx, tx, w.UserID, callerID, locked)
 }
 
 // GetBalance gets a wallet balance
@@ -172,11 +224,12 @@ func (w *Wallet) GetBalance() (*Wallet, error) {
 
 	err := DB.QueryRow(
 		ctx,
-		`SELECT id, balance, currency FROM wallets WHERE user_id = $1 AND is_active = true`,
+		`SELECT id, balance, held_balance, currency FROM wallets WHERE user_id = $1 AND is_active = true`,
 		w.UserID,
 	).Scan(
 		&wallet.ID,
 		&wallet.Balance,
+		&wallet.HeldBalance,
 		&wallet.Currency,
 	)
 	if err != nil {
@@ -186,7 +239,7 @@ func (w *Wallet) GetBalance() (*Wallet, error) {
 	return wallet, nil
 }
 
-// RechargeWallet recharges a wallet
+// RechargeWallet recharges a wallet and logs the deposit
 func (w *Wallet) RechargeWallet(amount int64) (*Wallet, error) {
 	if amount <= 0 {
 		return nil, fmt.Errorf("invalid amount")
@@ -204,8 +257,35 @@ func (w *Wallet) RechargeWallet(amount int64) (*Wallet, error) {
 	}()
 
 	// Recharge wallet
+	wallet, err := w.recharge(ctx, tx, amount)
+	if err != nil {
+		return nil, err
+	}
+	walletLog := WalletLog{
+		UserID:         w.UserID,
+		WalletID:       wallet.ID,
+		Activity:       ActivityTopup,
+		OldBalance:     wallet.Balance - amount,
+		NewBalance:     wallet.Balance,
+		ActivityAmount: amount,
+		Currency:       wallet.Currency,
+		Metadata:       `{"source": "nats_deposit"}`,
+	}
+	if err := walletLog.insert(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// recharge credits the wallet inside an existing transaction
+func (w *Wallet) recharge(ctx context.Context, tx pgx.Tx, amount int64) (*Wallet, error) {
 	var wallet Wallet
-	err = tx.QueryRow(
+	err := tx.QueryRow(
 		ctx,
 		`UPDATE wallets SET balance = balance + $1 WHERE user_id = $2 AND id = $3 AND is_active = true RETURNING id, balance, currency`, amount, w.UserID, w.ID,
 	).Scan(
@@ -216,18 +296,13 @@ func (w *Wallet) RechargeWallet(amount int64) (*Wallet, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	// Then commit transaction
-	if err := tx.Commit(ctx); err != nil {
-		return nil, err
-	}
 	return &wallet, nil
 }
 
-// WithdrawWallet withdraws from a wallet
+// WithdrawWallet withdraws from a wallet and logs the withdrawal
 func (w *Wallet) WithdrawWallet(amount int64) (*Wallet, error) {
-	if amount > w.Balance {
-		return nil, fmt.Errorf("insufficient funds")
+	if amount <= 0 {
+		return nil, fmt.Errorf("invalid amount")
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
@@ -244,7 +319,8 @@ func (w *Wallet) WithdrawWallet(amount int64) (*Wallet, error) {
 	var wallet Wallet
 	err = tx.QueryRow(
 		ctx,
-		`UPDATE wallets SET balance = balance - $1 WHERE user_id = $2 AND id = $3 AND is_active = true AND locked = false RETURNING id, balance, currency`,
+		`UPDATE wallets SET balance = balance - $1
+		WHERE user_id = $2 AND id = $3 AND is_active = true AND locked = false AND balance >= $1 RETURNING id, balance, currency`,
 		amount,
 		w.UserID,
 		w.ID,
@@ -253,9 +329,28 @@ func (w *Wallet) WithdrawWallet(amount int64) (*Wallet, error) {
 		&wallet.Balance,
 		&wallet.Currency,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInsufficientFunds
+	}
 	if err != nil {
 		return nil, err
 	}
+	if err := checkDependentSpending(ctx, tx, wallet.ID, uuid.Nil, amount); err != nil {
+		return nil, err
+	}
+	walletLog := WalletLog{
+		UserID:         w.UserID,
+		WalletID:       wallet.ID,
+		Activity:       ActivityWithdrawal,
+		OldBalance:     wallet.Balance + amount,
+		NewBalance:     wallet.Balance,
+		ActivityAmount: amount,
+		Currency:       wallet.Currency,
+		Metadata:       `{"source": "nats_withdraw"}`,
+	}
+	if err := walletLog.insert(ctx, tx); err != nil {
+		return nil, err
+	}
 
 	// Then commit transaction
 	if err := tx.Commit(ctx); err != nil {
@@ -264,6 +359,37 @@ func (w *Wallet) WithdrawWallet(amount int64) (*Wallet, error) {
 	return &wallet, nil
 }
 
+// GetWalletOwner returns the user owning a wallet
+func GetWalletOwner(walletID uuid.UUID) (uuid.UUID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var userID uuid.UUID
+	err := DB.QueryRow(ctx, `SELECT user_id FROM wallets WHERE id = $1`, walletID).Scan(&userID)
+	return userID, err
+}
+
+// GetWalletBalance gets the balance of a wallet by id, active or not
+func GetWalletBalance(walletID uuid.UUID) (*Wallet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	wallet := &Wallet{ID: walletID}
+	err := DB.QueryRow(
+		ctx,
+		`SELECT balance, held_balance, currency FROM wallets WHERE id = $1`,
+		walletID,
+	).Scan(
+		&wallet.Balance,
+		&wallet.HeldBalance,
+		&wallet.Currency,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
 // WalletIsLocked checks if a wallet is locked
 func (w *Wallet) WalletIsLocked() bool {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -284,34 +410,47 @@ func (w *Wallet) WalletIsLocked() bool {
 	return locked
 }
 
-// DeleteWallet deletes a wallet
-func (w *Wallet) DeleteWallet() error {
+// DeleteWallet deletes the wallets of a user and returns their ids
+func (w *Wallet) DeleteWallet() ([]uuid.UUID, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
 	tx, err := DB.Begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
 		_ = tx.Rollback(ctx) // no-op if already committed
 	}()
 
 	// Delete wallet
-	_, err = tx.Exec(
+	rows, err := tx.Query(
 		ctx,
-		`UPDATE wallets SET is_active = false, locked = true WHERE user_id = $1`,
+		`UPDATE wallets SET is_active = false, locked = true WHERE user_id = $1 RETURNING id`,
 		w.UserID,
 	)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	walletIDs := make([]uuid.UUID, 0, 1)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		walletIDs = append(walletIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
 	// Then commit transaction
 	if err := tx.Commit(ctx); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return walletIDs, nil
 }
 
 // CreateWalletLog creates a new wallet log
@@ -328,9 +467,22 @@ func (wl *WalletLog) CreateWalletLog() error {
 	}()
 
 	// Create wallet log
-	_, err = tx.Exec(
+	if err := wl.insert(ctx, tx); err != nil {
+		return err
+	}
+
+	// Then commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// insert writes the wallet log inside an existing transaction and links it to the wallet hash chain
+func (wl *WalletLog) insert(ctx context.Context, tx pgx.Tx) error {
+	err := tx.QueryRow(
 		ctx,
-		`INSERT INTO wallet_logs (user_id, wallet_id, activity, old_balance, new_balance, activity_amount, currency, metadata) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		`INSERT INTO wallet_logs (user_id, wallet_id, activity, old_balance, new_balance, activity_amount, currency, metadata, reference_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at`,
 		wl.UserID,
 		wl.WalletID,
 		wl.Activity,
@@ -339,16 +491,12 @@ func (wl *WalletLog) CreateWalletLog() error {
 		wl.ActivityAmount,
 		wl.Currency,
 		wl.Metadata,
-	)
+		wl.ReferenceID,
+	).Scan(&wl.ID, &wl.CreatedAt)
 	if err != nil {
 		return err
 	}
-
-	// Then commit transaction
-	if err := tx.Commit(ctx); err != nil {
-		return err
-	}
-	return nil
+	return chainWalletLogs(ctx, tx, wl.WalletID)
 }
 
 // GetWalletLogs gets a wallet logs
@@ -358,7 +506,7 @@ func (wl *WalletLog) GetWalletLogs() ([]WalletLog, error) {
 
 	rows, err := DB.Query(
 		ctx,
-		`SELECT id, user_id, wallet_id, activity, old_balance, new_balance, activity_amount, currency, metadata, created_at FROM wallet_logs ORDER BY created_at DESC`,
+		`SELECT id, user_id, wallet_id, activity, old_balance, new_balance, activity_amount, currency, metadata, reference_id, created_at FROM wallet_logs ORDER BY created_at DESC`,
 	)
 	if err != nil {
 		return nil, err
@@ -378,6 +526,7 @@ func (wl *WalletLog) GetWalletLogs() ([]WalletLog, error) {
 			&walletLog.ActivityAmount,
 			&walletLog.Currency,
 			&walletLog.Metadata,
+			&walletLog.ReferenceID,
 			&walletLog.CreatedAt,
 		)
 		if err != nil {
@@ -395,7 +544,7 @@ func (wl *WalletLog) GetWalletLogsByUser() ([]WalletLog, error) {
 
 	rows, err := DB.Query(
 		ctx,
-		`SELECT id, user_id, wallet_id, activity, old_balance, new_balance, activity_amount, currency, metadata, created_at FROM wallet_logs WHERE user_id = $1 ORDER BY created_at DESC`,
+		`SELECT id, user_id, wallet_id, activity, old_balance, new_balance, activity_amount, currency, metadata, reference_id, created_at FROM wallet_logs WHERE user_id = $1 ORDER BY created_at DESC`,
 		wl.UserID,
 	)
 	if err != nil {
@@ -416,6 +565,7 @@ func (wl *WalletLog) GetWalletLogsByUser() ([]WalletLog, error) {
 			&walletLog.ActivityAmount,
 			&walletLog.Currency,
 			&walletLog.Metadata,
+			&walletLog.ReferenceID,
 			&walletLog.CreatedAt,
 		)
 		if err != nil {
@@ -0,0 +1,270 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "PENDING"
+	DeliveryDelivered = "DELIVERED"
+	DeliveryDead      = "DEAD" // dead-letter, retries exhausted
+)
+
+// WebhookSubscription is the struct for a partner webhook subscription, limited to the events of the partner users
+type WebhookSubscription struct {
+	ID        uuid.UUID   `json:"id" db:"id,omitempty"`
+	Partner   string      `json:"partner" db:"partner"`
+	URL       string      `json:"url" db:"url"`
+	Secret    string      `json:"secret,omitempty" db:"secret"`
+	Events    []string    `json:"events" db:"events"` // event types, "*" for all
+	UserIDs   []uuid.UUID `json:"user_ids" db:"user_ids"`
+	IsActive  bool        `json:"is_active" db:"is_active"`
+	CreatedAt time.Time   `json:"created_at" db:"created_at,omitempty"`
+}
+
+// WebhookSubscriptionRequest is the struct for a webhook subscription request
+type WebhookSubscriptionRequest struct {
+	Partner string      `json:"partner" binding:"required,max=100"`
+	URL     string      `json:"url" binding:"required,url,startswith=https://"`
+	Events  []string    `json:"events" binding:"required,min=1,dive,oneof=* wallet.credited wallet.debited wallet.locked wallet.unlocked wallet.disabled"`
+	UserIDs []uuid.UUID `json:"user_ids" binding:"required,min=1,max=1000"`
+}
+
+// WebhookDelivery is the struct for a delivery of an event to a subscription
+type WebhookDelivery struct {
+	ID             uuid.UUID  `json:"id" db:"id,omitempty"`
+	SubscriptionID uuid.UUID  `json:"subscription_id" db:"subscription_id"`
+	EventID        uuid.UUID  `json:"event_id" db:"event_id"`
+	EventType      string     `json:"event_type" db:"event_type"`
+	Payload        string     `json:"payload" db:"payload"`
+	Status         string     `json:"status" db:"status"`
+	Attempts       int        `json:"attempts" db:"attempts"`
+	LastError      string     `json:"last_error,omitempty" db:"last_error"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty" db:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at,omitempty"`
+
+	// Subscription fields needed to send the delivery
+	URL    string `json:"-" db:"url"`
+	Secret string `json:"-" db:"secret"`
+}
+
+// CreateWebhookSubscription creates a subscription with a new signing secret
+func (r *WebhookSubscriptionRequest) CreateWebhookSubscription() (*WebhookSubscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	subscription := &WebhookSubscription{}
+	err := DB.QueryRow(
+		ctx,
+		`INSERT INTO webhook_subscriptions (partner, url, secret, events, user_ids) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, partner, url, secret, events, user_ids, is_active, created_at`,
+		r.Partner,
+		r.URL,
+		hex.EncodeToString(secret),
+		r.Events,
+		r.UserIDs,
+	).Scan(
+		&subscription.ID,
+		&subscription.Partner,
+		&subscription.URL,
+		&subscription.Secret,
+		&subscription.Events,
+		&subscription.UserIDs,
+		&subscription.IsActive,
+		&subscription.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// GetWebhookSubscriptions lists the subscriptions without their secret
+func GetWebhookSubscriptions() ([]WebhookSubscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows, err := DB.Query(
+		ctx,
+		`SELECT id, partner, url, events, user_ids, is_active, created_at FROM webhook_subscriptions ORDER BY created_at DESC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := make([]WebhookSubscription, 0)
+	for rows.Next() {
+		s := WebhookSubscription{}
+		if err := rows.Scan(&s.ID, &s.Partner, &s.URL, &s.Events, &s.UserIDs, &s.IsActive, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions, nil
+}
+
+// DisableWebhookSubscription stops new deliveries to a subscription
+func (s *WebhookSubscription) DisableWebhookSubscription() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err := DB.Exec(ctx, `UPDATE webhook_subscriptions SET is_active = false WHERE id = $1`, s.ID)
+	return err
+}
+
+// EnqueueWebhookDeliveries creates a delivery for every active subscription matching the event type
+// and the user of the event. The event id makes the enqueue idempotent.
+func EnqueueWebhookDeliveries(event WalletEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.Exec(
+		ctx,
+		`INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+		SELECT id, $1, $2::text, $3 FROM webhook_subscriptions
+		WHERE is_active = true AND ($2::text = ANY(events) OR '*' = ANY(events)) AND $4::uuid = ANY(user_ids)
+		ON CONFLICT (subscription_id, event_id) DO NOTHING`,
+		event.ID,
+		event.Type,
+		string(payload),
+		event.UserID,
+	)
+	return err
+}
+
+// deliveryColumns is the column list of a delivery joined with its subscription
+const deliveryColumns = `d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.last_error,
+	d.next_attempt_at, d.delivered_at, d.created_at, s.url, s.secret`
+
+// getDeliveries runs a delivery query
+func getDeliveries(ctx context.Context, query string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]WebhookDelivery, 0)
+	for rows.Next() {
+		d := WebhookDelivery{}
+		err := rows.Scan(
+			&d.ID,
+			&d.SubscriptionID,
+			&d.EventID,
+			&d.EventType,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.LastError,
+			&d.NextAttemptAt,
+			&d.DeliveredAt,
+			&d.CreatedAt,
+			&d.URL,
+			&d.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+// GetDueWebhookDeliveries lists the pending deliveries whose next attempt is due
+func GetDueWebhookDeliveries(limit int) ([]WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return getDeliveries(
+		ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = 'PENDING' AND d.next_attempt_at <= CURRENT_TIMESTAMP AND s.is_active = true
+		ORDER BY d.next_attempt_at LIMIT $1`,
+		limit,
+	)
+}
+
+// GetWebhookDeliveriesByStatus lists deliveries by status, e.g. the dead-letter store
+func GetWebhookDeliveriesByStatus(status string, limit int) ([]WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return getDeliveries(
+		ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = $1 ORDER BY d.created_at DESC LIMIT $2`,
+		status,
+		limit,
+	)
+}
+
+// MarkDelivered records a successful delivery
+func (d *WebhookDelivery) MarkDelivered() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err := DB.Exec(
+		ctx,
+		`UPDATE webhook_deliveries SET status = 'DELIVERED', attempts = attempts + 1, last_error = '', delivered_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		d.ID,
+	)
+	return err
+}
+
+// MarkFailed records a failed attempt and schedules the next one, or dead-letters the delivery
+func (d *WebhookDelivery) MarkFailed(lastError string, nextAttempt time.Time, dead bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	status := DeliveryPending
+	if dead {
+		status = DeliveryDead
+	}
+	_, err := DB.Exec(
+		ctx,
+		`UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $4`,
+		status,
+		lastError,
+		nextAttempt,
+		d.ID,
+	)
+	return err
+}
+
+// ReplayWebhookDelivery puts a delivery back in the queue with a fresh retry budget
+func (d *WebhookDelivery) ReplayWebhookDelivery() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tag, err := DB.Exec(
+		ctx,
+		`UPDATE webhook_deliveries SET status = 'PENDING', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		d.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MTNConfig holds the MTN MoMo Open API credentials
+type MTNConfig struct {
+	BaseURL            string
+	Environment        string
+	CallbackURL        string
+	CollectionKey      string
+	CollectionUser     string
+	CollectionAPIKey   string
+	DisbursementKey    string
+	DisbursementUser   string
+	DisbursementAPIKey string
+	PayerMessage       string
+	PayeeNote          string
+}
+
+// mtnConfigFromEnv loads the MTN MoMo configuration, ok is false when not configured
+func mtnConfigFromEnv() (MTNConfig, bool) {
+	config := MTNConfig{
+		BaseURL:            os.Getenv("MTN_MOMO_API_URL"),
+		Environment:        getenv("MTN_MOMO_ENVIRONMENT", "sandbox"),
+		CallbackURL:        os.Getenv("MTN_MOMO_CALLBACK_URL"),
+		CollectionKey:      os.Getenv("MTN_MOMO_COLLECTION_KEY"),
+		CollectionUser:     os.Getenv("MTN_MOMO_COLLECTION_USER"),
+		CollectionAPIKey:   os.Getenv("MTN_MOMO_COLLECTION_API_KEY"),
+		DisbursementKey:    os.Getenv("MTN_MOMO_DISBURSEMENT_KEY"),
+		DisbursementUser:   os.Getenv("MTN_MOMO_DISBURSEMENT_USER"),
+		DisbursementAPIKey: os.Getenv("MTN_MOMO_DISBURSEMENT_API_KEY"),
+		PayerMessage:       "Feeti wallet deposit",
+		PayeeNote:          "Feeti wallet withdrawal",
+	}
+	return config, config.BaseURL != ""
+}
+
+// mtnToken is a cached OAuth access token of an MTN product
+type mtnToken struct {
+	value   string
+	expires time.Time
+}
+
+// MTNMoMo is the MTN Mobile Money adapter (collection for cash-in, disbursement for cash-out)
+type MTNMoMo struct {
+	config MTNConfig
+	mu     sync.Mutex
+	tokens map[string]mtnToken
+}
+
+// NewMTNMoMo creates an MTN MoMo adapter
+func NewMTNMoMo(config MTNConfig) *MTNMoMo {
+	return &MTNMoMo{config: config, tokens: make(map[string]mtnToken)}
+}
+
+// Name returns the provider name
+func (m *MTNMoMo) Name() string {
+	return "mtn_momo"
+}
+
+// mtnParty is the payer or payee of an MTN request
+type mtnParty struct {
+	PartyIDType string `json:"partyIdType"`
+	PartyID     string `json:"partyId"`
+}
+
+// mtnPayment is the request and callback body of requesttopay and transfer
+type mtnPayment struct {
+	Amount                 string    `json:"amount"`
+	Currency               string    `json:"currency"`
+	ExternalID             string    `json:"externalId"`
+	FinancialTransactionID string    `json:"financialTransactionId,omitempty"`
+	Payer                  *mtnParty `json:"payer,omitempty"`
+	Payee                  *mtnParty `json:"payee,omitempty"`
+	PayerMessage           string    `json:"payerMessage,omitempty"`
+	PayeeNote              string    `json:"payeeNote,omitempty"`
+	Status                 string    `json:"status,omitempty"`
+	Reason                 any       `json:"reason,omitempty"`
+}
+
+// product returns the MTN product, path and credentials for a direction
+func (m *MTNMoMo) product(direction string) (name, path, key, user, apiKey string) {
+	if direction == CashOut {
+		return "disbursement", "transfer", m.config.DisbursementKey, m.config.DisbursementUser, m.config.DisbursementAPIKey
+	}
+	return "collection", "requesttopay", m.config.CollectionKey, m.config.CollectionUser, m.config.CollectionAPIKey
+}
+
+// token returns a valid access token for an MTN product
+func (m *MTNMoMo) token(ctx context.Context, direction string) (string, error) {
+	name, _, key, user, apiKey := m.product(direction)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t, ok := m.tokens[name]; ok && time.Now().Before(t.expires) {
+		return t.value, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/%s/token/", m.config.BaseURL, name), nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(user, apiKey)
+	req.Header.Set("Ocp-Apim-Subscription-Key", key)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &ProviderError{Provider: m.Name(), Operation: "token", StatusCode: resp.StatusCode}
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	// Refresh a minute before the token expires
+	m.tokens[name] = mtnToken{
+		value:   body.AccessToken,
+		expires: time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute),
+	}
+	return body.AccessToken, nil
+}
+
+// do sends an authenticated request to an MTN product
+func (m *MTNMoMo) do(ctx context.Context, direction, method, url string, body any, headers map[string]string) (*http.Response, error) {
+	token, err := m.token(ctx, direction)
+	if err != nil {
+		return nil, err
+	}
+	_, _, key, _, _ := m.product(direction)
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, &payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Ocp-Apim-Subscription-Key", key)
+	req.Header.Set("X-Target-Environment", m.config.Environment)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return httpClient.Do(req)
+}
+
+// Prepare returns the X-Reference-Id of a payment, chosen by the caller at MTN
+func (m *MTNMoMo) Prepare(ctx context.Context, req PaymentRequest) (string, error) {
+	return uuid.New().String(), nil
+}
+
+// Initiate sends a requesttopay (cash-in) or a transfer (cash-out)
+func (m *MTNMoMo) Initiate(ctx context.Context, req PaymentRequest) (*PaymentResult, error) {
+	name, path, _, _, _ := m.product(req.Direction)
+	reference := req.Reference
+
+	party := &mtnParty{PartyIDType: "MSISDN", PartyID: strings.TrimPrefix(req.PhoneNumber, "+")}
+	body := mtnPayment{
+		Amount:       strconv.FormatInt(req.Amount, 10),
+		Currency:     req.Currency,
+		ExternalID:   req.TransactionID.String(),
+		PayerMessage: m.config.PayerMessage,
+		PayeeNote:    m.config.PayeeNote,
+	}
+	if req.Direction == CashOut {
+		body.Payee = party
+	} else {
+		body.Payer = party
+	}
+
+	headers := map[string]string{"X-Reference-Id": reference}
+	if m.config.CallbackURL != "" {
+		headers["X-Callback-Url"] = m.config.CallbackURL
+	}
+	resp, err := m.do(ctx, req.Direction, http.MethodPost, fmt.Sprintf("%s/%s/v1_0/%s", m.config.BaseURL, name, path), body, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, &ProviderError{Provider: m.Name(), Operation: path, StatusCode: resp.StatusCode}
+	}
+	return &PaymentResult{Reference: reference, Status: StatusPending}, nil
+}
+
+// Status gets a requesttopay or transfer by reference
+func (m *MTNMoMo) Status(ctx context.Context, direction, reference string) (*PaymentResult, error) {
+	name, path, _, _, _ := m.product(direction)
+
+	resp, err := m.do(ctx, direction, http.MethodGet, fmt.Sprintf("%s/%s/v1_0/%s/%s", m.config.BaseURL, name, path, reference), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ProviderError{Provider: m.Name(), Operation: path + " status", StatusCode: resp.StatusCode}
+	}
+
+	var body mtnPayment
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	result := m.result(body)
+	result.Reference = reference
+	return result, nil
+}
+
+// ParseCallback parses the body MTN posts to X-Callback-Url.
+// MTN does not echo the reference id in the body, only our transaction id as externalId.
+func (m *MTNMoMo) ParseCallback(body []byte) (*PaymentResult, error) {
+	var payment mtnPayment
+	if err := json.Unmarshal(body, &payment); err != nil {
+		return nil, err
+	}
+	if payment.ExternalID == "" {
+		return nil, fmt.Errorf("mtn_momo callback without externalId")
+	}
+	result := m.result(payment)
+	result.ExternalID = payment.ExternalID
+	return result, nil
+}
+
+// result normalizes an MTN payment status
+func (m *MTNMoMo) result(payment mtnPayment) *PaymentResult {
+	result := &PaymentResult{Status: StatusPending}
+	switch payment.Status {
+	case "SUCCESSFUL":
+		result.Status = StatusSuccessful
+	case "FAILED", "REJECTED", "TIMEOUT":
+		result.Status = StatusFailed
+		result.Reason = fmt.Sprint(payment.Reason)
+	}
+	return result
+}
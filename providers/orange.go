@@ -0,0 +1,248 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OrangeConfig holds the Orange Money API credentials
+type OrangeConfig struct {
+	BaseURL           string
+	ConsumerKey       string
+	ConsumerSecret    string
+	AuthToken         string // X-AUTH-TOKEN of the channel user
+	ChannelUserMsisdn string
+	ChannelUserPin    string
+	NotifyURL         string
+}
+
+// orangeConfigFromEnv loads the Orange Money configuration, ok is false when not configured
+func orangeConfigFromEnv() (OrangeConfig, bool) {
+	config := OrangeConfig{
+		BaseURL:           os.Getenv("ORANGE_MONEY_API_URL"),
+		ConsumerKey:       os.Getenv("ORANGE_MONEY_CONSUMER_KEY"),
+		ConsumerSecret:    os.Getenv("ORANGE_MONEY_CONSUMER_SECRET"),
+		AuthToken:         os.Getenv("ORANGE_MONEY_AUTH_TOKEN"),
+		ChannelUserMsisdn: os.Getenv("ORANGE_MONEY_CHANNEL_MSISDN"),
+		ChannelUserPin:    os.Getenv("ORANGE_MONEY_CHANNEL_PIN"),
+		NotifyURL:         os.Getenv("ORANGE_MONEY_NOTIFY_URL"),
+	}
+	return config, config.BaseURL != ""
+}
+
+// OrangeMoney is the Orange Money adapter (mp for cash-in, cashin for cash-out)
+type OrangeMoney struct {
+	config  OrangeConfig
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewOrangeMoney creates an Orange Money adapter
+func NewOrangeMoney(config OrangeConfig) *OrangeMoney {
+	return &OrangeMoney{config: config}
+}
+
+// Name returns the provider name
+func (o *OrangeMoney) Name() string {
+	return "orange_money"
+}
+
+// orangeResponse is the envelope of Orange Money responses and notifications
+type orangeResponse struct {
+	Message string `json:"message"`
+	Data    struct {
+		PayToken       string `json:"payToken"`
+		TxnID          string `json:"txnid"`
+		Status         string `json:"status"`
+		InitTxnMessage string `json:"inittxnmessage"`
+		ConfirmTxnMsg  string `json:"confirmtxnmessage"`
+	} `json:"data"`
+}
+
+// orangePayment is the body of the mp/pay and cashin/pay requests
+type orangePayment struct {
+	NotifURL          string `json:"notifUrl"`
+	ChannelUserMsisdn string `json:"channelUserMsisdn"`
+	Amount            string `json:"amount"`
+	SubscriberMsisdn  string `json:"subscriberMsisdn"`
+	Pin               string `json:"pin"`
+	OrderID           string `json:"orderId"`
+	Description       string `json:"description"`
+	PayToken          string `json:"payToken"`
+}
+
+// operation returns the API path of a direction
+func (o *OrangeMoney) operation(direction string) string {
+	if direction == CashOut {
+		return "cashin"
+	}
+	return "mp"
+}
+
+// accessToken returns a valid OAuth access token
+func (o *OrangeMoney) accessToken(ctx context.Context) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.token != "" && time.Now().Before(o.expires) {
+		return o.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.config.BaseURL+"/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(o.config.ConsumerKey, o.config.ConsumerSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &ProviderError{Provider: o.Name(), Operation: "token", StatusCode: resp.StatusCode}
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	// Refresh a minute before the token expires
+	o.token = body.AccessToken
+	o.expires = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute)
+	return o.token, nil
+}
+
+// do sends an authenticated request and decodes the response envelope
+func (o *OrangeMoney) do(ctx context.Context, method, path string, body any) (*orangeResponse, error) {
+	token, err := o.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, o.config.BaseURL+"/omcoreapis/1.0.2/"+path, &payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-AUTH-TOKEN", o.config.AuthToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ProviderError{Provider: o.Name(), Operation: path, StatusCode: resp.StatusCode}
+	}
+
+	var envelope orangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, err
+	}
+	return &envelope, nil
+}
+
+// Prepare gets the pay token of a payment
+func (o *OrangeMoney) Prepare(ctx context.Context, req PaymentRequest) (string, error) {
+	initResp, err := o.do(ctx, http.MethodPost, o.operation(req.Direction)+"/init", nil)
+	if err != nil {
+		return "", err
+	}
+	if initResp.Data.PayToken == "" {
+		return "", fmt.Errorf("orange_money init without payToken")
+	}
+	return initResp.Data.PayToken, nil
+}
+
+// Initiate sends the payment of a pay token
+func (o *OrangeMoney) Initiate(ctx context.Context, req PaymentRequest) (*PaymentResult, error) {
+	payToken := req.Reference
+	payResp, err := o.do(ctx, http.MethodPost, o.operation(req.Direction)+"/pay", orangePayment{
+		NotifURL:          o.config.NotifyURL,
+		ChannelUserMsisdn: o.config.ChannelUserMsisdn,
+		Amount:            strconv.FormatInt(req.Amount, 10),
+		SubscriberMsisdn:  strings.TrimPrefix(req.PhoneNumber, "+237"),
+		Pin:               o.config.ChannelUserPin,
+		OrderID:           req.TransactionID.String(),
+		Description:       req.Description,
+		PayToken:          payToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := o.result(payResp)
+	result.Reference = payToken
+	return result, nil
+}
+
+// Status gets a payment by pay token
+func (o *OrangeMoney) Status(ctx context.Context, direction, reference string) (*PaymentResult, error) {
+	resp, err := o.do(ctx, http.MethodGet, o.operation(direction)+"/paymentstatus/"+reference, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := o.result(resp)
+	result.Reference = reference
+	return result, nil
+}
+
+// ParseCallback parses the notification Orange Money posts to notifUrl
+func (o *OrangeMoney) ParseCallback(body []byte) (*PaymentResult, error) {
+	var notification struct {
+		PayToken string `json:"payToken"`
+		Status   string `json:"status"`
+		Message  string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return nil, err
+	}
+	if notification.PayToken == "" {
+		return nil, fmt.Errorf("orange_money callback without payToken")
+	}
+
+	var resp orangeResponse
+	resp.Message = notification.Message
+	resp.Data.Status = notification.Status
+	result := o.result(&resp)
+	result.Reference = notification.PayToken
+	return result, nil
+}
+
+// result normalizes an Orange Money payment status
+func (o *OrangeMoney) result(resp *orangeResponse) *PaymentResult {
+	result := &PaymentResult{Status: StatusPending}
+	switch resp.Data.Status {
+	case "SUCCESSFULL", "SUCCESSFUL":
+		result.Status = StatusSuccessful
+	case "FAILED", "EXPIRED", "CANCELLED":
+		result.Status = StatusFailed
+		result.Reason = resp.Message
+		if resp.Data.ConfirmTxnMsg != "" {
+			result.Reason = resp.Data.ConfirmTxnMsg
+		}
+	}
+	return result
+}
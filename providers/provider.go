@@ -0,0 +1,142 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Payment directions
+const (
+	CashIn  = "CASH_IN"  // collect from the customer mobile money account
+	CashOut = "CASH_OUT" // pay out to the customer mobile money account
+)
+
+// Normalized payment statuses
+const (
+	StatusPending    = "PENDING"
+	StatusSuccessful = "SUCCESSFUL"
+	StatusFailed     = "FAILED"
+)
+
+// ErrUnknownProvider is returned when no adapter is registered under a name
+var ErrUnknownProvider = errors.New("unknown payment provider")
+
+// ProviderError is an HTTP error answered by a provider
+type ProviderError struct {
+	Provider   string
+	Operation  string
+	StatusCode int
+}
+
+// Error returns the error message
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s %s failed with status %d", e.Provider, e.Operation, e.StatusCode)
+}
+
+// IsRejected checks if the provider definitely refused a request, so nothing was paid.
+// Timeouts, dropped connections and 5xx answers are not rejections: the payment may have been made.
+func IsRejected(err error) bool {
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) {
+		return false
+	}
+	switch providerErr.StatusCode {
+	case http.StatusRequestTimeout, http.StatusConflict:
+		return false
+	}
+	return providerErr.StatusCode >= 400 && providerErr.StatusCode < 500
+}
+
+// IsNotFound checks if the provider does not know a payment
+func IsNotFound(err error) bool {
+	var providerErr *ProviderError
+	return errors.As(err, &providerErr) && providerErr.StatusCode == http.StatusNotFound
+}
+
+// PaymentRequest is a cash-in or cash-out sent to a provider
+type PaymentRequest struct {
+	TransactionID uuid.UUID
+	Direction     string
+	Amount        int64
+	Currency      string
+	PhoneNumber   string
+	Description   string
+	Reference     string // returned by Prepare
+}
+
+// PaymentResult is the provider view of a payment
+type PaymentResult struct {
+	Reference  string `json:"reference"`
+	ExternalID string `json:"external_id,omitempty"` // our transaction id when echoed by the provider
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Provider is a mobile money operator adapter
+type Provider interface {
+	// Name returns the provider name stored on transactions
+	Name() string
+	// Prepare returns the provider reference of a payment before it is sent, so it is stored before money can move
+	Prepare(ctx context.Context, req PaymentRequest) (string, error)
+	// Initiate starts the cash-in or cash-out of a prepared payment
+	Initiate(ctx context.Context, req PaymentRequest) (*PaymentResult, error)
+	// Status gets the current status of a payment by provider reference
+	Status(ctx context.Context, direction, reference string) (*PaymentResult, error)
+	// ParseCallback parses an asynchronous notification sent by the provider
+	ParseCallback(body []byte) (*PaymentResult, error)
+}
+
+var (
+	registry      = make(map[string]Provider)
+	registryMutex sync.RWMutex
+	httpClient    = &http.Client{Timeout: 15 * time.Second}
+)
+
+// Register adds a provider to the registry
+func Register(p Provider) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry[p.Name()] = p
+	log.Printf("Registered payment provider: %s", p.Name())
+}
+
+// Get returns the provider registered under name
+func Get(name string) (Provider, error) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	p, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	return p, nil
+}
+
+// LoadFromEnv registers the providers configured in the environment
+func LoadFromEnv(onCallback func(provider string, result PaymentResult)) {
+	if config, ok := mtnConfigFromEnv(); ok {
+		Register(NewMTNMoMo(config))
+	}
+	if config, ok := orangeConfigFromEnv(); ok {
+		Register(NewOrangeMoney(config))
+	}
+	if config, ok := simulatorConfigFromEnv(); ok {
+		Register(NewSimulator(config, onCallback))
+	}
+}
+
+// getenv returns the environment variable or a fallback
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,56 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestIsRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"bad request", &ProviderError{StatusCode: http.StatusBadRequest}, true},
+		{"wrapped unauthorized", fmt.Errorf("pay: %w", &ProviderError{StatusCode: http.StatusUnauthorized}), true},
+		{"request timeout", &ProviderError{StatusCode: http.StatusRequestTimeout}, false},
+		{"duplicate reference", &ProviderError{StatusCode: http.StatusConflict}, false},
+		{"server error", &ProviderError{StatusCode: http.StatusBadGateway}, false},
+		{"client timeout", context.DeadlineExceeded, false},
+		{"connection reset", errors.New("connection reset by peer"), false},
+		{"no error", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRejected(tt.err); got != tt.want {
+				t.Errorf("IsRejected(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimulatorUsesPreparedReference(t *testing.T) {
+	s := NewSimulator(SimulatorConfig{Outcome: OutcomeSuccess}, nil)
+	req := PaymentRequest{Direction: CashOut, Amount: 1000, Currency: "XAF"}
+
+	reference, err := s.Prepare(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	req.Reference = reference
+	result, err := s.Initiate(context.Background(), req)
+	if err != nil || result.Reference != reference || result.Status != StatusSuccessful {
+		t.Fatalf("Initiate() = %+v, %v, want %s successful", result, err, reference)
+	}
+
+	if _, err := s.Status(context.Background(), CashOut, "SIM-unknown"); !IsNotFound(err) {
+		t.Errorf("Status of an unknown reference = %v, want not found", err)
+	}
+	req.Amount = 0
+	if _, err := s.Initiate(context.Background(), req); !IsRejected(err) {
+		t.Errorf("Initiate of an invalid amount = %v, want rejected", err)
+	}
+}
@@ -0,0 +1,217 @@
+package providers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrNoSettlementLayout is returned when a provider has no settlement file layout
+var ErrNoSettlementLayout = errors.New("no settlement layout for provider")
+
+// SettlementLayout describes the CSV settlement file of a provider. Columns are header names.
+type SettlementLayout struct {
+	Delimiter        string `json:"delimiter"`          // "," by default
+	SkipLines        int    `json:"skip_lines"`         // lines before the header
+	ReferenceColumn  string `json:"reference_column"`   // provider reference
+	ExternalIDColumn string `json:"external_id_column"` // our transaction id, optional
+	AmountColumn     string `json:"amount_column"`      // whole units, thousands separators allowed
+	DecimalSeparator string `json:"decimal_separator"`  // "." by default, "," for French locale files
+	CurrencyColumn   string `json:"currency_column"`    // optional
+	StatusColumn     string `json:"status_column"`      // optional, lines with another status are skipped
+	SuccessStatus    string `json:"success_status"`     // settled status value, case-insensitive
+	DirectionColumn  string `json:"direction_column"`   // optional
+	CashInValue      string `json:"cash_in_value"`      // direction value of a cash-in
+}
+
+// SettlementLine is a settled payment read from a provider file
+type SettlementLine struct {
+	Line       int    `json:"line"`
+	Reference  string `json:"reference"`
+	ExternalID string `json:"external_id,omitempty"`
+	Amount     int64  `json:"amount"`
+	Currency   string `json:"currency,omitempty"`
+	Direction  string `json:"direction,omitempty"` // CashIn or CashOut when the file has a direction
+}
+
+// defaultSettlementLayouts are the layouts of the operator files, overridable per provider
+var defaultSettlementLayouts = map[string]SettlementLayout{
+	"mtn_momo": {
+		ReferenceColumn:  "Id",
+		ExternalIDColumn: "External Transaction Id",
+		AmountColumn:     "Amount",
+		CurrencyColumn:   "Currency",
+		StatusColumn:     "Status",
+		SuccessStatus:    "Successful",
+		DirectionColumn:  "Type",
+		CashInValue:      "Debit",
+	},
+	"orange_money": {
+		Delimiter:        ";",
+		DecimalSeparator: ",",
+		ReferenceColumn:  "Reference",
+		AmountColumn:     "Montant",
+		StatusColumn:     "Statut",
+		SuccessStatus:    "SUCCESS",
+		DirectionColumn:  "Type",
+		CashInValue:      "MERCHANT_PAYMENT",
+	},
+	"simulator": {
+		ReferenceColumn:  "reference",
+		ExternalIDColumn: "external_id",
+		AmountColumn:     "amount",
+		CurrencyColumn:   "currency",
+		StatusColumn:     "status",
+		SuccessStatus:    StatusSuccessful,
+	},
+}
+
+// SettlementLayoutFor returns the layout of a provider, SETTLEMENT_LAYOUT_<PROVIDER> JSON overrides the default
+func SettlementLayoutFor(provider string) (SettlementLayout, error) {
+	if raw := os.Getenv("SETTLEMENT_LAYOUT_" + strings.ToUpper(provider)); raw != "" {
+		var layout SettlementLayout
+		if err := json.Unmarshal([]byte(raw), &layout); err != nil {
+			return SettlementLayout{}, fmt.Errorf("invalid settlement layout of %s: %w", provider, err)
+		}
+		return layout, nil
+	}
+	layout, ok := defaultSettlementLayouts[provider]
+	if !ok {
+		return SettlementLayout{}, fmt.Errorf("%w: %s", ErrNoSettlementLayout, provider)
+	}
+	return layout, nil
+}
+
+// ParseSettlementFile reads the settled payments of a CSV settlement file
+func ParseSettlementFile(r io.Reader, layout SettlementLayout) ([]SettlementLine, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if layout.Delimiter != "" {
+		delimiter, _ := utf8.DecodeRuneInString(layout.Delimiter)
+		reader.Comma = delimiter
+	}
+
+	for i := 0; i < layout.SkipLines; i++ {
+		if _, err := reader.Read(); err != nil {
+			return nil, fmt.Errorf("settlement file too short: %w", err)
+		}
+	}
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("settlement file without header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff") // UTF-8 BOM of spreadsheet exports
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	column := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := columns[strings.ToLower(name)]
+		if !ok {
+			return -1, fmt.Errorf("settlement file without column %q", name)
+		}
+		return i, nil
+	}
+
+	indexes := make(map[string]int)
+	for key, name := range map[string]string{
+		"reference":   layout.ReferenceColumn,
+		"external_id": layout.ExternalIDColumn,
+		"amount":      layout.AmountColumn,
+		"currency":    layout.CurrencyColumn,
+		"status":      layout.StatusColumn,
+		"direction":   layout.DirectionColumn,
+	} {
+		i, err := column(name)
+		if err != nil {
+			return nil, err
+		}
+		indexes[key] = i
+	}
+	if indexes["reference"] < 0 || indexes["amount"] < 0 {
+		return nil, errors.New("settlement layout needs a reference and an amount column")
+	}
+
+	field := func(record []string, key string) string {
+		i := indexes[key]
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	lines := make([]SettlementLine, 0)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		lineNumber, _ := reader.FieldPos(0)
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if indexes["status"] >= 0 && !strings.EqualFold(field(record, "status"), layout.SuccessStatus) {
+			continue
+		}
+
+		amount, err := parseSettlementAmount(field(record, "amount"), layout.DecimalSeparator)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		line := SettlementLine{
+			Line:       lineNumber,
+			Reference:  field(record, "reference"),
+			ExternalID: field(record, "external_id"),
+			Amount:     amount,
+			Currency:   field(record, "currency"),
+		}
+		if line.Reference == "" && line.ExternalID == "" {
+			return nil, fmt.Errorf("line %d: missing reference", lineNumber)
+		}
+		if indexes["direction"] >= 0 {
+			line.Direction = CashOut
+			if strings.EqualFold(field(record, "direction"), layout.CashInValue) {
+				line.Direction = CashIn
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// parseSettlementAmount parses a whole amount such as "1 500", "1,500", "1500.00" or "1.500,00"
+func parseSettlementAmount(raw, decimalSeparator string) (int64, error) {
+	thousands := ","
+	if decimalSeparator == "" {
+		decimalSeparator = "."
+	}
+	if decimalSeparator == "," {
+		thousands = "."
+	}
+	cleaned := strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "", "'", "", thousands, "").Replace(raw)
+	whole, fraction, _ := strings.Cut(cleaned, decimalSeparator)
+	if strings.Trim(fraction, "0") != "" {
+		return 0, fmt.Errorf("amount %q has a fractional part", raw)
+	}
+	amount, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", raw)
+	}
+	if amount < 0 {
+		amount = -amount // debits are signed in some files
+	}
+	return amount, nil
+}
@@ -0,0 +1,143 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Simulator outcomes
+const (
+	OutcomeSuccess = "success"
+	OutcomeFail    = "fail"
+)
+
+// SimulatorConfig configures how simulated payments end
+type SimulatorConfig struct {
+	Outcome string        // final status of every payment
+	Delay   time.Duration // time before the payment reaches its final status
+}
+
+// simulatorConfigFromEnv loads the simulator configuration, ok is false when disabled
+func simulatorConfigFromEnv() (SimulatorConfig, bool) {
+	outcome := os.Getenv("PROVIDER_SIMULATOR")
+	if outcome != OutcomeSuccess && outcome != OutcomeFail {
+		return SimulatorConfig{}, false
+	}
+	delay, err := time.ParseDuration(os.Getenv("PROVIDER_SIMULATOR_DELAY"))
+	if err != nil {
+		delay = 0
+	}
+	return SimulatorConfig{Outcome: outcome, Delay: delay}, true
+}
+
+// Simulator is an in-process provider used to run deposit and withdrawal flows offline
+type Simulator struct {
+	config     SimulatorConfig
+	onCallback func(provider string, result PaymentResult)
+	mu         sync.Mutex
+	payments   map[string]*PaymentResult
+}
+
+// NewSimulator creates a simulator. onCallback receives the final status like a provider callback would.
+func NewSimulator(config SimulatorConfig, onCallback func(provider string, result PaymentResult)) *Simulator {
+	return &Simulator{
+		config:     config,
+		onCallback: onCallback,
+		payments:   make(map[string]*PaymentResult),
+	}
+}
+
+// Name returns the provider name
+func (s *Simulator) Name() string {
+	return "simulator"
+}
+
+// Prepare returns a new simulated reference
+func (s *Simulator) Prepare(ctx context.Context, req PaymentRequest) (string, error) {
+	return "SIM-" + uuid.New().String(), nil
+}
+
+// Initiate records the payment and completes it after the configured delay
+func (s *Simulator) Initiate(ctx context.Context, req PaymentRequest) (*PaymentResult, error) {
+	if req.Amount <= 0 {
+		return nil, &ProviderError{Provider: s.Name(), Operation: "initiate", StatusCode: http.StatusBadRequest}
+	}
+	result := &PaymentResult{
+		Reference:  req.Reference,
+		ExternalID: req.TransactionID.String(),
+		Status:     StatusPending,
+	}
+
+	s.mu.Lock()
+	s.payments[result.Reference] = result
+	s.mu.Unlock()
+
+	if s.config.Delay == 0 {
+		s.finish(result.Reference)
+		return s.lookup(result.Reference), nil
+	}
+	time.AfterFunc(s.config.Delay, func() {
+		s.finish(result.Reference)
+		if s.onCallback != nil {
+			s.onCallback(s.Name(), *s.lookup(result.Reference))
+		}
+	})
+	return s.lookup(result.Reference), nil
+}
+
+// Status gets a simulated payment by reference
+func (s *Simulator) Status(ctx context.Context, direction, reference string) (*PaymentResult, error) {
+	result := s.lookup(reference)
+	if result == nil {
+		return nil, &ProviderError{Provider: s.Name(), Operation: "status " + reference, StatusCode: http.StatusNotFound}
+	}
+	return result, nil
+}
+
+// ParseCallback parses a callback in the normalized PaymentResult layout
+func (s *Simulator) ParseCallback(body []byte) (*PaymentResult, error) {
+	var result PaymentResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if result.Reference == "" {
+		return nil, fmt.Errorf("simulator callback without reference")
+	}
+	return &result, nil
+}
+
+// finish moves a payment to the configured final status
+func (s *Simulator) finish(reference string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[reference]
+	if !ok {
+		return
+	}
+	if s.config.Outcome == OutcomeFail {
+		payment.Status = StatusFailed
+		payment.Reason = "simulated failure"
+		return
+	}
+	payment.Status = StatusSuccessful
+}
+
+// lookup returns a copy of a payment
+func (s *Simulator) lookup(reference string) *PaymentResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[reference]
+	if !ok {
+		return nil
+	}
+	result := *payment
+	return &result
+}